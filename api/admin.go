@@ -0,0 +1,46 @@
+package api
+
+import (
+	"context"
+
+	pb "github.com/ItsMeWithTheFace/linux-process-runner/api/proto"
+	"github.com/ItsMeWithTheFace/linux-process-runner/auth"
+	c "github.com/ItsMeWithTheFace/linux-process-runner/core"
+)
+
+// AdminMethodActions maps the AdminService RPCs to their RBAC action.
+var AdminMethodActions = map[string]auth.Action{
+	"/AdminService/Drain": auth.ActionDrain,
+}
+
+// AdminServer implements the server-side AdminService functions.
+type AdminServer struct {
+	pb.UnimplementedAdminServiceServer
+	jr *c.JobRunner
+}
+
+// InitializeAdminServer controls the job runner's lifecycle.
+func InitializeAdminServer(jr *c.JobRunner) *AdminServer {
+	return &AdminServer{jr: jr}
+}
+
+// Drain stops the server from accepting new jobs, or lets it accept them
+// again, and reports how many jobs are still running or queued.
+func (s *AdminServer) Drain(ctx context.Context, req *pb.DrainRequest) (*pb.DrainStatus, error) {
+	if err := requireRole(ctx, auth.ActionDrain); err != nil {
+		return nil, err
+	}
+
+	if req.GetResume() {
+		s.jr.Resume()
+	} else {
+		s.jr.Drain()
+	}
+
+	counts := s.jr.CountJobs()
+	return &pb.DrainStatus{
+		Draining:    s.jr.Draining(),
+		RunningJobs: int64(counts[c.Running]),
+		QueuedJobs:  int64(counts[c.Queued]),
+	}, nil
+}
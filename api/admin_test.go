@@ -0,0 +1,63 @@
+package api
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ItsMeWithTheFace/linux-process-runner/api/proto"
+	"github.com/ItsMeWithTheFace/linux-process-runner/auth"
+	c "github.com/ItsMeWithTheFace/linux-process-runner/core"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type AdminServerTestSuite struct {
+	suite.Suite
+	jr     *c.JobRunner
+	jobs   *JobRunnerServer
+	server *AdminServer
+}
+
+func (suite *AdminServerTestSuite) SetupTest() {
+	suite.jr = c.InitializeJobRunner(c.InitializeInMemoryJobStore())
+	suite.jobs = InitializeJobRunnerServer(WithJobRunner(suite.jr))
+	suite.server = InitializeAdminServer(suite.jr)
+}
+
+func (suite *AdminServerTestSuite) TestDrain() {
+	ctx := auth.NewContextWithIdentity(context.Background(), auth.Identity{Issuer: "CN=ca", Name: "alice"})
+	adminContext := auth.NewContextWithRole(ctx, auth.RoleAdmin)
+
+	out, err := suite.server.Drain(adminContext, &proto.DrainRequest{})
+	suite.Require().NoError(err)
+	assert.True(suite.T(), out.GetDraining())
+
+	_, err = suite.jobs.StartJob(ctx, &proto.JobStartRequest{Command: "ls"})
+	s, _ := status.FromError(err)
+	assert.Equal(suite.T(), codes.Unavailable, s.Code(), "new jobs should be rejected while draining")
+	assert.Empty(suite.T(), suite.jr.ListJobs(nil), "a rejected job shouldn't be recorded")
+
+	out, err = suite.server.Drain(adminContext, &proto.DrainRequest{Resume: true})
+	suite.Require().NoError(err)
+	assert.False(suite.T(), out.GetDraining())
+
+	_, err = suite.jobs.StartJob(ctx, &proto.JobStartRequest{Command: "ls"})
+	assert.NoError(suite.T(), err)
+}
+
+func (suite *AdminServerTestSuite) TestOnlyAdminsDrain() {
+	operatorContext := auth.NewContextWithRole(
+		auth.NewContextWithIdentity(context.Background(), auth.Identity{Issuer: "CN=ca", Name: "bob"}),
+		auth.RoleOperator,
+	)
+	_, err := suite.server.Drain(operatorContext, &proto.DrainRequest{})
+	s, _ := status.FromError(err)
+	assert.Equal(suite.T(), codes.PermissionDenied, s.Code())
+	assert.False(suite.T(), suite.jr.Draining())
+}
+
+func TestAdminServerTestSuite(t *testing.T) {
+	suite.Run(t, new(AdminServerTestSuite))
+}
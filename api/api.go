@@ -4,112 +4,474 @@ import (
 	"context"
 	"fmt"
 	"io"
-	"math/big"
 	"os/exec"
+	"sync"
+	"time"
 
 	pb "github.com/ItsMeWithTheFace/linux-process-runner/api/proto"
+	"github.com/ItsMeWithTheFace/linux-process-runner/audit"
 	"github.com/ItsMeWithTheFace/linux-process-runner/auth"
 	c "github.com/ItsMeWithTheFace/linux-process-runner/core"
+	"github.com/ItsMeWithTheFace/linux-process-runner/metrics"
 	"github.com/google/uuid"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
 
+// MethodActions maps every RPC that acts on jobs to its RBAC action.
+var MethodActions = map[string]auth.Action{
+	"/JobRunnerService/StartJob":        auth.ActionStart,
+	"/JobRunnerService/StopJob":         auth.ActionStop,
+	"/JobRunnerService/StopJobs":        auth.ActionStop,
+	"/JobRunnerService/DeleteJobs":      auth.ActionStop,
+	"/JobRunnerService/GetJobInfo":      auth.ActionGet,
+	"/JobRunnerService/ListJobs":        auth.ActionGet,
+	"/JobRunnerService/WatchJobs":       auth.ActionGet,
+	"/JobRunnerService/WaitJob":         auth.ActionGet,
+	"/JobRunnerService/StreamJobOutput": auth.ActionStream,
+	"/JobRunnerService/GetJobStats":     auth.ActionGet,
+	"/JobRunnerService/StreamJobStats":  auth.ActionGet,
+}
+
+// DefaultStatsInterval is how often StreamJobStats samples a job unless the
+// client asks otherwise, MinStatsInterval bounds how often it can ask for.
+const (
+	DefaultStatsInterval = time.Second
+	MinStatsInterval     = 100 * time.Millisecond
+)
+
+// QueuedPollInterval is how often StreamJobOutput checks whether a queued or
+// restarting job has started its next attempt.
+const QueuedPollInterval = 100 * time.Millisecond
+
+// Policy holds the authorization rules and request handling settings that
+// can be reloaded at runtime.
+type Policy struct {
+	// PublicJobInfo allows any authenticated user to query any job's metadata
+	// regardless of their role.
+	PublicJobInfo bool
+	// IdempotencyWindow is how long a StartJob idempotency key is remembered
+	// for, zero ignores the keys.
+	IdempotencyWindow time.Duration
+}
+
 // JobRunnerServer implements the server-side gRPC functions.
 type JobRunnerServer struct {
 	pb.UnimplementedJobRunnerServiceServer
 	jr *c.JobRunner
+
+	commands *auth.PolicyEngine
+	metrics  metrics.Recorder
+
+	mu     *sync.RWMutex
+	policy Policy
+
+	idempotency *idempotencyKeys
+}
+
+// ServerOption configures a JobRunnerServer.
+type ServerOption func(*JobRunnerServer)
+
+// WithJobRunner makes the server use an existing JobRunner instead of creating its own.
+func WithJobRunner(jr *c.JobRunner) ServerOption {
+	return func(s *JobRunnerServer) {
+		s.jr = jr
+	}
+}
+
+// WithPolicy sets the initial authorization policy.
+func WithPolicy(policy Policy) ServerOption {
+	return func(s *JobRunnerServer) {
+		s.policy = policy
+	}
+}
+
+// WithCommandPolicy checks every command against the engine's policy before
+// a job is created.
+func WithCommandPolicy(engine *auth.PolicyEngine) ServerOption {
+	return func(s *JobRunnerServer) {
+		s.commands = engine
+	}
+}
+
+// WithMetrics reports open output streams to rec.
+func WithMetrics(rec metrics.Recorder) ServerOption {
+	return func(s *JobRunnerServer) {
+		s.metrics = rec
+	}
 }
 
 // InitializeJobRunnerServer initializes the core functionality to start/stop/get jobs.
-func InitializeJobRunnerServer() *JobRunnerServer {
-	jr := c.InitializeJobRunner(c.InitializeInMemoryJobStore())
+func InitializeJobRunnerServer(opts ...ServerOption) *JobRunnerServer {
 	s := &JobRunnerServer{
-		jr: jr,
+		metrics:     metrics.Nop{},
+		mu:          &sync.RWMutex{},
+		idempotency: newIdempotencyKeys(),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.jr == nil {
+		s.jr = c.InitializeJobRunner(c.InitializeInMemoryJobStore())
 	}
 	return s
 }
 
+// SetPolicy replaces the server's authorization policy.
+func (s *JobRunnerServer) SetPolicy(policy Policy) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.policy = policy
+}
+
+func (s *JobRunnerServer) getPolicy() Policy {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.policy
+}
+
 // GetJobInfo retrieves a job's metadata.
 func (s *JobRunnerServer) GetJobInfo(ctx context.Context, req *pb.JobQueryRequest) (*pb.JobInfo, error) {
-	job, err := s.jr.GetJob(req.GetId())
+	job, err := s.getAuditedJob(ctx, req.GetId())
 
 	if err != nil {
 		return nil, handleError(req.GetId(), err)
 	}
 
+	if !s.getPolicy().PublicJobInfo {
+		if err = verifyJobOwnership(ctx, auth.ActionGet, job.Owner); err != nil {
+			return nil, err
+		}
+	}
+
+	return s.jobInfoToProto(job, s.jr.QueuePosition(job.Id)), nil
+}
+
+// ListJobs returns the jobs the selector matches that the caller is allowed
+// to see.
+func (s *JobRunnerServer) ListJobs(ctx context.Context, req *pb.ListJobsRequest) (*pb.JobList, error) {
+	selector, err := c.ParseSelector(req.GetSelector())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	out := &pb.JobList{}
+	positions := s.jr.QueuePositions()
+	for _, job := range s.jr.ListJobs(selector) {
+		if s.canSeeJob(ctx, job) {
+			out.Jobs = append(out.Jobs, s.jobInfoToProto(job, positions[job.Id]))
+		}
+	}
+	return out, nil
+}
+
+// WatchJobs streams the jobs the selector matches that the caller is allowed
+// to see, then every change to them until the client goes away.
+func (s *JobRunnerServer) WatchJobs(req *pb.ListJobsRequest, srv pb.JobRunnerService_WatchJobsServer) error {
+	selector, err := c.ParseSelector(req.GetSelector())
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	s.metrics.StreamStarted()
+	defer s.metrics.StreamFinished()
+
+	jobs, events, cancel := s.jr.WatchJobs(selector)
+	defer cancel()
+
+	positions := s.jr.QueuePositions()
+	for _, job := range jobs {
+		if !s.canSeeJob(srv.Context(), job) {
+			continue
+		}
+		if err := srv.Send(&pb.JobEvent{Type: pb.JobEventType_ADDED, Job: s.jobInfoToProto(job, positions[job.Id])}); err != nil {
+			return err
+		}
+	}
+
+	for {
+		select {
+		case <-srv.Context().Done():
+			return srv.Context().Err()
+		case event, ok := <-events:
+			if !ok {
+				return status.Error(codes.ResourceExhausted, "watch fell too far behind, start it again")
+			}
+			if !s.canSeeJob(srv.Context(), event.Job) {
+				continue
+			}
+			if err := srv.Send(&pb.JobEvent{Type: pb.JobEventType(event.Type), Job: s.jobInfoToProto(event.Job, s.jr.QueuePosition(event.Job.Id))}); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// WaitJob blocks until a job has finished and its process has exited, then
+// returns its final metadata. It gives up when the client's deadline expires.
+func (s *JobRunnerServer) WaitJob(ctx context.Context, req *pb.JobQueryRequest) (*pb.JobInfo, error) {
+	job, err := s.getAuditedJob(ctx, req.GetId())
+
+	if err != nil {
+		return nil, handleError(req.GetId(), err)
+	}
+
+	if !s.getPolicy().PublicJobInfo {
+		if err = verifyJobOwnership(ctx, auth.ActionGet, job.Owner); err != nil {
+			return nil, err
+		}
+	}
+
+	finished, err := s.jr.WaitJob(ctx, job.Id)
+
+	if err == context.DeadlineExceeded || err == context.Canceled {
+		return nil, status.FromContextError(err).Err()
+	}
+	if err != nil {
+		return nil, handleError(job.Id, err)
+	}
+
+	return s.jobInfoToProto(finished, s.jr.QueuePosition(finished.Id)), nil
+}
+
+// canSeeJob reports whether the caller may get the job's info.
+func (s *JobRunnerServer) canSeeJob(ctx context.Context, job c.JobInfo) bool {
+	return s.getPolicy().PublicJobInfo || verifyJobOwnership(ctx, auth.ActionGet, job.Owner) == nil
+}
+
+func (s *JobRunnerServer) jobInfoToProto(job c.JobInfo, queuePosition int) *pb.JobInfo {
 	r := &pb.JobInfo{
 		Id:        job.Id,
+		Name:      job.Name,
 		Command:   job.Cmd.Args[0],
 		Arguments: job.Cmd.Args[1:],
 		State:     pb.JobState(job.State),
+
+		FailureReason:    string(job.FailureReason),
+		MemoryLimitBytes: job.MemoryLimit,
+		MemoryPeakBytes:  job.MemoryPeak,
+		QueuePosition:    int64(queuePosition),
+		Priority:         job.Priority,
+		RestartPolicy:    restartPolicyToProto(job.Restart),
+		Labels:           job.Labels,
+		Annotations:      job.Annotations,
+		Owner:            job.Owner,
+		CreatedAt:        job.CreatedAt.Unix(),
+	}
+
+	for _, a := range job.Attempts {
+		attempt := &pb.JobAttempt{
+			Number:        int32(a.Number),
+			StartedAt:     a.StartedAt.UnixNano(),
+			ExitCode:      int32(a.ExitCode),
+			FailureReason: string(a.FailureReason),
+		}
+		if !a.FinishedAt.IsZero() {
+			attempt.FinishedAt = a.FinishedAt.UnixNano()
+		}
+		if a.Err != nil {
+			attempt.Error = a.Err.Error()
+		}
+		r.Attempts = append(r.Attempts, attempt)
 	}
 
 	if job.Err != nil {
 		r.Error = job.Err.Error()
 	}
 
-	return r, nil
+	return r
 }
 
-// StartJob creates and runs a job and returns the generated job ID.
+// StartJob creates and runs a job and returns the generated job ID. A request
+// retried with the same idempotency key returns the job the first one started.
 func (s *JobRunnerServer) StartJob(ctx context.Context, req *pb.JobStartRequest) (*pb.JobStartOutput, error) {
-	id := uuid.NewString()
-	cmd := exec.Command(req.GetCommand(), req.GetArguments()...)
-	owner, err := getClientID(ctx)
+	owner, err := getIdentity(ctx)
 
 	if err != nil {
 		return nil, err
 	}
 
-	job := s.jr.CreateJob(id, owner, cmd)
+	audit.SetJob(ctx, "", req.GetCommand(), req.GetArguments())
+
+	if len(req.GetIdempotencyKey()) > MaxIdempotencyKeyLength {
+		return nil, status.Errorf(codes.InvalidArgument, "idempotency key is longer than %d characters", MaxIdempotencyKeyLength)
+	}
 
-	go s.jr.StartJob(job)
+	window := s.getPolicy().IdempotencyWindow
+	if req.GetIdempotencyKey() == "" || window <= 0 {
+		id, err := s.startJob(ctx, owner, req)
+		if err != nil {
+			return nil, err
+		}
+		return &pb.JobStartOutput{Id: id}, nil
+	}
+
+	id, err := s.idempotency.start(ctx, owner.String(), req, window, time.Now(), func() (string, error) {
+		return s.startJob(ctx, owner, req)
+	})
+	if err != nil {
+		return nil, err
+	}
+	audit.SetJob(ctx, id, req.GetCommand(), req.GetArguments())
 
 	return &pb.JobStartOutput{Id: id}, nil
 }
 
-// StopJob attempts to kill a running job.
+func (s *JobRunnerServer) startJob(ctx context.Context, owner auth.Identity, req *pb.JobStartRequest) (string, error) {
+	// checked up front so that a rejected job doesn't leave a record behind
+	if s.jr.Draining() {
+		return "", handleError("", &c.ErrDraining{})
+	}
+
+	id := uuid.NewString()
+	commandPath := req.GetCommand()
+
+	if s.commands != nil {
+		decision := s.commands.Evaluate(owner, auth.RoleFromContext(ctx), req.GetCommand(), req.GetArguments())
+		if !decision.Allowed {
+			return "", status.Errorf(
+				codes.PermissionDenied,
+				fmt.Sprintf("command %s is not allowed: %s", req.GetCommand(), decision.Reason),
+			)
+		}
+		// the job runs the binary the decision was made on
+		commandPath = decision.Path
+	}
+
+	cmd := exec.Command(commandPath, req.GetArguments()...)
+	cmd.Args[0] = req.GetCommand()
+
+	restart := restartPolicyFromProto(req.GetRestartPolicy())
+	if err := restart.Validate(); err != nil {
+		return "", status.Errorf(codes.InvalidArgument, "restart policy: %s", err.Error())
+	}
+
+	if err := c.ValidateLabels(req.GetLabels()); err != nil {
+		return "", status.Errorf(codes.InvalidArgument, "labels: %s", err.Error())
+	}
+	if err := c.ValidateAnnotations(req.GetAnnotations()); err != nil {
+		return "", status.Errorf(codes.InvalidArgument, "annotations: %s", err.Error())
+	}
+	if req.GetName() != "" {
+		if err := c.ValidateJobName(req.GetName()); err != nil {
+			return "", status.Error(codes.InvalidArgument, err.Error())
+		}
+	}
+
+	job, err := s.jr.CreateNamedJob(id, owner.String(), req.GetName(), cmd,
+		c.WithRestartPolicy(restart),
+		c.WithLabels(req.GetLabels(), req.GetAnnotations()),
+	)
+	if err != nil {
+		return "", handleError(id, err)
+	}
+	audit.SetJob(ctx, id, req.GetCommand(), req.GetArguments())
+
+	if err := s.jr.SubmitJob(job, req.GetPriority()); err != nil {
+		return "", handleError(id, err)
+	}
+
+	return id, nil
+}
+
+// StopJob attempts to kill a running job or cancel a queued one.
 func (s *JobRunnerServer) StopJob(ctx context.Context, req *pb.JobStopRequest) (*pb.JobStopOutput, error) {
-	job, err := s.jr.GetJob(req.GetId())
+	job, err := s.getAuditedJob(ctx, req.GetId())
 
 	if err != nil {
 		return nil, handleError(req.GetId(), err)
 	}
 
-	if err = verifyJobOwnership(ctx, job.Owner); err != nil {
+	if err = verifyJobOwnership(ctx, auth.ActionStop, job.Owner); err != nil {
 		return nil, err
 	}
 
-	err = s.jr.StopJob(req.GetId())
+	err = s.jr.StopJob(job.Id)
 
 	if err != nil {
-		return nil, handleError(req.GetId(), err)
+		return nil, handleError(job.Id, err)
 	}
 
 	return &pb.JobStopOutput{}, nil
 }
 
 // StreamJobOutput streams a given job's output from their associated log file regardless
-// of their state.
+// of their state. Every attempt is streamed in order unless the request selects one.
 func (s *JobRunnerServer) StreamJobOutput(req *pb.JobQueryRequest, srv pb.JobRunnerService_StreamJobOutputServer) error {
-	job, err := s.jr.GetJob(req.GetId())
+	job, err := s.getAuditedJob(srv.Context(), req.GetId())
 
 	if err != nil {
 		return handleError(req.GetId(), err)
 	}
 
-	if err = verifyJobOwnership(srv.Context(), job.Owner); err != nil {
+	if err = verifyJobOwnership(srv.Context(), auth.ActionStream, job.Owner); err != nil {
 		return err
 	}
 
-	r, err := job.Output.NewReader()
-	defer r.Close()
+	selected := int(req.GetAttempt())
+	if selected < 0 {
+		return status.Errorf(codes.InvalidArgument, "attempt cannot be negative")
+	}
+	skip := req.GetOffset()
+	if skip < 0 {
+		return status.Errorf(codes.InvalidArgument, "offset cannot be negative")
+	}
+
+	s.metrics.StreamStarted()
+	defer s.metrics.StreamFinished()
+
+	first := selected
+	if first == 0 {
+		first = 1
+	}
+
+	for n := first; ; n++ {
+		// queued and restarting jobs have no output for the next attempt yet
+		for len(job.Attempts) < n && !job.State.IsTerminal() {
+			select {
+			case <-srv.Context().Done():
+				return srv.Context().Err()
+			case <-time.After(QueuedPollInterval):
+			}
+			if job, err = s.jr.GetJob(job.Id); err != nil {
+				return handleError(job.Id, err)
+			}
+		}
+
+		if len(job.Attempts) < n {
+			if selected != 0 {
+				return status.Errorf(codes.NotFound, "job %s has no attempt %d", job.Id, selected)
+			}
+			// finished, or cancelled before it started
+			return nil
+		}
+
+		if err := s.streamAttempt(srv, job, n, &skip); err != nil {
+			return err
+		}
+
+		if selected != 0 {
+			return nil
+		}
+		if job, err = s.jr.GetJob(job.Id); err != nil {
+			return handleError(job.Id, err)
+		}
+	}
+}
+
+// streamAttempt streams the output of one of a job's attempts until the
+// attempt has exited and all of its output was sent. The first skip bytes are
+// left out, and skip is decreased by however many of them the attempt had.
+func (s *JobRunnerServer) streamAttempt(srv pb.JobRunnerService_StreamJobOutputServer, job c.JobInfo, attempt int, skip *int64) error {
+	id := job.Id
+	r, err := job.Attempts[attempt-1].Output.NewReader()
 
 	if err != nil {
-		return handleError(job.Id, err)
+		return handleError(id, err)
 	}
 
+	defer r.Close()
+
 	// 16 KB buffer
 	buffer := make([]byte, 16*1000)
 
@@ -118,32 +480,179 @@ func (s *JobRunnerServer) StreamJobOutput(req *pb.JobQueryRequest, srv pb.JobRun
 		case <-srv.Context().Done():
 			return srv.Context().Err()
 		default:
+			finished := !job.Attempts[attempt-1].FinishedAt.IsZero()
 			n, err := r.Read(buffer)
 
-			if n == 0 && err == io.EOF && job.State > c.Running {
+			if n == 0 && err == io.EOF && finished {
 				return nil
 			}
 
-			shouldSkip := err == io.EOF && job.State <= c.Running
+			output := buffer[:n]
+			if *skip > 0 {
+				skipped := int64(len(output))
+				if skipped > *skip {
+					skipped = *skip
+				}
+				output = output[skipped:]
+				*skip -= skipped
+			}
+
+			shouldSkip := err == io.EOF && !finished || len(output) == 0 && n > 0
 			if !shouldSkip {
-				resp := &pb.JobStreamOutput{Output: buffer[:n]}
+				resp := &pb.JobStreamOutput{Output: output}
 				err = srv.Send(resp)
 				if err != nil {
-					return handleError(job.Id, err)
+					return handleError(id, err)
 				}
 			}
 
 			// TODO: change GetJob to return a pointer with privatized fields
 			// and Get functions so we avoid querying constantly while maintaining
 			// read-only on c.JobInfo
-			job, err = s.jr.GetJob(req.GetId())
+			job, err = s.jr.GetJob(id)
 			if err != nil {
-				handleError(job.Id, err)
+				return handleError(id, err)
 			}
 		}
 	}
 }
 
+// GetJobStats samples a running job's resource usage.
+func (s *JobRunnerServer) GetJobStats(ctx context.Context, req *pb.JobStatsRequest) (*pb.JobStats, error) {
+	job, err := s.verifyStatsAccess(ctx, req.GetId())
+	if err != nil {
+		return nil, err
+	}
+
+	stats, err := s.jr.GetJobStats(job.Id)
+	if err != nil {
+		return nil, handleError(job.Id, err)
+	}
+
+	return jobStatsToProto(job.Id, stats), nil
+}
+
+// StreamJobStats samples a job's resource usage every interval until it
+// stops running. CPU usage is reported over each interval.
+func (s *JobRunnerServer) StreamJobStats(req *pb.JobStatsRequest, srv pb.JobRunnerService_StreamJobStatsServer) error {
+	job, err := s.verifyStatsAccess(srv.Context(), req.GetId())
+	if err != nil {
+		return err
+	}
+
+	interval := DefaultStatsInterval
+	if req.GetIntervalMs() > 0 {
+		interval = time.Duration(req.GetIntervalMs()) * time.Millisecond
+		if interval < MinStatsInterval {
+			interval = MinStatsInterval
+		}
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var prev *c.JobStats
+	for {
+		stats, err := s.jr.GetJobStats(job.Id)
+		if _, ok := err.(*c.ErrNotRunning); ok && prev != nil {
+			return nil
+		}
+		if err != nil {
+			return handleError(job.Id, err)
+		}
+
+		if prev != nil {
+			stats.CPUPercent = stats.CPUPercentSince(*prev)
+		}
+		prev = &stats
+
+		if err := srv.Send(jobStatsToProto(job.Id, stats)); err != nil {
+			return err
+		}
+
+		select {
+		case <-srv.Context().Done():
+			return srv.Context().Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// verifyStatsAccess applies the same rules to a job's stats as to its info.
+func (s *JobRunnerServer) verifyStatsAccess(ctx context.Context, id string) (c.JobInfo, error) {
+	job, err := s.getAuditedJob(ctx, id)
+	if err != nil {
+		return job, handleError(id, err)
+	}
+
+	if !s.getPolicy().PublicJobInfo {
+		return job, verifyJobOwnership(ctx, auth.ActionGet, job.Owner)
+	}
+	return job, nil
+}
+
+func jobStatsToProto(id string, stats c.JobStats) *pb.JobStats {
+	return &pb.JobStats{
+		Id:           id,
+		Time:         stats.Time.UnixNano(),
+		Source:       string(stats.Source),
+		CpuUsageUsec: stats.CPUUsage.Microseconds(),
+		CpuPercent:   stats.CPUPercent,
+		MemoryBytes:  stats.MemoryBytes,
+		RssBytes:     stats.RSSBytes,
+		IoReadBytes:  stats.IOReadBytes,
+		IoWriteBytes: stats.IOWriteBytes,
+		Pids:         stats.PIDs,
+		OpenFds:      stats.OpenFDs,
+	}
+}
+
+// getAuditedJob gets a job and records it as the target of the RPC in the
+// audit log, or just its ID if the job doesn't exist.
+func (s *JobRunnerServer) getAuditedJob(ctx context.Context, id string) (c.JobInfo, error) {
+	job, err := s.getJob(ctx, id)
+	if err != nil {
+		audit.SetJob(ctx, id, "", nil)
+		return job, err
+	}
+
+	audit.SetJob(ctx, job.Id, job.Cmd.Args[0], job.Cmd.Args[1:])
+	return job, nil
+}
+
+// getJob looks a job up by its ID, or failing that by the name the caller
+// gave it.
+func (s *JobRunnerServer) getJob(ctx context.Context, idOrName string) (c.JobInfo, error) {
+	job, err := s.jr.GetJob(idOrName)
+	if _, ok := err.(*c.ErrNotFound); !ok {
+		return job, err
+	}
+
+	owner, ok := auth.IdentityFromContext(ctx)
+	if !ok {
+		return job, err
+	}
+	return s.jr.GetJobByName(owner.String(), idOrName)
+}
+
+func restartPolicyFromProto(p *pb.RestartPolicy) c.RestartPolicy {
+	return c.RestartPolicy{
+		Mode:           c.RestartMode(p.GetMode()),
+		MaxAttempts:    int(p.GetMaxAttempts()),
+		InitialBackoff: time.Duration(p.GetInitialBackoffMs()) * time.Millisecond,
+		MaxBackoff:     time.Duration(p.GetMaxBackoffMs()) * time.Millisecond,
+	}
+}
+
+func restartPolicyToProto(p c.RestartPolicy) *pb.RestartPolicy {
+	return &pb.RestartPolicy{
+		Mode:             pb.RestartMode(p.Mode),
+		MaxAttempts:      int32(p.MaxAttempts),
+		InitialBackoffMs: p.InitialBackoff.Milliseconds(),
+		MaxBackoffMs:     p.MaxBackoff.Milliseconds(),
+	}
+}
+
 // handleError customizes returned error messages based on their type.
 func handleError(id string, err error) error {
 	// TODO: handle other error types and associate error codes with them
@@ -153,6 +662,20 @@ func handleError(id string, err error) error {
 			codes.NotFound,
 			fmt.Sprintf("cannot find job with ID: %s Err: %s", id, err.Error()),
 		)
+	case *c.ErrNotRunning:
+		return status.Errorf(
+			codes.FailedPrecondition,
+			fmt.Sprintf("job %s is not running", id),
+		)
+	case *c.ErrNameTaken:
+		return status.Error(codes.AlreadyExists, err.Error())
+	case *c.ErrDraining:
+		return status.Error(codes.Unavailable, err.Error())
+	case *c.ErrAlreadyFinished:
+		return status.Errorf(
+			codes.FailedPrecondition,
+			fmt.Sprintf("job %s has already finished", id),
+		)
 	default:
 		return status.Errorf(
 			codes.Internal,
@@ -161,28 +684,29 @@ func handleError(id string, err error) error {
 	}
 }
 
-// verifyJobOwnership compares owner IDs to see if they match.
-func verifyJobOwnership(ctx context.Context, owner *big.Int) error {
-	o, err := getClientID(ctx)
+// verifyJobOwnership checks if the caller's role allows the action on a job,
+// comparing the caller's identity with the job's owner.
+func verifyJobOwnership(ctx context.Context, action auth.Action, owner string) error {
+	id, err := getIdentity(ctx)
 
 	if err != nil {
 		return err
 	}
 
-	if o.Cmp(owner) != 0 {
+	if err = auth.RoleFromContext(ctx).Authorize(action, id.String() == owner); err != nil {
 		return status.Errorf(
 			codes.PermissionDenied,
-			fmt.Sprint("user does not own this job"),
+			fmt.Sprintf("permission denied for %s: %s", id.Name, err.Error()),
 		)
 	}
 
 	return nil
 }
 
-// getClientID parses a client-side ID so it can be safely tested for job ownership.
-func getClientID(ctx context.Context) (*big.Int, error) {
-	if o, ok := ctx.Value(auth.ClientIDKey).(*big.Int); ok {
-		return o, nil
+// getIdentity retrieves the authenticated caller so it can be safely tested for job ownership.
+func getIdentity(ctx context.Context) (auth.Identity, error) {
+	if id, ok := auth.IdentityFromContext(ctx); ok {
+		return id, nil
 	}
-	return nil, status.Error(codes.Internal, "cannot find owner")
+	return auth.Identity{}, status.Error(codes.Internal, "cannot find owner")
 }
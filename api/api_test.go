@@ -1,14 +1,18 @@
 package api
 
 import (
+	"bytes"
 	"context"
-	"math/big"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/ItsMeWithTheFace/linux-process-runner/api/proto"
 	"github.com/ItsMeWithTheFace/linux-process-runner/auth"
+	c "github.com/ItsMeWithTheFace/linux-process-runner/core"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/suite"
+	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
@@ -23,8 +27,8 @@ func (suite *JobRunnerServerTestSuite) SetupTest() {
 }
 
 func (suite *JobRunnerServerTestSuite) TestUnauthorizedJobAction() {
-	mockContext := context.WithValue(context.Background(), auth.ClientIDKey, big.NewInt(123))
-	otherMockContext := context.WithValue(context.Background(), auth.ClientIDKey, big.NewInt(456))
+	mockContext := auth.NewContextWithIdentity(context.Background(), auth.Identity{Issuer: "CN=ca", Name: "alice"})
+	otherMockContext := auth.NewContextWithIdentity(context.Background(), auth.Identity{Issuer: "CN=ca", Name: "bob"})
 	output, err := suite.server.StartJob(mockContext, &proto.JobStartRequest{
 		Command: "ls",
 	})
@@ -35,6 +39,414 @@ func (suite *JobRunnerServerTestSuite) TestUnauthorizedJobAction() {
 	assert.Equal(suite.T(), codes.PermissionDenied, s.Code(), "it should be a permission denied error")
 }
 
+func (suite *JobRunnerServerTestSuite) TestPrivateJobInfo() {
+	suite.server.SetPolicy(Policy{PublicJobInfo: false})
+	mockContext := auth.NewContextWithIdentity(context.Background(), auth.Identity{Issuer: "CN=ca", Name: "alice"})
+	otherMockContext := auth.NewContextWithIdentity(context.Background(), auth.Identity{Issuer: "CN=ca", Name: "bob"})
+	output, err := suite.server.StartJob(mockContext, &proto.JobStartRequest{
+		Command: "ls",
+	})
+	assert.NoError(suite.T(), err)
+
+	_, err = suite.server.GetJobInfo(mockContext, &proto.JobQueryRequest{Id: output.Id})
+	assert.NoError(suite.T(), err, "owner should be able to get their job")
+
+	_, err = suite.server.GetJobInfo(otherMockContext, &proto.JobQueryRequest{Id: output.Id})
+	s, _ := status.FromError(err)
+	assert.Equal(suite.T(), codes.PermissionDenied, s.Code(), "other users should not see the job")
+}
+
+func (suite *JobRunnerServerTestSuite) TestOwnershipIsScopedToIssuer() {
+	mockContext := auth.NewContextWithIdentity(context.Background(), auth.Identity{Issuer: "CN=ca", Name: "alice"})
+	reissuedContext := auth.NewContextWithIdentity(context.Background(), auth.Identity{Issuer: "CN=ca", Name: "alice"})
+	otherCAContext := auth.NewContextWithIdentity(context.Background(), auth.Identity{Issuer: "CN=other-ca", Name: "alice"})
+	output, err := suite.server.StartJob(mockContext, &proto.JobStartRequest{
+		Command: "ls",
+	})
+	assert.NoError(suite.T(), err)
+
+	_, err = suite.server.StopJob(otherCAContext, &proto.JobStopRequest{Id: output.Id})
+	s, _ := status.FromError(err)
+	assert.Equal(suite.T(), codes.PermissionDenied, s.Code(), "same name from another CA should not own the job")
+
+	_, err = suite.server.StopJob(reissuedContext, &proto.JobStopRequest{Id: output.Id})
+	s, _ = status.FromError(err)
+	assert.NotEqual(suite.T(), codes.PermissionDenied, s.Code(), "a re-issued cert should still own the job")
+}
+
+func (suite *JobRunnerServerTestSuite) TestRoles() {
+	ownerContext := auth.NewContextWithIdentity(context.Background(), auth.Identity{Issuer: "CN=ca", Name: "alice"})
+	output, err := suite.server.StartJob(ownerContext, &proto.JobStartRequest{
+		Command: "ls",
+	})
+	assert.NoError(suite.T(), err)
+
+	operatorContext := auth.NewContextWithRole(
+		auth.NewContextWithIdentity(context.Background(), auth.Identity{Issuer: "CN=ca", Name: "bob"}),
+		auth.RoleOperator,
+	)
+	_, err = suite.server.GetJobInfo(operatorContext, &proto.JobQueryRequest{Id: output.Id})
+	s, _ := status.FromError(err)
+	assert.Equal(suite.T(), codes.PermissionDenied, s.Code(), "operators should not see other users' jobs")
+	assert.Contains(suite.T(), s.Message(), "role operator can only get its own jobs")
+
+	viewerContext := auth.NewContextWithRole(
+		auth.NewContextWithIdentity(context.Background(), auth.Identity{Issuer: "CN=ca", Name: "carol"}),
+		auth.RoleViewer,
+	)
+	_, err = suite.server.GetJobInfo(viewerContext, &proto.JobQueryRequest{Id: output.Id})
+	assert.NoError(suite.T(), err, "viewers should see any job")
+	_, err = suite.server.StopJob(viewerContext, &proto.JobStopRequest{Id: output.Id})
+	s, _ = status.FromError(err)
+	assert.Equal(suite.T(), codes.PermissionDenied, s.Code(), "viewers should not stop jobs")
+
+	adminContext := auth.NewContextWithRole(
+		auth.NewContextWithIdentity(context.Background(), auth.Identity{Issuer: "CN=ca", Name: "dave"}),
+		auth.RoleAdmin,
+	)
+	_, err = suite.server.GetJobInfo(adminContext, &proto.JobQueryRequest{Id: output.Id})
+	assert.NoError(suite.T(), err, "admins should see any job")
+	_, err = suite.server.StopJob(adminContext, &proto.JobStopRequest{Id: output.Id})
+	s, _ = status.FromError(err)
+	assert.NotEqual(suite.T(), codes.PermissionDenied, s.Code(), "admins should be able to stop any job")
+}
+
+func (suite *JobRunnerServerTestSuite) TestDeniedCommand() {
+	engine, err := auth.NewPolicyEngine(auth.CommandPolicy{
+		Default: auth.EffectAllow,
+		Rules:   []auth.CommandRule{{Principals: []string{"alice"}, Effect: auth.EffectDeny, Reason: "alice is on vacation"}},
+	})
+	assert.NoError(suite.T(), err)
+	suite.server = InitializeJobRunnerServer(WithCommandPolicy(engine))
+
+	mockContext := auth.NewContextWithIdentity(context.Background(), auth.Identity{Issuer: "CN=ca", Name: "alice"})
+	_, err = suite.server.StartJob(mockContext, &proto.JobStartRequest{Command: "ls"})
+	s, _ := status.FromError(err)
+	assert.Equal(suite.T(), codes.PermissionDenied, s.Code(), "denied commands should not start")
+	assert.Contains(suite.T(), s.Message(), "alice is on vacation")
+
+	otherMockContext := auth.NewContextWithIdentity(context.Background(), auth.Identity{Issuer: "CN=ca", Name: "bob"})
+	output, err := suite.server.StartJob(otherMockContext, &proto.JobStartRequest{Command: "ls"})
+	suite.Require().NoError(err, "allowed commands should start")
+	lsPath, err := auth.ResolveCommand("ls")
+	suite.Require().NoError(err)
+	job, err := suite.server.jr.GetJob(output.Id)
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), lsPath, job.Cmd.Path, "the job should run the path the policy decided on")
+	assert.Equal(suite.T(), "ls", job.Cmd.Args[0], "the command should be shown as given")
+}
+
+func (suite *JobRunnerServerTestSuite) TestJobStats() {
+	mockContext := auth.NewContextWithIdentity(context.Background(), auth.Identity{Issuer: "CN=ca", Name: "alice"})
+	otherMockContext := auth.NewContextWithIdentity(context.Background(), auth.Identity{Issuer: "CN=ca", Name: "bob"})
+	output, err := suite.server.StartJob(mockContext, &proto.JobStartRequest{Command: "sleep", Arguments: []string{"10"}})
+	suite.Require().NoError(err)
+	defer suite.server.StopJob(mockContext, &proto.JobStopRequest{Id: output.Id})
+
+	var stats *proto.JobStats
+	for i := 0; i < 100; i++ {
+		if stats, err = suite.server.GetJobStats(mockContext, &proto.JobStatsRequest{Id: output.Id}); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	suite.Require().NoError(err, "owner should see their running job's stats")
+	assert.Equal(suite.T(), output.Id, stats.GetId())
+	assert.GreaterOrEqual(suite.T(), stats.GetPids(), int64(1))
+
+	_, err = suite.server.GetJobStats(otherMockContext, &proto.JobStatsRequest{Id: output.Id})
+	s, _ := status.FromError(err)
+	assert.Equal(suite.T(), codes.PermissionDenied, s.Code(), "other users should not see the job's stats")
+
+	_, err = suite.server.StopJob(mockContext, &proto.JobStopRequest{Id: output.Id})
+	suite.Require().NoError(err)
+	_, err = suite.server.GetJobStats(mockContext, &proto.JobStatsRequest{Id: output.Id})
+	s, _ = status.FromError(err)
+	assert.Equal(suite.T(), codes.FailedPrecondition, s.Code(), "finished jobs have no stats")
+
+	_, err = suite.server.StopJob(mockContext, &proto.JobStopRequest{Id: output.Id})
+	s, _ = status.FromError(err)
+	assert.Equal(suite.T(), codes.FailedPrecondition, s.Code(), "finished jobs can't be stopped again")
+}
+
+func (suite *JobRunnerServerTestSuite) TestQueuedJob() {
+	jr := c.InitializeJobRunner(c.InitializeInMemoryJobStore(), c.WithSettings(c.RunnerSettings{
+		Queue: c.QueueSettings{MaxConcurrent: 1, Policy: c.QueueFIFO},
+	}))
+	suite.server = InitializeJobRunnerServer(WithJobRunner(jr))
+	mockContext := auth.NewContextWithIdentity(context.Background(), auth.Identity{Issuer: "CN=ca", Name: "alice"})
+
+	running, err := suite.server.StartJob(mockContext, &proto.JobStartRequest{Command: "sleep", Arguments: []string{"10"}})
+	suite.Require().NoError(err)
+	defer suite.server.StopJob(mockContext, &proto.JobStopRequest{Id: running.Id})
+	queued, err := suite.server.StartJob(mockContext, &proto.JobStartRequest{Command: "sleep", Arguments: []string{"10"}})
+	suite.Require().NoError(err)
+
+	info, err := suite.server.GetJobInfo(mockContext, &proto.JobQueryRequest{Id: queued.Id})
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), proto.JobState_QUEUED, info.GetState())
+	assert.Equal(suite.T(), int64(1), info.GetQueuePosition())
+
+	_, err = suite.server.StopJob(mockContext, &proto.JobStopRequest{Id: queued.Id})
+	suite.Require().NoError(err, "queued jobs should be cancellable")
+	info, err = suite.server.GetJobInfo(mockContext, &proto.JobQueryRequest{Id: queued.Id})
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), proto.JobState_STOPPED, info.GetState())
+	assert.Equal(suite.T(), int64(0), info.GetQueuePosition())
+}
+
+func (suite *JobRunnerServerTestSuite) TestWaitJob() {
+	mockContext := auth.NewContextWithIdentity(context.Background(), auth.Identity{Issuer: "CN=ca", Name: "alice"})
+	otherMockContext := auth.NewContextWithIdentity(context.Background(), auth.Identity{Issuer: "CN=ca", Name: "bob"})
+	output, err := suite.server.StartJob(mockContext, &proto.JobStartRequest{
+		Command:   "sh",
+		Arguments: []string{"-c", "sleep 0.2; exit 3"},
+		Name:      "build",
+	})
+	suite.Require().NoError(err)
+
+	info, err := suite.server.WaitJob(mockContext, &proto.JobQueryRequest{Id: "build"})
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), output.Id, info.GetId())
+	assert.Equal(suite.T(), proto.JobState_ERROR, info.GetState())
+	suite.Require().Len(info.GetAttempts(), 1)
+	assert.Equal(suite.T(), int32(3), info.GetAttempts()[0].GetExitCode(), "the job's exit code should be returned")
+
+	output, err = suite.server.StartJob(mockContext, &proto.JobStartRequest{Command: "sleep", Arguments: []string{"10"}})
+	suite.Require().NoError(err)
+	defer suite.server.StopJob(mockContext, &proto.JobStopRequest{Id: output.Id})
+
+	ctx, cancel := context.WithTimeout(mockContext, 50*time.Millisecond)
+	defer cancel()
+	_, err = suite.server.WaitJob(ctx, &proto.JobQueryRequest{Id: output.Id})
+	assert.Equal(suite.T(), codes.DeadlineExceeded, status.Code(err), "waiting should give up with the client's deadline")
+
+	suite.server.SetPolicy(Policy{PublicJobInfo: false})
+	_, err = suite.server.WaitJob(otherMockContext, &proto.JobQueryRequest{Id: output.Id})
+	assert.Equal(suite.T(), codes.PermissionDenied, status.Code(err), "other users should not wait on private jobs")
+
+	_, err = suite.server.WaitJob(mockContext, &proto.JobQueryRequest{Id: "missing"})
+	assert.Equal(suite.T(), codes.NotFound, status.Code(err))
+}
+
+func (suite *JobRunnerServerTestSuite) TestRestartedJob() {
+	mockContext := auth.NewContextWithIdentity(context.Background(), auth.Identity{Issuer: "CN=ca", Name: "alice"})
+
+	_, err := suite.server.StartJob(mockContext, &proto.JobStartRequest{
+		Command:       "true",
+		RestartPolicy: &proto.RestartPolicy{MaxAttempts: -1},
+	})
+	s, _ := status.FromError(err)
+	assert.Equal(suite.T(), codes.InvalidArgument, s.Code(), "invalid restart policies should be rejected")
+
+	output, err := suite.server.StartJob(mockContext, &proto.JobStartRequest{
+		Command:       "sh",
+		Arguments:     []string{"-c", "echo run; exit 1"},
+		RestartPolicy: &proto.RestartPolicy{Mode: proto.RestartMode_ON_FAILURE, MaxAttempts: 2, InitialBackoffMs: 1},
+	})
+	suite.Require().NoError(err)
+
+	var info *proto.JobInfo
+	suite.Require().Eventually(func() bool {
+		info, err = suite.server.GetJobInfo(mockContext, &proto.JobQueryRequest{Id: output.Id})
+		return err == nil && info.GetState() == proto.JobState_ERROR
+	}, 5*time.Second, 10*time.Millisecond)
+	suite.Require().Len(info.GetAttempts(), 2)
+	assert.Equal(suite.T(), int32(1), info.GetAttempts()[1].GetExitCode())
+
+	all := &fakeOutputStream{ctx: mockContext}
+	suite.Require().NoError(suite.server.StreamJobOutput(&proto.JobQueryRequest{Id: output.Id}, all))
+	assert.Equal(suite.T(), "run\nrun\n", all.String(), "every attempt should be streamed in order")
+
+	second := &fakeOutputStream{ctx: mockContext}
+	suite.Require().NoError(suite.server.StreamJobOutput(&proto.JobQueryRequest{Id: output.Id, Attempt: 2}, second))
+	assert.Equal(suite.T(), "run\n", second.String())
+
+	err = suite.server.StreamJobOutput(&proto.JobQueryRequest{Id: output.Id, Attempt: 3}, &fakeOutputStream{ctx: mockContext})
+	s, _ = status.FromError(err)
+	assert.Equal(suite.T(), codes.NotFound, s.Code(), "the job has no third attempt")
+
+	resumed := &fakeOutputStream{ctx: mockContext}
+	suite.Require().NoError(suite.server.StreamJobOutput(&proto.JobQueryRequest{Id: output.Id, Offset: 5}, resumed))
+	assert.Equal(suite.T(), "un\n", resumed.String(), "offsets should count the output of every attempt")
+
+	err = suite.server.StreamJobOutput(&proto.JobQueryRequest{Id: output.Id, Offset: -1}, &fakeOutputStream{ctx: mockContext})
+	s, _ = status.FromError(err)
+	assert.Equal(suite.T(), codes.InvalidArgument, s.Code())
+}
+
+func (suite *JobRunnerServerTestSuite) TestLabels() {
+	suite.server.SetPolicy(Policy{PublicJobInfo: false})
+	aliceContext := auth.NewContextWithIdentity(context.Background(), auth.Identity{Issuer: "CN=ca", Name: "alice"})
+	bobContext := auth.NewContextWithIdentity(context.Background(), auth.Identity{Issuer: "CN=ca", Name: "bob"})
+
+	_, err := suite.server.StartJob(aliceContext, &proto.JobStartRequest{Command: "true", Labels: map[string]string{"bad key": "a"}})
+	s, _ := status.FromError(err)
+	assert.Equal(suite.T(), codes.InvalidArgument, s.Code(), "invalid labels should be rejected")
+
+	prod, err := suite.server.StartJob(aliceContext, &proto.JobStartRequest{
+		Command:     "true",
+		Labels:      map[string]string{"env": "prod", "team": "a"},
+		Annotations: map[string]string{"ticket": "OPS-123: nightly backfill"},
+	})
+	suite.Require().NoError(err)
+	_, err = suite.server.StartJob(aliceContext, &proto.JobStartRequest{Command: "true", Labels: map[string]string{"env": "dev"}})
+	suite.Require().NoError(err)
+	_, err = suite.server.StartJob(bobContext, &proto.JobStartRequest{Command: "true", Labels: map[string]string{"env": "prod"}})
+	suite.Require().NoError(err)
+
+	list, err := suite.server.ListJobs(aliceContext, &proto.ListJobsRequest{Selector: "env=prod,team in (a,b)"})
+	suite.Require().NoError(err)
+	suite.Require().Len(list.GetJobs(), 1)
+	assert.Equal(suite.T(), prod.GetId(), list.GetJobs()[0].GetId())
+	assert.Equal(suite.T(), "OPS-123: nightly backfill", list.GetJobs()[0].GetAnnotations()["ticket"])
+	assert.Equal(suite.T(), "alice@CN=ca", list.GetJobs()[0].GetOwner())
+
+	list, err = suite.server.ListJobs(aliceContext, &proto.ListJobsRequest{Selector: "env"})
+	suite.Require().NoError(err)
+	assert.Len(suite.T(), list.GetJobs(), 2, "bob's jobs should be left out")
+
+	_, err = suite.server.ListJobs(aliceContext, &proto.ListJobsRequest{Selector: "env in prod"})
+	s, _ = status.FromError(err)
+	assert.Equal(suite.T(), codes.InvalidArgument, s.Code())
+}
+
+func (suite *JobRunnerServerTestSuite) TestIdempotencyKeys() {
+	suite.server.SetPolicy(Policy{IdempotencyWindow: time.Hour})
+	aliceContext := auth.NewContextWithIdentity(context.Background(), auth.Identity{Issuer: "CN=ca", Name: "alice"})
+	bobContext := auth.NewContextWithIdentity(context.Background(), auth.Identity{Issuer: "CN=ca", Name: "bob"})
+	req := &proto.JobStartRequest{Command: "true", Labels: map[string]string{"env": "prod"}, IdempotencyKey: "deploy-42"}
+
+	first, err := suite.server.StartJob(aliceContext, req)
+	suite.Require().NoError(err)
+	retry, err := suite.server.StartJob(aliceContext, req)
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), first.GetId(), retry.GetId(), "a retry should return the original job")
+
+	_, err = suite.server.StartJob(aliceContext, &proto.JobStartRequest{Command: "false", IdempotencyKey: "deploy-42"})
+	s, _ := status.FromError(err)
+	assert.Equal(suite.T(), codes.InvalidArgument, s.Code(), "a key reused for a different request should be rejected")
+
+	other, err := suite.server.StartJob(bobContext, req)
+	suite.Require().NoError(err)
+	assert.NotEqual(suite.T(), first.GetId(), other.GetId(), "keys should be scoped to the principal")
+
+	_, err = suite.server.StartJob(aliceContext, &proto.JobStartRequest{Command: "true", IdempotencyKey: strings.Repeat("k", MaxIdempotencyKeyLength+1)})
+	s, _ = status.FromError(err)
+	assert.Equal(suite.T(), codes.InvalidArgument, s.Code(), "long keys should be rejected")
+
+	suite.server.SetPolicy(Policy{})
+	again, err := suite.server.StartJob(aliceContext, req)
+	suite.Require().NoError(err)
+	assert.NotEqual(suite.T(), first.GetId(), again.GetId(), "keys should be ignored without a window")
+}
+
+func (suite *JobRunnerServerTestSuite) TestJobNames() {
+	suite.server.SetPolicy(Policy{PublicJobInfo: false})
+	aliceContext := auth.NewContextWithIdentity(context.Background(), auth.Identity{Issuer: "CN=ca", Name: "alice"})
+	bobContext := auth.NewContextWithIdentity(context.Background(), auth.Identity{Issuer: "CN=ca", Name: "bob"})
+
+	_, err := suite.server.StartJob(aliceContext, &proto.JobStartRequest{Command: "true", Name: "has space"})
+	s, _ := status.FromError(err)
+	assert.Equal(suite.T(), codes.InvalidArgument, s.Code(), "invalid names should be rejected")
+
+	out, err := suite.server.StartJob(aliceContext, &proto.JobStartRequest{Command: "sleep", Arguments: []string{"10"}, Name: "nap"})
+	suite.Require().NoError(err)
+
+	_, err = suite.server.StartJob(aliceContext, &proto.JobStartRequest{Command: "true", Name: "nap"})
+	s, _ = status.FromError(err)
+	assert.Equal(suite.T(), codes.AlreadyExists, s.Code(), "names should be unique per owner")
+
+	bobs, err := suite.server.StartJob(bobContext, &proto.JobStartRequest{Command: "true", Name: "nap"})
+	suite.Require().NoError(err, "other owners can use the same name")
+
+	info, err := suite.server.GetJobInfo(aliceContext, &proto.JobQueryRequest{Id: "nap"})
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), out.GetId(), info.GetId(), "the name should resolve to the caller's job")
+	assert.Equal(suite.T(), "nap", info.GetName())
+
+	info, err = suite.server.GetJobInfo(bobContext, &proto.JobQueryRequest{Id: "nap"})
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), bobs.GetId(), info.GetId())
+
+	_, err = suite.server.GetJobInfo(aliceContext, &proto.JobQueryRequest{Id: "missing"})
+	s, _ = status.FromError(err)
+	assert.Equal(suite.T(), codes.NotFound, s.Code())
+
+	suite.Require().Eventually(func() bool {
+		job, _ := suite.server.jr.GetJob(out.GetId())
+		return job.State == c.Running && job.Cmd.Process != nil
+	}, time.Second, 10*time.Millisecond)
+	_, err = suite.server.StopJob(aliceContext, &proto.JobStopRequest{Id: "nap"})
+	suite.Require().NoError(err)
+	job, err := suite.server.jr.GetJob(out.GetId())
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), c.Stopped, job.State, "jobs should be stoppable by name")
+}
+
+func (suite *JobRunnerServerTestSuite) TestWatchJobs() {
+	mockContext := auth.NewContextWithIdentity(context.Background(), auth.Identity{Issuer: "CN=ca", Name: "alice"})
+	ctx, cancel := context.WithCancel(mockContext)
+	stream := &fakeWatchStream{ctx: ctx, events: make(chan *proto.JobEvent, 16)}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- suite.server.WatchJobs(&proto.ListJobsRequest{Selector: "env=prod"}, stream)
+	}()
+	// the watch has to be running before the jobs start to see them added
+	time.Sleep(50 * time.Millisecond)
+
+	_, err := suite.server.StartJob(mockContext, &proto.JobStartRequest{Command: "true", Labels: map[string]string{"env": "dev"}})
+	suite.Require().NoError(err)
+	output, err := suite.server.StartJob(mockContext, &proto.JobStartRequest{Command: "true", Labels: map[string]string{"env": "prod"}})
+	suite.Require().NoError(err)
+
+	event := <-stream.events
+	assert.Equal(suite.T(), proto.JobEventType_ADDED, event.GetType())
+	assert.Equal(suite.T(), output.GetId(), event.GetJob().GetId())
+	for event.GetJob().GetState() != proto.JobState_COMPLETED {
+		select {
+		case event = <-stream.events:
+			assert.Equal(suite.T(), output.GetId(), event.GetJob().GetId(), "only matching jobs should be sent")
+		case <-time.After(5 * time.Second):
+			suite.FailNow("the job's completion was never sent")
+		}
+	}
+
+	cancel()
+	assert.Error(suite.T(), <-done)
+}
+
 func TestApiTestSuite(t *testing.T) {
 	suite.Run(t, new(JobRunnerServerTestSuite))
 }
+
+// fakeOutputStream collects what StreamJobOutput sends.
+type fakeOutputStream struct {
+	grpc.ServerStream
+	ctx context.Context
+	out bytes.Buffer
+}
+
+func (f *fakeOutputStream) Context() context.Context { return f.ctx }
+
+func (f *fakeOutputStream) Send(out *proto.JobStreamOutput) error {
+	f.out.Write(out.GetOutput())
+	return nil
+}
+
+func (f *fakeOutputStream) String() string { return f.out.String() }
+
+// fakeWatchStream passes on what WatchJobs sends.
+type fakeWatchStream struct {
+	grpc.ServerStream
+	ctx    context.Context
+	events chan *proto.JobEvent
+}
+
+func (f *fakeWatchStream) Context() context.Context { return f.ctx }
+
+func (f *fakeWatchStream) Send(event *proto.JobEvent) error {
+	f.events <- event
+	return nil
+}
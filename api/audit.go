@@ -0,0 +1,92 @@
+package api
+
+import (
+	"context"
+	"time"
+
+	pb "github.com/ItsMeWithTheFace/linux-process-runner/api/proto"
+	"github.com/ItsMeWithTheFace/linux-process-runner/audit"
+	"github.com/ItsMeWithTheFace/linux-process-runner/auth"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// AuditMethodActions maps the AuditService RPCs to their RBAC action.
+var AuditMethodActions = map[string]auth.Action{
+	"/AuditService/QueryAuditLog": auth.ActionReadAudit,
+}
+
+// DefaultAuditQueryLimit is how many entries a query returns unless it asks
+// for a different number.
+const DefaultAuditQueryLimit = 100
+
+// AuditServer implements the server-side AuditService functions.
+type AuditServer struct {
+	pb.UnimplementedAuditServiceServer
+	log *audit.FileLogger
+}
+
+// InitializeAuditServer serves queries against the files written by log.
+func InitializeAuditServer(log *audit.FileLogger) *AuditServer {
+	return &AuditServer{log: log}
+}
+
+// QueryAuditLog returns the most recent entries matching the query, oldest
+// first, and optionally verifies the log's hash chain.
+func (s *AuditServer) QueryAuditLog(ctx context.Context, req *pb.AuditQuery) (*pb.AuditLog, error) {
+	if err := requireRole(ctx, auth.ActionReadAudit); err != nil {
+		return nil, err
+	}
+
+	filter := audit.Filter{
+		Principal: req.GetPrincipal(),
+		JobId:     req.GetJobId(),
+		Method:    req.GetMethod(),
+		Limit:     DefaultAuditQueryLimit,
+	}
+	if req.GetSince() > 0 {
+		filter.Since = time.Unix(req.GetSince(), 0)
+	}
+	if req.GetLimit() > 0 {
+		filter.Limit = int(req.GetLimit())
+	}
+
+	files := s.log.Files()
+	entries, err := audit.Query(files, filter)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to read audit log: %s", err.Error())
+	}
+
+	out := &pb.AuditLog{}
+	for _, e := range entries {
+		out.Entries = append(out.Entries, auditEntryToProto(e))
+	}
+
+	if req.GetVerify() {
+		if err := audit.Verify(files); err != nil {
+			out.VerificationError = err.Error()
+		} else {
+			out.Verified = true
+		}
+	}
+
+	return out, nil
+}
+
+func auditEntryToProto(e audit.Entry) *pb.AuditEntry {
+	return &pb.AuditEntry{
+		Time:       e.Time.UnixNano(),
+		Principal:  e.Principal,
+		Role:       e.Role,
+		Peer:       e.Peer,
+		Method:     e.Method,
+		JobId:      e.JobId,
+		Command:    e.Command,
+		Arguments:  e.Args,
+		Decision:   string(e.Decision),
+		Outcome:    e.Outcome,
+		Error:      e.Error,
+		DurationMs: e.DurationMs,
+		Hash:       e.Hash,
+	}
+}
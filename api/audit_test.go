@@ -0,0 +1,97 @@
+package api
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ItsMeWithTheFace/linux-process-runner/api/proto"
+	"github.com/ItsMeWithTheFace/linux-process-runner/audit"
+	"github.com/ItsMeWithTheFace/linux-process-runner/auth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type AuditServerTestSuite struct {
+	suite.Suite
+	dir    string
+	log    *audit.FileLogger
+	server *AuditServer
+}
+
+func (suite *AuditServerTestSuite) SetupTest() {
+	dir, err := ioutil.TempDir("", "audit")
+	suite.Require().NoError(err)
+	suite.dir = dir
+
+	suite.log, err = audit.NewFileLogger(filepath.Join(dir, "audit.jsonl"), audit.FileLoggerOptions{HashChain: true})
+	suite.Require().NoError(err)
+	suite.server = InitializeAuditServer(suite.log)
+}
+
+func (suite *AuditServerTestSuite) TearDownTest() {
+	suite.log.Close()
+	os.RemoveAll(suite.dir)
+}
+
+func (suite *AuditServerTestSuite) TestJobActionsAreAudited() {
+	jobs := InitializeJobRunnerServer()
+	auditor := audit.NewAuditor(suite.log)
+	ctx := auth.NewContextWithIdentity(context.Background(), auth.Identity{Issuer: "CN=ca", Name: "alice"})
+
+	resp, err := auditor.UnaryInterceptor(ctx, &proto.JobStartRequest{Command: "ls", Arguments: []string{"-l"}},
+		&grpc.UnaryServerInfo{FullMethod: "/JobRunnerService/StartJob"},
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			return jobs.StartJob(ctx, req.(*proto.JobStartRequest))
+		})
+	suite.Require().NoError(err)
+	id := resp.(*proto.JobStartOutput).GetId()
+
+	_, err = auditor.UnaryInterceptor(ctx, &proto.JobQueryRequest{Id: "missing"},
+		&grpc.UnaryServerInfo{FullMethod: "/JobRunnerService/GetJobInfo"},
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			return jobs.GetJobInfo(ctx, req.(*proto.JobQueryRequest))
+		})
+	assert.Error(suite.T(), err)
+
+	adminContext := auth.NewContextWithRole(ctx, auth.RoleAdmin)
+	out, err := suite.server.QueryAuditLog(adminContext, &proto.AuditQuery{Verify: true, Since: time.Now().Add(-time.Minute).Unix()})
+	suite.Require().NoError(err)
+	assert.True(suite.T(), out.GetVerified(), out.GetVerificationError())
+
+	if assert.Len(suite.T(), out.GetEntries(), 2) {
+		start := out.GetEntries()[0]
+		assert.Equal(suite.T(), id, start.GetJobId())
+		assert.Equal(suite.T(), "ls", start.GetCommand())
+		assert.Equal(suite.T(), []string{"-l"}, start.GetArguments())
+		assert.Equal(suite.T(), "OK", start.GetOutcome())
+
+		get := out.GetEntries()[1]
+		assert.Equal(suite.T(), "missing", get.GetJobId(), "the requested ID should be logged even if the job doesn't exist")
+		assert.Equal(suite.T(), "NotFound", get.GetOutcome())
+	}
+
+	out, err = suite.server.QueryAuditLog(adminContext, &proto.AuditQuery{JobId: id})
+	suite.Require().NoError(err)
+	assert.Len(suite.T(), out.GetEntries(), 1)
+}
+
+func (suite *AuditServerTestSuite) TestOnlyAdminsQuery() {
+	viewerContext := auth.NewContextWithRole(
+		auth.NewContextWithIdentity(context.Background(), auth.Identity{Issuer: "CN=ca", Name: "carol"}),
+		auth.RoleViewer,
+	)
+	_, err := suite.server.QueryAuditLog(viewerContext, &proto.AuditQuery{})
+	s, _ := status.FromError(err)
+	assert.Equal(suite.T(), codes.PermissionDenied, s.Code())
+}
+
+func TestAuditServerTestSuite(t *testing.T) {
+	suite.Run(t, new(AuditServerTestSuite))
+}
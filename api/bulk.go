@@ -0,0 +1,90 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	pb "github.com/ItsMeWithTheFace/linux-process-runner/api/proto"
+	"github.com/ItsMeWithTheFace/linux-process-runner/auth"
+	c "github.com/ItsMeWithTheFace/linux-process-runner/core"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// StopJobs stops every selected job the caller is allowed to stop.
+func (s *JobRunnerServer) StopJobs(ctx context.Context, req *pb.BulkJobRequest) (*pb.BulkJobOutput, error) {
+	return s.bulk(ctx, req, func(job c.JobInfo) error {
+		if job.State.IsTerminal() {
+			return fmt.Errorf("job has already finished")
+		}
+		return nil
+	}, s.jr.StopJob)
+}
+
+// DeleteJobs deletes every selected job the caller is allowed to stop, as
+// long as it has finished.
+func (s *JobRunnerServer) DeleteJobs(ctx context.Context, req *pb.BulkJobRequest) (*pb.BulkJobOutput, error) {
+	return s.bulk(ctx, req, func(job c.JobInfo) error {
+		if !job.State.IsTerminal() {
+			return &c.ErrNotFinished{}
+		}
+		return nil
+	}, s.jr.DeleteJob)
+}
+
+// bulk applies act to every selected job the caller may stop, or with a dry
+// run only check, and reports how it went for each of them. Jobs the caller
+// may not act on are left out as if they didn't match.
+func (s *JobRunnerServer) bulk(
+	ctx context.Context,
+	req *pb.BulkJobRequest,
+	check func(c.JobInfo) error,
+	act func(id string) error,
+) (*pb.BulkJobOutput, error) {
+	filter, err := jobFilterFromProto(req.GetSelector(), time.Now())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if filter.IsEmpty() {
+		return nil, status.Error(codes.InvalidArgument, "a selector is required")
+	}
+
+	out := &pb.BulkJobOutput{}
+	for _, job := range s.jr.FindJobs(filter) {
+		if verifyJobOwnership(ctx, auth.ActionStop, job.Owner) != nil {
+			continue
+		}
+
+		err := check(job)
+		if err == nil && !req.GetDryRun() {
+			err = act(job.Id)
+		}
+
+		result := &pb.BulkJobResult{Id: job.Id, State: pb.JobState(job.State)}
+		if err != nil {
+			result.Error = err.Error()
+		}
+		out.Results = append(out.Results, result)
+	}
+	return out, nil
+}
+
+func jobFilterFromProto(sel *pb.JobSelector, now time.Time) (c.JobFilter, error) {
+	selector, err := c.ParseSelector(sel.GetLabels())
+	if err != nil {
+		return c.JobFilter{}, err
+	}
+	if sel.GetMinAgeSeconds() < 0 {
+		return c.JobFilter{}, fmt.Errorf("minimum age cannot be negative")
+	}
+
+	filter := c.JobFilter{Owner: sel.GetOwner(), Selector: selector}
+	for _, state := range sel.GetStates() {
+		filter.States = append(filter.States, c.JobState(state))
+	}
+	if sel.GetMinAgeSeconds() > 0 {
+		filter.CreatedBefore = now.Add(-time.Duration(sel.GetMinAgeSeconds()) * time.Second)
+	}
+	return filter, nil
+}
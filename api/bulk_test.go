@@ -0,0 +1,83 @@
+package api
+
+import (
+	"context"
+	"time"
+
+	"github.com/ItsMeWithTheFace/linux-process-runner/api/proto"
+	"github.com/ItsMeWithTheFace/linux-process-runner/auth"
+	c "github.com/ItsMeWithTheFace/linux-process-runner/core"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func (suite *JobRunnerServerTestSuite) TestBulkOperations() {
+	aliceContext := auth.NewContextWithIdentity(context.Background(), auth.Identity{Issuer: "CN=ca", Name: "alice"})
+	bobContext := auth.NewContextWithIdentity(context.Background(), auth.Identity{Issuer: "CN=ca", Name: "bob"})
+	labels := map[string]string{"pipeline-run": "42"}
+
+	var ids []string
+	for i := 0; i < 2; i++ {
+		out, err := suite.server.StartJob(aliceContext, &proto.JobStartRequest{Command: "sleep", Arguments: []string{"10"}, Labels: labels})
+		suite.Require().NoError(err)
+		ids = append(ids, out.GetId())
+	}
+	bobs, err := suite.server.StartJob(bobContext, &proto.JobStartRequest{Command: "sleep", Arguments: []string{"10"}, Labels: labels})
+	suite.Require().NoError(err)
+	defer suite.server.StopJob(bobContext, &proto.JobStopRequest{Id: bobs.GetId()})
+	for _, id := range append(ids, bobs.GetId()) {
+		suite.Require().Eventually(func() bool {
+			job, _ := suite.server.jr.GetJob(id)
+			return job.State == c.Running
+		}, 5*time.Second, 10*time.Millisecond)
+	}
+
+	_, err = suite.server.StopJobs(aliceContext, &proto.BulkJobRequest{})
+	s, _ := status.FromError(err)
+	assert.Equal(suite.T(), codes.InvalidArgument, s.Code(), "an empty selector would match every job")
+
+	selector := &proto.JobSelector{Labels: "pipeline-run=42", States: []proto.JobState{proto.JobState_RUNNING}}
+	preview, err := suite.server.StopJobs(aliceContext, &proto.BulkJobRequest{Selector: selector, DryRun: true})
+	suite.Require().NoError(err)
+	suite.Require().Len(preview.GetResults(), 2, "bob's job should be left out")
+	for _, result := range preview.GetResults() {
+		assert.Contains(suite.T(), ids, result.GetId())
+		assert.Empty(suite.T(), result.GetError())
+	}
+	info, _ := suite.server.GetJobInfo(aliceContext, &proto.JobQueryRequest{Id: ids[0]})
+	assert.Equal(suite.T(), proto.JobState_RUNNING, info.GetState(), "a dry run shouldn't stop anything")
+
+	deleted, err := suite.server.DeleteJobs(aliceContext, &proto.BulkJobRequest{Selector: selector})
+	suite.Require().NoError(err)
+	suite.Require().Len(deleted.GetResults(), 2)
+	assert.NotEmpty(suite.T(), deleted.GetResults()[0].GetError(), "running jobs can't be deleted")
+
+	stopped, err := suite.server.StopJobs(aliceContext, &proto.BulkJobRequest{Selector: selector})
+	suite.Require().NoError(err)
+	suite.Require().Len(stopped.GetResults(), 2)
+	for _, result := range stopped.GetResults() {
+		assert.Empty(suite.T(), result.GetError())
+		assert.Equal(suite.T(), proto.JobState_RUNNING, result.GetState(), "results have the state the job was selected in")
+	}
+
+	for _, id := range ids {
+		suite.Require().Eventually(func() bool {
+			job, _ := suite.server.jr.GetJob(id)
+			return len(job.Attempts) > 0 && !job.Attempts[0].FinishedAt.IsZero()
+		}, 5*time.Second, 10*time.Millisecond, "stopped jobs can be deleted once their process has exited")
+	}
+	deleted, err = suite.server.DeleteJobs(aliceContext, &proto.BulkJobRequest{Selector: &proto.JobSelector{Labels: "pipeline-run=42"}})
+	suite.Require().NoError(err)
+	suite.Require().Len(deleted.GetResults(), 2)
+	for _, result := range deleted.GetResults() {
+		assert.Empty(suite.T(), result.GetError())
+		_, err = suite.server.GetJobInfo(aliceContext, &proto.JobQueryRequest{Id: result.GetId()})
+		s, _ = status.FromError(err)
+		assert.Equal(suite.T(), codes.NotFound, s.Code())
+	}
+
+	info, err = suite.server.GetJobInfo(bobContext, &proto.JobQueryRequest{Id: bobs.GetId()})
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), proto.JobState_RUNNING, info.GetState(), "bob's job should be untouched")
+}
@@ -0,0 +1,232 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	pb "github.com/ItsMeWithTheFace/linux-process-runner/api/proto"
+	"github.com/ItsMeWithTheFace/linux-process-runner/auth"
+	"github.com/ItsMeWithTheFace/linux-process-runner/ca"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// CertificateMethodActions maps the CertificateService RPCs reserved for
+// admins to their RBAC action. Any authenticated client can renew its own
+// certificate.
+var CertificateMethodActions = map[string]auth.Action{
+	"/CertificateService/CreateEnrollmentToken":     auth.ActionManageCertificates,
+	"/CertificateService/ListCertificateRequests":   auth.ActionManageCertificates,
+	"/CertificateService/ApproveCertificateRequest": auth.ActionManageCertificates,
+	"/CertificateService/ListIssuedCertificates":    auth.ActionManageCertificates,
+	"/CertificateService/RevokeCertificate":         auth.ActionManageCertificates,
+}
+
+// DefaultEnrollmentTokenTTL is how long enrollment tokens are valid for unless
+// the admin creating them asks otherwise.
+const DefaultEnrollmentTokenTTL = 24 * time.Hour
+
+// CertificateServer implements the server-side CertificateService functions.
+type CertificateServer struct {
+	pb.UnimplementedCertificateServiceServer
+	ca       *ca.Authority
+	onRevoke func()
+}
+
+// InitializeCertificateServer serves the built-in CA. onRevoke is called
+// after every revocation so that the new CRL can be picked up straight away.
+func InitializeCertificateServer(authority *ca.Authority, onRevoke func()) *CertificateServer {
+	return &CertificateServer{ca: authority, onRevoke: onRevoke}
+}
+
+// CreateEnrollmentToken creates a one-time token a new user can enroll with.
+func (s *CertificateServer) CreateEnrollmentToken(ctx context.Context, req *pb.EnrollmentTokenRequest) (*pb.EnrollmentToken, error) {
+	if err := requireRole(ctx, auth.ActionManageCertificates); err != nil {
+		return nil, err
+	}
+
+	ttl := DefaultEnrollmentTokenTTL
+	if req.GetTtlSeconds() > 0 {
+		ttl = time.Duration(req.GetTtlSeconds()) * time.Second
+	}
+
+	token, expiresAt, err := s.ca.CreateToken(req.GetName(), auth.Role(req.GetRole()), ttl)
+	if err != nil {
+		return nil, handleCertificateError(err)
+	}
+
+	return &pb.EnrollmentToken{Token: token, ExpiresAt: expiresAt.Unix()}, nil
+}
+
+// ListCertificateRequests lists every enrollment and renewal request.
+func (s *CertificateServer) ListCertificateRequests(ctx context.Context, req *pb.ListCertificateRequestsRequest) (*pb.CertificateRequestList, error) {
+	if err := requireRole(ctx, auth.ActionManageCertificates); err != nil {
+		return nil, err
+	}
+
+	out := &pb.CertificateRequestList{}
+	for _, r := range s.ca.List() {
+		out.Requests = append(out.Requests, certificateRequestToProto(r))
+	}
+	return out, nil
+}
+
+// ApproveCertificateRequest issues or denies a pending enrollment request.
+func (s *CertificateServer) ApproveCertificateRequest(ctx context.Context, req *pb.CertificateRequestApproval) (*pb.CertificateRequest, error) {
+	if err := requireRole(ctx, auth.ActionManageCertificates); err != nil {
+		return nil, err
+	}
+
+	var r ca.Request
+	var err error
+	if req.GetDeny() {
+		r, err = s.ca.Deny(req.GetId())
+	} else {
+		r, err = s.ca.Approve(req.GetId(), auth.Role(req.GetRole()))
+	}
+	if err != nil {
+		return nil, handleCertificateError(err)
+	}
+
+	return certificateRequestToProto(r), nil
+}
+
+// ListIssuedCertificates lists every certificate issued by the CA.
+func (s *CertificateServer) ListIssuedCertificates(ctx context.Context, req *pb.ListIssuedCertificatesRequest) (*pb.IssuedCertificateList, error) {
+	if err := requireRole(ctx, auth.ActionManageCertificates); err != nil {
+		return nil, err
+	}
+
+	out := &pb.IssuedCertificateList{}
+	for _, crt := range s.ca.Issued() {
+		out.Certificates = append(out.Certificates, &pb.IssuedCertificate{
+			Serial:   crt.Serial,
+			Name:     crt.Name,
+			NotAfter: crt.NotAfter.Unix(),
+			Revoked:  crt.Revoked,
+		})
+	}
+	return out, nil
+}
+
+// RevokeCertificate revokes a certificate issued by the CA.
+func (s *CertificateServer) RevokeCertificate(ctx context.Context, req *pb.RevokeCertificateRequest) (*pb.RevokeCertificateOutput, error) {
+	if err := requireRole(ctx, auth.ActionManageCertificates); err != nil {
+		return nil, err
+	}
+
+	if err := s.ca.Revoke(req.GetSerial()); err != nil {
+		return nil, handleCertificateError(err)
+	}
+
+	if s.onRevoke != nil {
+		s.onRevoke()
+	}
+
+	return &pb.RevokeCertificateOutput{}, nil
+}
+
+// RenewCertificate issues a fresh certificate for the caller's own identity.
+func (s *CertificateServer) RenewCertificate(ctx context.Context, req *pb.RenewCertificateRequest) (*pb.CertificateRequest, error) {
+	id, err := getIdentity(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := s.ca.Renew(req.GetCsr(), id)
+	if err != nil {
+		return nil, handleCertificateError(err)
+	}
+
+	return certificateRequestToProto(r), nil
+}
+
+// EnrollmentServer implements the server-side EnrollmentService functions. It
+// is served without client authentication.
+type EnrollmentServer struct {
+	pb.UnimplementedEnrollmentServiceServer
+	ca      *ca.Authority
+	limiter *tokenBucket
+}
+
+// EnrollmentOption configures an EnrollmentServer.
+type EnrollmentOption func(*EnrollmentServer)
+
+// WithEnrollRate lets Enroll be called rate times a second on average, in
+// bursts of up to burst calls. Anyone who can reach the enrollment listener
+// can call it, so without a limit they could flood the CA with requests.
+func WithEnrollRate(rate float64, burst int) EnrollmentOption {
+	return func(s *EnrollmentServer) {
+		s.limiter = newTokenBucket(rate, burst)
+	}
+}
+
+// InitializeEnrollmentServer lets new users submit CSRs to the built-in CA.
+func InitializeEnrollmentServer(authority *ca.Authority, opts ...EnrollmentOption) *EnrollmentServer {
+	s := &EnrollmentServer{ca: authority}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Enroll submits a CSR, which is issued straight away if it comes with a
+// valid enrollment token.
+func (s *EnrollmentServer) Enroll(ctx context.Context, req *pb.EnrollRequest) (*pb.CertificateRequest, error) {
+	if s.limiter != nil && !s.limiter.allow(time.Now()) {
+		return nil, status.Error(codes.ResourceExhausted, "too many enrollment requests, try again later")
+	}
+
+	r, err := s.ca.Submit(req.GetCsr(), req.GetToken())
+	if err != nil {
+		return nil, handleCertificateError(err)
+	}
+	return certificateRequestToProto(r), nil
+}
+
+// GetEnrollment returns the state of an enrollment request, along with the
+// certificate once it has been issued.
+func (s *EnrollmentServer) GetEnrollment(ctx context.Context, req *pb.EnrollmentQuery) (*pb.CertificateRequest, error) {
+	r, err := s.ca.Get(req.GetId())
+	if err != nil {
+		return nil, handleCertificateError(err)
+	}
+	return certificateRequestToProto(r), nil
+}
+
+// requireRole checks that the caller's role allows an action that does not
+// target a job.
+func requireRole(ctx context.Context, action auth.Action) error {
+	if err := auth.RoleFromContext(ctx).Authorize(action, false); err != nil {
+		return status.Error(codes.PermissionDenied, err.Error())
+	}
+	return nil
+}
+
+func certificateRequestToProto(r ca.Request) *pb.CertificateRequest {
+	return &pb.CertificateRequest{
+		Id:          r.Id,
+		Name:        r.Name,
+		State:       pb.CertificateRequestState(r.State),
+		Role:        string(r.Role),
+		Certificate: r.Certificate,
+		Serial:      r.Serial,
+	}
+}
+
+// handleCertificateError customizes returned error messages based on their type.
+func handleCertificateError(err error) error {
+	switch err.(type) {
+	case *ca.ErrNotFound:
+		return status.Error(codes.NotFound, err.Error())
+	case *ca.ErrInvalidToken:
+		return status.Error(codes.Unauthenticated, err.Error())
+	case *ca.ErrInvalidRequest:
+		return status.Error(codes.InvalidArgument, err.Error())
+	case *ca.ErrTooManyRequests:
+		return status.Error(codes.ResourceExhausted, err.Error())
+	default:
+		return status.Errorf(codes.Internal, fmt.Sprintf("certificate authority error: %s", err.Error()))
+	}
+}
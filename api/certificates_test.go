@@ -0,0 +1,162 @@
+package api
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ItsMeWithTheFace/linux-process-runner/api/proto"
+	"github.com/ItsMeWithTheFace/linux-process-runner/auth"
+	"github.com/ItsMeWithTheFace/linux-process-runner/ca"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type CertificateServerTestSuite struct {
+	suite.Suite
+	dir        string
+	server     *CertificateServer
+	enrollment *EnrollmentServer
+	revoked    int
+}
+
+func (suite *CertificateServerTestSuite) SetupTest() {
+	dir, err := ioutil.TempDir("", "certificates")
+	suite.Require().NoError(err)
+	suite.dir = dir
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	suite.Require().NoError(err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	suite.Require().NoError(err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	suite.Require().NoError(err)
+
+	certPath := filepath.Join(dir, "ca.pem")
+	keyPath := filepath.Join(dir, "ca.key")
+	suite.Require().NoError(ioutil.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	suite.Require().NoError(ioutil.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600))
+
+	authority, err := ca.LoadAuthority(certPath, keyPath, filepath.Join(dir, "state"), time.Hour)
+	suite.Require().NoError(err)
+
+	suite.revoked = 0
+	suite.server = InitializeCertificateServer(authority, func() { suite.revoked++ })
+	suite.enrollment = InitializeEnrollmentServer(authority)
+}
+
+func (suite *CertificateServerTestSuite) TearDownTest() {
+	os.RemoveAll(suite.dir)
+}
+
+func (suite *CertificateServerTestSuite) csr(name string) []byte {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	suite.Require().NoError(err)
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{Subject: pkix.Name{CommonName: name}}, key)
+	suite.Require().NoError(err)
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der})
+}
+
+func (suite *CertificateServerTestSuite) TestOnlyAdminsManageCertificates() {
+	operatorContext := auth.NewContextWithRole(
+		auth.NewContextWithIdentity(context.Background(), auth.Identity{Issuer: "CN=ca", Name: "bob"}),
+		auth.RoleOperator,
+	)
+	_, err := suite.server.CreateEnrollmentToken(operatorContext, &proto.EnrollmentTokenRequest{Name: "alice"})
+	s, _ := status.FromError(err)
+	assert.Equal(suite.T(), codes.PermissionDenied, s.Code(), "operators should not create tokens")
+
+	_, err = suite.server.ListCertificateRequests(context.Background(), &proto.ListCertificateRequestsRequest{})
+	s, _ = status.FromError(err)
+	assert.Equal(suite.T(), codes.PermissionDenied, s.Code(), "callers without a role should be denied")
+}
+
+func (suite *CertificateServerTestSuite) TestEnrollAndRevoke() {
+	adminContext := auth.NewContextWithRole(
+		auth.NewContextWithIdentity(context.Background(), auth.Identity{Issuer: "CN=ca", Name: "dave"}),
+		auth.RoleAdmin,
+	)
+
+	_, err := suite.enrollment.Enroll(context.Background(), &proto.EnrollRequest{Csr: suite.csr("alice"), Token: "bogus"})
+	s, _ := status.FromError(err)
+	assert.Equal(suite.T(), codes.Unauthenticated, s.Code(), "unknown tokens should be rejected")
+
+	token, err := suite.server.CreateEnrollmentToken(adminContext, &proto.EnrollmentTokenRequest{Name: "alice", Role: "viewer"})
+	suite.Require().NoError(err)
+
+	req, err := suite.enrollment.Enroll(context.Background(), &proto.EnrollRequest{Csr: suite.csr("alice"), Token: token.GetToken()})
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), proto.CertificateRequestState_ISSUED, req.GetState())
+	assert.Equal(suite.T(), "viewer", req.GetRole())
+	assert.NotEmpty(suite.T(), req.GetCertificate())
+
+	_, err = suite.server.RevokeCertificate(adminContext, &proto.RevokeCertificateRequest{Serial: req.GetSerial()})
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), 1, suite.revoked, "revocation hook should run")
+
+	issued, err := suite.server.ListIssuedCertificates(adminContext, &proto.ListIssuedCertificatesRequest{})
+	suite.Require().NoError(err)
+	if assert.Len(suite.T(), issued.GetCertificates(), 1) {
+		assert.True(suite.T(), issued.GetCertificates()[0].GetRevoked())
+	}
+}
+
+func (suite *CertificateServerTestSuite) TestPendingEnrollment() {
+	adminContext := auth.NewContextWithRole(
+		auth.NewContextWithIdentity(context.Background(), auth.Identity{Issuer: "CN=ca", Name: "dave"}),
+		auth.RoleAdmin,
+	)
+
+	req, err := suite.enrollment.Enroll(context.Background(), &proto.EnrollRequest{Csr: suite.csr("alice")})
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), proto.CertificateRequestState_PENDING, req.GetState())
+
+	_, err = suite.server.ApproveCertificateRequest(adminContext, &proto.CertificateRequestApproval{Id: req.GetId(), Role: "operator"})
+	suite.Require().NoError(err)
+
+	req, err = suite.enrollment.GetEnrollment(context.Background(), &proto.EnrollmentQuery{Id: req.GetId()})
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), proto.CertificateRequestState_ISSUED, req.GetState())
+	assert.NotEmpty(suite.T(), req.GetCertificate(), "certificate should be available once approved")
+
+	_, err = suite.enrollment.GetEnrollment(context.Background(), &proto.EnrollmentQuery{Id: "missing"})
+	s, _ := status.FromError(err)
+	assert.Equal(suite.T(), codes.NotFound, s.Code())
+}
+
+func (suite *CertificateServerTestSuite) TestEnrollRateLimit() {
+	enrollment := InitializeEnrollmentServer(suite.enrollment.ca, WithEnrollRate(0.001, 2))
+	for i := 0; i < 2; i++ {
+		_, err := enrollment.Enroll(context.Background(), &proto.EnrollRequest{Csr: suite.csr("alice")})
+		suite.Require().NoError(err)
+	}
+
+	_, err := enrollment.Enroll(context.Background(), &proto.EnrollRequest{Csr: suite.csr("alice")})
+	s, _ := status.FromError(err)
+	assert.Equal(suite.T(), codes.ResourceExhausted, s.Code(), "enrollments past the burst should be refused")
+}
+
+func TestCertificateServerTestSuite(t *testing.T) {
+	suite.Run(t, new(CertificateServerTestSuite))
+}
@@ -0,0 +1,147 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"sync"
+	"time"
+
+	pb "github.com/ItsMeWithTheFace/linux-process-runner/api/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// MaxIdempotencyKeyLength bounds the idempotency keys clients can send.
+const MaxIdempotencyKeyLength = 255
+
+// idempotencySweepInterval is how often expired keys are forgotten.
+const idempotencySweepInterval = time.Minute
+
+type idempotencyKey struct {
+	principal string
+	key       string
+}
+
+type idempotencyEntry struct {
+	jobId       string
+	fingerprint [sha256.Size]byte
+	createdAt   time.Time
+	// done is closed once the start the entry was reserved for has returned,
+	// jobId is only set after that.
+	done chan struct{}
+}
+
+// inFlight reports whether the entry's job is still being started. Callers
+// must hold the idempotencyKeys lock.
+func (e *idempotencyEntry) inFlight() bool {
+	select {
+	case <-e.done:
+		return false
+	default:
+		return true
+	}
+}
+
+// idempotencyKeys remembers which job each principal's idempotency keys
+// started, so that a retried StartJob returns that job instead of starting
+// another one.
+type idempotencyKeys struct {
+	mu      sync.Mutex
+	entries map[idempotencyKey]*idempotencyEntry
+	swept   time.Time
+}
+
+func newIdempotencyKeys() *idempotencyKeys {
+	return &idempotencyKeys{entries: make(map[idempotencyKey]*idempotencyEntry)}
+}
+
+// start returns the job remembered for the principal's key if it was used
+// within window, or otherwise calls start and remembers the job it returns.
+// The key is reserved before start is called, so that concurrent retries
+// wait for it rather than starting another job, while other keys aren't held
+// up. A failed start isn't remembered so it can be retried, and a retry stops
+// waiting when ctx is done.
+func (k *idempotencyKeys) start(
+	ctx context.Context,
+	principal string,
+	req *pb.JobStartRequest,
+	window time.Duration,
+	now time.Time,
+	start func() (string, error),
+) (string, error) {
+	fingerprint, err := requestFingerprint(req)
+	if err != nil {
+		return "", status.Error(codes.Internal, err.Error())
+	}
+
+	key := idempotencyKey{principal: principal, key: req.GetIdempotencyKey()}
+	for {
+		k.mu.Lock()
+		k.sweep(window, now)
+
+		entry, ok := k.entries[key]
+		if !ok || (!entry.inFlight() && now.Sub(entry.createdAt) >= window) {
+			break
+		}
+		if entry.fingerprint != fingerprint {
+			k.mu.Unlock()
+			return "", status.Error(codes.InvalidArgument, "idempotency key was already used for a different request")
+		}
+		if !entry.inFlight() {
+			k.mu.Unlock()
+			return entry.jobId, nil
+		}
+		k.mu.Unlock()
+
+		// a failed start drops the entry, so look the key up again
+		select {
+		case <-entry.done:
+		case <-ctx.Done():
+			return "", status.FromContextError(ctx.Err()).Err()
+		}
+	}
+
+	entry := &idempotencyEntry{fingerprint: fingerprint, createdAt: now, done: make(chan struct{})}
+	k.entries[key] = entry
+	k.mu.Unlock()
+
+	id, err := start()
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err != nil {
+		delete(k.entries, key)
+	} else {
+		entry.jobId = id
+	}
+	close(entry.done)
+	return id, err
+}
+
+// sweep forgets the keys used longer than window ago, keeping any whose job
+// is still being started. Callers must hold k.mu.
+func (k *idempotencyKeys) sweep(window time.Duration, now time.Time) {
+	if now.Sub(k.swept) < idempotencySweepInterval {
+		return
+	}
+	for key, entry := range k.entries {
+		if !entry.inFlight() && now.Sub(entry.createdAt) >= window {
+			delete(k.entries, key)
+		}
+	}
+	k.swept = now
+}
+
+// requestFingerprint hashes everything in the request but its idempotency
+// key, so that retries match and anything else using the key doesn't.
+func requestFingerprint(req *pb.JobStartRequest) ([sha256.Size]byte, error) {
+	spec := proto.Clone(req).(*pb.JobStartRequest)
+	spec.IdempotencyKey = ""
+
+	b, err := proto.MarshalOptions{Deterministic: true}.Marshal(spec)
+	if err != nil {
+		return [sha256.Size]byte{}, err
+	}
+	return sha256.Sum256(b), nil
+}
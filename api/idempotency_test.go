@@ -0,0 +1,117 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	pb "github.com/ItsMeWithTheFace/linux-process-runner/api/proto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIdempotencyKeysExpire(t *testing.T) {
+	keys := newIdempotencyKeys()
+	req := &pb.JobStartRequest{Command: "true", IdempotencyKey: "k"}
+	now := time.Unix(0, 0)
+	n := 0
+	start := func() (string, error) {
+		n++
+		return string(rune('a' + n)), nil
+	}
+
+	first, err := keys.start(context.Background(), "alice", req, time.Hour, now, start)
+	assert.NoError(t, err)
+	retry, err := keys.start(context.Background(), "alice", req, time.Hour, now.Add(59*time.Minute), start)
+	assert.NoError(t, err)
+	assert.Equal(t, first, retry, "the key should be remembered within the window")
+
+	later, err := keys.start(context.Background(), "alice", req, time.Hour, now.Add(time.Hour), start)
+	assert.NoError(t, err)
+	assert.NotEqual(t, first, later, "the key should be forgotten after the window")
+	assert.Len(t, keys.entries, 1, "expired keys should be swept")
+}
+
+func TestIdempotencyKeysForgetFailedStarts(t *testing.T) {
+	keys := newIdempotencyKeys()
+	req := &pb.JobStartRequest{Command: "true", IdempotencyKey: "k"}
+	now := time.Unix(0, 0)
+
+	_, err := keys.start(context.Background(), "alice", req, time.Hour, now, func() (string, error) { return "", errors.New("full") })
+	assert.Error(t, err)
+
+	id, err := keys.start(context.Background(), "alice", req, time.Hour, now, func() (string, error) { return "job", nil })
+	assert.NoError(t, err)
+	assert.Equal(t, "job", id, "a failed start should be retried")
+}
+
+func TestIdempotencyKeysStartConcurrently(t *testing.T) {
+	keys := newIdempotencyKeys()
+	now := time.Unix(0, 0)
+	release := make(chan struct{})
+	started := make(chan struct{})
+
+	go keys.start(context.Background(), "alice", &pb.JobStartRequest{Command: "true", IdempotencyKey: "slow"}, time.Hour, now, func() (string, error) {
+		close(started)
+		<-release
+		return "slow", nil
+	})
+	<-started
+	defer close(release)
+
+	done := make(chan string)
+	go func() {
+		id, _ := keys.start(context.Background(), "alice", &pb.JobStartRequest{Command: "true", IdempotencyKey: "fast"}, time.Hour, now, func() (string, error) {
+			return "fast", nil
+		})
+		done <- id
+	}()
+
+	select {
+	case id := <-done:
+		assert.Equal(t, "fast", id)
+	case <-time.After(5 * time.Second):
+		t.Fatal("a slow start should not hold up other keys")
+	}
+}
+
+func TestIdempotencyKeysRetryWaitsForStart(t *testing.T) {
+	keys := newIdempotencyKeys()
+	req := &pb.JobStartRequest{Command: "true", IdempotencyKey: "k"}
+	now := time.Unix(0, 0)
+	release := make(chan struct{})
+	started := make(chan struct{})
+	var calls int32
+
+	first := make(chan string)
+	go func() {
+		id, _ := keys.start(context.Background(), "alice", req, time.Hour, now, func() (string, error) {
+			atomic.AddInt32(&calls, 1)
+			close(started)
+			<-release
+			return "job", nil
+		})
+		first <- id
+	}()
+	<-started
+
+	retry := make(chan string)
+	go func() {
+		id, _ := keys.start(context.Background(), "alice", req, time.Hour, now, func() (string, error) {
+			atomic.AddInt32(&calls, 1)
+			return "another", nil
+		})
+		retry <- id
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := keys.start(ctx, "alice", req, time.Hour, now, func() (string, error) { return "another", nil })
+	assert.Error(t, err, "a retry should give up waiting when its context is done")
+
+	close(release)
+	assert.Equal(t, "job", <-first)
+	assert.Equal(t, "job", <-retry, "a retry should wait for the first start and return its job")
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
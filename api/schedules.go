@@ -0,0 +1,181 @@
+package api
+
+import (
+	"context"
+	"fmt"
+
+	pb "github.com/ItsMeWithTheFace/linux-process-runner/api/proto"
+	"github.com/ItsMeWithTheFace/linux-process-runner/audit"
+	"github.com/ItsMeWithTheFace/linux-process-runner/auth"
+	"github.com/ItsMeWithTheFace/linux-process-runner/schedule"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ScheduleMethodActions maps the ScheduleService RPCs to the RBAC action of
+// the jobs they create or act on.
+var ScheduleMethodActions = map[string]auth.Action{
+	"/ScheduleService/CreateSchedule": auth.ActionStart,
+	"/ScheduleService/ListSchedules":  auth.ActionGet,
+	"/ScheduleService/DeleteSchedule": auth.ActionStop,
+	"/ScheduleService/PauseSchedule":  auth.ActionStop,
+}
+
+// ScheduleServer implements the server-side ScheduleService functions.
+type ScheduleServer struct {
+	pb.UnimplementedScheduleServiceServer
+	schedules *schedule.Scheduler
+	commands  *auth.PolicyEngine
+}
+
+// InitializeScheduleServer serves the schedules of scheduler. New schedules'
+// commands are checked against the engine's policy if it isn't nil.
+func InitializeScheduleServer(scheduler *schedule.Scheduler, commands *auth.PolicyEngine) *ScheduleServer {
+	return &ScheduleServer{schedules: scheduler, commands: commands}
+}
+
+// CreateSchedule creates a schedule owned by the caller.
+func (s *ScheduleServer) CreateSchedule(ctx context.Context, req *pb.CreateScheduleRequest) (*pb.Schedule, error) {
+	owner, err := getIdentity(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	audit.SetJob(ctx, "", req.GetCommand(), req.GetArguments())
+
+	command := req.GetCommand()
+	if s.commands != nil {
+		decision := s.commands.Evaluate(owner, auth.RoleFromContext(ctx), req.GetCommand(), req.GetArguments())
+		if !decision.Allowed {
+			return nil, status.Errorf(
+				codes.PermissionDenied,
+				fmt.Sprintf("command %s is not allowed: %s", req.GetCommand(), decision.Reason),
+			)
+		}
+		// every run uses the binary the decision was made on
+		command = decision.Path
+	}
+
+	sch, err := s.schedules.Create(
+		owner.String(),
+		string(auth.CertificateRoleFromContext(ctx)),
+		req.GetCron(),
+		command,
+		req.GetArguments(),
+		schedule.OverlapPolicy(req.GetOverlapPolicy()),
+	)
+	if err != nil {
+		return nil, handleScheduleError(err)
+	}
+
+	return scheduleToProto(sch), nil
+}
+
+// ListSchedules lists the schedules the caller is allowed to see.
+func (s *ScheduleServer) ListSchedules(ctx context.Context, req *pb.ListSchedulesRequest) (*pb.ScheduleList, error) {
+	out := &pb.ScheduleList{}
+	for _, sch := range s.schedules.List() {
+		if verifyJobOwnership(ctx, auth.ActionGet, sch.Owner) == nil {
+			out.Schedules = append(out.Schedules, scheduleToProto(sch))
+		}
+	}
+	return out, nil
+}
+
+// DeleteSchedule deletes a schedule, jobs it started keep running.
+func (s *ScheduleServer) DeleteSchedule(ctx context.Context, req *pb.DeleteScheduleRequest) (*pb.DeleteScheduleOutput, error) {
+	if err := s.verifyScheduleOwnership(ctx, req.GetId()); err != nil {
+		return nil, err
+	}
+
+	if err := s.schedules.Delete(req.GetId()); err != nil {
+		return nil, handleScheduleError(err)
+	}
+
+	return &pb.DeleteScheduleOutput{}, nil
+}
+
+// PauseSchedule pauses or resumes a schedule.
+func (s *ScheduleServer) PauseSchedule(ctx context.Context, req *pb.PauseScheduleRequest) (*pb.Schedule, error) {
+	if err := s.verifyScheduleOwnership(ctx, req.GetId()); err != nil {
+		return nil, err
+	}
+
+	sch, err := s.schedules.SetPaused(req.GetId(), req.GetPaused())
+	if err != nil {
+		return nil, handleScheduleError(err)
+	}
+
+	return scheduleToProto(sch), nil
+}
+
+// ScheduleRunCheck checks every run of a schedule the way CreateSchedule
+// checked its creation, so that runs stop once the owner's role or the
+// command policy no longer allows them. The owner's role is resolved again
+// with rbac, and the command is evaluated again if commands isn't nil.
+func ScheduleRunCheck(rbac *auth.RBAC, commands *auth.PolicyEngine) schedule.RunCheck {
+	return func(sch schedule.Schedule) error {
+		owner, err := auth.ParseIdentity(sch.Owner)
+		if err != nil {
+			return err
+		}
+
+		role := rbac.ResolveRole(owner, auth.Role(sch.OwnerRole))
+		if err := role.Authorize(auth.ActionStart, true); err != nil {
+			return fmt.Errorf("owner %s: %w", sch.Owner, err)
+		}
+
+		if commands != nil {
+			decision := commands.Evaluate(owner, role, sch.Command, sch.Args)
+			if !decision.Allowed {
+				return fmt.Errorf("command %s is not allowed: %s", sch.Command, decision.Reason)
+			}
+		}
+		return nil
+	}
+}
+
+// verifyScheduleOwnership checks that the caller may change the schedule the
+// same way they could stop its jobs.
+func (s *ScheduleServer) verifyScheduleOwnership(ctx context.Context, id string) error {
+	sch, err := s.schedules.Get(id)
+	if err != nil {
+		return handleScheduleError(err)
+	}
+
+	audit.SetJob(ctx, "", sch.Command, sch.Args)
+	return verifyJobOwnership(ctx, auth.ActionStop, sch.Owner)
+}
+
+func scheduleToProto(sch schedule.Schedule) *pb.Schedule {
+	out := &pb.Schedule{
+		Id:            sch.Id,
+		Owner:         sch.Owner,
+		Cron:          sch.Cron,
+		Command:       sch.Command,
+		Arguments:     sch.Args,
+		OverlapPolicy: pb.OverlapPolicy(sch.Overlap),
+		Paused:        sch.Paused,
+		CreatedAt:     sch.CreatedAt.Unix(),
+		LastJobId:     sch.LastJobId,
+	}
+	if !sch.Paused && !sch.NextRunAt.IsZero() {
+		out.NextRunAt = sch.NextRunAt.Unix()
+	}
+	if !sch.LastRunAt.IsZero() {
+		out.LastRunAt = sch.LastRunAt.Unix()
+	}
+	return out
+}
+
+// handleScheduleError customizes returned error messages based on their type.
+func handleScheduleError(err error) error {
+	switch err.(type) {
+	case *schedule.ErrNotFound:
+		return status.Error(codes.NotFound, err.Error())
+	case *schedule.ErrInvalidSchedule:
+		return status.Error(codes.InvalidArgument, err.Error())
+	default:
+		return status.Errorf(codes.Internal, fmt.Sprintf("scheduler error: %s", err.Error()))
+	}
+}
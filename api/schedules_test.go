@@ -0,0 +1,136 @@
+package api
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/ItsMeWithTheFace/linux-process-runner/api/proto"
+	"github.com/ItsMeWithTheFace/linux-process-runner/auth"
+	c "github.com/ItsMeWithTheFace/linux-process-runner/core"
+	"github.com/ItsMeWithTheFace/linux-process-runner/schedule"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type ScheduleServerTestSuite struct {
+	suite.Suite
+	dir    string
+	server *ScheduleServer
+}
+
+func (suite *ScheduleServerTestSuite) SetupTest() {
+	dir, err := ioutil.TempDir("", "schedules")
+	suite.Require().NoError(err)
+	suite.dir = dir
+
+	scheduler, err := schedule.Load(c.InitializeJobRunner(c.InitializeInMemoryJobStore()), dir)
+	suite.Require().NoError(err)
+	suite.server = InitializeScheduleServer(scheduler, nil)
+}
+
+func (suite *ScheduleServerTestSuite) TearDownTest() {
+	os.RemoveAll(suite.dir)
+}
+
+func (suite *ScheduleServerTestSuite) TestOwnership() {
+	aliceContext := auth.NewContextWithIdentity(context.Background(), auth.Identity{Issuer: "CN=ca", Name: "alice"})
+	bobContext := auth.NewContextWithIdentity(context.Background(), auth.Identity{Issuer: "CN=ca", Name: "bob"})
+	adminContext := auth.NewContextWithRole(
+		auth.NewContextWithIdentity(context.Background(), auth.Identity{Issuer: "CN=ca", Name: "dave"}),
+		auth.RoleAdmin,
+	)
+
+	sch, err := suite.server.CreateSchedule(aliceContext, &proto.CreateScheduleRequest{
+		Cron:          "0 3 * * *",
+		Command:       "find",
+		Arguments:     []string{"/tmp", "-mtime", "+7", "-delete"},
+		OverlapPolicy: proto.OverlapPolicy_SKIP,
+	})
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), "alice@CN=ca", sch.GetOwner())
+	assert.NotZero(suite.T(), sch.GetNextRunAt())
+
+	list, err := suite.server.ListSchedules(bobContext, &proto.ListSchedulesRequest{})
+	suite.Require().NoError(err)
+	assert.Empty(suite.T(), list.GetSchedules(), "bob should not see alice's schedules")
+
+	_, err = suite.server.PauseSchedule(bobContext, &proto.PauseScheduleRequest{Id: sch.GetId(), Paused: true})
+	s, _ := status.FromError(err)
+	assert.Equal(suite.T(), codes.PermissionDenied, s.Code())
+	_, err = suite.server.DeleteSchedule(bobContext, &proto.DeleteScheduleRequest{Id: sch.GetId()})
+	s, _ = status.FromError(err)
+	assert.Equal(suite.T(), codes.PermissionDenied, s.Code())
+
+	paused, err := suite.server.PauseSchedule(aliceContext, &proto.PauseScheduleRequest{Id: sch.GetId(), Paused: true})
+	suite.Require().NoError(err)
+	assert.True(suite.T(), paused.GetPaused())
+	assert.Zero(suite.T(), paused.GetNextRunAt(), "paused schedules have no next run")
+
+	list, err = suite.server.ListSchedules(adminContext, &proto.ListSchedulesRequest{})
+	suite.Require().NoError(err)
+	assert.Len(suite.T(), list.GetSchedules(), 1, "admins should see every schedule")
+
+	_, err = suite.server.DeleteSchedule(adminContext, &proto.DeleteScheduleRequest{Id: sch.GetId()})
+	suite.Require().NoError(err)
+	_, err = suite.server.DeleteSchedule(aliceContext, &proto.DeleteScheduleRequest{Id: sch.GetId()})
+	s, _ = status.FromError(err)
+	assert.Equal(suite.T(), codes.NotFound, s.Code())
+}
+
+func (suite *ScheduleServerTestSuite) TestInvalidCron() {
+	ctx := auth.NewContextWithIdentity(context.Background(), auth.Identity{Issuer: "CN=ca", Name: "alice"})
+	_, err := suite.server.CreateSchedule(ctx, &proto.CreateScheduleRequest{Cron: "0 25 * * *", Command: "ls"})
+	s, _ := status.FromError(err)
+	assert.Equal(suite.T(), codes.InvalidArgument, s.Code())
+}
+
+func (suite *ScheduleServerTestSuite) TestDeniedCommand() {
+	engine, err := auth.NewPolicyEngine(auth.CommandPolicy{
+		Default: auth.EffectAllow,
+		Rules:   []auth.CommandRule{{Principals: []string{"alice"}, Effect: auth.EffectDeny, Reason: "alice is on vacation"}},
+	})
+	suite.Require().NoError(err)
+	suite.server.commands = engine
+
+	ctx := auth.NewContextWithIdentity(context.Background(), auth.Identity{Issuer: "CN=ca", Name: "alice"})
+	_, err = suite.server.CreateSchedule(ctx, &proto.CreateScheduleRequest{Cron: "@daily", Command: "ls"})
+	s, _ := status.FromError(err)
+	assert.Equal(suite.T(), codes.PermissionDenied, s.Code(), "schedules should follow the command policy")
+}
+
+func (suite *ScheduleServerTestSuite) TestRunCheck() {
+	ctx := auth.NewContextWithIdentity(context.Background(), auth.Identity{Issuer: "CN=ca", Name: "alice"})
+	ctx = auth.NewContextWithCertificateRole(ctx, auth.RoleOperator)
+	created, err := suite.server.CreateSchedule(ctx, &proto.CreateScheduleRequest{Cron: "@daily", Command: "ls"})
+	suite.Require().NoError(err)
+	sch, err := suite.server.schedules.Get(created.GetId())
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), string(auth.RoleOperator), sch.OwnerRole, "the role from alice's certificate should be kept")
+
+	rbac := auth.NewRBAC(auth.RolePolicy{DefaultRole: auth.RoleViewer})
+	engine, err := auth.NewPolicyEngine(auth.CommandPolicy{Default: auth.EffectAllow})
+	suite.Require().NoError(err)
+	check := ScheduleRunCheck(rbac, engine)
+	assert.NoError(suite.T(), check(sch))
+
+	suite.Require().NoError(engine.SetPolicy(auth.CommandPolicy{
+		Default: auth.EffectAllow,
+		Rules:   []auth.CommandRule{{Principals: []string{"alice"}, Effect: auth.EffectDeny, Reason: "alice is on vacation"}},
+	}))
+	assert.Error(suite.T(), check(sch), "runs should follow the current command policy")
+
+	suite.Require().NoError(engine.SetPolicy(auth.CommandPolicy{Default: auth.EffectAllow}))
+	rbac.SetPolicy(auth.RolePolicy{
+		DefaultRole: auth.RoleViewer,
+		Bindings:    []auth.RoleBinding{{Name: "alice", Role: auth.RoleViewer}},
+	})
+	assert.Error(suite.T(), check(sch), "runs should stop once the owner can no longer start jobs")
+}
+
+func TestScheduleServerTestSuite(t *testing.T) {
+	suite.Run(t, new(ScheduleServerTestSuite))
+}
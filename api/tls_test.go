@@ -2,9 +2,13 @@ package api
 
 import (
 	"context"
+	"io/ioutil"
 	"log"
 	"net"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	pb "github.com/ItsMeWithTheFace/linux-process-runner/api/proto"
 	"github.com/ItsMeWithTheFace/linux-process-runner/auth"
@@ -79,6 +83,93 @@ func (suite *TlsAuthTestSuite) TestUnsuccessfulMtlsConnection() {
 	assert.Error(suite.T(), err, "it should not start the job with invalid tls creds")
 }
 
+func (suite *TlsAuthTestSuite) TestReloadedCredentials() {
+	serverTls, err := auth.NewServerTlsReloader(auth.TlsFiles{Cert: "test_certs/ca1/server.pem", Key: "test_certs/ca1/server.key", CA: "test_certs/ca2/ca2.pem"})
+	assert.NoError(suite.T(), err, "it should load server credentials")
+
+	clientTls, err := auth.NewClientTlsReloader(auth.TlsFiles{Cert: "test_certs/ca1/client.pem", Key: "test_certs/ca1/client.key", CA: "test_certs/ca1/ca1.pem"})
+	assert.NoError(suite.T(), err, "it should load client credentials")
+
+	s, conn, err := suite.setupServerAndClient(serverTls.Credentials(), clientTls.Credentials())
+	assert.NoError(suite.T(), err)
+
+	go func() {
+		if err := s.Serve(suite.lis); err != nil {
+			log.Fatalf("server exited with error: %v", err)
+		}
+	}()
+
+	defer conn.Close()
+	defer s.Stop()
+
+	c := handlers.Client{
+		JobRunnerServiceClient: pb.NewJobRunnerServiceClient(conn),
+	}
+
+	err = c.HandleArgs([]string{"start", "ls"})
+	assert.Error(suite.T(), err, "server should not trust the client's CA yet")
+
+	err = serverTls.Reload(auth.TlsFiles{Cert: "test_certs/ca1/server.pem", Key: "test_certs/ca1/server.key", CA: "test_certs/ca1/ca1.pem"})
+	assert.NoError(suite.T(), err, "it should reload server credentials")
+
+	err = serverTls.Reload(auth.TlsFiles{Cert: "test_certs/missing.pem", Key: "test_certs/ca1/server.key", CA: "test_certs/ca1/ca1.pem"})
+	assert.Error(suite.T(), err, "a failed reload should keep the previous credentials")
+
+	assert.Eventually(suite.T(), func() bool {
+		return c.HandleArgs([]string{"start", "ls"}) == nil
+	}, 5*time.Second, 50*time.Millisecond, "it should start the job once the server trusts the client's CA")
+}
+
+func (suite *TlsAuthTestSuite) TestWatchedClientCredentials() {
+	dir, err := ioutil.TempDir("", "certs")
+	assert.NoError(suite.T(), err)
+	defer os.RemoveAll(dir)
+
+	files := auth.TlsFiles{
+		Cert: filepath.Join(dir, "client.pem"),
+		Key:  filepath.Join(dir, "client.key"),
+		CA:   filepath.Join(dir, "ca.pem"),
+	}
+	copyFile(suite.T(), "test_certs/ca1/client.pem", files.Cert)
+	copyFile(suite.T(), "test_certs/ca1/client.key", files.Key)
+	copyFile(suite.T(), "test_certs/ca2/ca2.pem", files.CA)
+
+	serverCreds, err := auth.GetServerTlsCredentials("test_certs/ca1/server.pem", "test_certs/ca1/server.key", "test_certs/ca1/ca1.pem")
+	assert.NoError(suite.T(), err, "it should load server credentials")
+
+	clientTls, err := auth.NewClientTlsReloader(files)
+	assert.NoError(suite.T(), err, "it should load client credentials")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go clientTls.Watch(ctx, 10*time.Millisecond)
+
+	s, conn, err := suite.setupServerAndClient(serverCreds, clientTls.Credentials())
+	assert.NoError(suite.T(), err)
+
+	go func() {
+		if err := s.Serve(suite.lis); err != nil {
+			log.Fatalf("server exited with error: %v", err)
+		}
+	}()
+
+	defer conn.Close()
+	defer s.Stop()
+
+	c := handlers.Client{
+		JobRunnerServiceClient: pb.NewJobRunnerServiceClient(conn),
+	}
+
+	err = c.HandleArgs([]string{"start", "ls"})
+	assert.Error(suite.T(), err, "client should not trust the server's CA yet")
+
+	copyFile(suite.T(), "test_certs/ca1/ca1.pem", files.CA)
+
+	assert.Eventually(suite.T(), func() bool {
+		return c.HandleArgs([]string{"start", "ls"}) == nil
+	}, 5*time.Second, 50*time.Millisecond, "it should pick up the rotated CA bundle")
+}
+
 func TestTlsAuthTestSuite(t *testing.T) {
 	suite.Run(t, new(TlsAuthTestSuite))
 }
@@ -99,3 +190,9 @@ func (suite *TlsAuthTestSuite) setupServerAndClient(serverCreds credentials.Tran
 
 	return s, conn, err
 }
+
+func copyFile(t *testing.T, src string, dst string) {
+	b, err := ioutil.ReadFile(src)
+	assert.NoError(t, err)
+	assert.NoError(t, ioutil.WriteFile(dst, b, 0600))
+}
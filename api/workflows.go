@@ -0,0 +1,160 @@
+package api
+
+import (
+	"context"
+	"fmt"
+
+	pb "github.com/ItsMeWithTheFace/linux-process-runner/api/proto"
+	"github.com/ItsMeWithTheFace/linux-process-runner/audit"
+	"github.com/ItsMeWithTheFace/linux-process-runner/auth"
+	"github.com/ItsMeWithTheFace/linux-process-runner/workflow"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// WorkflowMethodActions maps the WorkflowService RPCs to the RBAC action of
+// the jobs they start or act on.
+var WorkflowMethodActions = map[string]auth.Action{
+	"/WorkflowService/SubmitWorkflow": auth.ActionStart,
+	"/WorkflowService/GetWorkflow":    auth.ActionGet,
+	"/WorkflowService/ListWorkflows":  auth.ActionGet,
+	"/WorkflowService/CancelWorkflow": auth.ActionStop,
+}
+
+// WorkflowServer implements the server-side WorkflowService functions.
+type WorkflowServer struct {
+	pb.UnimplementedWorkflowServiceServer
+	orchestrator *workflow.Orchestrator
+	commands     *auth.PolicyEngine
+}
+
+// InitializeWorkflowServer serves the workflows of orchestrator. Every step's
+// command is checked against the engine's policy if it isn't nil.
+func InitializeWorkflowServer(orchestrator *workflow.Orchestrator, commands *auth.PolicyEngine) *WorkflowServer {
+	return &WorkflowServer{orchestrator: orchestrator, commands: commands}
+}
+
+// SubmitWorkflow starts a workflow owned by the caller.
+func (s *WorkflowServer) SubmitWorkflow(ctx context.Context, req *pb.SubmitWorkflowRequest) (*pb.Workflow, error) {
+	owner, err := getIdentity(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	steps := make([]workflow.StepSpec, 0, len(req.GetSteps()))
+	for _, step := range req.GetSteps() {
+		command := step.GetCommand()
+		if s.commands != nil {
+			decision := s.commands.Evaluate(owner, auth.RoleFromContext(ctx), step.GetCommand(), step.GetArguments())
+			if !decision.Allowed {
+				audit.SetJob(ctx, "", step.GetCommand(), step.GetArguments())
+				return nil, status.Errorf(
+					codes.PermissionDenied,
+					fmt.Sprintf("command %s of step %s is not allowed: %s", step.GetCommand(), step.GetName(), decision.Reason),
+				)
+			}
+			// the step runs the binary the decision was made on
+			command = decision.Path
+		}
+		steps = append(steps, workflow.StepSpec{
+			Name:      step.GetName(),
+			Command:   command,
+			Args:      step.GetArguments(),
+			DependsOn: step.GetDependsOn(),
+			Condition: workflow.Condition(step.GetCondition()),
+		})
+	}
+
+	wf, err := s.orchestrator.Submit(owner.String(), req.GetName(), steps)
+	if err != nil {
+		return nil, handleWorkflowError(err)
+	}
+
+	return workflowToProto(wf), nil
+}
+
+// GetWorkflow returns a workflow and the state of its steps.
+func (s *WorkflowServer) GetWorkflow(ctx context.Context, req *pb.WorkflowQueryRequest) (*pb.Workflow, error) {
+	wf, err := s.verifyWorkflowOwnership(ctx, auth.ActionGet, req.GetId())
+	if err != nil {
+		return nil, err
+	}
+
+	return workflowToProto(wf), nil
+}
+
+// ListWorkflows lists the workflows the caller is allowed to see.
+func (s *WorkflowServer) ListWorkflows(ctx context.Context, req *pb.ListWorkflowsRequest) (*pb.WorkflowList, error) {
+	out := &pb.WorkflowList{}
+	for _, wf := range s.orchestrator.List() {
+		if verifyJobOwnership(ctx, auth.ActionGet, wf.Owner) == nil {
+			out.Workflows = append(out.Workflows, workflowToProto(wf))
+		}
+	}
+	return out, nil
+}
+
+// CancelWorkflow stops a workflow's running jobs and cancels the rest.
+func (s *WorkflowServer) CancelWorkflow(ctx context.Context, req *pb.WorkflowQueryRequest) (*pb.Workflow, error) {
+	if _, err := s.verifyWorkflowOwnership(ctx, auth.ActionStop, req.GetId()); err != nil {
+		return nil, err
+	}
+
+	wf, err := s.orchestrator.Cancel(req.GetId())
+	if err != nil {
+		return nil, handleWorkflowError(err)
+	}
+
+	return workflowToProto(wf), nil
+}
+
+// verifyWorkflowOwnership checks that the caller may act on the workflow the
+// same way they could on its jobs.
+func (s *WorkflowServer) verifyWorkflowOwnership(ctx context.Context, action auth.Action, id string) (workflow.Workflow, error) {
+	wf, err := s.orchestrator.Get(id)
+	if err != nil {
+		return workflow.Workflow{}, handleWorkflowError(err)
+	}
+
+	if err := verifyJobOwnership(ctx, action, wf.Owner); err != nil {
+		return workflow.Workflow{}, err
+	}
+	return wf, nil
+}
+
+func workflowToProto(wf workflow.Workflow) *pb.Workflow {
+	out := &pb.Workflow{
+		Id:        wf.Id,
+		Owner:     wf.Owner,
+		Name:      wf.Name,
+		State:     pb.WorkflowState(wf.State),
+		CreatedAt: wf.CreatedAt.Unix(),
+	}
+	if !wf.FinishedAt.IsZero() {
+		out.FinishedAt = wf.FinishedAt.Unix()
+	}
+	for _, step := range wf.Steps {
+		out.Steps = append(out.Steps, &pb.WorkflowStep{
+			Name:      step.Name,
+			Command:   step.Command,
+			Arguments: step.Args,
+			DependsOn: step.DependsOn,
+			Condition: pb.StepCondition(step.Condition),
+			State:     pb.StepState(step.State),
+			JobId:     step.JobId,
+		})
+	}
+	return out
+}
+
+// handleWorkflowError customizes returned error messages based on their type.
+func handleWorkflowError(err error) error {
+	switch err.(type) {
+	case *workflow.ErrNotFound:
+		return status.Error(codes.NotFound, err.Error())
+	case *workflow.ErrInvalidWorkflow:
+		return status.Error(codes.InvalidArgument, err.Error())
+	default:
+		return status.Errorf(codes.Internal, fmt.Sprintf("workflow error: %s", err.Error()))
+	}
+}
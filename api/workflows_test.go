@@ -0,0 +1,113 @@
+package api
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ItsMeWithTheFace/linux-process-runner/api/proto"
+	"github.com/ItsMeWithTheFace/linux-process-runner/auth"
+	c "github.com/ItsMeWithTheFace/linux-process-runner/core"
+	"github.com/ItsMeWithTheFace/linux-process-runner/workflow"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type WorkflowServerTestSuite struct {
+	suite.Suite
+	jr     *c.JobRunner
+	server *WorkflowServer
+}
+
+func (suite *WorkflowServerTestSuite) SetupTest() {
+	suite.jr = c.InitializeJobRunner(c.InitializeInMemoryJobStore())
+	suite.server = InitializeWorkflowServer(workflow.InitializeOrchestrator(suite.jr), nil)
+}
+
+func (suite *WorkflowServerTestSuite) TestOwnership() {
+	aliceContext := auth.NewContextWithIdentity(context.Background(), auth.Identity{Issuer: "CN=ca", Name: "alice"})
+	bobContext := auth.NewContextWithIdentity(context.Background(), auth.Identity{Issuer: "CN=ca", Name: "bob"})
+	adminContext := auth.NewContextWithRole(
+		auth.NewContextWithIdentity(context.Background(), auth.Identity{Issuer: "CN=ca", Name: "dave"}),
+		auth.RoleAdmin,
+	)
+
+	wf, err := suite.server.SubmitWorkflow(aliceContext, &proto.SubmitWorkflowRequest{
+		Name: "pipeline",
+		Steps: []*proto.WorkflowStep{
+			{Name: "build", Command: "sleep", Arguments: []string{"10"}},
+			{Name: "cleanup", Command: "true", DependsOn: []string{"build"}, Condition: proto.StepCondition_CONDITION_ALWAYS},
+		},
+	})
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), "alice@CN=ca", wf.GetOwner())
+	assert.Equal(suite.T(), proto.WorkflowState_WORKFLOW_RUNNING, wf.GetState())
+	suite.Require().Len(wf.GetSteps(), 2)
+	assert.NotEmpty(suite.T(), wf.GetSteps()[0].GetJobId())
+	assert.Equal(suite.T(), proto.StepState_STEP_PENDING, wf.GetSteps()[1].GetState())
+
+	list, err := suite.server.ListWorkflows(bobContext, &proto.ListWorkflowsRequest{})
+	suite.Require().NoError(err)
+	assert.Empty(suite.T(), list.GetWorkflows(), "bob should not see alice's workflows")
+
+	_, err = suite.server.GetWorkflow(bobContext, &proto.WorkflowQueryRequest{Id: wf.GetId()})
+	s, _ := status.FromError(err)
+	assert.Equal(suite.T(), codes.PermissionDenied, s.Code())
+	_, err = suite.server.CancelWorkflow(bobContext, &proto.WorkflowQueryRequest{Id: wf.GetId()})
+	s, _ = status.FromError(err)
+	assert.Equal(suite.T(), codes.PermissionDenied, s.Code())
+
+	list, err = suite.server.ListWorkflows(adminContext, &proto.ListWorkflowsRequest{})
+	suite.Require().NoError(err)
+	assert.Len(suite.T(), list.GetWorkflows(), 1, "admins should see every workflow")
+
+	suite.Require().Eventually(func() bool {
+		job, _ := suite.jr.GetJob(wf.GetSteps()[0].GetJobId())
+		return job.State == c.Running
+	}, 5*time.Second, 10*time.Millisecond)
+	cancelled, err := suite.server.CancelWorkflow(aliceContext, &proto.WorkflowQueryRequest{Id: wf.GetId()})
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), proto.WorkflowState_WORKFLOW_CANCELLED, cancelled.GetState())
+
+	_, err = suite.server.GetWorkflow(aliceContext, &proto.WorkflowQueryRequest{Id: "missing"})
+	s, _ = status.FromError(err)
+	assert.Equal(suite.T(), codes.NotFound, s.Code())
+}
+
+func (suite *WorkflowServerTestSuite) TestInvalidWorkflow() {
+	ctx := auth.NewContextWithIdentity(context.Background(), auth.Identity{Issuer: "CN=ca", Name: "alice"})
+	_, err := suite.server.SubmitWorkflow(ctx, &proto.SubmitWorkflowRequest{
+		Steps: []*proto.WorkflowStep{{Name: "test", Command: "true", DependsOn: []string{"build"}}},
+	})
+	s, _ := status.FromError(err)
+	assert.Equal(suite.T(), codes.InvalidArgument, s.Code())
+}
+
+func (suite *WorkflowServerTestSuite) TestDeniedCommand() {
+	engine, err := auth.NewPolicyEngine(auth.CommandPolicy{
+		Default: auth.EffectAllow,
+		Rules:   []auth.CommandRule{{Args: []string{"^-rf$"}, Effect: auth.EffectDeny, Reason: "no deleting"}},
+	})
+	suite.Require().NoError(err)
+	suite.server.commands = engine
+
+	ctx := auth.NewContextWithIdentity(context.Background(), auth.Identity{Issuer: "CN=ca", Name: "alice"})
+	_, err = suite.server.SubmitWorkflow(ctx, &proto.SubmitWorkflowRequest{
+		Steps: []*proto.WorkflowStep{
+			{Name: "build", Command: "true"},
+			{Name: "cleanup", Command: "rm", Arguments: []string{"-rf", "out"}, DependsOn: []string{"build"}},
+		},
+	})
+	s, _ := status.FromError(err)
+	assert.Equal(suite.T(), codes.PermissionDenied, s.Code(), "every step should follow the command policy")
+
+	list, err := suite.server.ListWorkflows(ctx, &proto.ListWorkflowsRequest{})
+	suite.Require().NoError(err)
+	assert.Empty(suite.T(), list.GetWorkflows(), "no step should have started")
+}
+
+func TestWorkflowServerTestSuite(t *testing.T) {
+	suite.Run(t, new(WorkflowServerTestSuite))
+}
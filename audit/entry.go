@@ -0,0 +1,78 @@
+package audit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Decision records whether an RPC was let through to its handler's logic.
+type Decision string
+
+const (
+	DecisionAllow Decision = "allow"
+	DecisionDeny  Decision = "deny"
+)
+
+// Entry is a single line of the audit log.
+type Entry struct {
+	Time      time.Time `json:"time"`
+	Principal string    `json:"principal,omitempty"`
+	Role      string    `json:"role,omitempty"`
+	Peer      string    `json:"peer,omitempty"`
+	Method    string    `json:"method"`
+	JobId     string    `json:"job_id,omitempty"`
+	Command   string    `json:"command,omitempty"`
+	Args      []string  `json:"args,omitempty"`
+	Decision  Decision  `json:"decision"`
+	Outcome   string    `json:"outcome"`
+	Error     string    `json:"error,omitempty"`
+	// DurationMs is how long the RPC took, streams are logged when they end.
+	DurationMs int64 `json:"duration_ms"`
+
+	// PrevHash and Hash chain entries together when hash chaining is enabled.
+	PrevHash string `json:"prev_hash,omitempty"`
+	Hash     string `json:"hash,omitempty"`
+}
+
+// record is the entry for an in-flight RPC. Interceptors and handlers further
+// down the chain fill it in through the context.
+type record struct {
+	mu    sync.Mutex
+	entry Entry
+}
+
+type recordKey struct{}
+
+func newContextWithRecord(ctx context.Context, r *record) context.Context {
+	return context.WithValue(ctx, recordKey{}, r)
+}
+
+func update(ctx context.Context, f func(*Entry)) {
+	r, ok := ctx.Value(recordKey{}).(*record)
+	if !ok {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	f(&r.entry)
+}
+
+// SetPrincipal records who made the RPC. It does nothing if the RPC is not
+// being audited.
+func SetPrincipal(ctx context.Context, principal string, role string) {
+	update(ctx, func(e *Entry) {
+		e.Principal = principal
+		e.Role = role
+	})
+}
+
+// SetJob records the job an RPC acted on. It does nothing if the RPC is not
+// being audited.
+func SetJob(ctx context.Context, id string, command string, args []string) {
+	update(ctx, func(e *Entry) {
+		e.JobId = id
+		e.Command = command
+		e.Args = args
+	})
+}
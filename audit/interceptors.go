@@ -0,0 +1,101 @@
+package audit
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+type auditStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (a *auditStream) Context() context.Context {
+	return a.ctx
+}
+
+// Auditor logs an entry for every RPC once it has finished. It has to run
+// before the auth interceptors so that rejected calls are logged too.
+type Auditor struct {
+	logger Logger
+}
+
+// NewAuditor creates an Auditor writing to logger.
+func NewAuditor(logger Logger) *Auditor {
+	return &Auditor{logger: logger}
+}
+
+// UnaryInterceptor audits unary RPCs.
+func (a *Auditor) UnaryInterceptor(
+	ctx context.Context,
+	req interface{},
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (interface{}, error) {
+	r := a.start(ctx, info.FullMethod)
+
+	resp, err := handler(newContextWithRecord(ctx, r), req)
+
+	a.finish(r, err)
+	return resp, err
+}
+
+// StreamInterceptor audits streaming RPCs.
+func (a *Auditor) StreamInterceptor(
+	srv interface{},
+	stream grpc.ServerStream,
+	info *grpc.StreamServerInfo,
+	handler grpc.StreamHandler,
+) error {
+	r := a.start(stream.Context(), info.FullMethod)
+
+	err := handler(srv, &auditStream{
+		ServerStream: stream,
+		ctx:          newContextWithRecord(stream.Context(), r),
+	})
+
+	a.finish(r, err)
+	return err
+}
+
+func (a *Auditor) start(ctx context.Context, method string) *record {
+	r := &record{entry: Entry{Time: time.Now().UTC(), Method: method}}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		r.entry.Peer = p.Addr.String()
+	}
+	return r
+}
+
+// finish fills in the RPC's result and writes the entry. Failing to write is
+// logged rather than failing an RPC that has already run.
+func (a *Auditor) finish(r *record, err error) {
+	r.mu.Lock()
+	e := r.entry
+	r.mu.Unlock()
+
+	e.DurationMs = time.Since(e.Time).Milliseconds()
+
+	s, ok := status.FromError(err)
+	if !ok {
+		// streams end with the bare context error when the client goes away
+		s = status.FromContextError(err)
+	}
+	e.Outcome = s.Code().String()
+	e.Decision = DecisionAllow
+	if err != nil {
+		e.Error = s.Message()
+		if s.Code() == codes.PermissionDenied || s.Code() == codes.Unauthenticated {
+			e.Decision = DecisionDeny
+		}
+	}
+
+	if err := a.logger.Log(e); err != nil {
+		log.Printf("failed to write audit entry for %s: %v", e.Method, err)
+	}
+}
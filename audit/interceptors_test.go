@@ -0,0 +1,104 @@
+package audit
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+type memoryLogger struct {
+	entries []Entry
+}
+
+func (m *memoryLogger) Log(e Entry) error {
+	m.entries = append(m.entries, e)
+	return nil
+}
+
+type InterceptorTestSuite struct {
+	suite.Suite
+	logger  *memoryLogger
+	auditor *Auditor
+	ctx     context.Context
+}
+
+func (suite *InterceptorTestSuite) SetupTest() {
+	suite.logger = &memoryLogger{}
+	suite.auditor = NewAuditor(suite.logger)
+	suite.ctx = peer.NewContext(context.Background(), &peer.Peer{
+		Addr: &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 4242},
+	})
+}
+
+func (suite *InterceptorTestSuite) TestUnaryInterceptor() {
+	info := &grpc.UnaryServerInfo{FullMethod: "/JobRunnerService/StartJob"}
+	_, err := suite.auditor.UnaryInterceptor(suite.ctx, nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		SetPrincipal(ctx, "alice@CN=ca", "operator")
+		SetJob(ctx, "1234", "ls", []string{"-l"})
+		return nil, nil
+	})
+	suite.Require().NoError(err)
+
+	if assert.Len(suite.T(), suite.logger.entries, 1) {
+		e := suite.logger.entries[0]
+		assert.Equal(suite.T(), "alice@CN=ca", e.Principal)
+		assert.Equal(suite.T(), "operator", e.Role)
+		assert.Equal(suite.T(), "127.0.0.1:4242", e.Peer)
+		assert.Equal(suite.T(), "/JobRunnerService/StartJob", e.Method)
+		assert.Equal(suite.T(), "1234", e.JobId)
+		assert.Equal(suite.T(), "ls", e.Command)
+		assert.Equal(suite.T(), []string{"-l"}, e.Args)
+		assert.Equal(suite.T(), DecisionAllow, e.Decision)
+		assert.Equal(suite.T(), "OK", e.Outcome)
+	}
+}
+
+func (suite *InterceptorTestSuite) TestDeniedCall() {
+	info := &grpc.UnaryServerInfo{FullMethod: "/JobRunnerService/StopJob"}
+	_, err := suite.auditor.UnaryInterceptor(suite.ctx, nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, status.Error(codes.PermissionDenied, "role viewer cannot stop jobs")
+	})
+	assert.Error(suite.T(), err, "the handler's error should be returned unchanged")
+
+	if assert.Len(suite.T(), suite.logger.entries, 1) {
+		e := suite.logger.entries[0]
+		assert.Equal(suite.T(), DecisionDeny, e.Decision)
+		assert.Equal(suite.T(), "PermissionDenied", e.Outcome)
+		assert.Equal(suite.T(), "role viewer cannot stop jobs", e.Error)
+	}
+}
+
+type mockStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (m *mockStream) Context() context.Context {
+	return m.ctx
+}
+
+func (suite *InterceptorTestSuite) TestCancelledStream() {
+	info := &grpc.StreamServerInfo{FullMethod: "/JobRunnerService/StreamJobOutput"}
+	err := suite.auditor.StreamInterceptor(nil, &mockStream{ctx: suite.ctx}, info, func(srv interface{}, stream grpc.ServerStream) error {
+		SetJob(stream.Context(), "1234", "", nil)
+		return context.Canceled
+	})
+	assert.Equal(suite.T(), context.Canceled, err)
+
+	if assert.Len(suite.T(), suite.logger.entries, 1) {
+		assert.Equal(suite.T(), "1234", suite.logger.entries[0].JobId)
+		assert.Equal(suite.T(), "Canceled", suite.logger.entries[0].Outcome)
+		assert.Equal(suite.T(), DecisionAllow, suite.logger.entries[0].Decision)
+	}
+}
+
+func TestInterceptorTestSuite(t *testing.T) {
+	suite.Run(t, new(InterceptorTestSuite))
+}
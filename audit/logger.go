@@ -0,0 +1,212 @@
+package audit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Logger writes audit entries.
+type Logger interface {
+	Log(e Entry) error
+}
+
+// FileLogger appends entries to a file as JSON lines. Once the file grows past
+// MaxBytes it is rotated to path.1, path.1 to path.2 and so on, keeping at
+// most MaxBackups old files.
+type FileLogger struct {
+	path       string
+	maxBytes   int64
+	maxBackups int
+	hashChain  bool
+
+	mu       *sync.Mutex
+	f        *os.File
+	size     int64
+	prevHash string
+}
+
+// FileLoggerOptions configures a FileLogger. A zero MaxBytes disables
+// rotation.
+type FileLoggerOptions struct {
+	MaxBytes   int64
+	MaxBackups int
+	// HashChain stores the SHA-256 of every entry, including the previous
+	// entry's hash, so that edited or removed lines can be detected.
+	HashChain bool
+}
+
+// NewFileLogger opens path for appending, creating it and its directory if
+// needed. With hash chaining enabled the chain continues from the last entry
+// already in the file.
+func NewFileLogger(path string, opts FileLoggerOptions) (*FileLogger, error) {
+	l := &FileLogger{
+		path:       path,
+		maxBytes:   opts.MaxBytes,
+		maxBackups: opts.MaxBackups,
+		hashChain:  opts.HashChain,
+		mu:         &sync.Mutex{},
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+
+	if l.hashChain {
+		prevHash, err := lastHash(l.Files())
+		if err != nil {
+			l.f.Close()
+			return nil, err
+		}
+		l.prevHash = prevHash
+	}
+
+	return l, nil
+}
+
+// Log appends e to the file, rotating it first if it is full.
+func (l *FileLogger) Log(e Entry) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.hashChain {
+		e.PrevHash = l.prevHash
+		hash, err := hashEntry(e)
+		if err != nil {
+			return err
+		}
+		e.Hash = hash
+	}
+
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	b = append(b, '\n')
+
+	if l.maxBytes > 0 && l.size > 0 && l.size+int64(len(b)) > l.maxBytes {
+		if err := l.rotate(); err != nil {
+			return err
+		}
+	}
+
+	n, err := l.f.Write(b)
+	l.size += int64(n)
+	if err != nil {
+		return err
+	}
+
+	l.prevHash = e.Hash
+	return nil
+}
+
+// Close closes the underlying file.
+func (l *FileLogger) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.f.Close()
+}
+
+// Files returns the log's files from oldest to newest.
+func (l *FileLogger) Files() []string {
+	return files(l.path, l.maxBackups)
+}
+
+func (l *FileLogger) open() error {
+	f, err := os.OpenFile(l.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	l.f = f
+	l.size = info.Size()
+	return nil
+}
+
+// rotate shifts every backup up by one, dropping the oldest, and starts a new
+// file. Callers must hold l.mu.
+func (l *FileLogger) rotate() error {
+	if err := l.f.Close(); err != nil {
+		return err
+	}
+
+	if l.maxBackups > 0 {
+		for i := l.maxBackups - 1; i > 0; i-- {
+			if err := os.Rename(backupPath(l.path, i), backupPath(l.path, i+1)); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+		if err := os.Rename(l.path, backupPath(l.path, 1)); err != nil {
+			return err
+		}
+	} else if err := os.Remove(l.path); err != nil {
+		return err
+	}
+
+	return l.open()
+}
+
+func backupPath(path string, i int) string {
+	return fmt.Sprintf("%s.%d", path, i)
+}
+
+// files lists path's backups from oldest to newest followed by path itself,
+// skipping any that don't exist.
+func files(path string, maxBackups int) []string {
+	var paths []string
+	for i := maxBackups; i > 0; i-- {
+		if _, err := os.Stat(backupPath(path, i)); err == nil {
+			paths = append(paths, backupPath(path, i))
+		}
+	}
+	if _, err := os.Stat(path); err == nil {
+		paths = append(paths, path)
+	}
+	return paths
+}
+
+// hashEntry returns the hex SHA-256 of e's JSON encoding without its own hash.
+func hashEntry(e Entry) (string, error) {
+	e.Hash = ""
+	b, err := json.Marshal(e)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// lastHash returns the hash of the newest entry in paths, which are ordered
+// oldest first.
+func lastHash(paths []string) (string, error) {
+	for i := len(paths) - 1; i >= 0; i-- {
+		found := false
+		hash := ""
+		err := scanFile(paths[i], func(e Entry) error {
+			found = true
+			hash = e.Hash
+			return nil
+		})
+		if err != nil {
+			return "", err
+		}
+		if found {
+			return hash, nil
+		}
+	}
+	return "", nil
+}
@@ -0,0 +1,143 @@
+package audit
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type LoggerTestSuite struct {
+	suite.Suite
+	dir  string
+	path string
+}
+
+func (suite *LoggerTestSuite) SetupTest() {
+	dir, err := ioutil.TempDir("", "audit")
+	suite.Require().NoError(err)
+	suite.dir = dir
+	suite.path = filepath.Join(dir, "audit.jsonl")
+}
+
+func (suite *LoggerTestSuite) TearDownTest() {
+	os.RemoveAll(suite.dir)
+}
+
+func (suite *LoggerTestSuite) entry(principal string, method string) Entry {
+	return Entry{
+		Time:      time.Now().UTC(),
+		Principal: principal,
+		Method:    method,
+		Decision:  DecisionAllow,
+		Outcome:   "OK",
+	}
+}
+
+func (suite *LoggerTestSuite) TestQuery() {
+	l, err := NewFileLogger(suite.path, FileLoggerOptions{})
+	suite.Require().NoError(err)
+	defer l.Close()
+
+	old := suite.entry("alice@CN=ca", "/JobRunnerService/StartJob")
+	old.Time = time.Now().Add(-time.Hour).UTC()
+	suite.Require().NoError(l.Log(old))
+	for _, e := range []Entry{
+		suite.entry("alice@CN=ca", "/JobRunnerService/StopJob"),
+		suite.entry("bob@CN=ca", "/JobRunnerService/StartJob"),
+		suite.entry("alice@CN=ca", "/JobRunnerService/StartJob"),
+	} {
+		suite.Require().NoError(l.Log(e))
+	}
+
+	entries, err := Query(l.Files(), Filter{Principal: "alice@CN=ca"})
+	suite.Require().NoError(err)
+	assert.Len(suite.T(), entries, 3)
+
+	entries, err = Query(l.Files(), Filter{Method: "StartJob"})
+	suite.Require().NoError(err)
+	assert.Len(suite.T(), entries, 3, "methods should match by their short name")
+
+	entries, err = Query(l.Files(), Filter{Method: "StartJob", Since: time.Now().Add(-time.Minute)})
+	suite.Require().NoError(err)
+	assert.Len(suite.T(), entries, 2)
+
+	entries, err = Query(l.Files(), Filter{Limit: 1})
+	suite.Require().NoError(err)
+	if assert.Len(suite.T(), entries, 1) {
+		assert.Equal(suite.T(), "alice@CN=ca", entries[0].Principal, "limit should keep the most recent entries")
+		assert.Equal(suite.T(), "/JobRunnerService/StartJob", entries[0].Method)
+	}
+}
+
+func (suite *LoggerTestSuite) TestRotation() {
+	l, err := NewFileLogger(suite.path, FileLoggerOptions{MaxBytes: 300, MaxBackups: 2})
+	suite.Require().NoError(err)
+	defer l.Close()
+
+	for i := 0; i < 20; i++ {
+		suite.Require().NoError(l.Log(suite.entry("alice@CN=ca", "/JobRunnerService/GetJobInfo")))
+	}
+
+	assert.Equal(suite.T(), []string{suite.path + ".2", suite.path + ".1", suite.path}, l.Files())
+	_, err = os.Stat(suite.path + ".3")
+	assert.True(suite.T(), os.IsNotExist(err), "only max_backups old files should be kept")
+
+	for _, path := range l.Files() {
+		info, err := os.Stat(path)
+		suite.Require().NoError(err)
+		assert.LessOrEqual(suite.T(), info.Size(), int64(300))
+	}
+}
+
+func (suite *LoggerTestSuite) TestHashChain() {
+	opts := FileLoggerOptions{MaxBytes: 1000, MaxBackups: 5, HashChain: true}
+	l, err := NewFileLogger(suite.path, opts)
+	suite.Require().NoError(err)
+	for i := 0; i < 5; i++ {
+		suite.Require().NoError(l.Log(suite.entry("alice@CN=ca", "/JobRunnerService/StartJob")))
+	}
+	suite.Require().NoError(l.Close())
+
+	l, err = NewFileLogger(suite.path, opts)
+	suite.Require().NoError(err)
+	for i := 0; i < 5; i++ {
+		suite.Require().NoError(l.Log(suite.entry("bob@CN=ca", "/JobRunnerService/StartJob")))
+	}
+	suite.Require().NoError(l.Close())
+
+	assert.Greater(suite.T(), len(l.Files()), 1, "the log should have rotated")
+	assert.NoError(suite.T(), Verify(l.Files()), "chain should continue across restarts and rotations")
+
+	b, err := ioutil.ReadFile(suite.path)
+	suite.Require().NoError(err)
+	suite.Require().NoError(ioutil.WriteFile(suite.path, []byte(strings.Replace(string(b), "bob", "eve", 1)), 0600))
+
+	err = Verify(l.Files())
+	assert.IsType(suite.T(), &ErrChainBroken{}, err, "edited entries should be detected")
+}
+
+func (suite *LoggerTestSuite) TestRemovedEntryIsDetected() {
+	l, err := NewFileLogger(suite.path, FileLoggerOptions{HashChain: true})
+	suite.Require().NoError(err)
+	for i := 0; i < 3; i++ {
+		suite.Require().NoError(l.Log(suite.entry("alice@CN=ca", "/JobRunnerService/StartJob")))
+	}
+	suite.Require().NoError(l.Close())
+
+	b, err := ioutil.ReadFile(suite.path)
+	suite.Require().NoError(err)
+	lines := strings.SplitAfter(string(b), "\n")
+	suite.Require().NoError(ioutil.WriteFile(suite.path, []byte(lines[0]+lines[2]), 0600))
+
+	assert.IsType(suite.T(), &ErrChainBroken{}, Verify([]string{suite.path}))
+}
+
+func TestLoggerTestSuite(t *testing.T) {
+	suite.Run(t, new(LoggerTestSuite))
+}
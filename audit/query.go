@@ -0,0 +1,124 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// maxLineSize bounds a single audit entry, mostly to cap very long argument lists.
+const maxLineSize = 1024 * 1024
+
+// Filter selects audit entries. Zero fields match everything.
+type Filter struct {
+	Principal string
+	JobId     string
+	// Method matches full method names or just the RPC's name, e.g. "StartJob".
+	Method string
+	Since  time.Time
+	// Limit keeps only the most recent entries.
+	Limit int
+}
+
+func (f Filter) matches(e Entry) bool {
+	if f.Principal != "" && e.Principal != f.Principal {
+		return false
+	}
+	if f.JobId != "" && e.JobId != f.JobId {
+		return false
+	}
+	if f.Method != "" && e.Method != f.Method && !strings.HasSuffix(e.Method, "/"+f.Method) {
+		return false
+	}
+	if !f.Since.IsZero() && e.Time.Before(f.Since) {
+		return false
+	}
+	return true
+}
+
+// Query returns the entries in paths, oldest first, that match filter.
+func Query(paths []string, filter Filter) ([]Entry, error) {
+	var entries []Entry
+	err := scan(paths, func(e Entry) error {
+		if filter.matches(e) {
+			entries = append(entries, e)
+			if filter.Limit > 0 && len(entries) > filter.Limit {
+				entries = entries[1:]
+			}
+		}
+		return nil
+	})
+	return entries, err
+}
+
+// ErrChainBroken reports the first entry whose hash does not match its
+// contents or the entry before it.
+type ErrChainBroken struct {
+	path string
+	line int
+}
+
+func (e *ErrChainBroken) Error() string {
+	return fmt.Sprintf("hash chain broken at %s:%d", e.path, e.line)
+}
+
+// Verify checks the hash chain across paths, which must be ordered oldest
+// first. The first entry's previous hash is trusted as is since older files
+// may have been rotated away.
+func Verify(paths []string) error {
+	first := true
+	prevHash := ""
+	for _, path := range paths {
+		line := 0
+		err := scan([]string{path}, func(e Entry) error {
+			line++
+			hash, err := hashEntry(e)
+			if err != nil {
+				return err
+			}
+			if e.Hash == "" || hash != e.Hash || (!first && e.PrevHash != prevHash) {
+				return &ErrChainBroken{path: path, line: line}
+			}
+			first = false
+			prevHash = e.Hash
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func scan(paths []string, f func(Entry) error) error {
+	for _, path := range paths {
+		if err := scanFile(path, f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func scanFile(path string, f func(Entry) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), maxLineSize)
+	for scanner.Scan() {
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		if err := f(e); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,268 @@
+package auth
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Effect is the outcome of a command policy rule.
+type Effect string
+
+const (
+	EffectAllow Effect = "allow"
+	EffectDeny  Effect = "deny"
+)
+
+// CommandRule allows or denies commands for a set of principals. Every
+// non-empty matcher has to match for the rule to apply:
+//   - Principals are glob patterns on the identity's name, e.g. spiffe://example.org/ops/*
+//   - Issuers are glob patterns on the distinguished name of the identity's CA,
+//     e.g. CN=ops-ca, since two CAs can issue the same name
+//   - Roles lists the roles the rule applies to
+//   - Commands are glob patterns on the command's canonical path, see
+//     ResolveCommand, e.g. /usr/bin/*
+//   - Args are regular expressions, the rule applies if any argument matches any of them
+//
+// Globs follow path.Match, so * does not match a '/'. Leave a matcher empty
+// to match everything.
+type CommandRule struct {
+	Name       string   `yaml:"name"`
+	Principals []string `yaml:"principals"`
+	Issuers    []string `yaml:"issuers"`
+	Roles      []Role   `yaml:"roles"`
+	Commands   []string `yaml:"commands"`
+	Args       []string `yaml:"args"`
+	Effect     Effect   `yaml:"effect"`
+	Reason     string   `yaml:"reason"`
+
+	args []*regexp.Regexp
+}
+
+// CommandPolicy is an ordered list of rules where the first matching rule
+// decides. Default applies when no rule matches. In DryRun mode decisions are
+// only logged and every command is allowed.
+type CommandPolicy struct {
+	Default Effect        `yaml:"default"`
+	DryRun  bool          `yaml:"dry_run"`
+	Rules   []CommandRule `yaml:"rules"`
+}
+
+// CommandDecision explains why a command was allowed or denied.
+type CommandDecision struct {
+	Allowed bool
+	// Path is the command's canonical path from ResolveCommand, which is the
+	// path the command has to be run from for the decision to hold.
+	Path   string
+	Rule   string
+	Reason string
+	DryRun bool
+}
+
+// DefaultCommandPolicy allows every command.
+func DefaultCommandPolicy() CommandPolicy {
+	return CommandPolicy{Default: EffectAllow}
+}
+
+// LoadCommandPolicy reads a YAML command policy file. Unknown fields, effects,
+// roles and invalid patterns are rejected.
+func LoadCommandPolicy(filePath string) (CommandPolicy, error) {
+	b, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return CommandPolicy{}, err
+	}
+
+	policy := DefaultCommandPolicy()
+	dec := yaml.NewDecoder(bytes.NewReader(b))
+	dec.KnownFields(true)
+	if err := dec.Decode(&policy); err != nil {
+		return CommandPolicy{}, fmt.Errorf("parsing %s: %w", filePath, err)
+	}
+
+	if err := policy.compile(); err != nil {
+		return CommandPolicy{}, fmt.Errorf("validating %s: %w", filePath, err)
+	}
+
+	return policy, nil
+}
+
+// compile validates the policy and compiles its argument patterns.
+func (p *CommandPolicy) compile() error {
+	if p.Default != EffectAllow && p.Default != EffectDeny {
+		return fmt.Errorf("default: unknown effect %q", p.Default)
+	}
+
+	for i := range p.Rules {
+		rule := &p.Rules[i]
+		if rule.Effect != EffectAllow && rule.Effect != EffectDeny {
+			return fmt.Errorf("rules[%d]: unknown effect %q", i, rule.Effect)
+		}
+		for _, role := range rule.Roles {
+			if !role.Valid() {
+				return fmt.Errorf("rules[%d]: unknown role %q", i, role)
+			}
+		}
+		patterns := append(append([]string{}, rule.Principals...), rule.Issuers...)
+		for _, pattern := range append(patterns, rule.Commands...) {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("rules[%d]: invalid pattern %q: %w", i, pattern, err)
+			}
+		}
+		rule.args = nil
+		for _, pattern := range rule.Args {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return fmt.Errorf("rules[%d]: invalid argument pattern %q: %w", i, pattern, err)
+			}
+			rule.args = append(rule.args, re)
+		}
+	}
+
+	return nil
+}
+
+func (r *CommandRule) matches(id Identity, role Role, commandPath string, args []string) bool {
+	if len(r.Principals) > 0 && !matchesAnyGlob(r.Principals, id.Name) {
+		return false
+	}
+
+	if len(r.Issuers) > 0 && !matchesAnyGlob(r.Issuers, id.Issuer) {
+		return false
+	}
+
+	if len(r.Roles) > 0 {
+		found := false
+		for _, candidate := range r.Roles {
+			found = found || candidate == role
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if len(r.Commands) > 0 && !matchesAnyGlob(r.Commands, commandPath) {
+		return false
+	}
+
+	if len(r.args) > 0 {
+		for _, arg := range args {
+			for _, re := range r.args {
+				if re.MatchString(arg) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+
+	return true
+}
+
+func matchesAnyGlob(patterns []string, value string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, value); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// PolicyEngine decides whether a principal may run a command.
+type PolicyEngine struct {
+	mu     *sync.RWMutex
+	policy CommandPolicy
+}
+
+// NewPolicyEngine creates a PolicyEngine that evaluates policy.
+func NewPolicyEngine(policy CommandPolicy) (*PolicyEngine, error) {
+	if err := policy.compile(); err != nil {
+		return nil, err
+	}
+	return &PolicyEngine{mu: &sync.RWMutex{}, policy: policy}, nil
+}
+
+// SetPolicy validates and replaces the command policy.
+func (e *PolicyEngine) SetPolicy(policy CommandPolicy) error {
+	if err := policy.compile(); err != nil {
+		return err
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.policy = policy
+	return nil
+}
+
+// Evaluate decides whether the principal may run command with args. The
+// command is matched on its canonical path, which the job has to be run from.
+// Commands with a relative path are denied even in dry-run mode.
+func (e *PolicyEngine) Evaluate(id Identity, role Role, command string, args []string) CommandDecision {
+	e.mu.RLock()
+	policy := e.policy
+	e.mu.RUnlock()
+
+	commandPath, err := ResolveCommand(command)
+	if err != nil {
+		log.Printf("command policy: denied principal=%s command=%q: %s", id, command, err.Error())
+		return CommandDecision{Path: command, Reason: err.Error(), DryRun: policy.DryRun}
+	}
+
+	decision := evaluate(policy, id, role, commandPath, args)
+	decision.DryRun = policy.DryRun
+
+	if policy.DryRun {
+		log.Printf("command policy (dry-run): principal=%s command=%q path=%q allowed=%t rule=%q reason=%q",
+			id, command, decision.Path, decision.Allowed, decision.Rule, decision.Reason)
+		decision.Allowed = true
+	} else if !decision.Allowed {
+		log.Printf("command policy: denied principal=%s command=%q path=%q rule=%q reason=%q",
+			id, command, decision.Path, decision.Rule, decision.Reason)
+	}
+
+	return decision
+}
+
+// ResolveCommand returns the canonical path of a command: looked up on the
+// server's PATH if it has no slash, cleaned, and with every symlink followed.
+// Matching on it keeps a rule from being bypassed by spelling the same binary
+// differently, like /usr//bin/rm, /usr/bin/../bin/rm or /bin/rm. Relative
+// paths depend on the server's working dir and are rejected. A command that
+// can't be found is returned cleaned, it fails when it's run.
+func ResolveCommand(command string) (string, error) {
+	if strings.Contains(command, "/") && !filepath.IsAbs(command) {
+		return "", fmt.Errorf("command %s is a relative path, use an absolute path or a name on the PATH", command)
+	}
+
+	commandPath, err := exec.LookPath(command)
+	if err != nil {
+		return filepath.Clean(command), nil
+	}
+	return filepath.EvalSymlinks(filepath.Clean(commandPath))
+}
+
+func evaluate(policy CommandPolicy, id Identity, role Role, commandPath string, args []string) CommandDecision {
+	for _, rule := range policy.Rules {
+		if rule.matches(id, role, commandPath, args) {
+			return CommandDecision{
+				Allowed: rule.Effect == EffectAllow,
+				Path:    commandPath,
+				Rule:    rule.Name,
+				Reason:  rule.Reason,
+			}
+		}
+	}
+
+	return CommandDecision{
+		Allowed: policy.Default == EffectAllow,
+		Path:    commandPath,
+		Reason:  fmt.Sprintf("no rule matched, default is %s", policy.Default),
+	}
+}
@@ -0,0 +1,151 @@
+package auth
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type PolicyEngineTestSuite struct {
+	suite.Suite
+	engine *PolicyEngine
+	lsPath string
+}
+
+func (suite *PolicyEngineTestSuite) SetupTest() {
+	lsPath, err := ResolveCommand("ls")
+	suite.Require().NoError(err)
+	suite.lsPath = lsPath
+
+	suite.engine, err = NewPolicyEngine(CommandPolicy{
+		Default: EffectDeny,
+		Rules: []CommandRule{
+			{Name: "admins", Roles: []Role{RoleAdmin}, Effect: EffectAllow},
+			{Name: "no-recursive-ls", Commands: []string{lsPath}, Args: []string{"^-.*R"}, Effect: EffectDeny, Reason: "too slow"},
+			{Name: "ops", Principals: []string{"spiffe://example.org/ops/*"}, Effect: EffectAllow},
+			{Name: "ls", Commands: []string{lsPath}, Effect: EffectAllow},
+		},
+	})
+	suite.Require().NoError(err)
+}
+
+func (suite *PolicyEngineTestSuite) TestEvaluate() {
+	alice := Identity{Issuer: "CN=ca", Name: "alice"}
+	ops := Identity{Issuer: "CN=ca", Name: "spiffe://example.org/ops/bob"}
+
+	cases := []struct {
+		name    string
+		id      Identity
+		role    Role
+		command string
+		args    []string
+		allowed bool
+		rule    string
+	}{
+		{"admin can run anything", alice, RoleAdmin, "rm", []string{"-rf", "/tmp/x"}, true, "admins"},
+		{"resolved path is matched", alice, RoleOperator, "ls", []string{"-l"}, true, "ls"},
+		{"argument pattern denies", alice, RoleOperator, "ls", []string{"-l", "-aR"}, false, "no-recursive-ls"},
+		{"principal glob allows", ops, RoleOperator, "rm", []string{"/tmp/x"}, true, "ops"},
+		{"default denies", alice, RoleOperator, "rm", []string{"/tmp/x"}, false, ""},
+		{"unresolvable command falls through to default", alice, RoleOperator, "does-not-exist", nil, false, ""},
+	}
+
+	for _, tc := range cases {
+		decision := suite.engine.Evaluate(tc.id, tc.role, tc.command, tc.args)
+		assert.Equal(suite.T(), tc.allowed, decision.Allowed, tc.name)
+		assert.Equal(suite.T(), tc.rule, decision.Rule, tc.name)
+	}
+
+	decision := suite.engine.Evaluate(alice, RoleOperator, "ls", []string{"-R"})
+	assert.Equal(suite.T(), suite.lsPath, decision.Path, "it should report the resolved path")
+	assert.Equal(suite.T(), "too slow", decision.Reason, "it should report the rule's reason")
+}
+
+func (suite *PolicyEngineTestSuite) TestPathSpellings() {
+	rmPath, err := ResolveCommand("rm")
+	suite.Require().NoError(err)
+	suite.Require().NoError(suite.engine.SetPolicy(CommandPolicy{
+		Default: EffectAllow,
+		Rules:   []CommandRule{{Name: "no-rm", Commands: []string{rmPath}, Effect: EffectDeny}},
+	}))
+
+	dir, err := ioutil.TempDir("", "commands")
+	suite.Require().NoError(err)
+	defer os.RemoveAll(dir)
+	link := filepath.Join(dir, "remove")
+	suite.Require().NoError(os.Symlink(rmPath, link))
+
+	alice := Identity{Issuer: "CN=ca", Name: "alice"}
+	parent := filepath.Dir(rmPath)
+	for _, command := range []string{
+		"rm",
+		rmPath,
+		parent + "//rm",
+		parent + "/../" + filepath.Base(parent) + "/rm",
+		link,
+	} {
+		decision := suite.engine.Evaluate(alice, RoleOperator, command, nil)
+		assert.False(suite.T(), decision.Allowed, command)
+		assert.Equal(suite.T(), rmPath, decision.Path, "%s should be run from its canonical path", command)
+	}
+
+	for _, command := range []string{"../../usr/bin/rm", "./rm", "bin/rm"} {
+		decision := suite.engine.Evaluate(alice, RoleOperator, command, nil)
+		assert.False(suite.T(), decision.Allowed, "relative path %s should be denied", command)
+	}
+
+	suite.Require().NoError(suite.engine.SetPolicy(CommandPolicy{Default: EffectAllow, DryRun: true}))
+	assert.False(suite.T(), suite.engine.Evaluate(alice, RoleOperator, "./rm", nil).Allowed, "dry-run shouldn't allow relative paths")
+}
+
+func (suite *PolicyEngineTestSuite) TestIssuers() {
+	suite.Require().NoError(suite.engine.SetPolicy(CommandPolicy{
+		Default: EffectDeny,
+		Rules:   []CommandRule{{Name: "ops", Principals: []string{"alice"}, Issuers: []string{"CN=ops-ca"}, Effect: EffectAllow}},
+	}))
+
+	assert.True(suite.T(), suite.engine.Evaluate(Identity{Issuer: "CN=ops-ca", Name: "alice"}, RoleOperator, "ls", nil).Allowed)
+	assert.False(suite.T(), suite.engine.Evaluate(Identity{Issuer: "CN=other-ca", Name: "alice"}, RoleOperator, "ls", nil).Allowed,
+		"the same name from another CA shouldn't match")
+}
+
+func (suite *PolicyEngineTestSuite) TestDryRun() {
+	assert.NoError(suite.T(), suite.engine.SetPolicy(CommandPolicy{Default: EffectDeny, DryRun: true}))
+	decision := suite.engine.Evaluate(Identity{Issuer: "CN=ca", Name: "alice"}, RoleOperator, "ls", nil)
+	assert.True(suite.T(), decision.Allowed, "dry-run should allow everything")
+	assert.True(suite.T(), decision.DryRun)
+}
+
+func (suite *PolicyEngineTestSuite) TestLoadCommandPolicy() {
+	dir, err := ioutil.TempDir("", "commands")
+	suite.Require().NoError(err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "commands.yaml")
+
+	suite.Require().NoError(ioutil.WriteFile(path, []byte("rules:\n  - commands: [/bin/ls]\n    args: ['^-l$']\n    effect: deny\n"), 0600))
+	policy, err := LoadCommandPolicy(path)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), EffectAllow, policy.Default, "default should default to allow")
+
+	for _, contents := range []string{
+		"default: maybe\n",
+		"rules:\n  - effect: permit\n",
+		"rules:\n  - roles: [root]\n    effect: allow\n",
+		"rules:\n  - args: ['(']\n    effect: allow\n",
+		"rules:\n  - commands: ['[']\n    effect: allow\n",
+		"rules:\n  - issuers: ['[']\n    effect: allow\n",
+		"rule: []\n",
+	} {
+		suite.Require().NoError(ioutil.WriteFile(path, []byte(contents), 0600))
+		_, err = LoadCommandPolicy(path)
+		assert.Error(suite.T(), err, contents)
+	}
+}
+
+func TestPolicyEngineTestSuite(t *testing.T) {
+	suite.Run(t, new(PolicyEngineTestSuite))
+}
@@ -0,0 +1,191 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"sync"
+	"time"
+)
+
+// RevocationChecker rejects client certificates whose serial numbers are
+// listed in one or more CRL files. Every CRL must be signed by a CA from the
+// configured CA bundle. A CRL whose next update has passed is stale: it is
+// logged and kept in use, or with SetRejectStale every certificate from its
+// issuer is rejected until a fresh one is loaded.
+type RevocationChecker struct {
+	mu          *sync.RWMutex
+	caPath      string
+	paths       []string
+	revoked     map[string]bool
+	nextUpdate  map[string]time.Time
+	rejectStale bool
+}
+
+// NewRevocationChecker loads the given PEM or DER encoded CRL files for the
+// first time.
+func NewRevocationChecker(caPath string, paths []string) (*RevocationChecker, error) {
+	rc := &RevocationChecker{mu: &sync.RWMutex{}}
+	if err := rc.Reload(caPath, paths); err != nil {
+		return nil, err
+	}
+	return rc, nil
+}
+
+// Reload reads the CRL files and swaps in their revoked serial numbers. The
+// previous list is kept if any file fails to load.
+func (rc *RevocationChecker) Reload(caPath string, paths []string) error {
+	cas, err := loadCertificates(caPath)
+	if err != nil {
+		return err
+	}
+
+	revoked := make(map[string]bool)
+	nextUpdate := make(map[string]time.Time)
+	for _, path := range paths {
+		crl, err := loadCRL(path)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+
+		if err := verifyCRL(crl, cas); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+
+		if !crl.NextUpdate.IsZero() && time.Now().After(crl.NextUpdate) {
+			log.Printf("crl %s from %s is stale, its next update was due at %s", path, crl.Issuer.String(), crl.NextUpdate.Format(time.RFC3339))
+		}
+		// with several CRLs from one issuer the one that goes stale first wins
+		issuer := crl.Issuer.String()
+		if due, ok := nextUpdate[issuer]; !crl.NextUpdate.IsZero() && (!ok || crl.NextUpdate.Before(due)) {
+			nextUpdate[issuer] = crl.NextUpdate
+		}
+		for _, entry := range crl.RevokedCertificateEntries {
+			revoked[revocationKey(crl.Issuer, entry.SerialNumber)] = true
+		}
+	}
+
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.caPath = caPath
+	rc.paths = paths
+	rc.revoked = revoked
+	rc.nextUpdate = nextUpdate
+	return nil
+}
+
+// SetRejectStale sets whether certificates whose issuer's CRL is stale are
+// rejected as if they were revoked.
+func (rc *RevocationChecker) SetRejectStale(reject bool) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.rejectStale = reject
+}
+
+// Refresh re-reads the currently configured CRL files.
+func (rc *RevocationChecker) Refresh() error {
+	rc.mu.RLock()
+	caPath, paths := rc.caPath, rc.paths
+	rc.mu.RUnlock()
+
+	return rc.Reload(caPath, paths)
+}
+
+// Watch reloads the CRL files every interval until ctx is cancelled. Failed
+// reloads are logged and the previous list stays in use.
+func (rc *RevocationChecker) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := rc.Refresh(); err != nil {
+				log.Printf("failed to reload crls: %v", err)
+			}
+		}
+	}
+}
+
+// IsRevoked checks if a certificate appears in any of the loaded CRLs, or if
+// its issuer's CRL is stale and stale CRLs are rejected.
+func (rc *RevocationChecker) IsRevoked(crt *x509.Certificate) bool {
+	rc.mu.RLock()
+	defer rc.mu.RUnlock()
+	if due, ok := rc.nextUpdate[crt.Issuer.String()]; ok && rc.rejectStale && time.Now().After(due) {
+		return true
+	}
+	return rc.revoked[revocationKey(crt.Issuer, crt.SerialNumber)]
+}
+
+// revocationKey scopes a serial number to its issuer, since serials are only
+// unique within a single CA.
+func revocationKey(issuer pkix.Name, serial *big.Int) string {
+	return issuer.String() + "/" + serial.String()
+}
+
+// loadCRL reads a PEM or DER encoded CRL.
+func loadCRL(path string) (*x509.RevocationList, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if block, _ := pem.Decode(bytes.TrimSpace(b)); block != nil {
+		if block.Type != "X509 CRL" {
+			return nil, fmt.Errorf("expected an X509 CRL, found %s", block.Type)
+		}
+		b = block.Bytes
+	}
+	return x509.ParseRevocationList(b)
+}
+
+// verifyCRL checks that the CRL was signed by one of the trusted CAs.
+func verifyCRL(crl *x509.RevocationList, cas []*x509.Certificate) error {
+	for _, ca := range cas {
+		if ca.Subject.String() != crl.Issuer.String() {
+			continue
+		}
+		if err := crl.CheckSignatureFrom(ca); err == nil {
+			return nil
+		}
+	}
+	return fmt.Errorf("crl issued by %s is not signed by a trusted CA", crl.Issuer.String())
+}
+
+// loadCertificates reads every certificate in a PEM bundle.
+func loadCertificates(path string) ([]*x509.Certificate, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, b = pem.Decode(bytes.TrimSpace(b))
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		crt, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, crt)
+	}
+
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("no certificates found in %s", path)
+	}
+	return certs, nil
+}
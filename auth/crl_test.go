@@ -0,0 +1,200 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestCA(t *testing.T, name string) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	assert.NoError(t, err)
+
+	return &testCA{cert: cert, key: key}
+}
+
+func (ca *testCA) issue(t *testing.T, serial int64, template *x509.Certificate) *x509.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+
+	template.SerialNumber = big.NewInt(serial)
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(time.Hour)
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	assert.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	assert.NoError(t, err)
+	return cert
+}
+
+func (ca *testCA) crl(t *testing.T, serials ...int64) []byte {
+	return ca.crlUntil(t, time.Now().Add(time.Hour), serials...)
+}
+
+// crlUntil creates a CRL whose next update is due at nextUpdate.
+func (ca *testCA) crlUntil(t *testing.T, nextUpdate time.Time, serials ...int64) []byte {
+	var revoked []pkix.RevokedCertificate
+	for _, serial := range serials {
+		revoked = append(revoked, pkix.RevokedCertificate{SerialNumber: big.NewInt(serial), RevocationTime: time.Now()})
+	}
+	der, err := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+		Number:              big.NewInt(1),
+		ThisUpdate:          nextUpdate.Add(-2 * time.Hour),
+		NextUpdate:          nextUpdate,
+		RevokedCertificates: revoked,
+	}, ca.cert, ca.key)
+	assert.NoError(t, err)
+	return der
+}
+
+func (ca *testCA) pem() []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.cert.Raw})
+}
+
+type RevocationTestSuite struct {
+	suite.Suite
+	dir string
+	ca  *testCA
+}
+
+func (suite *RevocationTestSuite) SetupTest() {
+	dir, err := ioutil.TempDir("", "crl")
+	suite.Require().NoError(err)
+	suite.dir = dir
+	suite.ca = newTestCA(suite.T(), "ca")
+}
+
+func (suite *RevocationTestSuite) TearDownTest() {
+	os.RemoveAll(suite.dir)
+}
+
+func (suite *RevocationTestSuite) writeFile(name string, b []byte) string {
+	path := filepath.Join(suite.dir, name)
+	suite.Require().NoError(ioutil.WriteFile(path, b, 0600))
+	return path
+}
+
+func (suite *RevocationTestSuite) TestIsRevoked() {
+	caPath := suite.writeFile("ca.pem", suite.ca.pem())
+	derPath := suite.writeFile("der.crl", suite.ca.crl(suite.T(), 2))
+	pemPath := suite.writeFile("pem.crl", pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: suite.ca.crl(suite.T(), 3)}))
+
+	rc, err := NewRevocationChecker(caPath, []string{derPath, pemPath})
+	assert.NoError(suite.T(), err, "it should load DER and PEM crls")
+
+	assert.True(suite.T(), rc.IsRevoked(suite.ca.issue(suite.T(), 2, &x509.Certificate{})), "serial from DER crl should be revoked")
+	assert.True(suite.T(), rc.IsRevoked(suite.ca.issue(suite.T(), 3, &x509.Certificate{})), "serial from PEM crl should be revoked")
+	assert.False(suite.T(), rc.IsRevoked(suite.ca.issue(suite.T(), 4, &x509.Certificate{})), "unlisted serial should not be revoked")
+
+	other := newTestCA(suite.T(), "other")
+	assert.False(suite.T(), rc.IsRevoked(other.issue(suite.T(), 2, &x509.Certificate{})), "same serial from another CA should not be revoked")
+}
+
+func (suite *RevocationTestSuite) TestUntrustedCRL() {
+	caPath := suite.writeFile("ca.pem", suite.ca.pem())
+	other := newTestCA(suite.T(), "ca")
+	crlPath := suite.writeFile("other.crl", other.crl(suite.T(), 2))
+
+	_, err := NewRevocationChecker(caPath, []string{crlPath})
+	assert.Error(suite.T(), err, "crl signed by an unknown key should be rejected")
+}
+
+func (suite *RevocationTestSuite) TestReloadKeepsPreviousList() {
+	caPath := suite.writeFile("ca.pem", suite.ca.pem())
+	crlPath := suite.writeFile("ca.crl", suite.ca.crl(suite.T(), 2))
+
+	rc, err := NewRevocationChecker(caPath, []string{crlPath})
+	assert.NoError(suite.T(), err)
+
+	assert.Error(suite.T(), rc.Reload(caPath, []string{suite.writeFile("bad.crl", []byte("garbage"))}))
+	assert.True(suite.T(), rc.IsRevoked(suite.ca.issue(suite.T(), 2, &x509.Certificate{})), "failed reload should keep the previous list")
+}
+
+func (suite *RevocationTestSuite) TestStaleCRL() {
+	caPath := suite.writeFile("ca.pem", suite.ca.pem())
+	crlPath := suite.writeFile("ca.crl", suite.ca.crlUntil(suite.T(), time.Now().Add(-time.Minute), 2))
+
+	rc, err := NewRevocationChecker(caPath, []string{crlPath})
+	suite.Require().NoError(err, "a stale crl should still load")
+	valid := suite.ca.issue(suite.T(), 3, &x509.Certificate{})
+	assert.True(suite.T(), rc.IsRevoked(suite.ca.issue(suite.T(), 2, &x509.Certificate{})))
+	assert.False(suite.T(), rc.IsRevoked(valid), "a stale crl is only logged by default")
+
+	rc.SetRejectStale(true)
+	assert.True(suite.T(), rc.IsRevoked(valid), "certificates from the stale crl's issuer should be rejected")
+	other := newTestCA(suite.T(), "other")
+	assert.False(suite.T(), rc.IsRevoked(other.issue(suite.T(), 3, &x509.Certificate{})), "other issuers shouldn't be affected")
+
+	suite.writeFile("ca.crl", suite.ca.crl(suite.T(), 2))
+	suite.Require().NoError(rc.Refresh())
+	assert.False(suite.T(), rc.IsRevoked(valid), "a fresh crl should be trusted again")
+}
+
+func (suite *RevocationTestSuite) TestInterceptorRejectsRevokedCertificate() {
+	caPath := suite.writeFile("ca.pem", suite.ca.pem())
+	crlPath := suite.writeFile("ca.crl", suite.ca.crl(suite.T(), 2))
+	rc, err := NewRevocationChecker(caPath, []string{crlPath})
+	assert.NoError(suite.T(), err)
+
+	a := NewAuthenticator(WithRevocationChecker(rc))
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) { return nil, nil }
+	info := &grpc.UnaryServerInfo{FullMethod: "/JobRunnerService/StartJob"}
+
+	_, err = a.UnaryInterceptor(peerContext(suite.ca.issue(suite.T(), 2, &x509.Certificate{})), nil, info, handler)
+	s, _ := status.FromError(err)
+	assert.Equal(suite.T(), codes.Unauthenticated, s.Code(), "revoked certificate should be rejected")
+
+	_, err = a.UnaryInterceptor(peerContext(suite.ca.issue(suite.T(), 3, &x509.Certificate{Subject: pkix.Name{CommonName: "alice"}})), nil, info, handler)
+	assert.NoError(suite.T(), err, "valid certificate should be accepted")
+}
+
+func TestRevocationTestSuite(t *testing.T) {
+	suite.Run(t, new(RevocationTestSuite))
+}
+
+// peerContext mimics the context grpc creates for an mTLS connection.
+func peerContext(crt *x509.Certificate) context.Context {
+	return peer.NewContext(context.Background(), &peer.Peer{
+		AuthInfo: credentials.TLSInfo{
+			State: tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{crt}}},
+		},
+	})
+}
@@ -0,0 +1,79 @@
+package auth
+
+import (
+	"context"
+	"crypto/x509"
+	"fmt"
+	"strings"
+)
+
+// spiffeScheme is the URI scheme of SPIFFE IDs, e.g. spiffe://example.org/ops/alice.
+const spiffeScheme = "spiffe"
+
+type identityKey struct{}
+
+// Identity is the stable principal a client certificate authenticates as.
+// Unlike the certificate's serial number it survives re-issuing a cert to the
+// same user, and it is scoped to the issuing CA so that two CAs cannot issue
+// the same identity.
+type Identity struct {
+	// Issuer is the distinguished name of the CA that issued the certificate.
+	Issuer string
+	// Name is the certificate's SPIFFE ID if it has one, otherwise its
+	// subject common name.
+	Name string
+}
+
+// IdentityFromCertificate derives the identity of a verified client certificate.
+func IdentityFromCertificate(crt *x509.Certificate) (Identity, error) {
+	id := Identity{Issuer: crt.Issuer.String()}
+
+	for _, uri := range crt.URIs {
+		if uri.Scheme == spiffeScheme {
+			id.Name = uri.String()
+			return id, nil
+		}
+	}
+
+	if crt.Subject.CommonName == "" {
+		return Identity{}, fmt.Errorf("certificate has neither a SPIFFE ID nor a common name")
+	}
+
+	id.Name = crt.Subject.CommonName
+	return id, nil
+}
+
+// IsSpiffe checks if the identity is a SPIFFE ID.
+func (id Identity) IsSpiffe() bool {
+	return strings.HasPrefix(id.Name, spiffeScheme+"://")
+}
+
+// String returns the identity in the form name@issuer. Any '%' and '@' in the
+// name are percent-encoded so that the first '@' always separates the two.
+func (id Identity) String() string {
+	name := strings.ReplaceAll(id.Name, "%", "%25")
+	name = strings.ReplaceAll(name, "@", "%40")
+	return name + "@" + id.Issuer
+}
+
+// ParseIdentity parses an identity in the form returned by String.
+func ParseIdentity(s string) (Identity, error) {
+	i := strings.Index(s, "@")
+	if i < 0 {
+		return Identity{}, fmt.Errorf("identity %q has no issuer", s)
+	}
+	name := strings.ReplaceAll(s[:i], "%40", "@")
+	name = strings.ReplaceAll(name, "%25", "%")
+	return Identity{Name: name, Issuer: s[i+1:]}, nil
+}
+
+// NewContextWithIdentity returns a copy of ctx that carries the identity.
+func NewContextWithIdentity(ctx context.Context, id Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, id)
+}
+
+// IdentityFromContext returns the identity stored by the auth interceptors.
+func IdentityFromContext(ctx context.Context) (Identity, bool) {
+	id, ok := ctx.Value(identityKey{}).(Identity)
+	return id, ok
+}
@@ -0,0 +1,92 @@
+package auth
+
+import (
+	"context"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type IdentityTestSuite struct {
+	suite.Suite
+	ca *testCA
+}
+
+func (suite *IdentityTestSuite) SetupTest() {
+	suite.ca = newTestCA(suite.T(), "ca")
+}
+
+func (suite *IdentityTestSuite) TestIdentityFromCommonName() {
+	crt := suite.ca.issue(suite.T(), 2, &x509.Certificate{Subject: pkix.Name{CommonName: "alice", OrganizationalUnit: []string{"Tech"}}})
+	id, err := IdentityFromCertificate(crt)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), Identity{Issuer: "CN=ca", Name: "alice"}, id)
+	assert.False(suite.T(), id.IsSpiffe())
+}
+
+func (suite *IdentityTestSuite) TestIdentityFromSpiffeID() {
+	spiffeID, _ := url.Parse("spiffe://example.org/ops/alice")
+	otherURI, _ := url.Parse("https://example.org/alice")
+	crt := suite.ca.issue(suite.T(), 2, &x509.Certificate{
+		Subject: pkix.Name{CommonName: "alice"},
+		URIs:    []*url.URL{otherURI, spiffeID},
+	})
+	id, err := IdentityFromCertificate(crt)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "spiffe://example.org/ops/alice", id.Name, "SPIFFE ID should take precedence over the common name")
+	assert.True(suite.T(), id.IsSpiffe())
+}
+
+func (suite *IdentityTestSuite) TestIdentityWithoutName() {
+	_, err := IdentityFromCertificate(suite.ca.issue(suite.T(), 2, &x509.Certificate{}))
+	assert.Error(suite.T(), err, "a certificate without a name has no identity")
+}
+
+func (suite *IdentityTestSuite) TestReissuedCertificateKeepsIdentity() {
+	first, _ := IdentityFromCertificate(suite.ca.issue(suite.T(), 2, &x509.Certificate{Subject: pkix.Name{CommonName: "alice"}}))
+	second, _ := IdentityFromCertificate(suite.ca.issue(suite.T(), 3, &x509.Certificate{Subject: pkix.Name{CommonName: "alice"}}))
+	assert.Equal(suite.T(), first.String(), second.String())
+}
+
+func (suite *IdentityTestSuite) TestString() {
+	assert.Equal(suite.T(), "alice@CN=ca", Identity{Issuer: "CN=ca", Name: "alice"}.String())
+	assert.NotEqual(suite.T(),
+		Identity{Issuer: "c", Name: "a@b"}.String(),
+		Identity{Issuer: "b@c", Name: "a"}.String(),
+		"names containing '@' should not collide with other issuers",
+	)
+}
+
+func (suite *IdentityTestSuite) TestParseIdentity() {
+	for _, id := range []Identity{
+		{Issuer: "CN=ca", Name: "alice"},
+		{Issuer: "b@c", Name: "a"},
+		{Issuer: "c", Name: "a@b%40"},
+		{Issuer: "CN=ca", Name: "spiffe://example.org/ops/alice"},
+	} {
+		parsed, err := ParseIdentity(id.String())
+		assert.NoError(suite.T(), err)
+		assert.Equal(suite.T(), id, parsed)
+	}
+
+	_, err := ParseIdentity("alice")
+	assert.Error(suite.T(), err, "an identity without an issuer should be rejected")
+}
+
+func (suite *IdentityTestSuite) TestContext() {
+	_, ok := IdentityFromContext(context.Background())
+	assert.False(suite.T(), ok)
+
+	id := Identity{Issuer: "CN=ca", Name: "alice"}
+	stored, ok := IdentityFromContext(NewContextWithIdentity(context.Background(), id))
+	assert.True(suite.T(), ok)
+	assert.Equal(suite.T(), id, stored)
+}
+
+func TestIdentityTestSuite(t *testing.T) {
+	suite.Run(t, new(IdentityTestSuite))
+}
@@ -2,7 +2,9 @@ package auth
 
 import (
 	"context"
+	"log"
 
+	"github.com/ItsMeWithTheFace/linux-process-runner/audit"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials"
@@ -10,8 +12,6 @@ import (
 	"google.golang.org/grpc/status"
 )
 
-const ClientIDKey = "ClientID"
-
 type authStream struct {
 	grpc.ServerStream
 	ctx context.Context
@@ -21,13 +21,52 @@ func (a *authStream) Context() context.Context {
 	return a.ctx
 }
 
-func UnaryAuthInterceptor(
+// Authenticator extracts the client's Identity from its verified certificate
+// and rejects certificates that have been revoked. With RBAC enabled it also
+// resolves the client's Role and rejects RPCs the role can never perform.
+type Authenticator struct {
+	revocations *RevocationChecker
+	rbac        *RBAC
+	methods     map[string]Action
+}
+
+// AuthenticatorOption configures an Authenticator.
+type AuthenticatorOption func(*Authenticator)
+
+// WithRevocationChecker rejects client certificates listed in the checker's CRLs.
+func WithRevocationChecker(rc *RevocationChecker) AuthenticatorOption {
+	return func(a *Authenticator) {
+		a.revocations = rc
+	}
+}
+
+// WithRBAC resolves roles using rbac. methods maps full gRPC method names to
+// the action they perform, calls to methods the caller's role cannot perform
+// even on its own jobs are rejected before reaching the handler.
+func WithRBAC(rbac *RBAC, methods map[string]Action) AuthenticatorOption {
+	return func(a *Authenticator) {
+		a.rbac = rbac
+		a.methods = methods
+	}
+}
+
+// NewAuthenticator creates an Authenticator with the given options.
+func NewAuthenticator(opts ...AuthenticatorOption) *Authenticator {
+	a := &Authenticator{}
+	for _, opt := range opts {
+		opt(a)
+	}
+	return a
+}
+
+// UnaryInterceptor authenticates unary RPCs.
+func (a *Authenticator) UnaryInterceptor(
 	ctx context.Context,
 	req interface{},
 	info *grpc.UnaryServerInfo,
 	handler grpc.UnaryHandler,
 ) (interface{}, error) {
-	newCtx, err := updateContextWithAuthInfo(ctx)
+	newCtx, err := a.updateContextWithAuthInfo(ctx, info.FullMethod)
 
 	if err != nil {
 		return nil, err
@@ -36,13 +75,14 @@ func UnaryAuthInterceptor(
 	return handler(newCtx, req)
 }
 
-func StreamAuthInterceptor(
+// StreamInterceptor authenticates streaming RPCs.
+func (a *Authenticator) StreamInterceptor(
 	srv interface{},
 	stream grpc.ServerStream,
 	info *grpc.StreamServerInfo,
 	handler grpc.StreamHandler,
 ) error {
-	newCtx, err := updateContextWithAuthInfo(stream.Context())
+	newCtx, err := a.updateContextWithAuthInfo(stream.Context(), info.FullMethod)
 
 	if err != nil {
 		return err
@@ -54,7 +94,27 @@ func StreamAuthInterceptor(
 	})
 }
 
-func updateContextWithAuthInfo(ctx context.Context) (context.Context, error) {
+// UnaryAuthInterceptor authenticates unary RPCs without revocation checks.
+func UnaryAuthInterceptor(
+	ctx context.Context,
+	req interface{},
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (interface{}, error) {
+	return NewAuthenticator().UnaryInterceptor(ctx, req, info, handler)
+}
+
+// StreamAuthInterceptor authenticates streaming RPCs without revocation checks.
+func StreamAuthInterceptor(
+	srv interface{},
+	stream grpc.ServerStream,
+	info *grpc.StreamServerInfo,
+	handler grpc.StreamHandler,
+) error {
+	return NewAuthenticator().StreamInterceptor(srv, stream, info, handler)
+}
+
+func (a *Authenticator) updateContextWithAuthInfo(ctx context.Context, method string) (context.Context, error) {
 	p, ok := peer.FromContext(ctx)
 	if !ok {
 		return nil, status.Error(codes.PermissionDenied, "unable to get peer from context")
@@ -71,10 +131,37 @@ func updateContextWithAuthInfo(ctx context.Context) (context.Context, error) {
 
 	crt := tlsAuth.State.VerifiedChains[0][0]
 
-	// TODO: additionally verify CA cert via comparing Issue name of crt
-	// and Subject name of a loaded CA cert
-	serial := crt.SerialNumber
+	if a.revocations != nil && a.revocations.IsRevoked(crt) {
+		if id, err := IdentityFromCertificate(crt); err == nil {
+			audit.SetPrincipal(ctx, id.String(), "")
+		}
+		log.Printf("audit: rejected revoked certificate serial=%s subject=%q issuer=%q peer=%v method=%s",
+			crt.SerialNumber, crt.Subject.String(), crt.Issuer.String(), p.Addr, method)
+		return nil, status.Errorf(codes.Unauthenticated, "client certificate with serial %s has been revoked", crt.SerialNumber)
+	}
+
+	// the chain has already been verified against the server's CA bundle, so
+	// the issuer recorded in the identity is one we trust
+	id, err := IdentityFromCertificate(crt)
+	if err != nil {
+		return nil, status.Errorf(codes.Unauthenticated, "invalid client certificate: %s", err.Error())
+	}
+
+	ctx = NewContextWithIdentity(ctx, id)
+	audit.SetPrincipal(ctx, id.String(), "")
+
+	if a.rbac != nil {
+		certRole := CertificateRole(crt)
+		role := a.rbac.ResolveRole(id, certRole)
+		audit.SetPrincipal(ctx, id.String(), string(role))
+		if action, ok := a.methods[method]; ok {
+			if err := role.Authorize(action, true); err != nil {
+				return nil, status.Error(codes.PermissionDenied, err.Error())
+			}
+		}
+		ctx = NewContextWithRole(ctx, role)
+		ctx = NewContextWithCertificateRole(ctx, certRole)
+	}
 
-	ctxWithClientID := context.WithValue(ctx, ClientIDKey, serial)
-	return ctxWithClientID, nil
+	return ctx, nil
 }
@@ -0,0 +1,258 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Role grants a set of actions on jobs.
+type Role string
+
+const (
+	// RoleViewer can read any job's metadata and output but cannot start or
+	// stop jobs.
+	RoleViewer Role = "viewer"
+	// RoleOperator can start jobs and stop, query and stream the jobs it owns.
+	RoleOperator Role = "operator"
+	// RoleAdmin can perform every action on any job.
+	RoleAdmin Role = "admin"
+)
+
+// roleURIPrefix marks a URI SAN that assigns a role, e.g. urn:linux-process-runner:role:admin.
+const roleURIPrefix = "urn:linux-process-runner:role:"
+
+// Action is something a client can do with a job.
+type Action string
+
+const (
+	ActionStart  Action = "start"
+	ActionStop   Action = "stop"
+	ActionGet    Action = "get"
+	ActionStream Action = "stream"
+	// ActionManageCertificates covers approving, listing and revoking
+	// certificates issued by the built-in CA.
+	ActionManageCertificates Action = "manage certificates"
+	// ActionReadAudit covers querying the audit log.
+	ActionReadAudit Action = "read audit log"
+	// ActionDrain covers draining the server and resuming it.
+	ActionDrain Action = "drain"
+)
+
+type roleKey struct{}
+
+type certificateRoleKey struct{}
+
+// rank orders roles so that the most privileged one wins when a certificate
+// carries several.
+func (r Role) rank() int {
+	switch r {
+	case RoleViewer:
+		return 1
+	case RoleOperator:
+		return 2
+	case RoleAdmin:
+		return 3
+	default:
+		return 0
+	}
+}
+
+// Valid checks if r is one of the known roles.
+func (r Role) Valid() bool {
+	return r.rank() > 0
+}
+
+// onJob reports whether the action targets an existing job.
+func (a Action) onJob() bool {
+	return a == ActionStop || a == ActionGet || a == ActionStream
+}
+
+// Authorize decides whether the role may perform action on a job. ownJob
+// reports whether the caller owns the job and is ignored for actions that do
+// not target an existing job. The returned error describes why the action
+// was denied.
+func (r Role) Authorize(action Action, ownJob bool) error {
+	switch r {
+	case RoleAdmin:
+		return nil
+	case RoleOperator:
+		if action == ActionStart || (action.onJob() && ownJob) {
+			return nil
+		}
+		if !action.onJob() {
+			return fmt.Errorf("role %s cannot %s", r, action)
+		}
+		return fmt.Errorf("role %s can only %s its own jobs", r, action)
+	case RoleViewer:
+		if action == ActionGet || action == ActionStream {
+			return nil
+		}
+		return fmt.Errorf("role %s is read-only and cannot %s jobs", r, action)
+	default:
+		return fmt.Errorf("unknown role %q", r)
+	}
+}
+
+// RoleBinding assigns a role to an identity. An empty Issuer matches the
+// name from any trusted CA.
+type RoleBinding struct {
+	Name   string `yaml:"name"`
+	Issuer string `yaml:"issuer"`
+	Role   Role   `yaml:"role"`
+}
+
+// RolePolicy maps identities to roles. Bindings take precedence over roles
+// carried in the certificate, and DefaultRole applies when neither exists.
+type RolePolicy struct {
+	DefaultRole Role          `yaml:"default_role"`
+	Bindings    []RoleBinding `yaml:"bindings"`
+}
+
+// DefaultRolePolicy lets every client start and manage its own jobs.
+func DefaultRolePolicy() RolePolicy {
+	return RolePolicy{DefaultRole: RoleOperator}
+}
+
+// LoadRolePolicy reads a YAML role policy file. Unknown fields and roles are
+// rejected.
+func LoadRolePolicy(path string) (RolePolicy, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return RolePolicy{}, err
+	}
+
+	policy := DefaultRolePolicy()
+	dec := yaml.NewDecoder(bytes.NewReader(b))
+	dec.KnownFields(true)
+	if err := dec.Decode(&policy); err != nil {
+		return RolePolicy{}, fmt.Errorf("parsing %s: %w", path, err)
+	}
+
+	if err := policy.Validate(); err != nil {
+		return RolePolicy{}, fmt.Errorf("validating %s: %w", path, err)
+	}
+
+	return policy, nil
+}
+
+// Validate checks that every role in the policy exists.
+func (p RolePolicy) Validate() error {
+	if !p.DefaultRole.Valid() {
+		return fmt.Errorf("default_role: unknown role %q", p.DefaultRole)
+	}
+	for i, binding := range p.Bindings {
+		if binding.Name == "" {
+			return fmt.Errorf("bindings[%d]: name is required", i)
+		}
+		if !binding.Role.Valid() {
+			return fmt.Errorf("bindings[%d]: unknown role %q", i, binding.Role)
+		}
+	}
+	return nil
+}
+
+// RBAC resolves the role of an authenticated client.
+type RBAC struct {
+	mu     *sync.RWMutex
+	policy RolePolicy
+}
+
+// NewRBAC creates an RBAC that resolves roles using policy.
+func NewRBAC(policy RolePolicy) *RBAC {
+	return &RBAC{mu: &sync.RWMutex{}, policy: policy}
+}
+
+// SetPolicy replaces the role policy.
+func (r *RBAC) SetPolicy(policy RolePolicy) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.policy = policy
+}
+
+// Resolve returns the role of the client. A binding in the policy file wins,
+// then the most privileged role named by the certificate's OUs or
+// urn:linux-process-runner:role URI SANs, then the default role.
+func (r *RBAC) Resolve(id Identity, crt *x509.Certificate) Role {
+	return r.ResolveRole(id, CertificateRole(crt))
+}
+
+// ResolveRole returns the role of id when its certificate carried certRole,
+// which is empty if it carried none. It lets the role of a client be worked
+// out again after the connection that presented its certificate is gone.
+func (r *RBAC) ResolveRole(id Identity, certRole Role) Role {
+	r.mu.RLock()
+	policy := r.policy
+	r.mu.RUnlock()
+
+	for _, binding := range policy.Bindings {
+		if binding.Name == id.Name && (binding.Issuer == "" || binding.Issuer == id.Issuer) {
+			return binding.Role
+		}
+	}
+
+	if certRole.Valid() {
+		return certRole
+	}
+
+	return policy.DefaultRole
+}
+
+// CertificateRole returns the most privileged role named by the
+// certificate's OUs or role URI SANs, or an empty role if it names none.
+func CertificateRole(crt *x509.Certificate) Role {
+	var role Role
+	for _, ou := range crt.Subject.OrganizationalUnit {
+		if candidate := Role(strings.ToLower(ou)); candidate.rank() > role.rank() {
+			role = candidate
+		}
+	}
+	for _, uri := range crt.URIs {
+		if s := uri.String(); strings.HasPrefix(s, roleURIPrefix) {
+			if candidate := Role(strings.TrimPrefix(s, roleURIPrefix)); candidate.rank() > role.rank() {
+				role = candidate
+			}
+		}
+	}
+	return role
+}
+
+// RoleURI returns the URI SAN that assigns role to a certificate.
+func RoleURI(role Role) *url.URL {
+	return &url.URL{Scheme: "urn", Opaque: strings.TrimPrefix(roleURIPrefix, "urn:") + string(role)}
+}
+
+// NewContextWithRole returns a copy of ctx that carries the role.
+func NewContextWithRole(ctx context.Context, role Role) context.Context {
+	return context.WithValue(ctx, roleKey{}, role)
+}
+
+// NewContextWithCertificateRole returns a copy of ctx that carries the role
+// named by the client's certificate.
+func NewContextWithCertificateRole(ctx context.Context, role Role) context.Context {
+	return context.WithValue(ctx, certificateRoleKey{}, role)
+}
+
+// CertificateRoleFromContext returns the role named by the client's
+// certificate, or an empty role if it named none.
+func CertificateRoleFromContext(ctx context.Context) Role {
+	role, _ := ctx.Value(certificateRoleKey{}).(Role)
+	return role
+}
+
+// RoleFromContext returns the role stored by the auth interceptors. Contexts
+// authenticated without RBAC default to RoleOperator, which matches the
+// behaviour before roles existed.
+func RoleFromContext(ctx context.Context) Role {
+	if role, ok := ctx.Value(roleKey{}).(Role); ok {
+		return role
+	}
+	return RoleOperator
+}
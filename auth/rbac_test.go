@@ -0,0 +1,152 @@
+package auth
+
+import (
+	"context"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type RBACTestSuite struct {
+	suite.Suite
+	ca *testCA
+}
+
+func (suite *RBACTestSuite) SetupTest() {
+	suite.ca = newTestCA(suite.T(), "ca")
+}
+
+func (suite *RBACTestSuite) TestAuthorize() {
+	cases := []struct {
+		role    Role
+		action  Action
+		ownJob  bool
+		allowed bool
+	}{
+		{RoleAdmin, ActionStop, false, true},
+		{RoleAdmin, ActionStream, false, true},
+		{RoleOperator, ActionStart, false, true},
+		{RoleOperator, ActionStop, true, true},
+		{RoleOperator, ActionStop, false, false},
+		{RoleOperator, ActionGet, false, false},
+		{RoleOperator, ActionStream, false, false},
+		{RoleViewer, ActionGet, false, true},
+		{RoleViewer, ActionStart, false, false},
+		{RoleViewer, ActionStream, false, true},
+		{RoleAdmin, ActionManageCertificates, false, true},
+		{RoleOperator, ActionManageCertificates, true, false},
+		{RoleViewer, ActionManageCertificates, true, false},
+		{RoleAdmin, ActionReadAudit, false, true},
+		{RoleOperator, ActionReadAudit, true, false},
+		{RoleViewer, ActionReadAudit, false, false},
+		{RoleAdmin, ActionDrain, false, true},
+		{RoleOperator, ActionDrain, false, false},
+		{RoleViewer, ActionDrain, false, false},
+		{Role("root"), ActionGet, true, false},
+	}
+
+	for _, tc := range cases {
+		err := tc.role.Authorize(tc.action, tc.ownJob)
+		assert.Equal(suite.T(), tc.allowed, err == nil, "%s %s own=%t", tc.role, tc.action, tc.ownJob)
+	}
+}
+
+func (suite *RBACTestSuite) TestResolve() {
+	roleURI := RoleURI(RoleAdmin)
+	assert.Equal(suite.T(), "urn:linux-process-runner:role:admin", roleURI.String())
+	rbac := NewRBAC(RolePolicy{
+		DefaultRole: RoleViewer,
+		Bindings: []RoleBinding{
+			{Name: "bound", Role: RoleAdmin},
+			{Name: "scoped", Issuer: "CN=other-ca", Role: RoleAdmin},
+		},
+	})
+
+	cases := []struct {
+		name     string
+		template *x509.Certificate
+		role     Role
+	}{
+		{"binding wins over OU", &x509.Certificate{Subject: pkix.Name{CommonName: "bound", OrganizationalUnit: []string{"viewer"}}}, RoleAdmin},
+		{"binding for another issuer", &x509.Certificate{Subject: pkix.Name{CommonName: "scoped"}}, RoleViewer},
+		{"OU", &x509.Certificate{Subject: pkix.Name{CommonName: "ou", OrganizationalUnit: []string{"Tech", "Operator"}}}, RoleOperator},
+		{"URI SAN", &x509.Certificate{Subject: pkix.Name{CommonName: "uri", OrganizationalUnit: []string{"operator"}}, URIs: []*url.URL{roleURI}}, RoleAdmin},
+		{"default", &x509.Certificate{Subject: pkix.Name{CommonName: "nobody", OrganizationalUnit: []string{"Tech"}}}, RoleViewer},
+	}
+
+	for i, tc := range cases {
+		crt := suite.ca.issue(suite.T(), int64(i+2), tc.template)
+		id, err := IdentityFromCertificate(crt)
+		assert.NoError(suite.T(), err)
+		assert.Equal(suite.T(), tc.role, rbac.Resolve(id, crt), tc.name)
+	}
+}
+
+func (suite *RBACTestSuite) TestResolveRole() {
+	rbac := NewRBAC(RolePolicy{
+		DefaultRole: RoleViewer,
+		Bindings:    []RoleBinding{{Name: "bound", Role: RoleOperator}},
+	})
+
+	assert.Equal(suite.T(), RoleOperator, rbac.ResolveRole(Identity{Issuer: "CN=ca", Name: "bound"}, RoleAdmin), "a binding should win over the certificate's role")
+	assert.Equal(suite.T(), RoleAdmin, rbac.ResolveRole(Identity{Issuer: "CN=ca", Name: "alice"}, RoleAdmin))
+	assert.Equal(suite.T(), RoleViewer, rbac.ResolveRole(Identity{Issuer: "CN=ca", Name: "alice"}, ""))
+
+	rbac.SetPolicy(RolePolicy{DefaultRole: RoleOperator})
+	assert.Equal(suite.T(), RoleOperator, rbac.ResolveRole(Identity{Issuer: "CN=ca", Name: "alice"}, ""), "the current policy should be used")
+}
+
+func (suite *RBACTestSuite) TestLoadRolePolicy() {
+	dir, err := ioutil.TempDir("", "rbac")
+	suite.Require().NoError(err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "roles.yaml")
+	suite.Require().NoError(ioutil.WriteFile(path, []byte("bindings:\n  - name: alice\n    role: admin\n"), 0600))
+	policy, err := LoadRolePolicy(path)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), RoleOperator, policy.DefaultRole, "default role should default to operator")
+	assert.Equal(suite.T(), []RoleBinding{{Name: "alice", Role: RoleAdmin}}, policy.Bindings)
+
+	suite.Require().NoError(ioutil.WriteFile(path, []byte("bindings:\n  - name: alice\n    role: root\n"), 0600))
+	_, err = LoadRolePolicy(path)
+	assert.Error(suite.T(), err, "unknown roles should be rejected")
+
+	suite.Require().NoError(ioutil.WriteFile(path, []byte("default: admin\n"), 0600))
+	_, err = LoadRolePolicy(path)
+	assert.Error(suite.T(), err, "unknown fields should be rejected")
+}
+
+func (suite *RBACTestSuite) TestInterceptorEnforcesRole() {
+	a := NewAuthenticator(WithRBAC(NewRBAC(DefaultRolePolicy()), map[string]Action{"/JobRunnerService/StartJob": ActionStart}))
+	var role Role
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		role = RoleFromContext(ctx)
+		return nil, nil
+	}
+	info := &grpc.UnaryServerInfo{FullMethod: "/JobRunnerService/StartJob"}
+
+	viewer := suite.ca.issue(suite.T(), 2, &x509.Certificate{Subject: pkix.Name{CommonName: "v", OrganizationalUnit: []string{"viewer"}}})
+	_, err := a.UnaryInterceptor(peerContext(viewer), nil, info, handler)
+	s, _ := status.FromError(err)
+	assert.Equal(suite.T(), codes.PermissionDenied, s.Code(), "viewers should not be able to start jobs")
+
+	operator := suite.ca.issue(suite.T(), 3, &x509.Certificate{Subject: pkix.Name{CommonName: "o"}})
+	_, err = a.UnaryInterceptor(peerContext(operator), nil, info, handler)
+	assert.NoError(suite.T(), err, "operators should be able to start jobs")
+	assert.Equal(suite.T(), RoleOperator, role, "the role should be passed on to the handler")
+}
+
+func TestRBACTestSuite(t *testing.T) {
+	suite.Run(t, new(RBACTestSuite))
+}
@@ -1,29 +1,266 @@
 package auth
 
 import (
+	"context"
 	"crypto/tls"
 	"crypto/x509"
 	"fmt"
 	"io/ioutil"
+	"log"
+	"sync"
+	"time"
 
 	"google.golang.org/grpc/credentials"
 )
 
+var cipherSuites = []uint16{
+	tls.TLS_AES_128_GCM_SHA256,
+	tls.TLS_AES_256_GCM_SHA384,
+	tls.TLS_CHACHA20_POLY1305_SHA256,
+}
+
+// TlsFiles lists the PEM files that make up a TLS identity.
+type TlsFiles struct {
+	Cert string
+	Key  string
+	CA   string
+}
+
+func (f TlsFiles) paths() []string {
+	return []string{f.Cert, f.Key, f.CA}
+}
+
+// ServerTlsReloader serves a server-side TLS configuration that can be
+// swapped at runtime. New handshakes use the latest configuration while
+// established connections are left untouched.
+type ServerTlsReloader struct {
+	mu     *sync.RWMutex
+	files  TlsFiles
+	config *tls.Config
+}
+
+// NewServerTlsReloader loads the server's TLS files for the first time.
+func NewServerTlsReloader(files TlsFiles) (*ServerTlsReloader, error) {
+	r := &ServerTlsReloader{mu: &sync.RWMutex{}}
+	if err := r.Reload(files); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload reads the given TLS files and swaps them in if they are valid. The
+// previous configuration is kept if loading fails.
+func (r *ServerTlsReloader) Reload(files TlsFiles) error {
+	config, err := loadServerTlsConfig(files.Cert, files.Key, files.CA)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.files = files
+	r.config = config
+	return nil
+}
+
+// Watch reloads the TLS files whenever they change on disk until ctx is
+// cancelled. Failed reloads are logged and the previous configuration stays
+// in use.
+func (r *ServerTlsReloader) Watch(ctx context.Context, interval time.Duration) {
+	watchFiles(ctx, interval, r.currentPaths, func() {
+		if err := r.Reload(r.currentFiles()); err != nil {
+			log.Printf("failed to reload server tls files: %v", err)
+			return
+		}
+		log.Println("reloaded server tls files")
+	})
+}
+
+// Credentials returns transport credentials that resolve the current TLS
+// configuration on every handshake.
+func (r *ServerTlsReloader) Credentials() credentials.TransportCredentials {
+	return credentials.NewTLS(&tls.Config{
+		MinVersion:         tls.VersionTLS13,
+		GetConfigForClient: r.getConfigForClient,
+	})
+}
+
+// ServerAuthOnlyCredentials is like Credentials but does not ask clients for
+// a certificate. It is meant for endpoints that issue clients their first
+// certificate and must not be used for anything else.
+func (r *ServerTlsReloader) ServerAuthOnlyCredentials() credentials.TransportCredentials {
+	return credentials.NewTLS(&tls.Config{
+		MinVersion: tls.VersionTLS13,
+		GetConfigForClient: func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+			config, err := r.getConfigForClient(hello)
+			if err != nil {
+				return nil, err
+			}
+			config = config.Clone()
+			config.ClientAuth = tls.NoClientCert
+			config.ClientCAs = nil
+			return config, nil
+		},
+	})
+}
+
+// TlsConfig is like Credentials but for HTTP servers, which also need
+// HTTP/1.1 offered during ALPN.
+func (r *ServerTlsReloader) TlsConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS13,
+		NextProtos: []string{"h2", "http/1.1"},
+		GetConfigForClient: func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+			config, err := r.getConfigForClient(hello)
+			if err != nil {
+				return nil, err
+			}
+			config = config.Clone()
+			config.NextProtos = []string{"h2", "http/1.1"}
+			return config, nil
+		},
+	}
+}
+
+func (r *ServerTlsReloader) getConfigForClient(*tls.ClientHelloInfo) (*tls.Config, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.config, nil
+}
+
+func (r *ServerTlsReloader) currentFiles() TlsFiles {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.files
+}
+
+func (r *ServerTlsReloader) currentPaths() []string {
+	return r.currentFiles().paths()
+}
+
+// ClientTlsReloader is the client-side counterpart of ServerTlsReloader. The
+// client certificate and CA bundle are looked up on every handshake so that
+// long-lived connections pick up rotated files when they reconnect.
+type ClientTlsReloader struct {
+	mu    *sync.RWMutex
+	files TlsFiles
+	cert  *tls.Certificate
+	roots *x509.CertPool
+}
+
+// NewClientTlsReloader loads the client's TLS files for the first time.
+func NewClientTlsReloader(files TlsFiles) (*ClientTlsReloader, error) {
+	r := &ClientTlsReloader{mu: &sync.RWMutex{}}
+	if err := r.Reload(files); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload reads the given TLS files and swaps them in if they are valid. The
+// previous certificate and CA bundle are kept if loading fails.
+func (r *ClientTlsReloader) Reload(files TlsFiles) error {
+	roots, err := loadCertPool(files.CA)
+	if err != nil {
+		return err
+	}
+
+	cert, err := tls.LoadX509KeyPair(files.Cert, files.Key)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.files = files
+	r.cert = &cert
+	r.roots = roots
+	return nil
+}
+
+// Watch reloads the TLS files whenever they change on disk until ctx is
+// cancelled. Failed reloads are logged and the previous files stay in use.
+func (r *ClientTlsReloader) Watch(ctx context.Context, interval time.Duration) {
+	watchFiles(ctx, interval, r.currentPaths, func() {
+		if err := r.Reload(r.currentFiles()); err != nil {
+			log.Printf("failed to reload client tls files: %v", err)
+		}
+	})
+}
+
+// Credentials returns transport credentials that use the current client
+// certificate and CA bundle on every handshake.
+func (r *ClientTlsReloader) Credentials() credentials.TransportCredentials {
+	return credentials.NewTLS(&tls.Config{
+		MinVersion:           tls.VersionTLS13,
+		CipherSuites:         cipherSuites,
+		GetClientCertificate: r.getClientCertificate,
+		// the root pool can change between handshakes, so the server's chain
+		// is verified in verifyConnection instead of through RootCAs
+		InsecureSkipVerify: true,
+		VerifyConnection:   r.verifyConnection,
+	})
+}
+
+func (r *ClientTlsReloader) getClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+// verifyConnection performs the same checks as the standard library does for
+// a client with RootCAs set, using the latest CA bundle.
+func (r *ClientTlsReloader) verifyConnection(cs tls.ConnectionState) error {
+	if len(cs.PeerCertificates) == 0 {
+		return fmt.Errorf("server did not present a certificate")
+	}
+
+	r.mu.RLock()
+	roots := r.roots
+	r.mu.RUnlock()
+
+	opts := x509.VerifyOptions{
+		DNSName:       cs.ServerName,
+		Roots:         roots,
+		Intermediates: x509.NewCertPool(),
+	}
+	for _, cert := range cs.PeerCertificates[1:] {
+		opts.Intermediates.AddCert(cert)
+	}
+
+	_, err := cs.PeerCertificates[0].Verify(opts)
+	return err
+}
+
+func (r *ClientTlsReloader) currentFiles() TlsFiles {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.files
+}
+
+func (r *ClientTlsReloader) currentPaths() []string {
+	return r.currentFiles().paths()
+}
+
 // GetServerTlsCredentials creates an appropriate TLS configuration for server-side use.
 func GetServerTlsCredentials(certPath string, certKeyPath string, caCertPath string) (credentials.TransportCredentials, error) {
-	serverCert, err := tls.LoadX509KeyPair(certPath, certKeyPath)
+	config, err := loadServerTlsConfig(certPath, certKeyPath, caCertPath)
 	if err != nil {
 		return nil, err
 	}
 
-	caCert, err := ioutil.ReadFile(caCertPath)
+	return credentials.NewTLS(config), nil
+}
+
+func loadServerTlsConfig(certPath string, certKeyPath string, caCertPath string) (*tls.Config, error) {
+	serverCert, err := tls.LoadX509KeyPair(certPath, certKeyPath)
 	if err != nil {
 		return nil, err
 	}
 
-	certPool := x509.NewCertPool()
-	if !certPool.AppendCertsFromPEM(caCert) {
-		return nil, fmt.Errorf("failed to add server CA's certificate")
+	certPool, err := loadCertPool(caCertPath)
+	if err != nil {
+		return nil, err
 	}
 
 	config := &tls.Config{
@@ -31,28 +268,21 @@ func GetServerTlsCredentials(certPath string, certKeyPath string, caCertPath str
 		ClientCAs:    certPool,
 		Certificates: []tls.Certificate{serverCert},
 		MinVersion:   tls.VersionTLS13,
-		CipherSuites: []uint16{
-			tls.TLS_AES_128_GCM_SHA256,
-			tls.TLS_AES_256_GCM_SHA384,
-			tls.TLS_CHACHA20_POLY1305_SHA256,
-		},
+		CipherSuites: cipherSuites,
+		// configs returned from GetConfigForClient bypass grpc's ALPN setup
+		NextProtos: []string{"h2"},
 	}
 
-	return credentials.NewTLS(config), nil
+	return config, nil
 }
 
 // GetClientTlsCredentials creates an appropriate TLS configuration for client-side use.
 func GetClientTlsCredentials(certPath string, certKeyPath string, caCertPath string) (credentials.TransportCredentials, error) {
-	caCert, err := ioutil.ReadFile(caCertPath)
+	certPool, err := loadCertPool(caCertPath)
 	if err != nil {
 		return nil, err
 	}
 
-	certPool := x509.NewCertPool()
-	if !certPool.AppendCertsFromPEM(caCert) {
-		return nil, fmt.Errorf("failed to add client CA's certificate")
-	}
-
 	clientCert, err := tls.LoadX509KeyPair(certPath, certKeyPath)
 	if err != nil {
 		return nil, err
@@ -62,12 +292,40 @@ func GetClientTlsCredentials(certPath string, certKeyPath string, caCertPath str
 		Certificates: []tls.Certificate{clientCert},
 		RootCAs:      certPool,
 		MinVersion:   tls.VersionTLS13,
-		CipherSuites: []uint16{
-			tls.TLS_AES_128_GCM_SHA256,
-			tls.TLS_AES_256_GCM_SHA384,
-			tls.TLS_CHACHA20_POLY1305_SHA256,
-		},
+		CipherSuites: cipherSuites,
+	}
+
+	return credentials.NewTLS(config), nil
+}
+
+// GetEnrollmentTlsCredentials creates a TLS configuration for clients that do
+// not have a certificate yet and only need to verify the server.
+func GetEnrollmentTlsCredentials(caCertPath string) (credentials.TransportCredentials, error) {
+	certPool, err := loadCertPool(caCertPath)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &tls.Config{
+		RootCAs:      certPool,
+		MinVersion:   tls.VersionTLS13,
+		CipherSuites: cipherSuites,
 	}
 
 	return credentials.NewTLS(config), nil
 }
+
+// loadCertPool reads a PEM bundle of CA certificates.
+func loadCertPool(caCertPath string) (*x509.CertPool, error) {
+	caCert, err := ioutil.ReadFile(caCertPath)
+	if err != nil {
+		return nil, err
+	}
+
+	certPool := x509.NewCertPool()
+	if !certPool.AppendCertsFromPEM(caCert) {
+		return nil, fmt.Errorf("failed to add CA certificate from %s", caCertPath)
+	}
+
+	return certPool, nil
+}
@@ -0,0 +1,61 @@
+package auth
+
+import (
+	"context"
+	"os"
+	"time"
+)
+
+// DefaultWatchInterval is how often TLS files are checked for changes.
+const DefaultWatchInterval = 30 * time.Second
+
+// fileVersion identifies a revision of a file on disk.
+type fileVersion struct {
+	modTime time.Time
+	size    int64
+}
+
+// statFiles returns the current version of each path. Files that cannot be
+// read are given a zero version so that they are retried on the next check.
+func statFiles(paths []string) []fileVersion {
+	versions := make([]fileVersion, len(paths))
+	for i, path := range paths {
+		if info, err := os.Stat(path); err == nil {
+			versions[i] = fileVersion{modTime: info.ModTime(), size: info.Size()}
+		}
+	}
+	return versions
+}
+
+// watchFiles polls the files returned by paths every interval and calls
+// onChange when any of them is modified, until ctx is cancelled.
+func watchFiles(ctx context.Context, interval time.Duration, paths func() []string, onChange func()) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	last := statFiles(paths())
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			current := statFiles(paths())
+			if changed(last, current) {
+				onChange()
+			}
+			last = current
+		}
+	}
+}
+
+func changed(a []fileVersion, b []fileVersion) bool {
+	if len(a) != len(b) {
+		return true
+	}
+	for i := range a {
+		if !a[i].modTime.Equal(b[i].modTime) || a[i].size != b[i].size {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,654 @@
+package ca
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ItsMeWithTheFace/linux-process-runner/auth"
+	"github.com/google/uuid"
+)
+
+const (
+	stateFile = "state.json"
+	crlFile   = "ca.crl"
+	// crlValidity is how long a generated CRL stays valid. It is regenerated
+	// on every revocation, whenever the authority is loaded and by
+	// KeepCRLFresh once half of it has passed.
+	crlValidity = 7 * 24 * time.Hour
+)
+
+// RequestState is the lifecycle state of a certificate request.
+type RequestState int32
+
+const (
+	// Pending requests are waiting for an admin's approval.
+	Pending RequestState = iota
+	// Issued requests have a signed certificate.
+	Issued
+	// Denied requests were rejected by an admin.
+	Denied
+)
+
+// Request is a certificate signing request submitted for enrollment.
+type Request struct {
+	Id          string       `json:"id"`
+	Name        string       `json:"name"`
+	State       RequestState `json:"state"`
+	Role        auth.Role    `json:"role,omitempty"`
+	CSR         []byte       `json:"csr"`
+	Certificate []byte       `json:"certificate,omitempty"`
+	Serial      string       `json:"serial,omitempty"`
+	CreatedAt   time.Time    `json:"created_at"`
+}
+
+// IssuedCertificate records a certificate signed by the authority so that it
+// can be revoked later.
+type IssuedCertificate struct {
+	Serial    string    `json:"serial"`
+	Name      string    `json:"name"`
+	NotAfter  time.Time `json:"not_after"`
+	Revoked   bool      `json:"revoked"`
+	RevokedAt time.Time `json:"revoked_at,omitempty"`
+}
+
+// enrollmentToken is a one-time token that lets its holder enroll as Name
+// without waiting for approval. Only a hash of the token is stored.
+type enrollmentToken struct {
+	Name      string    `json:"name"`
+	Role      auth.Role `json:"role,omitempty"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// state is everything the authority persists between restarts.
+type state struct {
+	Requests map[string]*Request           `json:"requests"`
+	Tokens   map[string]*enrollmentToken   `json:"tokens"`
+	Issued   map[string]*IssuedCertificate `json:"issued"`
+}
+
+// Authority is a certificate authority that issues short-lived client
+// certificates from CSRs.
+type Authority struct {
+	cert    *x509.Certificate
+	key     crypto.Signer
+	dir     string
+	certTTL time.Duration
+
+	maxPending        int
+	maxPendingPerName int
+	requestTTL        time.Duration
+
+	mu    *sync.Mutex
+	state state
+	// crlNextUpdate is when the CRL last written goes stale.
+	crlNextUpdate time.Time
+}
+
+// AuthorityOption configures an Authority.
+type AuthorityOption func(*Authority)
+
+// WithPendingLimits caps how many requests can wait for approval at once, in
+// total and for any one name. A zero limit means unlimited.
+func WithPendingLimits(total int, perName int) AuthorityOption {
+	return func(a *Authority) {
+		a.maxPending = total
+		a.maxPendingPerName = perName
+	}
+}
+
+// WithRequestTTL forgets pending and denied requests once they are older than
+// ttl. A zero ttl keeps them forever.
+func WithRequestTTL(ttl time.Duration) AuthorityOption {
+	return func(a *Authority) {
+		a.requestTTL = ttl
+	}
+}
+
+// LoadAuthority loads the CA's certificate and private key and any state
+// saved in dir by a previous run. Certificates it issues are valid for
+// certTTL.
+func LoadAuthority(certPath string, keyPath string, dir string, certTTL time.Duration, opts ...AuthorityOption) (*Authority, error) {
+	cert, err := loadCertificate(certPath)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := loadPrivateKey(keyPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	a := &Authority{
+		cert:    cert,
+		key:     key,
+		dir:     dir,
+		certTTL: certTTL,
+		mu:      &sync.Mutex{},
+		state: state{
+			Requests: make(map[string]*Request),
+			Tokens:   make(map[string]*enrollmentToken),
+			Issued:   make(map[string]*IssuedCertificate),
+		},
+	}
+	for _, opt := range opts {
+		opt(a)
+	}
+
+	b, err := ioutil.ReadFile(filepath.Join(dir, stateFile))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err == nil {
+		if err := json.Unmarshal(b, &a.state); err != nil {
+			return nil, fmt.Errorf("reading ca state: %w", err)
+		}
+	}
+	if a.prune(time.Now()) {
+		if err := a.save(); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := a.writeCRL(); err != nil {
+		return nil, err
+	}
+
+	return a, nil
+}
+
+// KeepCRLFresh checks the CRL every interval until ctx is cancelled and
+// re-signs it once less than half of its validity is left, so that a CA
+// without revocations never publishes a stale CRL. onUpdate is called after
+// every re-sign so that the new CRL can be picked up.
+func (a *Authority) KeepCRLFresh(ctx context.Context, interval time.Duration, onUpdate func()) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			updated, err := a.refreshCRL(now)
+			if err != nil {
+				log.Printf("failed to re-sign the ca's crl: %v", err)
+			}
+			if updated {
+				onUpdate()
+			}
+		}
+	}
+}
+
+// refreshCRL re-signs the CRL if less than half of its validity is left at
+// now, and reports whether it did.
+func (a *Authority) refreshCRL(now time.Time) (bool, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.crlNextUpdate.Sub(now) > crlValidity/2 {
+		return false, nil
+	}
+	if err := a.writeCRL(); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// CRLPath returns the location of the CRL listing every revoked certificate.
+func (a *Authority) CRLPath() string {
+	return filepath.Join(a.dir, crlFile)
+}
+
+// CreateToken creates a one-time enrollment token for name that expires
+// after ttl. Certificates issued with it carry role, if set.
+func (a *Authority) CreateToken(name string, role auth.Role, ttl time.Duration) (string, time.Time, error) {
+	if name == "" {
+		return "", time.Time{}, &ErrInvalidRequest{reason: "a token must be bound to a name"}
+	}
+	if role != "" && !role.Valid() {
+		return "", time.Time{}, &ErrInvalidRequest{reason: fmt.Sprintf("unknown role %q", role)}
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", time.Time{}, err
+	}
+	token := hex.EncodeToString(b)
+	expiresAt := time.Now().Add(ttl)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.prune(time.Now())
+	a.state.Tokens[hashToken(token)] = &enrollmentToken{Name: name, Role: role, ExpiresAt: expiresAt}
+	return token, expiresAt, a.save()
+}
+
+// Submit records a CSR for enrollment. With a valid token the certificate is
+// issued straight away and the token is used up, otherwise the request waits
+// for an admin to approve it.
+func (a *Authority) Submit(csrPEM []byte, token string) (Request, error) {
+	csr, name, err := parseCSR(csrPEM)
+	if err != nil {
+		return Request{}, err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	now := time.Now()
+	a.prune(now)
+	req := &Request{
+		Id:        uuid.NewString(),
+		Name:      name,
+		State:     Pending,
+		CSR:       csrPEM,
+		CreatedAt: now,
+	}
+
+	if token != "" {
+		hash := hashToken(token)
+		t, ok := a.state.Tokens[hash]
+		if !ok || time.Now().After(t.ExpiresAt) {
+			return Request{}, &ErrInvalidToken{}
+		}
+		if t.Name != name {
+			return Request{}, &ErrInvalidRequest{reason: fmt.Sprintf("token was issued for %q, not %q", t.Name, name)}
+		}
+
+		delete(a.state.Tokens, hash)
+		req.Role = t.Role
+		if err := a.issue(req, csr); err != nil {
+			return Request{}, err
+		}
+	} else if err := a.checkPendingLimits(name); err != nil {
+		return Request{}, err
+	}
+
+	a.state.Requests[req.Id] = req
+	return *req, a.save()
+}
+
+// Get returns a certificate request.
+func (a *Authority) Get(id string) (Request, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	req, ok := a.state.Requests[id]
+	if !ok {
+		return Request{}, &ErrNotFound{}
+	}
+	return *req, nil
+}
+
+// List returns every certificate request, oldest first.
+func (a *Authority) List() []Request {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	requests := make([]Request, 0, len(a.state.Requests))
+	for _, req := range a.state.Requests {
+		requests = append(requests, *req)
+	}
+	sort.Slice(requests, func(i, j int) bool {
+		return requests[i].CreatedAt.Before(requests[j].CreatedAt)
+	})
+	return requests
+}
+
+// Approve issues the certificate for a pending request, granting role if set.
+func (a *Authority) Approve(id string, role auth.Role) (Request, error) {
+	if role != "" && !role.Valid() {
+		return Request{}, &ErrInvalidRequest{reason: fmt.Sprintf("unknown role %q", role)}
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	req, ok := a.state.Requests[id]
+	if !ok {
+		return Request{}, &ErrNotFound{}
+	}
+	if req.State != Pending {
+		return Request{}, &ErrInvalidRequest{reason: "request is not pending"}
+	}
+
+	csr, _, err := parseCSR(req.CSR)
+	if err != nil {
+		return Request{}, err
+	}
+
+	req.Role = role
+	if err := a.issue(req, csr); err != nil {
+		return Request{}, err
+	}
+	return *req, a.save()
+}
+
+// Deny rejects a pending request.
+func (a *Authority) Deny(id string) (Request, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	req, ok := a.state.Requests[id]
+	if !ok {
+		return Request{}, &ErrNotFound{}
+	}
+	if req.State != Pending {
+		return Request{}, &ErrInvalidRequest{reason: "request is not pending"}
+	}
+	req.State = Denied
+	return *req, a.save()
+}
+
+// Renew issues a new certificate for an already authenticated client. The
+// CSR has to be for the client's own identity, and the renewed certificate
+// keeps the role granted the last time this CA issued one for it.
+func (a *Authority) Renew(csrPEM []byte, id auth.Identity) (Request, error) {
+	csr, name, err := parseCSR(csrPEM)
+	if err != nil {
+		return Request{}, err
+	}
+	if name != id.Name {
+		return Request{}, &ErrInvalidRequest{reason: fmt.Sprintf("cannot renew a certificate for %q as %q", name, id.Name)}
+	}
+	if id.Issuer != a.cert.Subject.String() {
+		return Request{}, &ErrInvalidRequest{reason: "only certificates issued by this CA can be renewed"}
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	req := &Request{
+		Id:        uuid.NewString(),
+		Name:      name,
+		CSR:       csrPEM,
+		CreatedAt: time.Now(),
+	}
+	var latest *Request
+	for _, prev := range a.state.Requests {
+		if prev.Name == name && prev.State == Issued && (latest == nil || prev.CreatedAt.After(latest.CreatedAt)) {
+			latest = prev
+		}
+	}
+	if latest != nil {
+		req.Role = latest.Role
+	}
+
+	if err := a.issue(req, csr); err != nil {
+		return Request{}, err
+	}
+	a.state.Requests[req.Id] = req
+	return *req, a.save()
+}
+
+// Issued returns every certificate signed by the authority.
+func (a *Authority) Issued() []IssuedCertificate {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	issued := make([]IssuedCertificate, 0, len(a.state.Issued))
+	for _, crt := range a.state.Issued {
+		issued = append(issued, *crt)
+	}
+	sort.Slice(issued, func(i, j int) bool {
+		return issued[i].NotAfter.Before(issued[j].NotAfter)
+	})
+	return issued
+}
+
+// Revoke marks a certificate as revoked and regenerates the CRL.
+func (a *Authority) Revoke(serial string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	crt, ok := a.state.Issued[serial]
+	if !ok {
+		return &ErrNotFound{}
+	}
+	if !crt.Revoked {
+		crt.Revoked = true
+		crt.RevokedAt = time.Now()
+	}
+	if err := a.save(); err != nil {
+		return err
+	}
+	return a.writeCRL()
+}
+
+// checkPendingLimits checks that another request for name can wait for
+// approval. Callers must hold a.mu.
+func (a *Authority) checkPendingLimits(name string) error {
+	total, forName := 0, 0
+	for _, req := range a.state.Requests {
+		if req.State != Pending {
+			continue
+		}
+		total++
+		if req.Name == name {
+			forName++
+		}
+	}
+	if a.maxPendingPerName > 0 && forName >= a.maxPendingPerName {
+		return &ErrTooManyRequests{reason: fmt.Sprintf("%q already has %d requests waiting for approval", name, forName)}
+	}
+	if a.maxPending > 0 && total >= a.maxPending {
+		return &ErrTooManyRequests{reason: fmt.Sprintf("%d requests are already waiting for approval", total)}
+	}
+	return nil
+}
+
+// prune forgets expired tokens, and pending and denied requests older than
+// the request ttl. It reports whether anything was removed. Callers must hold
+// a.mu or have exclusive access to the authority.
+func (a *Authority) prune(now time.Time) bool {
+	pruned := false
+	for hash, t := range a.state.Tokens {
+		if now.After(t.ExpiresAt) {
+			delete(a.state.Tokens, hash)
+			pruned = true
+		}
+	}
+	if a.requestTTL <= 0 {
+		return pruned
+	}
+	for id, req := range a.state.Requests {
+		if req.State != Issued && now.Sub(req.CreatedAt) > a.requestTTL {
+			delete(a.state.Requests, id)
+			pruned = true
+		}
+	}
+	return pruned
+}
+
+// issue signs the CSR and records the certificate. The certificate only
+// carries the requester's name, and the role URI if one was granted, so a
+// CSR cannot ask for extra OUs or SANs. Callers must hold a.mu.
+func (a *Authority) issue(req *Request, csr *x509.CertificateRequest) error {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: csr.Subject.CommonName},
+		NotBefore:    now.Add(-time.Minute),
+		NotAfter:     now.Add(a.certTTL),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	for _, uri := range csr.URIs {
+		if uri.Scheme == "spiffe" {
+			template.URIs = []*url.URL{uri}
+			break
+		}
+	}
+	if req.Role != "" {
+		template.URIs = append(template.URIs, auth.RoleURI(req.Role))
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, a.cert, csr.PublicKey, a.key)
+	if err != nil {
+		return err
+	}
+
+	req.State = Issued
+	req.Serial = serial.String()
+	req.Certificate = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	a.state.Issued[req.Serial] = &IssuedCertificate{
+		Serial:   req.Serial,
+		Name:     req.Name,
+		NotAfter: template.NotAfter,
+	}
+	return nil
+}
+
+// writeCRL signs a CRL listing every revoked certificate. Callers must hold
+// a.mu or have exclusive access to the authority.
+func (a *Authority) writeCRL() error {
+	var revoked []pkix.RevokedCertificate
+	for _, crt := range a.state.Issued {
+		if !crt.Revoked {
+			continue
+		}
+		serial, ok := new(big.Int).SetString(crt.Serial, 10)
+		if !ok {
+			return fmt.Errorf("invalid serial %q in ca state", crt.Serial)
+		}
+		revoked = append(revoked, pkix.RevokedCertificate{SerialNumber: serial, RevocationTime: crt.RevokedAt})
+	}
+
+	now := time.Now()
+	der, err := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+		Number:              big.NewInt(now.UnixNano()),
+		ThisUpdate:          now,
+		NextUpdate:          now.Add(crlValidity),
+		RevokedCertificates: revoked,
+	}, a.cert, a.key)
+	if err != nil {
+		return err
+	}
+
+	if err := writeFileAtomic(a.CRLPath(), pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: der})); err != nil {
+		return err
+	}
+	a.crlNextUpdate = now.Add(crlValidity)
+	return nil
+}
+
+// save persists the authority's state. Callers must hold a.mu.
+func (a *Authority) save() error {
+	b, err := json.MarshalIndent(a.state, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(a.dir, stateFile), b)
+}
+
+// parseCSR decodes a PEM encoded CSR, checks its signature and returns the
+// identity name it asks for.
+func parseCSR(csrPEM []byte) (*x509.CertificateRequest, string, error) {
+	block, _ := pem.Decode(csrPEM)
+	if block == nil || block.Type != "CERTIFICATE REQUEST" {
+		return nil, "", &ErrInvalidRequest{reason: "csr must be a PEM encoded CERTIFICATE REQUEST"}
+	}
+
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		return nil, "", &ErrInvalidRequest{reason: err.Error()}
+	}
+	if err := csr.CheckSignature(); err != nil {
+		return nil, "", &ErrInvalidRequest{reason: err.Error()}
+	}
+
+	// the name is derived the same way auth derives identities from certificates
+	for _, uri := range csr.URIs {
+		if uri.Scheme == "spiffe" {
+			return csr, uri.String(), nil
+		}
+	}
+	if csr.Subject.CommonName == "" {
+		return nil, "", &ErrInvalidRequest{reason: "csr has neither a SPIFFE ID nor a common name"}
+	}
+	return csr, csr.Subject.CommonName, nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func loadCertificate(path string) (*x509.Certificate, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(b)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, fmt.Errorf("%s does not contain a PEM encoded certificate", path)
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
+
+func loadPrivateKey(path string) (crypto.Signer, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, fmt.Errorf("%s does not contain a PEM encoded private key", path)
+	}
+
+	var key interface{}
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("%s does not contain a signing key", path)
+	}
+	return signer, nil
+}
+
+// writeFileAtomic replaces path with b so that readers never see a partial file.
+func writeFileAtomic(path string, b []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,282 @@
+package ca
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ItsMeWithTheFace/linux-process-runner/auth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type AuthorityTestSuite struct {
+	suite.Suite
+	dir      string
+	certPath string
+	keyPath  string
+}
+
+func (suite *AuthorityTestSuite) SetupTest() {
+	dir, err := ioutil.TempDir("", "ca")
+	suite.Require().NoError(err)
+	suite.dir = dir
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	suite.Require().NoError(err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	suite.Require().NoError(err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	suite.Require().NoError(err)
+
+	suite.certPath = filepath.Join(dir, "ca.pem")
+	suite.keyPath = filepath.Join(dir, "ca.key")
+	suite.Require().NoError(ioutil.WriteFile(suite.certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	suite.Require().NoError(ioutil.WriteFile(suite.keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600))
+}
+
+func (suite *AuthorityTestSuite) TearDownTest() {
+	os.RemoveAll(suite.dir)
+}
+
+func (suite *AuthorityTestSuite) load() *Authority {
+	a, err := LoadAuthority(suite.certPath, suite.keyPath, filepath.Join(suite.dir, "state"), time.Hour)
+	suite.Require().NoError(err)
+	return a
+}
+
+func (suite *AuthorityTestSuite) csr(name string) []byte {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	suite.Require().NoError(err)
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject: pkix.Name{CommonName: name, OrganizationalUnit: []string{"admin"}},
+	}, key)
+	suite.Require().NoError(err)
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der})
+}
+
+func parseCertificate(t *testing.T, b []byte) *x509.Certificate {
+	block, _ := pem.Decode(b)
+	if !assert.NotNil(t, block) {
+		t.FailNow()
+	}
+	crt, err := x509.ParseCertificate(block.Bytes)
+	assert.NoError(t, err)
+	return crt
+}
+
+func (suite *AuthorityTestSuite) TestEnrollWithToken() {
+	a := suite.load()
+
+	token, _, err := a.CreateToken("alice", auth.RoleViewer, time.Hour)
+	suite.Require().NoError(err)
+
+	_, err = a.Submit(suite.csr("bob"), token)
+	assert.IsType(suite.T(), &ErrInvalidRequest{}, err, "token should only work for the name it was created for")
+
+	req, err := a.Submit(suite.csr("alice"), token)
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), Issued, req.State, "request with a valid token should be issued straight away")
+
+	crt := parseCertificate(suite.T(), req.Certificate)
+	assert.Equal(suite.T(), "alice", crt.Subject.CommonName)
+	assert.Empty(suite.T(), crt.Subject.OrganizationalUnit, "OUs from the CSR should not be copied")
+	assert.Equal(suite.T(), []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}, crt.ExtKeyUsage)
+	if assert.Len(suite.T(), crt.URIs, 1) {
+		assert.Equal(suite.T(), auth.RoleURI(auth.RoleViewer).String(), crt.URIs[0].String(), "token's role should be granted")
+	}
+
+	_, err = a.Submit(suite.csr("alice"), token)
+	assert.IsType(suite.T(), &ErrInvalidToken{}, err, "tokens can only be used once")
+}
+
+func (suite *AuthorityTestSuite) TestExpiredToken() {
+	a := suite.load()
+
+	token, _, err := a.CreateToken("alice", "", -time.Second)
+	suite.Require().NoError(err)
+
+	_, err = a.Submit(suite.csr("alice"), token)
+	assert.IsType(suite.T(), &ErrInvalidToken{}, err)
+}
+
+func (suite *AuthorityTestSuite) TestApproveAndDeny() {
+	a := suite.load()
+
+	pending, err := a.Submit(suite.csr("alice"), "")
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), Pending, pending.State, "request without a token should wait for approval")
+	assert.Empty(suite.T(), pending.Certificate)
+
+	approved, err := a.Approve(pending.Id, auth.RoleOperator)
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), Issued, approved.State)
+	assert.NotEmpty(suite.T(), approved.Certificate)
+
+	other, err := a.Submit(suite.csr("mallory"), "")
+	suite.Require().NoError(err)
+	denied, err := a.Deny(other.Id)
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), Denied, denied.State)
+
+	_, err = a.Approve(other.Id, "")
+	assert.Error(suite.T(), err, "denied requests cannot be approved")
+
+	_, err = a.Get("missing")
+	assert.IsType(suite.T(), &ErrNotFound{}, err)
+}
+
+func (suite *AuthorityTestSuite) TestPendingLimits() {
+	a, err := LoadAuthority(suite.certPath, suite.keyPath, filepath.Join(suite.dir, "state"), time.Hour, WithPendingLimits(3, 2))
+	suite.Require().NoError(err)
+
+	for i := 0; i < 2; i++ {
+		_, err := a.Submit(suite.csr("mallory"), "")
+		suite.Require().NoError(err)
+	}
+	_, err = a.Submit(suite.csr("mallory"), "")
+	assert.IsType(suite.T(), &ErrTooManyRequests{}, err, "a name should only have so many requests waiting")
+
+	_, err = a.Submit(suite.csr("alice"), "")
+	suite.Require().NoError(err)
+	_, err = a.Submit(suite.csr("bob"), "")
+	assert.IsType(suite.T(), &ErrTooManyRequests{}, err, "only so many requests should wait in total")
+
+	token, _, err := a.CreateToken("bob", "", time.Hour)
+	suite.Require().NoError(err)
+	_, err = a.Submit(suite.csr("bob"), token)
+	assert.NoError(suite.T(), err, "requests with a token don't wait, so aren't limited")
+}
+
+func (suite *AuthorityTestSuite) TestPruneExpired() {
+	a, err := LoadAuthority(suite.certPath, suite.keyPath, filepath.Join(suite.dir, "state"), time.Hour, WithRequestTTL(time.Hour))
+	suite.Require().NoError(err)
+
+	pending, err := a.Submit(suite.csr("alice"), "")
+	suite.Require().NoError(err)
+	denied, err := a.Submit(suite.csr("mallory"), "")
+	suite.Require().NoError(err)
+	_, err = a.Deny(denied.Id)
+	suite.Require().NoError(err)
+	token, _, err := a.CreateToken("bob", "", time.Minute)
+	suite.Require().NoError(err)
+	issued, err := a.Submit(suite.csr("bob"), token)
+	suite.Require().NoError(err)
+	_, _, err = a.CreateToken("carol", "", time.Minute)
+	suite.Require().NoError(err)
+
+	a.mu.Lock()
+	assert.True(suite.T(), a.prune(time.Now().Add(2*time.Hour)))
+	assert.Empty(suite.T(), a.state.Tokens, "expired tokens should be forgotten")
+	a.mu.Unlock()
+
+	_, err = a.Get(pending.Id)
+	assert.IsType(suite.T(), &ErrNotFound{}, err, "old pending requests should be forgotten")
+	_, err = a.Get(denied.Id)
+	assert.IsType(suite.T(), &ErrNotFound{}, err, "old denied requests should be forgotten")
+	_, err = a.Get(issued.Id)
+	assert.NoError(suite.T(), err, "issued requests should be kept")
+}
+
+func (suite *AuthorityTestSuite) TestRenewKeepsRole() {
+	a := suite.load()
+
+	token, _, err := a.CreateToken("alice", auth.RoleAdmin, time.Hour)
+	suite.Require().NoError(err)
+	req, err := a.Submit(suite.csr("alice"), token)
+	suite.Require().NoError(err)
+
+	id, err := auth.IdentityFromCertificate(parseCertificate(suite.T(), req.Certificate))
+	suite.Require().NoError(err)
+
+	_, err = a.Renew(suite.csr("bob"), id)
+	assert.IsType(suite.T(), &ErrInvalidRequest{}, err, "clients can only renew their own certificate")
+
+	renewed, err := a.Renew(suite.csr("alice"), id)
+	suite.Require().NoError(err)
+	assert.NotEqual(suite.T(), req.Serial, renewed.Serial)
+	assert.Equal(suite.T(), auth.RoleAdmin, renewed.Role, "renewed certificate should keep its role")
+}
+
+func (suite *AuthorityTestSuite) TestRevoke() {
+	a := suite.load()
+
+	token, _, err := a.CreateToken("alice", "", time.Hour)
+	suite.Require().NoError(err)
+	req, err := a.Submit(suite.csr("alice"), token)
+	suite.Require().NoError(err)
+	crt := parseCertificate(suite.T(), req.Certificate)
+
+	rc, err := auth.NewRevocationChecker(suite.certPath, []string{a.CRLPath()})
+	suite.Require().NoError(err, "the ca should always write a crl")
+	assert.False(suite.T(), rc.IsRevoked(crt))
+
+	suite.Require().NoError(a.Revoke(req.Serial))
+	suite.Require().NoError(rc.Refresh())
+	assert.True(suite.T(), rc.IsRevoked(crt), "revoked certificate should be in the crl")
+
+	assert.IsType(suite.T(), &ErrNotFound{}, a.Revoke("1234"))
+}
+
+func (suite *AuthorityTestSuite) TestRefreshCRL() {
+	a := suite.load()
+	number := func() *big.Int {
+		b, err := ioutil.ReadFile(a.CRLPath())
+		suite.Require().NoError(err)
+		block, _ := pem.Decode(b)
+		suite.Require().NotNil(block)
+		crl, err := x509.ParseRevocationList(block.Bytes)
+		suite.Require().NoError(err)
+		return crl.Number
+	}
+	first := number()
+
+	updated, err := a.refreshCRL(time.Now())
+	suite.Require().NoError(err)
+	assert.False(suite.T(), updated, "a fresh crl should be left alone")
+
+	updated, err = a.refreshCRL(time.Now().Add(crlValidity / 2))
+	suite.Require().NoError(err)
+	assert.True(suite.T(), updated, "a crl half way through its validity should be re-signed")
+	assert.Equal(suite.T(), 1, number().Cmp(first), "the re-signed crl should have a higher number")
+}
+
+func (suite *AuthorityTestSuite) TestStatePersists() {
+	a := suite.load()
+
+	token, _, err := a.CreateToken("alice", "", time.Hour)
+	suite.Require().NoError(err)
+	pending, err := a.Submit(suite.csr("bob"), "")
+	suite.Require().NoError(err)
+
+	reloaded := suite.load()
+
+	_, err = reloaded.Submit(suite.csr("alice"), token)
+	assert.NoError(suite.T(), err, "tokens should survive a restart")
+
+	_, err = reloaded.Approve(pending.Id, "")
+	assert.NoError(suite.T(), err, "pending requests should survive a restart")
+	assert.Len(suite.T(), reloaded.Issued(), 2)
+}
+
+func TestAuthorityTestSuite(t *testing.T) {
+	suite.Run(t, new(AuthorityTestSuite))
+}
@@ -0,0 +1,31 @@
+package ca
+
+import "fmt"
+
+type ErrNotFound struct{}
+
+type ErrInvalidToken struct{}
+
+type ErrInvalidRequest struct {
+	reason string
+}
+
+type ErrTooManyRequests struct {
+	reason string
+}
+
+func (e *ErrNotFound) Error() string {
+	return fmt.Sprintf("certificate request not found")
+}
+
+func (e *ErrInvalidToken) Error() string {
+	return fmt.Sprintf("enrollment token is invalid, expired or already used")
+}
+
+func (e *ErrInvalidRequest) Error() string {
+	return fmt.Sprintf("invalid certificate request: %s", e.reason)
+}
+
+func (e *ErrTooManyRequests) Error() string {
+	return fmt.Sprintf("too many certificate requests: %s", e.reason)
+}
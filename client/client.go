@@ -0,0 +1,254 @@
+package client
+
+import (
+	"context"
+	"fmt"
+
+	pb "github.com/ItsMeWithTheFace/linux-process-runner/api/proto"
+	"github.com/ItsMeWithTheFace/linux-process-runner/auth"
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
+)
+
+// DefaultAddress is the server the client connects to unless told otherwise.
+const DefaultAddress = "localhost:8080"
+
+// Client is a connection to a job runner server. Its methods return the
+// server's errors as gRPC statuses, which status.Code can inspect, and retry
+// calls that fail with Unavailable according to its retry policy.
+type Client struct {
+	conn   *grpc.ClientConn
+	jobs   pb.JobRunnerServiceClient
+	retry  RetryPolicy
+	cancel context.CancelFunc
+}
+
+type options struct {
+	addr     string
+	creds    credentials.TransportCredentials
+	tlsFiles *auth.TlsFiles
+	dialOpts []grpc.DialOption
+	retry    RetryPolicy
+}
+
+// Option configures a Client.
+type Option func(*options)
+
+// WithAddress connects to the server at addr instead of DefaultAddress.
+func WithAddress(addr string) Option {
+	return func(o *options) {
+		o.addr = addr
+	}
+}
+
+// WithTLSFiles authenticates with the client certificate and key in the
+// given PEM files and trusts servers signed by the CA in ca. The files are
+// watched and reloaded when they change, so rotated certificates are used
+// when the client reconnects.
+func WithTLSFiles(cert string, key string, ca string) Option {
+	return func(o *options) {
+		o.tlsFiles = &auth.TlsFiles{Cert: cert, Key: key, CA: ca}
+	}
+}
+
+// WithTransportCredentials uses creds to secure the connection instead of
+// files.
+func WithTransportCredentials(creds credentials.TransportCredentials) Option {
+	return func(o *options) {
+		o.creds = creds
+	}
+}
+
+// WithRetryPolicy retries calls that fail with Unavailable according to
+// policy instead of DefaultRetryPolicy.
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(o *options) {
+		o.retry = policy
+	}
+}
+
+// WithDialOptions passes extra options to grpc.Dial.
+func WithDialOptions(opts ...grpc.DialOption) Option {
+	return func(o *options) {
+		o.dialOpts = append(o.dialOpts, opts...)
+	}
+}
+
+// Dial creates a client for the server. One of WithTLSFiles or
+// WithTransportCredentials is required. The connection is made lazily, so an
+// unreachable server only shows up once the first call fails.
+func Dial(opts ...Option) (*Client, error) {
+	o := options{addr: DefaultAddress, retry: DefaultRetryPolicy}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	dialOpts := append([]grpc.DialOption(nil), o.dialOpts...)
+	switch {
+	case o.creds != nil:
+		dialOpts = append(dialOpts, grpc.WithTransportCredentials(o.creds))
+	case o.tlsFiles != nil:
+		reloader, err := auth.NewClientTlsReloader(*o.tlsFiles)
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		go reloader.Watch(ctx, auth.DefaultWatchInterval)
+		dialOpts = append(dialOpts, grpc.WithTransportCredentials(reloader.Credentials()))
+	default:
+		cancel()
+		return nil, fmt.Errorf("client: credentials are required, use WithTLSFiles or WithTransportCredentials")
+	}
+
+	conn, err := grpc.Dial(o.addr, dialOpts...)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	return &Client{
+		conn:   conn,
+		jobs:   pb.NewJobRunnerServiceClient(conn),
+		retry:  o.retry,
+		cancel: cancel,
+	}, nil
+}
+
+// Close closes the connection to the server.
+func (c *Client) Close() error {
+	c.cancel()
+	return c.conn.Close()
+}
+
+// StartOption configures a job started with Start.
+type StartOption func(*pb.JobStartRequest)
+
+// WithName names the job. Names are unique among the owner's jobs and can be
+// used instead of the job's ID.
+func WithName(name string) StartOption {
+	return func(req *pb.JobStartRequest) {
+		req.Name = name
+	}
+}
+
+// WithLabels attaches labels, which jobs can be selected by, to the job.
+func WithLabels(labels map[string]string) StartOption {
+	return func(req *pb.JobStartRequest) {
+		req.Labels = labels
+	}
+}
+
+// WithAnnotations attaches free-form annotations to the job.
+func WithAnnotations(annotations map[string]string) StartOption {
+	return func(req *pb.JobStartRequest) {
+		req.Annotations = annotations
+	}
+}
+
+// WithPriority sets the job's place in the queue when the server queues jobs
+// by priority.
+func WithPriority(priority int32) StartOption {
+	return func(req *pb.JobStartRequest) {
+		req.Priority = priority
+	}
+}
+
+// WithRestartPolicy runs the job's command again as policy asks.
+func WithRestartPolicy(policy RestartPolicy) StartOption {
+	return func(req *pb.JobStartRequest) {
+		req.RestartPolicy = policy.proto()
+	}
+}
+
+// WithIdempotencyKey sets the key that makes retrying the start safe. Start
+// generates one if none is given.
+func WithIdempotencyKey(key string) StartOption {
+	return func(req *pb.JobStartRequest) {
+		req.IdempotencyKey = key
+	}
+}
+
+// Start starts a job and returns its ID. Every start carries an idempotency
+// key, so a retry after the server went away returns the job the first try
+// started, as long as the server remembers idempotency keys.
+func (c *Client) Start(ctx context.Context, command string, args []string, opts ...StartOption) (string, error) {
+	req := &pb.JobStartRequest{Command: command, Arguments: args, IdempotencyKey: uuid.NewString()}
+	for _, opt := range opts {
+		opt(req)
+	}
+
+	var out *pb.JobStartOutput
+	err := c.call(ctx, func(ctx context.Context) (err error) {
+		out, err = c.jobs.StartJob(ctx, req)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	return out.GetId(), nil
+}
+
+// Stop stops a running job or cancels a queued one. id can be the job's ID
+// or name. Stopping a finished job fails with FailedPrecondition, except on a
+// retry, where the try that went unanswered may have stopped it.
+func (c *Client) Stop(ctx context.Context, id string) error {
+	attempt := 0
+	return c.call(ctx, func(ctx context.Context) error {
+		attempt++
+		_, err := c.jobs.StopJob(ctx, &pb.JobStopRequest{Id: id})
+		if attempt > 1 && status.Code(err) == codes.FailedPrecondition {
+			return nil
+		}
+		return err
+	})
+}
+
+// Get returns a job by its ID or name.
+func (c *Client) Get(ctx context.Context, id string) (Job, error) {
+	var info *pb.JobInfo
+	err := c.call(ctx, func(ctx context.Context) (err error) {
+		info, err = c.jobs.GetJobInfo(ctx, &pb.JobQueryRequest{Id: id})
+		return err
+	})
+	if err != nil {
+		return Job{}, err
+	}
+	return jobFromProto(info), nil
+}
+
+// List returns the jobs a label selector matches that the caller can see,
+// oldest first. An empty selector matches every job.
+func (c *Client) List(ctx context.Context, selector string) ([]Job, error) {
+	var list *pb.JobList
+	err := c.call(ctx, func(ctx context.Context) (err error) {
+		list, err = c.jobs.ListJobs(ctx, &pb.ListJobsRequest{Selector: selector})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	jobs := make([]Job, 0, len(list.GetJobs()))
+	for _, info := range list.GetJobs() {
+		jobs = append(jobs, jobFromProto(info))
+	}
+	return jobs, nil
+}
+
+// Wait blocks until a job has finished and its last attempt has exited, and
+// returns it. Use ctx to give up waiting.
+func (c *Client) Wait(ctx context.Context, id string) (Job, error) {
+	var info *pb.JobInfo
+	err := c.call(ctx, func(ctx context.Context) (err error) {
+		info, err = c.jobs.WaitJob(ctx, &pb.JobQueryRequest{Id: id})
+		return err
+	})
+	if err != nil {
+		return Job{}, err
+	}
+	return jobFromProto(info), nil
+}
@@ -0,0 +1,202 @@
+package client
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ItsMeWithTheFace/linux-process-runner/api"
+	pb "github.com/ItsMeWithTheFace/linux-process-runner/api/proto"
+	"github.com/ItsMeWithTheFace/linux-process-runner/auth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+const certDir = "../api/test_certs/ca1/"
+
+// flakyServer fails the first call to StartJob, loses the reply to the first
+// StopJob and breaks off the first output stream partway through a message,
+// the way a restarting server would.
+type flakyServer struct {
+	*api.JobRunnerServer
+	starts  int32
+	stops   int32
+	streams int32
+}
+
+func (s *flakyServer) StartJob(ctx context.Context, req *pb.JobStartRequest) (*pb.JobStartOutput, error) {
+	if atomic.AddInt32(&s.starts, 1) == 1 {
+		return nil, status.Error(codes.Unavailable, "server is restarting")
+	}
+	return s.JobRunnerServer.StartJob(ctx, req)
+}
+
+func (s *flakyServer) StopJob(ctx context.Context, req *pb.JobStopRequest) (*pb.JobStopOutput, error) {
+	out, err := s.JobRunnerServer.StopJob(ctx, req)
+	if atomic.AddInt32(&s.stops, 1) == 1 {
+		return nil, status.Error(codes.Unavailable, "server is restarting")
+	}
+	return out, err
+}
+
+func (s *flakyServer) StreamJobOutput(req *pb.JobQueryRequest, srv pb.JobRunnerService_StreamJobOutputServer) error {
+	if atomic.AddInt32(&s.streams, 1) == 1 {
+		s.JobRunnerServer.StreamJobOutput(req, &brokenStream{srv})
+		return status.Error(codes.Unavailable, "server is restarting")
+	}
+	return s.JobRunnerServer.StreamJobOutput(req, srv)
+}
+
+// brokenStream sends two bytes of the first message and fails after that.
+type brokenStream struct {
+	pb.JobRunnerService_StreamJobOutputServer
+}
+
+func (s *brokenStream) Send(out *pb.JobStreamOutput) error {
+	if len(out.GetOutput()) > 2 {
+		s.JobRunnerService_StreamJobOutputServer.Send(&pb.JobStreamOutput{Output: out.GetOutput()[:2]})
+	}
+	return status.Error(codes.Unavailable, "server is restarting")
+}
+
+type ClientTestSuite struct {
+	suite.Suite
+	flaky  *flakyServer
+	server *grpc.Server
+	client *Client
+}
+
+func (suite *ClientTestSuite) SetupTest() {
+	reloader, err := auth.NewServerTlsReloader(auth.TlsFiles{
+		Cert: certDir + "server.pem",
+		Key:  certDir + "server.key",
+		CA:   certDir + "ca1.pem",
+	})
+	suite.Require().NoError(err)
+	authenticator := auth.NewAuthenticator()
+	suite.server = grpc.NewServer(
+		grpc.Creds(reloader.Credentials()),
+		grpc.UnaryInterceptor(authenticator.UnaryInterceptor),
+		grpc.StreamInterceptor(authenticator.StreamInterceptor),
+	)
+	suite.flaky = &flakyServer{JobRunnerServer: api.InitializeJobRunnerServer()}
+	pb.RegisterJobRunnerServiceServer(suite.server, suite.flaky)
+
+	lis := bufconn.Listen(1024 * 1024)
+	go suite.server.Serve(lis)
+
+	suite.client, err = Dial(
+		WithAddress("bufnet"),
+		WithTLSFiles(certDir+"client.pem", certDir+"client.key", certDir+"ca1.pem"),
+		WithRetryPolicy(RetryPolicy{MaxAttempts: 3, InitialBackoff: 10 * time.Millisecond, MaxBackoff: 50 * time.Millisecond}),
+		WithDialOptions(grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		})),
+	)
+	suite.Require().NoError(err)
+}
+
+func (suite *ClientTestSuite) TearDownTest() {
+	suite.client.Close()
+	suite.server.Stop()
+}
+
+func (suite *ClientTestSuite) TestJobLifecycle() {
+	ctx := context.Background()
+	id, err := suite.client.Start(ctx, "echo", []string{"hello"}, WithName("greet"), WithLabels(map[string]string{"env": "dev"}))
+	suite.Require().NoError(err, "the start should be retried after Unavailable")
+	assert.Equal(suite.T(), int32(2), atomic.LoadInt32(&suite.flaky.starts))
+
+	job, err := suite.client.Wait(ctx, "greet")
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), id, job.ID)
+	assert.Equal(suite.T(), StateCompleted, job.State)
+	assert.Equal(suite.T(), 0, job.ExitCode)
+	assert.Equal(suite.T(), []string{"hello"}, job.Args)
+	assert.True(suite.T(), job.Finished())
+
+	jobs, err := suite.client.List(ctx, "env=dev")
+	suite.Require().NoError(err)
+	suite.Require().Len(jobs, 1)
+	assert.Equal(suite.T(), "greet", jobs[0].Name)
+
+	jobs, err = suite.client.List(ctx, "env=prod")
+	suite.Require().NoError(err)
+	assert.Empty(suite.T(), jobs)
+}
+
+func (suite *ClientTestSuite) TestLogsResumeAfterDisconnect() {
+	ctx := context.Background()
+	id, err := suite.client.Start(ctx, "echo", []string{"hello"})
+	suite.Require().NoError(err)
+
+	logs := suite.client.Logs(ctx, id)
+	defer logs.Close()
+	b, err := ioutil.ReadAll(logs)
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), "hello\n", string(b), "output should carry on from where the stream broke off")
+	assert.Equal(suite.T(), int32(2), atomic.LoadInt32(&suite.flaky.streams))
+
+	logs = suite.client.Logs(ctx, id, WithOffset(3))
+	defer logs.Close()
+	b, err = ioutil.ReadAll(logs)
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), "lo\n", string(b))
+}
+
+func (suite *ClientTestSuite) TestStopAndErrors() {
+	ctx := context.Background()
+	id, err := suite.client.Start(ctx, "sleep", []string{"10"})
+	suite.Require().NoError(err)
+	suite.Eventually(func() bool {
+		job, err := suite.client.Get(ctx, id)
+		return err == nil && job.State == StateRunning
+	}, 5*time.Second, 20*time.Millisecond)
+
+	suite.Require().NoError(suite.client.Stop(ctx, id), "a retried stop of a job the first try stopped should succeed")
+	job, err := suite.client.Wait(ctx, id)
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), StateStopped, job.State)
+	err = suite.client.Stop(ctx, id)
+	assert.Equal(suite.T(), codes.FailedPrecondition, status.Code(err), "stopping a finished job should fail")
+
+	_, err = suite.client.Get(ctx, "missing")
+	assert.Equal(suite.T(), codes.NotFound, status.Code(err), "errors should be returned as gRPC statuses")
+
+	waitCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	id, err = suite.client.Start(ctx, "sleep", []string{"10"})
+	suite.Require().NoError(err)
+	defer suite.client.Stop(ctx, id)
+	_, err = suite.client.Wait(waitCtx, id)
+	assert.Error(suite.T(), err, "waiting should give up with the context")
+}
+
+func (suite *ClientTestSuite) TestDialRequiresCredentials() {
+	_, err := Dial(WithAddress("bufnet"))
+	assert.Error(suite.T(), err)
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 10, InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second}
+	for attempt, max := range []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond, time.Second, time.Second} {
+		d := policy.backoff(attempt + 1)
+		assert.True(t, d >= max/2 && d <= max, "backoff %d should be between %v and %v, got %v", attempt+1, max/2, max, d)
+	}
+
+	err := policy.wait(context.Background(), 1, status.Error(codes.NotFound, "missing"))
+	assert.Equal(t, codes.NotFound, status.Code(err), "only Unavailable should be retried")
+	err = policy.wait(context.Background(), 10, status.Error(codes.Unavailable, "down"))
+	assert.Equal(t, codes.Unavailable, status.Code(err), "the last attempt should not be retried")
+}
+
+func TestClientTestSuite(t *testing.T) {
+	suite.Run(t, new(ClientTestSuite))
+}
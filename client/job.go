@@ -0,0 +1,109 @@
+package client
+
+import (
+	"strings"
+	"time"
+
+	pb "github.com/ItsMeWithTheFace/linux-process-runner/api/proto"
+)
+
+// State is where a job is in its lifecycle.
+type State string
+
+const (
+	StateCreated   State = "created"
+	StateQueued    State = "queued"
+	StateRunning   State = "running"
+	StateStopped   State = "stopped"
+	StateCompleted State = "completed"
+	StateError     State = "error"
+)
+
+// IsTerminal reports whether a job in the state will never run again.
+func (s State) IsTerminal() bool {
+	return s == StateStopped || s == StateCompleted || s == StateError
+}
+
+// Job is a job as the server last reported it.
+type Job struct {
+	ID    string
+	Name  string
+	Owner string
+
+	Command string
+	Args    []string
+	State   State
+
+	// Attempts counts the runs of the job's command so far. ExitCode is the
+	// last one's exit code once it has exited, -1 if it was killed by a
+	// signal or didn't start.
+	Attempts int
+	ExitCode int
+	// Error and FailureReason explain why a job ended in StateError.
+	Error         string
+	FailureReason string
+
+	Labels      map[string]string
+	Annotations map[string]string
+	CreatedAt   time.Time
+
+	exited bool
+}
+
+// Finished reports whether the job is in a terminal state and its last
+// attempt, if it had any, has exited.
+func (j Job) Finished() bool {
+	return j.State.IsTerminal() && (j.Attempts == 0 || j.exited)
+}
+
+func jobFromProto(info *pb.JobInfo) Job {
+	job := Job{
+		ID:            info.GetId(),
+		Name:          info.GetName(),
+		Owner:         info.GetOwner(),
+		Command:       info.GetCommand(),
+		Args:          info.GetArguments(),
+		State:         State(strings.ToLower(info.GetState().String())),
+		Attempts:      len(info.GetAttempts()),
+		Error:         info.GetError(),
+		FailureReason: info.GetFailureReason(),
+		Labels:        info.GetLabels(),
+		Annotations:   info.GetAnnotations(),
+		CreatedAt:     time.Unix(info.GetCreatedAt(), 0),
+	}
+	if n := len(info.GetAttempts()); n > 0 {
+		last := info.GetAttempts()[n-1]
+		job.ExitCode = int(last.GetExitCode())
+		job.exited = last.GetFinishedAt() != 0
+	}
+	return job
+}
+
+// RestartMode says when a job's command runs again.
+type RestartMode int32
+
+const (
+	RestartNever RestartMode = iota
+	RestartOnFailure
+	RestartAlways
+)
+
+// RestartPolicy says when and how often a job's command runs again, with
+// the delay between runs doubling from InitialBackoff up to MaxBackoff.
+// MaxAttempts includes the first run and zero means no limit. The server's
+// defaults apply to backoffs left at zero.
+type RestartPolicy struct {
+	Mode           RestartMode
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+}
+
+func (p RestartPolicy) proto() *pb.RestartPolicy {
+	return &pb.RestartPolicy{
+		Mode:             pb.RestartMode(p.Mode),
+		MaxAttempts:      int32(p.MaxAttempts),
+		InitialBackoffMs: p.InitialBackoff.Milliseconds(),
+		MaxBackoffMs:     p.MaxBackoff.Milliseconds(),
+	}
+}
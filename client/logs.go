@@ -0,0 +1,100 @@
+package client
+
+import (
+	"context"
+	"io"
+
+	pb "github.com/ItsMeWithTheFace/linux-process-runner/api/proto"
+)
+
+// LogsOption configures the output returned by Logs.
+type LogsOption func(*pb.JobQueryRequest)
+
+// WithAttempt only returns the output of one attempt of the job, counting
+// from 1, instead of every attempt in order.
+func WithAttempt(attempt int) LogsOption {
+	return func(req *pb.JobQueryRequest) {
+		req.Attempt = int32(attempt)
+	}
+}
+
+// WithOffset skips the first offset bytes of output.
+func WithOffset(offset int64) LogsOption {
+	return func(req *pb.JobQueryRequest) {
+		req.Offset = offset
+	}
+}
+
+// Logs returns a job's output from the start, following it until the job
+// has finished. If the stream breaks off because the server is Unavailable,
+// the reader reconnects according to the client's retry policy and carries
+// on from the last byte it received. Close the reader, or cancel ctx, to stop
+// following early.
+func (c *Client) Logs(ctx context.Context, id string, opts ...LogsOption) io.ReadCloser {
+	req := &pb.JobQueryRequest{Id: id}
+	for _, opt := range opts {
+		opt(req)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	return &logReader{c: c, ctx: ctx, cancel: cancel, req: req}
+}
+
+type logReader struct {
+	c      *Client
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// req.Offset is advanced as output arrives so that a new stream picks up
+	// where the last one broke off
+	req    *pb.JobQueryRequest
+	stream pb.JobRunnerService_StreamJobOutputClient
+	buf    []byte
+	// failures counts the reconnects since output last arrived
+	failures int
+}
+
+func (r *logReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		if r.stream == nil {
+			stream, err := r.c.jobs.StreamJobOutput(r.ctx, r.req)
+			if err != nil {
+				if err = r.reconnect(err); err != nil {
+					return 0, err
+				}
+				continue
+			}
+			r.stream = stream
+		}
+
+		out, err := r.stream.Recv()
+		if err == io.EOF {
+			return 0, io.EOF
+		}
+		if err != nil {
+			r.stream = nil
+			if err = r.reconnect(err); err != nil {
+				return 0, err
+			}
+			continue
+		}
+
+		r.failures = 0
+		r.buf = out.GetOutput()
+		r.req.Offset += int64(len(r.buf))
+	}
+
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+func (r *logReader) reconnect(err error) error {
+	r.failures++
+	return r.c.retry.wait(r.ctx, r.failures, err)
+}
+
+func (r *logReader) Close() error {
+	r.cancel()
+	return nil
+}
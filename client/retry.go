@@ -0,0 +1,70 @@
+package client
+
+import (
+	"context"
+	"math/rand"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// RetryPolicy says how calls that fail because the server is Unavailable are
+// retried. MaxAttempts includes the first try, so values below 2 disable
+// retries. The delay before each retry doubles from InitialBackoff up to
+// MaxBackoff, with up to half of it taken off at random so that clients
+// don't all come back at once.
+type RetryPolicy struct {
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+}
+
+// DefaultRetryPolicy tries calls up to five times over about three seconds.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    5,
+	InitialBackoff: 200 * time.Millisecond,
+	MaxBackoff:     2 * time.Second,
+}
+
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	d := p.InitialBackoff
+	for i := 1; i < attempt && d < p.MaxBackoff; i++ {
+		d *= 2
+	}
+	if d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// wait sleeps before retrying a call that failed with err on the given
+// attempt. It returns err instead if the call shouldn't be retried, or the
+// context's error if it is done first.
+func (p RetryPolicy) wait(ctx context.Context, attempt int, err error) error {
+	if status.Code(err) != codes.Unavailable || attempt >= p.MaxAttempts {
+		return err
+	}
+
+	timer := time.NewTimer(p.backoff(attempt))
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// call runs fn, retrying it according to the client's retry policy.
+func (c *Client) call(ctx context.Context, fn func(ctx context.Context) error) error {
+	for attempt := 1; ; attempt++ {
+		err := fn(ctx)
+		if err == nil {
+			return nil
+		}
+		if err = c.retry.wait(ctx, attempt, err); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,433 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config represents the server's configuration file.
+type Config struct {
+	Listeners     ListenersConfig     `yaml:"listeners"`
+	TLS           TLSConfig           `yaml:"tls"`
+	Log           LogConfig           `yaml:"log"`
+	Limits        LimitsConfig        `yaml:"limits"`
+	Retention     RetentionConfig     `yaml:"retention"`
+	Queue         QueueConfig         `yaml:"queue"`
+	Jobs          JobsConfig          `yaml:"jobs"`
+	Authorization AuthorizationConfig `yaml:"authorization"`
+
+	CertificateAuthority CertificateAuthorityConfig `yaml:"certificate_authority"`
+
+	Audit     AuditConfig     `yaml:"audit"`
+	Schedules SchedulesConfig `yaml:"schedules"`
+
+	Idempotency IdempotencyConfig `yaml:"idempotency"`
+	Shutdown    ShutdownConfig    `yaml:"shutdown"`
+}
+
+// ListenersConfig holds the addresses the server listens on. Enrollment
+// serves the built-in CA's enrollment API without client authentication,
+// Metrics serves Prometheus metrics over plain HTTP and Gateway serves the
+// job API as JSON over HTTPS with the same mTLS as GRPC. All three are
+// disabled when empty.
+type ListenersConfig struct {
+	GRPC       string `yaml:"grpc"`
+	Enrollment string `yaml:"enrollment"`
+	Metrics    string `yaml:"metrics"`
+	Gateway    string `yaml:"gateway"`
+}
+
+// TLSConfig holds the paths to the server's TLS material. The files are
+// checked for changes every WatchInterval and the CRLs are re-read every
+// CRLRefreshInterval, a zero interval disables either. A CRL past its next
+// update is logged, with RejectStaleCRLs its issuer's certificates are
+// rejected as well.
+type TLSConfig struct {
+	Cert          string        `yaml:"cert"`
+	Key           string        `yaml:"key"`
+	CA            string        `yaml:"ca"`
+	WatchInterval time.Duration `yaml:"watch_interval"`
+
+	CRLs               []string      `yaml:"crls"`
+	CRLRefreshInterval time.Duration `yaml:"crl_refresh_interval"`
+	RejectStaleCRLs    bool          `yaml:"reject_stale_crls"`
+}
+
+// LogConfig selects where job output is written to.
+type LogConfig struct {
+	Backend string `yaml:"backend"`
+	Dir     string `yaml:"dir"`
+}
+
+// LimitsConfig holds the default resource limits applied to every job.
+// A zero value means the resource is not limited.
+type LimitsConfig struct {
+	CPUPercent   int64 `yaml:"cpu_percent"`
+	MemoryBytes  int64 `yaml:"memory_bytes"`
+	MaxProcesses int64 `yaml:"max_processes"`
+}
+
+// RetentionConfig controls how long finished jobs are kept around.
+// A zero JobTTL keeps jobs forever.
+type RetentionConfig struct {
+	JobTTL     time.Duration `yaml:"job_ttl"`
+	RemoveLogs bool          `yaml:"remove_logs"`
+}
+
+// QueueConfig limits how many jobs run at once, globally and per owner.
+// Jobs over the limits wait in a queue that is ordered by Policy. A zero
+// limit means unlimited.
+type QueueConfig struct {
+	MaxConcurrent int    `yaml:"max_concurrent"`
+	MaxPerOwner   int    `yaml:"max_per_owner"`
+	Policy        string `yaml:"policy"`
+}
+
+// Queue policies.
+const (
+	QueuePolicyFIFO     = "fifo"
+	QueuePolicyPriority = "priority"
+)
+
+// JobsConfig configures how jobs are run. With a StateDir every job runs
+// under a shim that keeps it going and its output captured while the server
+// restarts, and the jobs saved in StateDir are recovered at startup. An empty
+// StateDir runs jobs as children of the server.
+type JobsConfig struct {
+	StateDir string `yaml:"state_dir"`
+}
+
+// AuthorizationConfig holds the authorization policy. RolePolicyFile points
+// at an optional YAML file that binds identities to roles and
+// CommandPolicyFile at one that allows or denies commands.
+type AuthorizationConfig struct {
+	PublicJobInfo     bool   `yaml:"public_job_info"`
+	RolePolicyFile    string `yaml:"role_policy_file"`
+	CommandPolicyFile string `yaml:"command_policy_file"`
+}
+
+// CertificateAuthorityConfig configures the built-in CA that issues client
+// certificates. Its certificate has to be part of the tls.ca bundle for the
+// certificates it issues to be accepted. The enrollment listener is open to
+// anyone, so requests waiting for approval are capped by MaxPending and
+// MaxPendingPerName and forgotten after RequestTTL along with denied ones,
+// and Enroll is limited to EnrollRate calls a second in bursts of
+// EnrollBurst. Zero leaves any of them unlimited.
+type CertificateAuthorityConfig struct {
+	Enabled  bool          `yaml:"enabled"`
+	Cert     string        `yaml:"cert"`
+	Key      string        `yaml:"key"`
+	StateDir string        `yaml:"state_dir"`
+	CertTTL  time.Duration `yaml:"cert_ttl"`
+
+	MaxPending        int           `yaml:"max_pending"`
+	MaxPendingPerName int           `yaml:"max_pending_per_name"`
+	RequestTTL        time.Duration `yaml:"request_ttl"`
+	EnrollRate        float64       `yaml:"enroll_rate"`
+	EnrollBurst       int           `yaml:"enroll_burst"`
+}
+
+// AuditConfig configures the audit log of every RPC. An empty Path disables
+// it. The file is rotated once it reaches MaxBytes, keeping MaxBackups old
+// files, and with HashChain every entry includes the hash of the one before.
+type AuditConfig struct {
+	Path       string `yaml:"path"`
+	MaxBytes   int64  `yaml:"max_bytes"`
+	MaxBackups int    `yaml:"max_backups"`
+	HashChain  bool   `yaml:"hash_chain"`
+}
+
+// SchedulesConfig configures recurring jobs. Schedules are saved in
+// StateDir, an empty StateDir disables them.
+type SchedulesConfig struct {
+	StateDir string `yaml:"state_dir"`
+}
+
+// IdempotencyConfig configures how long a StartJob idempotency key is
+// remembered for. A zero Window disables idempotency keys.
+type IdempotencyConfig struct {
+	Window time.Duration `yaml:"window"`
+}
+
+// ShutdownConfig controls what happens to running jobs when the server gets
+// SIGTERM. With Mode wait they have up to Timeout to finish, a zero Timeout
+// waits for as long as they take, and are stopped after that. With Mode stop
+// they are stopped straight away, and with Mode detach they are left running
+// for the next server to recover, which needs jobs.state_dir. Stopped jobs
+// get GracePeriod to exit after SIGTERM before they are killed.
+type ShutdownConfig struct {
+	Mode        string        `yaml:"mode"`
+	Timeout     time.Duration `yaml:"timeout"`
+	GracePeriod time.Duration `yaml:"grace_period"`
+}
+
+// Shutdown modes.
+const (
+	ShutdownModeWait   = "wait"
+	ShutdownModeStop   = "stop"
+	ShutdownModeDetach = "detach"
+)
+
+// LogBackendFile writes job output to files under LogConfig.Dir.
+const LogBackendFile = "file"
+
+// Default returns the configuration the server used before it was configurable.
+func Default() *Config {
+	return &Config{
+		Listeners: ListenersConfig{GRPC: "0.0.0.0:8080"},
+		TLS: TLSConfig{
+			Cert: "certs/server.pem",
+			Key:  "certs/server.key",
+			CA:   "certs/ca.pem",
+
+			WatchInterval:      30 * time.Second,
+			CRLRefreshInterval: 5 * time.Minute,
+		},
+		Log: LogConfig{
+			Backend: LogBackendFile,
+			Dir:     "/var/log/linux-process-runner",
+		},
+		Queue: QueueConfig{Policy: QueuePolicyFIFO},
+		CertificateAuthority: CertificateAuthorityConfig{
+			Cert:     "certs/ca.pem",
+			Key:      "certs/ca.key",
+			StateDir: "/var/lib/linux-process-runner/ca",
+			CertTTL:  24 * time.Hour,
+
+			MaxPending:        1000,
+			MaxPendingPerName: 5,
+			RequestTTL:        7 * 24 * time.Hour,
+			EnrollRate:        1,
+			EnrollBurst:       10,
+		},
+		Audit: AuditConfig{
+			MaxBytes:   100 * 1024 * 1024,
+			MaxBackups: 10,
+		},
+		Idempotency: IdempotencyConfig{Window: 24 * time.Hour},
+		Shutdown: ShutdownConfig{
+			Mode:        ShutdownModeWait,
+			Timeout:     time.Minute,
+			GracePeriod: 10 * time.Second,
+		},
+	}
+}
+
+// Load reads and validates the configuration file at path. Fields missing
+// from the file keep their default values and unknown fields are rejected.
+func Load(path string) (*Config, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := Default()
+	dec := yaml.NewDecoder(bytes.NewReader(b))
+	dec.KnownFields(true)
+	if err := dec.Decode(cfg); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("validating %s: %w", path, err)
+	}
+
+	return cfg, nil
+}
+
+// Validate checks that the configuration is usable.
+func (c *Config) Validate() error {
+	if _, _, err := net.SplitHostPort(c.Listeners.GRPC); err != nil {
+		return fmt.Errorf("listeners.grpc: %w", err)
+	}
+
+	for name, path := range map[string]string{
+		"tls.cert": c.TLS.Cert,
+		"tls.key":  c.TLS.Key,
+		"tls.ca":   c.TLS.CA,
+	} {
+		if path == "" {
+			return fmt.Errorf("%s is required", name)
+		}
+		if _, err := os.Stat(path); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+
+	for i, path := range c.TLS.CRLs {
+		if _, err := os.Stat(path); err != nil {
+			return fmt.Errorf("tls.crls[%d]: %w", i, err)
+		}
+	}
+
+	if c.TLS.WatchInterval < 0 || c.TLS.CRLRefreshInterval < 0 {
+		return fmt.Errorf("tls intervals cannot be negative")
+	}
+
+	for name, path := range map[string]string{
+		"authorization.role_policy_file":    c.Authorization.RolePolicyFile,
+		"authorization.command_policy_file": c.Authorization.CommandPolicyFile,
+	} {
+		if path == "" {
+			continue
+		}
+		if _, err := os.Stat(path); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+
+	if c.Log.Backend != LogBackendFile {
+		return fmt.Errorf("log.backend: unsupported backend %q", c.Log.Backend)
+	}
+	if c.Log.Dir == "" {
+		return fmt.Errorf("log.dir is required")
+	}
+
+	if c.Limits.CPUPercent < 0 || c.Limits.MemoryBytes < 0 || c.Limits.MaxProcesses < 0 {
+		return fmt.Errorf("limits cannot be negative")
+	}
+
+	if c.Retention.JobTTL < 0 {
+		return fmt.Errorf("retention.job_ttl cannot be negative")
+	}
+
+	if c.Queue.MaxConcurrent < 0 || c.Queue.MaxPerOwner < 0 {
+		return fmt.Errorf("queue limits cannot be negative")
+	}
+	if c.Queue.Policy != QueuePolicyFIFO && c.Queue.Policy != QueuePolicyPriority {
+		return fmt.Errorf("queue.policy: unsupported policy %q", c.Queue.Policy)
+	}
+
+	if c.Idempotency.Window < 0 {
+		return fmt.Errorf("idempotency.window cannot be negative")
+	}
+
+	switch c.Shutdown.Mode {
+	case ShutdownModeWait, ShutdownModeStop:
+	case ShutdownModeDetach:
+		if c.Jobs.StateDir == "" {
+			return fmt.Errorf("shutdown.mode: %s requires jobs.state_dir", ShutdownModeDetach)
+		}
+	default:
+		return fmt.Errorf("shutdown.mode: unsupported mode %q", c.Shutdown.Mode)
+	}
+	if c.Shutdown.Timeout < 0 || c.Shutdown.GracePeriod < 0 {
+		return fmt.Errorf("shutdown durations cannot be negative")
+	}
+
+	if c.Audit.MaxBytes < 0 || c.Audit.MaxBackups < 0 {
+		return fmt.Errorf("audit limits cannot be negative")
+	}
+
+	if c.Listeners.Metrics != "" {
+		if _, _, err := net.SplitHostPort(c.Listeners.Metrics); err != nil {
+			return fmt.Errorf("listeners.metrics: %w", err)
+		}
+	}
+	if c.Listeners.Gateway != "" {
+		if _, _, err := net.SplitHostPort(c.Listeners.Gateway); err != nil {
+			return fmt.Errorf("listeners.gateway: %w", err)
+		}
+	}
+
+	if err := c.CertificateAuthority.validate(); err != nil {
+		return err
+	}
+
+	if c.Listeners.Enrollment != "" {
+		if !c.CertificateAuthority.Enabled {
+			return fmt.Errorf("listeners.enrollment requires certificate_authority.enabled")
+		}
+		if _, _, err := net.SplitHostPort(c.Listeners.Enrollment); err != nil {
+			return fmt.Errorf("listeners.enrollment: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (c CertificateAuthorityConfig) validate() error {
+	if !c.Enabled {
+		return nil
+	}
+
+	for name, path := range map[string]string{
+		"certificate_authority.cert": c.Cert,
+		"certificate_authority.key":  c.Key,
+	} {
+		if _, err := os.Stat(path); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+
+	if c.StateDir == "" {
+		return fmt.Errorf("certificate_authority.state_dir is required")
+	}
+
+	if c.CertTTL <= 0 {
+		return fmt.Errorf("certificate_authority.cert_ttl must be positive")
+	}
+
+	if c.MaxPending < 0 || c.MaxPendingPerName < 0 || c.RequestTTL < 0 || c.EnrollRate < 0 || c.EnrollBurst < 0 {
+		return fmt.Errorf("certificate_authority enrollment limits cannot be negative")
+	}
+
+	if c.EnrollRate > 0 && c.EnrollBurst == 0 {
+		return fmt.Errorf("certificate_authority.enroll_burst must be positive when enroll_rate is set")
+	}
+
+	return nil
+}
+
+// RestartRequired lists the settings that differ in next but can only be
+// applied by restarting the server.
+func (c *Config) RestartRequired(next *Config) []string {
+	var fields []string
+	if c.Listeners != next.Listeners {
+		fields = append(fields, "listeners")
+	}
+	if c.TLS.WatchInterval != next.TLS.WatchInterval {
+		fields = append(fields, "tls.watch_interval")
+	}
+	if c.TLS.CRLRefreshInterval != next.TLS.CRLRefreshInterval {
+		fields = append(fields, "tls.crl_refresh_interval")
+	}
+	if c.Log != next.Log {
+		fields = append(fields, "log")
+	}
+	if c.Audit != next.Audit {
+		fields = append(fields, "audit")
+	}
+	if c.CertificateAuthority != next.CertificateAuthority {
+		fields = append(fields, "certificate_authority")
+	}
+	if c.Schedules != next.Schedules {
+		fields = append(fields, "schedules")
+	}
+	if c.Jobs != next.Jobs {
+		fields = append(fields, "jobs")
+	}
+	return fields
+}
+
+// Reloaded returns the config a server running with c runs with once it has
+// reloaded next: next, except for the settings RestartRequired lists, which
+// keep their current values.
+func (c *Config) Reloaded(next *Config) *Config {
+	reloaded := *next
+	reloaded.Listeners = c.Listeners
+	reloaded.TLS.WatchInterval = c.TLS.WatchInterval
+	reloaded.TLS.CRLRefreshInterval = c.TLS.CRLRefreshInterval
+	reloaded.Log = c.Log
+	reloaded.Audit = c.Audit
+	reloaded.CertificateAuthority = c.CertificateAuthority
+	reloaded.Schedules = c.Schedules
+	reloaded.Jobs = c.Jobs
+	return &reloaded
+}
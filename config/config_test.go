@@ -0,0 +1,136 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type ConfigTestSuite struct {
+	suite.Suite
+	dir string
+}
+
+func (suite *ConfigTestSuite) SetupTest() {
+	dir, err := ioutil.TempDir("", "config")
+	suite.Require().NoError(err)
+	suite.dir = dir
+
+	for _, name := range []string{"server.pem", "server.key", "ca.pem"} {
+		suite.Require().NoError(ioutil.WriteFile(filepath.Join(dir, name), []byte{}, 0600))
+	}
+}
+
+func (suite *ConfigTestSuite) TearDownTest() {
+	os.RemoveAll(suite.dir)
+}
+
+func (suite *ConfigTestSuite) writeConfig(contents string) string {
+	path := filepath.Join(suite.dir, "server.yaml")
+	suite.Require().NoError(ioutil.WriteFile(path, []byte(contents), 0600))
+	return path
+}
+
+func (suite *ConfigTestSuite) tlsSection() string {
+	return "tls:\n" +
+		"  cert: " + filepath.Join(suite.dir, "server.pem") + "\n" +
+		"  key: " + filepath.Join(suite.dir, "server.key") + "\n" +
+		"  ca: " + filepath.Join(suite.dir, "ca.pem") + "\n"
+}
+
+func (suite *ConfigTestSuite) TestLoadValidConfig() {
+	path := suite.writeConfig(suite.tlsSection() + `
+listeners:
+  grpc: 127.0.0.1:9090
+limits:
+  memory_bytes: 1048576
+retention:
+  job_ttl: 1h
+`)
+	cfg, err := Load(path)
+	assert.NoError(suite.T(), err, "it should load a valid config")
+	assert.Equal(suite.T(), "127.0.0.1:9090", cfg.Listeners.GRPC)
+	assert.Equal(suite.T(), int64(1048576), cfg.Limits.MemoryBytes)
+	assert.Equal(suite.T(), time.Hour, cfg.Retention.JobTTL)
+	assert.Equal(suite.T(), Default().Log, cfg.Log, "missing sections should keep their defaults")
+	assert.Equal(suite.T(), Default().Authorization, cfg.Authorization, "missing sections should keep their defaults")
+	assert.Empty(suite.T(), cfg.Audit.Path, "the audit log should be off unless a path is set")
+	assert.Empty(suite.T(), cfg.Schedules.StateDir, "schedules should be off unless a state dir is set")
+}
+
+func (suite *ConfigTestSuite) TestLoadInvalidConfig() {
+	cases := []struct {
+		name     string
+		contents string
+	}{
+		{"unknown field", suite.tlsSection() + "listeners:\n  grpcc: 0.0.0.0:8080\n"},
+		{"bad address", suite.tlsSection() + "listeners:\n  grpc: nope\n"},
+		{"missing tls file", "tls:\n  cert: /does/not/exist\n"},
+		{"unsupported log backend", suite.tlsSection() + "log:\n  backend: s3\n"},
+		{"negative limit", suite.tlsSection() + "limits:\n  max_processes: -1\n"},
+		{"missing crl file", suite.tlsSection() + "  crls: [/does/not/exist]\n"},
+		{"negative watch interval", suite.tlsSection() + "  watch_interval: -1s\n"},
+		{"missing role policy", suite.tlsSection() + "authorization:\n  role_policy_file: /does/not/exist\n"},
+		{"missing command policy", suite.tlsSection() + "authorization:\n  command_policy_file: /does/not/exist\n"},
+		{"ca without key", suite.tlsSection() + "certificate_authority:\n  enabled: true\n  key: /does/not/exist\n"},
+		{"negative enrollment limit", suite.tlsSection() + "certificate_authority:\n  enabled: true\n" +
+			"  cert: " + filepath.Join(suite.dir, "ca.pem") + "\n  key: " + filepath.Join(suite.dir, "server.key") + "\n  max_pending: -1\n"},
+		{"enrollment without ca", suite.tlsSection() + "listeners:\n  enrollment: 0.0.0.0:8443\n"},
+		{"bad metrics address", suite.tlsSection() + "listeners:\n  metrics: localhost\n"},
+		{"bad gateway address", suite.tlsSection() + "listeners:\n  gateway: localhost\n"},
+		{"negative audit backups", suite.tlsSection() + "audit:\n  max_backups: -1\n"},
+		{"negative ttl", suite.tlsSection() + "retention:\n  job_ttl: -1h\n"},
+		{"negative queue limit", suite.tlsSection() + "queue:\n  max_per_owner: -1\n"},
+		{"unsupported queue policy", suite.tlsSection() + "queue:\n  policy: lifo\n"},
+		{"negative idempotency window", suite.tlsSection() + "idempotency:\n  window: -1h\n"},
+		{"unsupported shutdown mode", suite.tlsSection() + "shutdown:\n  mode: abandon\n"},
+		{"detach without state dir", suite.tlsSection() + "shutdown:\n  mode: detach\n"},
+		{"negative grace period", suite.tlsSection() + "shutdown:\n  grace_period: -1s\n"},
+	}
+
+	for _, tc := range cases {
+		_, err := Load(suite.writeConfig(tc.contents))
+		assert.Error(suite.T(), err, tc.name)
+	}
+}
+
+func (suite *ConfigTestSuite) TestRestartRequired() {
+	current := Default()
+	next := Default()
+	next.Limits.CPUPercent = 50
+	next.Authorization.PublicJobInfo = true
+	next.Authorization.RolePolicyFile = "roles.yaml"
+	next.Idempotency.Window = time.Hour
+	next.Shutdown.Mode = ShutdownModeStop
+	assert.Empty(suite.T(), current.RestartRequired(next), "limits and policies can be reloaded")
+
+	next.Listeners.GRPC = "0.0.0.0:9090"
+	next.Log.Dir = "/tmp"
+	assert.Equal(suite.T(), []string{"listeners", "log"}, current.RestartRequired(next))
+
+	next.Jobs.StateDir = "/tmp/jobs"
+	assert.Contains(suite.T(), current.RestartRequired(next), "jobs")
+}
+
+func (suite *ConfigTestSuite) TestReloaded() {
+	current := Default()
+	next := Default()
+	next.Limits.CPUPercent = 50
+	next.Listeners.GRPC = "0.0.0.0:9090"
+	next.Log.Dir = "/tmp"
+
+	reloaded := current.Reloaded(next)
+	assert.Equal(suite.T(), int64(50), reloaded.Limits.CPUPercent, "reloadable settings should be applied")
+	assert.Equal(suite.T(), current.Listeners, reloaded.Listeners, "settings that need a restart should be kept")
+	assert.Equal(suite.T(), current.Log, reloaded.Log)
+	assert.Equal(suite.T(), []string{"listeners", "log"}, reloaded.RestartRequired(next), "a later reload should still report them")
+}
+
+func TestConfigTestSuite(t *testing.T) {
+	suite.Run(t, new(ConfigTestSuite))
+}
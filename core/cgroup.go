@@ -0,0 +1,132 @@
+package core
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	cgroupRoot   = "/sys/fs/cgroup"
+	cgroupParent = "linux-process-runner"
+	// cpuPeriod is the cpu.max period in microseconds that CPU quotas are relative to.
+	cpuPeriod = 100000
+)
+
+// ResourceLimits restricts the resources a job can use. A zero value means
+// the resource is not limited.
+type ResourceLimits struct {
+	CPUPercent   int64
+	MemoryBytes  int64
+	MaxProcesses int64
+}
+
+// IsZero reports whether no limits are set.
+func (l ResourceLimits) IsZero() bool {
+	return l == ResourceLimits{}
+}
+
+// cgroupsEnabled checks if a cgroup v2 unified hierarchy is mounted.
+func cgroupsEnabled() bool {
+	_, err := os.Stat(filepath.Join(cgroupRoot, "cgroup.controllers"))
+	return err == nil
+}
+
+// createCgroup creates a cgroup for the job and writes its limits to it.
+func createCgroup(id string, limits ResourceLimits) (string, error) {
+	parent := filepath.Join(cgroupRoot, cgroupParent)
+	if err := os.MkdirAll(parent, 0755); err != nil {
+		return "", err
+	}
+
+	// controllers have to be enabled on every ancestor before a child can use them
+	for _, dir := range []string{cgroupRoot, parent} {
+		for _, controller := range []string{"cpu", "memory", "pids"} {
+			if err := writeCgroupFile(dir, "cgroup.subtree_control", "+"+controller); err != nil {
+				return "", err
+			}
+		}
+	}
+
+	path := filepath.Join(parent, id)
+	if err := os.Mkdir(path, 0755); err != nil && !os.IsExist(err) {
+		return "", err
+	}
+
+	if limits.CPUPercent > 0 {
+		quota := limits.CPUPercent * cpuPeriod / 100
+		if err := writeCgroupFile(path, "cpu.max", fmt.Sprintf("%d %d", quota, cpuPeriod)); err != nil {
+			return "", err
+		}
+	}
+	if limits.MemoryBytes > 0 {
+		if err := writeCgroupFile(path, "memory.max", strconv.FormatInt(limits.MemoryBytes, 10)); err != nil {
+			return "", err
+		}
+	}
+	if limits.MaxProcesses > 0 {
+		if err := writeCgroupFile(path, "pids.max", strconv.FormatInt(limits.MaxProcesses, 10)); err != nil {
+			return "", err
+		}
+	}
+
+	return path, nil
+}
+
+// addToCgroup moves a process into the cgroup at path.
+func addToCgroup(path string, pid int) error {
+	return writeCgroupFile(path, "cgroup.procs", strconv.Itoa(pid))
+}
+
+// removeCgroup deletes a job's cgroup. This only succeeds once every process
+// in it has exited.
+func removeCgroup(path string) error {
+	return os.Remove(path)
+}
+
+// memoryUsage is what a cgroup recorded about its memory use.
+type memoryUsage struct {
+	limit    int64
+	peak     int64
+	oomKills int64
+}
+
+// readMemoryUsage reads a cgroup's memory limit, peak usage and OOM kill
+// count. memory.peak only exists since Linux 5.19 and is left at zero on
+// older kernels.
+func readMemoryUsage(path string) (memoryUsage, error) {
+	events, err := readKeyValues(filepath.Join(path, "memory.events"), " ")
+	if err != nil {
+		return memoryUsage{}, err
+	}
+
+	usage := memoryUsage{oomKills: events["oom_kill"]}
+	if b, err := ioutil.ReadFile(filepath.Join(path, "memory.max")); err == nil {
+		// "max" means unlimited and fails to parse, leaving the limit at zero
+		usage.limit, _ = strconv.ParseInt(strings.TrimSpace(string(b)), 10, 64)
+	}
+	if b, err := ioutil.ReadFile(filepath.Join(path, "memory.peak")); err == nil {
+		usage.peak, _ = strconv.ParseInt(strings.TrimSpace(string(b)), 10, 64)
+	}
+	return usage, nil
+}
+
+// systemOOMKills returns the number of processes the kernel's OOM killer has
+// killed since boot, or -1 if the kernel doesn't report it.
+func systemOOMKills() int64 {
+	vmstat, err := readKeyValues(filepath.Join(procRoot, "vmstat"), " ")
+	if err != nil {
+		return -1
+	}
+	if n, ok := vmstat["oom_kill"]; ok {
+		return n
+	}
+	return -1
+}
+
+func writeCgroupFile(dir string, name string, value string) error {
+	return ioutil.WriteFile(filepath.Join(dir, name), []byte(value), 0644)
+}
@@ -0,0 +1,152 @@
+package core
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// ShutdownMode says what happens to running jobs when the runner shuts down.
+type ShutdownMode string
+
+const (
+	// ShutdownWait lets running jobs finish, stopping the ones that are still
+	// running once the shutdown timeout is up.
+	ShutdownWait ShutdownMode = "wait"
+	// ShutdownStop stops running jobs straight away.
+	ShutdownStop ShutdownMode = "stop"
+	// ShutdownDetach leaves running jobs to their shims, for a restarted
+	// server to recover. Without a state dir jobs are stopped instead.
+	ShutdownDetach ShutdownMode = "detach"
+)
+
+// ShutdownSettings controls how the runner shuts down. A zero Timeout waits
+// for running jobs for as long as they take. Stopped jobs get GracePeriod to
+// exit after SIGTERM before they are killed, a zero GracePeriod kills them
+// right away.
+type ShutdownSettings struct {
+	Mode        ShutdownMode
+	Timeout     time.Duration
+	GracePeriod time.Duration
+}
+
+// Drain stops the runner from starting new jobs. Jobs submitted while it is
+// draining fail with ErrDraining, and queued jobs stay queued until Resume is
+// called. Running jobs carry on as usual.
+func (jr *JobRunner) Drain() {
+	jr.mu.Lock()
+	defer jr.mu.Unlock()
+	jr.draining = true
+}
+
+// Resume starts accepting new jobs again after Drain, and starts the queued
+// jobs that fit within the limits.
+func (jr *JobRunner) Resume() {
+	jr.mu.Lock()
+	jr.draining = false
+	jr.mu.Unlock()
+
+	jr.dispatch()
+}
+
+// Draining reports whether the runner has stopped starting new jobs.
+func (jr *JobRunner) Draining() bool {
+	jr.mu.RLock()
+	defer jr.mu.RUnlock()
+	return jr.draining
+}
+
+// Shutdown drains the runner and cancels queued jobs. It then waits for
+// running jobs to finish, stops them or leaves them running, as the shutdown
+// settings say, and returns once every job it waits for has finished or ctx
+// is done.
+func (jr *JobRunner) Shutdown(ctx context.Context) error {
+	jr.Drain()
+	settings := jr.Settings().Shutdown
+
+	for _, job := range jr.ListJobs(nil) {
+		if job.State != Queued {
+			continue
+		}
+		if err := jr.StopJob(job.Id); err != nil {
+			log.Printf("shutdown: could not cancel queued job %s: %s", job.Id, err.Error())
+		}
+	}
+
+	if settings.Mode == ShutdownDetach && jr.stateDir != "" {
+		return nil
+	}
+
+	if settings.Mode == ShutdownWait {
+		waitCtx, cancel := ctx, func() {}
+		if settings.Timeout > 0 {
+			waitCtx, cancel = context.WithTimeout(ctx, settings.Timeout)
+		}
+		err := jr.waitJobs(waitCtx, nil)
+		cancel()
+		if err == nil || ctx.Err() != nil {
+			return err
+		}
+		log.Printf("shutdown: jobs still running after %s, stopping them", settings.Timeout)
+	}
+
+	stopping := make(map[string]bool)
+	return jr.waitJobs(ctx, func(job JobInfo) {
+		// jobs dispatched just before the drain are stopped once they're running
+		if job.State != Running || stopping[job.Id] {
+			return
+		}
+		stopping[job.Id] = true
+		go func() {
+			if err := jr.stopJob(job.Id, settings.GracePeriod); err != nil {
+				log.Printf("shutdown: could not stop job %s: %s", job.Id, err.Error())
+			}
+		}()
+	})
+}
+
+// waitJobs blocks until every job has finished, calling unfinished for each
+// unfinished job it sees and every change to one.
+func (jr *JobRunner) waitJobs(ctx context.Context, unfinished func(JobInfo)) error {
+	for {
+		jobs, events, cancel := jr.store.WatchRecords(nil)
+		caughtUp, err := waitAll(ctx, jobs, events, unfinished)
+		cancel()
+		// a watch that fell behind is started again from the latest state
+		if caughtUp || err != nil {
+			return err
+		}
+	}
+}
+
+// waitAll follows the events of jobs until all of them have finished. It
+// returns false if the events stopped before then.
+func waitAll(ctx context.Context, jobs []JobInfo, events <-chan JobEvent, unfinished func(JobInfo)) (bool, error) {
+	pending := make(map[string]bool)
+	seen := func(job JobInfo) {
+		if job.finished() {
+			delete(pending, job.Id)
+			return
+		}
+		pending[job.Id] = true
+		if unfinished != nil {
+			unfinished(job)
+		}
+	}
+
+	for _, job := range jobs {
+		seen(job)
+	}
+	for len(pending) > 0 {
+		select {
+		case <-ctx.Done():
+			return true, ctx.Err()
+		case event, ok := <-events:
+			if !ok {
+				return false, nil
+			}
+			seen(event.Job)
+		}
+	}
+	return true, nil
+}
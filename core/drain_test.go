@@ -0,0 +1,141 @@
+package core
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type DrainTestSuite struct {
+	suite.Suite
+	jr     *JobRunner
+	logDir string
+}
+
+func (suite *DrainTestSuite) SetupTest() {
+	dir, err := ioutil.TempDir("", "logs")
+	suite.Require().NoError(err)
+	suite.logDir = dir
+	suite.newRunner(RunnerSettings{})
+}
+
+func (suite *DrainTestSuite) TearDownTest() {
+	suite.jr.Shutdown(context.Background())
+	os.RemoveAll(suite.logDir)
+}
+
+func (suite *DrainTestSuite) newRunner(settings RunnerSettings) {
+	suite.jr = InitializeJobRunner(InitializeInMemoryJobStore(), WithLogDir(suite.logDir), WithSettings(settings))
+}
+
+func (suite *DrainTestSuite) submit(id string, name string, args ...string) {
+	job := suite.jr.CreateJob(id, "123", exec.Command(name, args...))
+	suite.Require().NoError(suite.jr.SubmitJob(job, 0))
+}
+
+func (suite *DrainTestSuite) waitForState(id string, state JobState) {
+	suite.Require().Eventually(func() bool {
+		job, _ := suite.jr.GetJob(id)
+		return job.State == state
+	}, 5*time.Second, 5*time.Millisecond)
+}
+
+func (suite *DrainTestSuite) TestDrain() {
+	suite.newRunner(RunnerSettings{Queue: QueueSettings{MaxConcurrent: 1}})
+	suite.submit("1", "sleep", "10")
+	suite.submit("2", "true")
+	suite.waitForState("1", Running)
+
+	suite.jr.Drain()
+	assert.True(suite.T(), suite.jr.Draining())
+	job := suite.jr.CreateJob("3", "123", exec.Command("true"))
+	assert.IsType(suite.T(), &ErrDraining{}, suite.jr.SubmitJob(job, 0), "new jobs should be rejected")
+	job, _ = suite.jr.GetJob("3")
+	assert.Equal(suite.T(), JobState(Error), job.State)
+
+	suite.Require().NoError(suite.jr.StopJob("1"))
+	suite.jr.WaitJob(context.Background(), "1")
+	job, _ = suite.jr.GetJob("2")
+	assert.Equal(suite.T(), JobState(Queued), job.State, "queued jobs shouldn't start while draining")
+
+	suite.jr.Resume()
+	assert.False(suite.T(), suite.jr.Draining())
+	job, err := suite.jr.WaitJob(context.Background(), "2")
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), JobState(Completed), job.State, "queued jobs should start once resumed")
+}
+
+func (suite *DrainTestSuite) TestShutdownWaitsForJobs() {
+	suite.newRunner(RunnerSettings{
+		Queue:    QueueSettings{MaxConcurrent: 1},
+		Shutdown: ShutdownSettings{Mode: ShutdownWait, Timeout: 5 * time.Second},
+	})
+	suite.submit("1", "sleep", "0.2")
+	suite.submit("2", "true")
+
+	suite.Require().NoError(suite.jr.Shutdown(context.Background()))
+	job, _ := suite.jr.GetJob("1")
+	assert.Equal(suite.T(), JobState(Completed), job.State, "running jobs should be left to finish")
+	job, _ = suite.jr.GetJob("2")
+	assert.Equal(suite.T(), JobState(Stopped), job.State, "queued jobs should be cancelled")
+	assert.Empty(suite.T(), job.Attempts)
+}
+
+func (suite *DrainTestSuite) TestShutdownStopsJobsAfterTimeout() {
+	suite.newRunner(RunnerSettings{
+		Shutdown: ShutdownSettings{Mode: ShutdownWait, Timeout: 100 * time.Millisecond, GracePeriod: 5 * time.Second},
+	})
+	suite.submit("1", "sleep", "10")
+	suite.waitForState("1", Running)
+
+	start := time.Now()
+	suite.Require().NoError(suite.jr.Shutdown(context.Background()))
+	assert.Less(suite.T(), int64(time.Since(start)), int64(5*time.Second), "sleep should exit on SIGTERM without being killed")
+	job, _ := suite.jr.GetJob("1")
+	assert.Equal(suite.T(), JobState(Stopped), job.State)
+	assert.Equal(suite.T(), FailureReason(""), job.Attempts[0].FailureReason, "a stopped job didn't fail")
+}
+
+func (suite *DrainTestSuite) TestShutdownStop() {
+	suite.newRunner(RunnerSettings{
+		Shutdown: ShutdownSettings{Mode: ShutdownStop, GracePeriod: 300 * time.Millisecond},
+	})
+	// exits cleanly on SIGTERM, as long as it's given the time
+	suite.submit("1", "sh", "-c", "trap 'exit 0' TERM; while true; do sleep 0.05; done")
+	// ignores SIGTERM and has to be killed
+	suite.submit("2", "sh", "-c", "trap '' TERM; while true; do sleep 0.05; done")
+	suite.waitForState("1", Running)
+	suite.waitForState("2", Running)
+	// the traps are set once the shell has started
+	time.Sleep(100 * time.Millisecond)
+
+	suite.Require().NoError(suite.jr.Shutdown(context.Background()))
+
+	job, _ := suite.jr.GetJob("1")
+	assert.Equal(suite.T(), JobState(Stopped), job.State)
+	assert.Equal(suite.T(), 0, job.Attempts[0].ExitCode, "the job should have exited by itself")
+	job, _ = suite.jr.GetJob("2")
+	assert.Equal(suite.T(), JobState(Stopped), job.State)
+	assert.Equal(suite.T(), -1, job.Attempts[0].ExitCode, "the job should have been killed after the grace period")
+}
+
+func (suite *DrainTestSuite) TestShutdownStopsJobsStartedDuringIt() {
+	suite.newRunner(RunnerSettings{Shutdown: ShutdownSettings{Mode: ShutdownStop}})
+	suite.submit("1", "sleep", "10")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	suite.Require().NoError(suite.jr.Shutdown(ctx), "a job dispatched before the drain should be stopped once it's running")
+	job, _ := suite.jr.GetJob("1")
+	assert.Equal(suite.T(), JobState(Stopped), job.State)
+}
+
+func TestDrainTestSuite(t *testing.T) {
+	suite.Run(t, new(DrainTestSuite))
+}
@@ -6,6 +6,22 @@ type ErrNotFound struct{}
 
 type ErrIllegalStateChange struct{}
 
+type ErrNotRunning struct{}
+
+type ErrNotFinished struct{}
+
+type ErrInvalidSelector struct {
+	reason string
+}
+
+type ErrNameTaken struct {
+	name string
+}
+
+type ErrDraining struct{}
+
+type ErrAlreadyFinished struct{}
+
 func (e *ErrNotFound) Error() string {
 	return fmt.Sprintf("asset not found")
 }
@@ -13,3 +29,27 @@ func (e *ErrNotFound) Error() string {
 func (e *ErrIllegalStateChange) Error() string {
 	return fmt.Sprintf("attempted to change from terminal state")
 }
+
+func (e *ErrNotRunning) Error() string {
+	return fmt.Sprintf("job is not running")
+}
+
+func (e *ErrNotFinished) Error() string {
+	return fmt.Sprintf("job has not finished")
+}
+
+func (e *ErrInvalidSelector) Error() string {
+	return fmt.Sprintf("invalid selector: %s", e.reason)
+}
+
+func (e *ErrNameTaken) Error() string {
+	return fmt.Sprintf("a job named %s already exists", e.name)
+}
+
+func (e *ErrDraining) Error() string {
+	return fmt.Sprintf("the server is draining and not accepting new jobs")
+}
+
+func (e *ErrAlreadyFinished) Error() string {
+	return fmt.Sprintf("cannot stop a job in a terminal state")
+}
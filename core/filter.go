@@ -0,0 +1,50 @@
+package core
+
+import "time"
+
+// JobFilter selects jobs by owner, labels, state and age. Fields left at
+// their zero value match every job.
+type JobFilter struct {
+	Owner    string
+	Selector Selector
+	// States matches jobs in any of the states.
+	States []JobState
+	// CreatedBefore matches jobs created before the time.
+	CreatedBefore time.Time
+}
+
+// IsEmpty reports whether the filter matches every job.
+func (f JobFilter) IsEmpty() bool {
+	return f.Owner == "" && len(f.Selector) == 0 && len(f.States) == 0 && f.CreatedBefore.IsZero()
+}
+
+// Matches reports whether the job meets every condition of the filter.
+func (f JobFilter) Matches(job JobInfo) bool {
+	if f.Owner != "" && job.Owner != f.Owner {
+		return false
+	}
+	if !f.CreatedBefore.IsZero() && !job.CreatedAt.Before(f.CreatedBefore) {
+		return false
+	}
+	if len(f.States) > 0 {
+		found := false
+		for _, state := range f.States {
+			found = found || job.State == state
+		}
+		if !found {
+			return false
+		}
+	}
+	return f.Selector.Matches(job.Labels)
+}
+
+// FindJobs returns every job the filter matches, oldest first.
+func (jr *JobRunner) FindJobs(filter JobFilter) []JobInfo {
+	var jobs []JobInfo
+	for _, job := range jr.store.ListRecords(filter.Selector) {
+		if filter.Matches(job) {
+			jobs = append(jobs, job)
+		}
+	}
+	return jobs
+}
@@ -0,0 +1,42 @@
+package core
+
+import (
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJobFilter(t *testing.T) {
+	now := time.Now()
+	job := JobInfo{
+		Owner:     "alice@CN=ca",
+		State:     Running,
+		CreatedAt: now.Add(-time.Hour),
+		Labels:    map[string]string{"run": "42"},
+	}
+	prod, _ := ParseSelector("run=42")
+	dev, _ := ParseSelector("run=43")
+
+	assert.True(t, JobFilter{}.IsEmpty())
+	assert.True(t, JobFilter{}.Matches(job))
+	assert.True(t, JobFilter{Owner: "alice@CN=ca", Selector: prod, States: []JobState{Queued, Running}, CreatedBefore: now}.Matches(job))
+	assert.False(t, JobFilter{Owner: "bob@CN=ca"}.Matches(job))
+	assert.False(t, JobFilter{Selector: dev}.Matches(job))
+	assert.False(t, JobFilter{States: []JobState{Completed}}.Matches(job))
+	assert.False(t, JobFilter{CreatedBefore: now.Add(-2 * time.Hour)}.Matches(job), "the job isn't old enough")
+}
+
+func TestFindJobs(t *testing.T) {
+	jr := InitializeJobRunner(InitializeInMemoryJobStore())
+	jr.store.CreateRecord("1", exec.Command("ls"), "alice@CN=ca", Running, nil, WithLabels(map[string]string{"run": "42"}, nil))
+	jr.store.CreateRecord("2", exec.Command("ls"), "alice@CN=ca", Completed, nil, WithLabels(map[string]string{"run": "42"}, nil))
+	jr.store.CreateRecord("3", exec.Command("ls"), "bob@CN=ca", Running, nil, WithLabels(map[string]string{"run": "42"}, nil))
+
+	selector, _ := ParseSelector("run=42")
+	jobs := jr.FindJobs(JobFilter{Owner: "alice@CN=ca", Selector: selector, States: []JobState{Running}})
+	if assert.Len(t, jobs, 1) {
+		assert.Equal(t, "1", jobs[0].Id)
+	}
+}
@@ -1,37 +1,96 @@
 package core
 
 import (
-	"math/big"
 	"os/exec"
+	"sort"
 	"sync"
+	"time"
 )
 
 // InMemoryJobStore represents an in-memory concurrent database to store job info.
 type InMemoryJobStore struct {
-	jobs map[string]*JobInfo
-	mu   *sync.RWMutex
+	jobs     map[string]*JobInfo
+	names    map[jobName]string
+	watchers map[*watcher]struct{}
+	mu       *sync.RWMutex
+}
+
+// jobName identifies a job by its owner and name.
+type jobName struct {
+	owner string
+	name  string
 }
 
 // InitializeInMemoryJobStore creates an empty InMemoryJobStore.
 func InitializeInMemoryJobStore() *InMemoryJobStore {
 	return &InMemoryJobStore{
-		jobs: make(map[string]*JobInfo),
-		mu:   &sync.RWMutex{},
+		jobs:     make(map[string]*JobInfo),
+		names:    make(map[jobName]string),
+		watchers: make(map[*watcher]struct{}),
+		mu:       &sync.RWMutex{},
 	}
 }
 
 // CreateRecord inserts a new record of a job instance.
-func (store *InMemoryJobStore) CreateRecord(id string, cmd *exec.Cmd, owner *big.Int, state JobState, jobError error) JobInfo {
+func (store *InMemoryJobStore) CreateRecord(id string, cmd *exec.Cmd, owner string, state JobState, jobError error, opts ...JobOption) JobInfo {
+	job, _ := store.CreateNamedRecord(id, "", cmd, owner, state, jobError, opts...)
+	return job
+}
+
+// CreateNamedRecord inserts a new record of a job instance with a name that
+// is unique among the owner's jobs. An empty name leaves the job unnamed.
+func (store *InMemoryJobStore) CreateNamedRecord(id string, name string, cmd *exec.Cmd, owner string, state JobState, jobError error, opts ...JobOption) (JobInfo, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	key := jobName{owner: owner, name: name}
+	if _, ok := store.names[key]; ok && name != "" {
+		return JobInfo{}, &ErrNameTaken{name: name}
+	}
+
+	job := &JobInfo{
+		Id:        id,
+		Name:      name,
+		Cmd:       cmd,
+		Owner:     owner,
+		State:     state,
+		Err:       jobError,
+		CreatedAt: time.Now(),
+		stopped:   make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(job)
+	}
+	store.jobs[id] = job
+	if name != "" {
+		store.names[key] = id
+	}
+	store.notify(JobAdded, job)
+	return *job, nil
+}
+
+// RestoreRecord inserts a job recovered from a previous run of the server as
+// it was, keeping its ID, name and attempts.
+func (store *InMemoryJobStore) RestoreRecord(job JobInfo) error {
 	store.mu.Lock()
 	defer store.mu.Unlock()
-	store.jobs[id] = &JobInfo{
-		Id:    id,
-		Cmd:   cmd,
-		Owner: owner,
-		State: state,
-		Err:   jobError,
+	if _, ok := store.jobs[job.Id]; ok {
+		return &ErrIllegalStateChange{}
+	}
+	key := jobName{owner: job.Owner, name: job.Name}
+	if _, ok := store.names[key]; ok && job.Name != "" {
+		return &ErrNameTaken{name: job.Name}
+	}
+
+	job.stopped = make(chan struct{})
+	if job.State == Stopped {
+		close(job.stopped)
 	}
-	return *store.jobs[id]
+	store.jobs[job.Id] = &job
+	if job.Name != "" {
+		store.names[key] = job.Id
+	}
+	store.notify(JobAdded, &job)
+	return nil
 }
 
 // GetRecord returns info on a job if it exists.
@@ -39,11 +98,99 @@ func (store *InMemoryJobStore) GetRecord(id string) (JobInfo, error) {
 	store.mu.RLock()
 	defer store.mu.RUnlock()
 	if jobInfo, ok := store.jobs[id]; ok {
-		return *jobInfo, nil
+		return jobInfo.snapshot(), nil
 	}
 	return JobInfo{}, &ErrNotFound{}
 }
 
+// GetRecordByName returns info on the owner's job with the given name if it
+// exists.
+func (store *InMemoryJobStore) GetRecordByName(owner string, name string) (JobInfo, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	if id, ok := store.names[jobName{owner: owner, name: name}]; ok && name != "" {
+		return store.jobs[id].snapshot(), nil
+	}
+	return JobInfo{}, &ErrNotFound{}
+}
+
+// ListRecords returns every job the selector matches, oldest first.
+func (store *InMemoryJobStore) ListRecords(selector Selector) []JobInfo {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	return store.listRecords(selector)
+}
+
+// WatchRecords returns the jobs the selector matches and subscribes to their
+// changes from then on.
+func (store *InMemoryJobStore) WatchRecords(selector Selector) ([]JobInfo, <-chan JobEvent, func()) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	w := &watcher{selector: selector, events: make(chan JobEvent, WatchBufferSize)}
+	store.watchers[w] = struct{}{}
+	return store.listRecords(selector), w.events, store.unwatch(w)
+}
+
+// WatchRecord returns a job and subscribes to its changes from then on.
+func (store *InMemoryJobStore) WatchRecord(id string) (JobInfo, <-chan JobEvent, func(), error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	job, ok := store.jobs[id]
+	if !ok {
+		return JobInfo{}, nil, nil, &ErrNotFound{}
+	}
+	w := &watcher{id: id, events: make(chan JobEvent, WatchBufferSize)}
+	store.watchers[w] = struct{}{}
+	return job.snapshot(), w.events, store.unwatch(w), nil
+}
+
+// unwatch returns a function that unsubscribes the watcher.
+func (store *InMemoryJobStore) unwatch(w *watcher) func() {
+	return func() {
+		store.mu.Lock()
+		defer store.mu.Unlock()
+		if _, ok := store.watchers[w]; ok {
+			delete(store.watchers, w)
+			close(w.events)
+		}
+	}
+}
+
+func (store *InMemoryJobStore) listRecords(selector Selector) []JobInfo {
+	var jobs []JobInfo
+	for _, job := range store.jobs {
+		if selector.Matches(job.Labels) {
+			jobs = append(jobs, job.snapshot())
+		}
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].CreatedAt.Before(jobs[j].CreatedAt) })
+	return jobs
+}
+
+// notify sends an event to every watcher that matches the job. A
+// watcher that has fallen behind is closed rather than holding up the store.
+// Callers must hold store.mu.
+func (store *InMemoryJobStore) notify(eventType JobEventType, job *JobInfo) {
+	for w := range store.watchers {
+		if !w.matches(job) {
+			continue
+		}
+		select {
+		case w.events <- JobEvent{Type: eventType, Job: job.snapshot()}:
+		default:
+			delete(store.watchers, w)
+			close(w.events)
+		}
+	}
+}
+
+// snapshot copies a job so that later changes to the record don't show.
+func (job *JobInfo) snapshot() JobInfo {
+	out := *job
+	out.Attempts = append([]Attempt(nil), job.Attempts...)
+	return out
+}
+
 // UpdateRecordOutput updates a job with an input/output stream to allow easy
 // retrieval of job output.
 func (store *InMemoryJobStore) UpdateRecordOutput(id string, logBuffer LogBuffer) {
@@ -52,22 +199,160 @@ func (store *InMemoryJobStore) UpdateRecordOutput(id string, logBuffer LogBuffer
 	store.jobs[id].Output = logBuffer
 }
 
+// StartRecordAttempt records a new run of a job's command, which becomes the
+// job's current command and output.
+func (store *InMemoryJobStore) StartRecordAttempt(id string, cmd *exec.Cmd, logBuffer LogBuffer) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	job := store.jobs[id]
+	if job.State.IsTerminal() {
+		return &ErrIllegalStateChange{}
+	}
+	job.Cmd = cmd
+	job.Output = logBuffer
+	job.Attempts = append(job.Attempts, Attempt{
+		Number:    len(job.Attempts) + 1,
+		Output:    logBuffer,
+		StartedAt: time.Now(),
+	})
+	store.notify(JobModified, job)
+	return nil
+}
+
+// FinishRecordAttempt records how a job's latest run ended. A run that has
+// already ended is left as it was, as when a stopped job's next run never
+// started.
+func (store *InMemoryJobStore) FinishRecordAttempt(id string, exitCode int, reason FailureReason, attemptError error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	job := store.jobs[id]
+	if len(job.Attempts) == 0 || job.attemptFinished() {
+		return
+	}
+	attempt := &job.Attempts[len(job.Attempts)-1]
+	attempt.FinishedAt = time.Now()
+	attempt.ExitCode = exitCode
+	attempt.Err = attemptError
+	attempt.FailureReason = reason
+	store.notify(JobModified, job)
+}
+
 // UpdateRecordState updates a job's current state.
 func (store *InMemoryJobStore) UpdateRecordState(id string, newState JobState) error {
 	store.mu.Lock()
 	defer store.mu.Unlock()
-	if store.jobs[id].State > Running {
+	if store.jobs[id].State.IsTerminal() {
 		return &ErrIllegalStateChange{}
 	}
 	store.jobs[id].State = newState
+	if newState.IsTerminal() {
+		store.jobs[id].FinishedAt = time.Now()
+	}
+	store.notify(JobModified, store.jobs[id])
+	return nil
+}
+
+// UpdateRecordQueued moves a job into the queue with the priority it was
+// submitted with.
+func (store *InMemoryJobStore) UpdateRecordQueued(id string, priority int32) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if store.jobs[id].State.IsTerminal() {
+		return &ErrIllegalStateChange{}
+	}
+	store.jobs[id].State = JobState(Queued)
+	store.jobs[id].Priority = priority
+	store.notify(JobModified, store.jobs[id])
 	return nil
 }
 
 // UpdateRecordError populates a job's error field if it encountered an error
 // during execution.
-func (store *InMemoryJobStore) UpdateRecordError(id string, newError error) {
+func (store *InMemoryJobStore) UpdateRecordError(id string, newError error) error {
+	return store.UpdateRecordFailure(id, FailureError, newError)
+}
+
+// UpdateRecordFailure moves a job to the Error state with the reason it failed.
+// A job that has already finished keeps its state.
+func (store *InMemoryJobStore) UpdateRecordFailure(id string, reason FailureReason, newError error) error {
 	store.mu.Lock()
 	defer store.mu.Unlock()
+	if store.jobs[id].State.IsTerminal() {
+		return &ErrIllegalStateChange{}
+	}
 	store.jobs[id].Err = newError
+	store.jobs[id].FailureReason = reason
 	store.jobs[id].State = JobState(Error)
+	store.jobs[id].FinishedAt = time.Now()
+	store.notify(JobModified, store.jobs[id])
+	return nil
+}
+
+// UpdateRecordMemory stores a job's memory limit and OOM kill count from its
+// latest attempt. The peak usage is the highest of every attempt.
+func (store *InMemoryJobStore) UpdateRecordMemory(id string, limit int64, peak int64, oomKills int64) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	store.jobs[id].MemoryLimit = limit
+	if peak > store.jobs[id].MemoryPeak {
+		store.jobs[id].MemoryPeak = peak
+	}
+	store.jobs[id].OOMKills = oomKills
+}
+
+// UpdateRecordCgroup stores the path of the cgroup a job's process runs in.
+func (store *InMemoryJobStore) UpdateRecordCgroup(id string, path string) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	store.jobs[id].CgroupPath = path
+}
+
+// RemoveRecordsFinishedBefore deletes every job that reached a terminal state
+// before t and returns the removed records.
+func (store *InMemoryJobStore) RemoveRecordsFinishedBefore(t time.Time) []JobInfo {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	var removed []JobInfo
+	for _, job := range store.jobs {
+		if job.finished() && job.FinishedAt.Before(t) {
+			removed = append(removed, *job)
+			store.removeRecord(job)
+		}
+	}
+	return removed
+}
+
+// RemoveRecord deletes a job that has finished.
+func (store *InMemoryJobStore) RemoveRecord(id string) (JobInfo, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	job, ok := store.jobs[id]
+	if !ok {
+		return JobInfo{}, &ErrNotFound{}
+	}
+	if !job.finished() {
+		return JobInfo{}, &ErrNotFinished{}
+	}
+	store.removeRecord(job)
+	return *job, nil
+}
+
+// removeRecord deletes a job and frees its name. Callers must hold store.mu.
+func (store *InMemoryJobStore) removeRecord(job *JobInfo) {
+	delete(store.jobs, job.Id)
+	if job.Name != "" {
+		delete(store.names, jobName{owner: job.Owner, name: job.Name})
+	}
+	store.notify(JobDeleted, job)
+}
+
+// CountRecordsByState returns how many jobs are in each state.
+func (store *InMemoryJobStore) CountRecordsByState() map[JobState]int {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	counts := make(map[JobState]int)
+	for _, job := range store.jobs {
+		counts[job.State]++
+	}
+	return counts
 }
@@ -2,9 +2,9 @@ package core
 
 import (
 	"fmt"
-	"math/big"
 	"os/exec"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/suite"
@@ -23,13 +23,13 @@ func (suite *InMemoryJobStoreTestSuite) TestCreateRecord() {
 	cases := []struct {
 		command   string
 		arguments []string
-		owner     *big.Int
+		owner     string
 		state     JobState
 		jobError  error
 	}{
-		{"/bin/ls", []string{}, big.NewInt(123), Stopped, nil},
-		{"/usr/bin/tail", []string{"-f", "log.txt"}, big.NewInt(789), Created, nil},
-		{"/bin/cp", []string{"file1", "file2"}, big.NewInt(456), Error, fmt.Errorf("file does not exist")},
+		{"/bin/ls", []string{}, "123", Stopped, nil},
+		{"/usr/bin/tail", []string{"-f", "log.txt"}, "789", Created, nil},
+		{"/bin/cp", []string{"file1", "file2"}, "456", Error, fmt.Errorf("file does not exist")},
 	}
 
 	for _, tc := range cases {
@@ -44,7 +44,7 @@ func (suite *InMemoryJobStoreTestSuite) TestCreateRecord() {
 }
 
 func (suite *InMemoryJobStoreTestSuite) TestGetExistingRecord() {
-	jobInfo := suite.store.CreateRecord("1", exec.Command("tail", "-f", "log.txt"), big.NewInt(789), Created, nil)
+	jobInfo := suite.store.CreateRecord("1", exec.Command("tail", "-f", "log.txt"), "789", Created, nil)
 	retrievedJobInfo, err := suite.store.GetRecord(jobInfo.Id)
 	assert.Nil(suite.T(), err, "it should not return an error")
 	assert.Equal(suite.T(), jobInfo, retrievedJobInfo, "retrieved record should be equal to created record")
@@ -56,8 +56,33 @@ func (suite *InMemoryJobStoreTestSuite) TestGetNonExistentRecord() {
 	assert.Equal(suite.T(), JobInfo{}, jobInfo, "it should not return any job info")
 }
 
+func (suite *InMemoryJobStoreTestSuite) TestNamedRecords() {
+	job, err := suite.store.CreateNamedRecord("1", "backup", exec.Command("true"), "alice", Stopped, nil)
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), "backup", job.Name)
+
+	_, err = suite.store.CreateNamedRecord("2", "backup", exec.Command("true"), "alice", Created, nil)
+	assert.IsType(suite.T(), &ErrNameTaken{}, err, "names should be unique per owner")
+	_, err = suite.store.GetRecord("2")
+	assert.Error(suite.T(), err, "the conflicting job should not be stored")
+
+	_, err = suite.store.CreateNamedRecord("3", "backup", exec.Command("true"), "bob", Created, nil)
+	assert.NoError(suite.T(), err, "other owners can use the same name")
+
+	found, err := suite.store.GetRecordByName("alice", "backup")
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), "1", found.Id)
+	_, err = suite.store.GetRecordByName("carol", "backup")
+	assert.IsType(suite.T(), &ErrNotFound{}, err)
+
+	_, err = suite.store.RemoveRecord("1")
+	suite.Require().NoError(err)
+	_, err = suite.store.CreateNamedRecord("4", "backup", exec.Command("true"), "alice", Created, nil)
+	assert.NoError(suite.T(), err, "deleting a job should free its name")
+}
+
 func (suite *InMemoryJobStoreTestSuite) TestUpdateRecordState() {
-	jobInfo := suite.store.CreateRecord("1", exec.Command("tail", "-f", "log.txt"), big.NewInt(789), Created, nil)
+	jobInfo := suite.store.CreateRecord("1", exec.Command("tail", "-f", "log.txt"), "789", Created, nil)
 	err := suite.store.UpdateRecordState(jobInfo.Id, Stopped)
 	assert.NoError(suite.T(), err, "it should be a valid state change")
 	updatedJobInfo, _ := suite.store.GetRecord(jobInfo.Id)
@@ -66,15 +91,24 @@ func (suite *InMemoryJobStoreTestSuite) TestUpdateRecordState() {
 
 func (suite *InMemoryJobStoreTestSuite) TestUpdateRecordError() {
 	err := fmt.Errorf("error while running tail")
-	jobInfo := suite.store.CreateRecord("1", exec.Command("tail", "-f", "log.txt"), big.NewInt(789), Created, nil)
+	jobInfo := suite.store.CreateRecord("1", exec.Command("tail", "-f", "log.txt"), "789", Created, nil)
 	suite.store.UpdateRecordError(jobInfo.Id, err)
 	updatedJobInfo, _ := suite.store.GetRecord(jobInfo.Id)
 	assert.Equal(suite.T(), JobState(Error), updatedJobInfo.State)
 	assert.Equal(suite.T(), err, updatedJobInfo.Err)
 }
 
+func (suite *InMemoryJobStoreTestSuite) TestUpdateFinishedRecordFailure() {
+	jobInfo := suite.store.CreateRecord("1", exec.Command("tail", "-f", "log.txt"), "789", Stopped, nil)
+	err := suite.store.UpdateRecordFailure(jobInfo.Id, FailureError, fmt.Errorf("error while running tail"))
+	assert.IsType(suite.T(), &ErrIllegalStateChange{}, err)
+	updatedJobInfo, _ := suite.store.GetRecord(jobInfo.Id)
+	assert.Equal(suite.T(), JobState(Stopped), updatedJobInfo.State, "a finished job should keep its state")
+	assert.NoError(suite.T(), updatedJobInfo.Err)
+}
+
 func (suite *InMemoryJobStoreTestSuite) TestUpdateRecordOutput() {
-	jobInfo := suite.store.CreateRecord("1", exec.Command("tail", "-f", "log.txt"), big.NewInt(789), Created, nil)
+	jobInfo := suite.store.CreateRecord("1", exec.Command("tail", "-f", "log.txt"), "789", Created, nil)
 	lb, err := NewLogBuffer(jobInfo.Id)
 
 	assert.NoError(suite.T(), err, "a log buffer should not produce an error")
@@ -83,6 +117,83 @@ func (suite *InMemoryJobStoreTestSuite) TestUpdateRecordOutput() {
 	assert.Equal(suite.T(), lb, updatedJobInfo.Output)
 }
 
+func (suite *InMemoryJobStoreTestSuite) TestListRecords() {
+	suite.store.CreateRecord("1", exec.Command("ls"), "123", Created, nil, WithLabels(map[string]string{"env": "prod", "team": "a"}, nil))
+	suite.store.CreateRecord("2", exec.Command("ls"), "123", Created, nil, WithLabels(map[string]string{"env": "dev"}, nil))
+	suite.store.CreateRecord("3", exec.Command("ls"), "123", Created, nil)
+
+	ids := func(selector string) []string {
+		sel, err := ParseSelector(selector)
+		suite.Require().NoError(err)
+		var out []string
+		for _, job := range suite.store.ListRecords(sel) {
+			out = append(out, job.Id)
+		}
+		return out
+	}
+	assert.Equal(suite.T(), []string{"1", "2", "3"}, ids(""), "the empty selector matches every job, oldest first")
+	assert.Equal(suite.T(), []string{"1"}, ids("env=prod"))
+	assert.Equal(suite.T(), []string{"2", "3"}, ids("env!=prod"))
+	assert.Equal(suite.T(), []string{"1", "2"}, ids("env"))
+}
+
+func (suite *InMemoryJobStoreTestSuite) TestWatchRecords() {
+	suite.store.CreateRecord("1", exec.Command("ls"), "123", Created, nil, WithLabels(map[string]string{"env": "prod"}, nil))
+	sel, _ := ParseSelector("env=prod")
+	jobs, events, cancel := suite.store.WatchRecords(sel)
+	defer cancel()
+	suite.Require().Len(jobs, 1)
+
+	suite.store.CreateRecord("2", exec.Command("ls"), "123", Created, nil, WithLabels(map[string]string{"env": "dev"}, nil))
+	suite.store.CreateRecord("3", exec.Command("ls"), "123", Created, nil, WithLabels(map[string]string{"env": "prod"}, nil))
+	suite.store.UpdateRecordState("1", Stopped)
+
+	event := <-events
+	assert.Equal(suite.T(), JobAdded, event.Type)
+	assert.Equal(suite.T(), "3", event.Job.Id, "jobs the selector doesn't match aren't sent")
+	event = <-events
+	assert.Equal(suite.T(), JobModified, event.Type)
+	assert.Equal(suite.T(), JobState(Stopped), event.Job.State)
+
+	suite.store.RemoveRecordsFinishedBefore(time.Now().Add(time.Second))
+	event = <-events
+	assert.Equal(suite.T(), JobDeleted, event.Type)
+	assert.Equal(suite.T(), "1", event.Job.Id)
+}
+
+func (suite *InMemoryJobStoreTestSuite) TestWatchRecord() {
+	suite.store.CreateRecord("1", exec.Command("ls"), "123", Created, nil)
+	suite.store.CreateRecord("2", exec.Command("ls"), "123", Created, nil)
+	job, events, cancel, err := suite.store.WatchRecord("1")
+	suite.Require().NoError(err)
+	defer cancel()
+	assert.Equal(suite.T(), "1", job.Id)
+
+	suite.store.UpdateRecordState("2", Running)
+	suite.store.UpdateRecordState("1", Running)
+	event := <-events
+	assert.Equal(suite.T(), "1", event.Job.Id, "other jobs' events aren't sent")
+	assert.Equal(suite.T(), JobState(Running), event.Job.State)
+
+	_, _, _, err = suite.store.WatchRecord("3")
+	assert.IsType(suite.T(), &ErrNotFound{}, err)
+}
+
+func (suite *InMemoryJobStoreTestSuite) TestSlowWatcherIsClosed() {
+	_, events, cancel := suite.store.WatchRecords(nil)
+	defer cancel()
+
+	for i := 0; i <= WatchBufferSize; i++ {
+		suite.store.CreateRecord(fmt.Sprint(i), exec.Command("ls"), "123", Created, nil)
+	}
+
+	n := 0
+	for range events {
+		n++
+	}
+	assert.Equal(suite.T(), WatchBufferSize, n, "the watcher should be closed once its buffer is full")
+}
+
 func TestInMemoryJobTestSuite(t *testing.T) {
 	suite.Run(t, new(InMemoryJobStoreTestSuite))
 }
@@ -1,12 +1,17 @@
 package core
 
 import (
+	"context"
 	"fmt"
 	"io"
-	"math/big"
+	"log"
 	"os"
 	"os/exec"
+	"sync"
 	"syscall"
+	"time"
+
+	"github.com/ItsMeWithTheFace/linux-process-runner/metrics"
 )
 
 type JobState int32
@@ -22,77 +27,398 @@ const (
 	Completed
 	// Error is set if a command returned with a non-zero exit code.
 	Error
+	// Queued means a job is waiting for the concurrency limits to let it start.
+	Queued
 )
 
+var jobStateNames = map[JobState]string{
+	Created:   "created",
+	Running:   "running",
+	Stopped:   "stopped",
+	Completed: "completed",
+	Error:     "error",
+	Queued:    "queued",
+}
+
+// String returns the state's lowercase name.
+func (s JobState) String() string {
+	if name, ok := jobStateNames[s]; ok {
+		return name
+	}
+	return fmt.Sprintf("unknown(%d)", int32(s))
+}
+
+// IsTerminal reports whether a job in this state has finished for good.
+func (s JobState) IsTerminal() bool {
+	return s == Stopped || s == Completed || s == Error
+}
+
 // JobInfo represents a job within the server's context.
 type JobInfo struct {
-	Id     string
+	Id string
+	// Name is an optional name for the job, unique among its owner's jobs.
+	Name   string
 	Cmd    *exec.Cmd
 	Output LogBuffer
-	Owner  *big.Int
+	Owner  string
 	State  JobState
 	Err    error
+
+	CreatedAt  time.Time
+	FinishedAt time.Time
+	CgroupPath string
+	Priority   int32
+
+	// FailureReason explains why a job ended in the Error state.
+	FailureReason FailureReason
+	// MemoryLimit is the cgroup memory limit in bytes the job ran with, zero
+	// if it wasn't limited. MemoryPeak is the most memory it used, from its
+	// cgroup if available, otherwise its main process's peak RSS.
+	MemoryLimit int64
+	MemoryPeak  int64
+	// OOMKills counts processes in the job's cgroup killed by the OOM killer.
+	OOMKills int64
+
+	// Labels identify the job for selectors, Annotations hold anything else
+	// its owner wants to attach. Neither changes after the job is created.
+	Labels      map[string]string
+	Annotations map[string]string
+
+	// Restart is the job's restart policy and Attempts every run of its
+	// command so far. Cmd and Output belong to the latest attempt.
+	Restart  RestartPolicy
+	Attempts []Attempt
+
+	// stopped is closed when the job is stopped so that a pending restart
+	// can be cancelled.
+	stopped chan struct{}
+}
+
+// Attempt is one run of a job's command.
+type Attempt struct {
+	Number     int
+	Output     LogBuffer
+	StartedAt  time.Time
+	FinishedAt time.Time
+	// ExitCode is -1 if the command was killed by a signal or didn't start.
+	ExitCode      int
+	Err           error
+	FailureReason FailureReason
+}
+
+// JobOption configures a job when it is created.
+type JobOption func(*JobInfo)
+
+// FailureReason is why a job failed.
+type FailureReason string
+
+const (
+	// FailureError means the job could not be started or its output could
+	// not be written.
+	FailureError FailureReason = "error"
+	// FailureExitCode means the job's command exited with a non-zero code.
+	FailureExitCode FailureReason = "exit_code"
+	// FailureOOMKilled means the kernel's OOM killer killed the job.
+	FailureOOMKilled FailureReason = "oom_killed"
+	// FailureKilled means the job was killed by a signal the runner didn't send.
+	FailureKilled FailureReason = "killed"
+)
+
+// RetentionPolicy controls when finished jobs are removed. A zero TTL keeps
+// jobs forever.
+type RetentionPolicy struct {
+	TTL        time.Duration
+	RemoveLogs bool
+}
+
+// RunnerSettings holds the JobRunner options that can be changed while jobs
+// are running. Changes only apply to jobs started afterwards.
+type RunnerSettings struct {
+	Limits    ResourceLimits
+	Retention RetentionPolicy
+	Queue     QueueSettings
+	Shutdown  ShutdownSettings
 }
 
 // JobRunner handles starting, stopping and getting jobs.
 type JobRunner struct {
-	store *InMemoryJobStore
+	store     *InMemoryJobStore
+	logDir    string
+	stateDir  string
+	shim      []string
+	metrics   metrics.Recorder
+	scheduler *scheduler
+
+	mu       *sync.RWMutex
+	settings RunnerSettings
+	draining bool
+}
+
+// RunnerOption configures a JobRunner.
+type RunnerOption func(*JobRunner)
+
+// WithLogDir sets the folder that job output is written to.
+func WithLogDir(dir string) RunnerOption {
+	return func(jr *JobRunner) {
+		jr.logDir = dir
+	}
+}
+
+// WithStateDir runs every job under a shim that records the job's state in
+// dir, so that the job outlives the server and Recover can reattach to it.
+func WithStateDir(dir string) RunnerOption {
+	return func(jr *JobRunner) {
+		jr.stateDir = dir
+	}
+}
+
+// WithMetrics reports job starts, stops, durations and output to rec.
+func WithMetrics(rec metrics.Recorder) RunnerOption {
+	return func(jr *JobRunner) {
+		jr.metrics = rec
+	}
+}
+
+// WithSettings sets the initial limits and retention policy.
+func WithSettings(settings RunnerSettings) RunnerOption {
+	return func(jr *JobRunner) {
+		jr.settings = settings
+	}
 }
 
 // InitializeJobRunner creates a pointer to an instantiated JobRunner.
-func InitializeJobRunner(store *InMemoryJobStore) *JobRunner {
-	return &JobRunner{store: store}
+func InitializeJobRunner(store *InMemoryJobStore, opts ...RunnerOption) *JobRunner {
+	jr := &JobRunner{
+		store:     store,
+		logDir:    DefaultLogDir,
+		metrics:   metrics.Nop{},
+		scheduler: newScheduler(),
+		shim:      []string{"/proc/self/exe", ShimCommand},
+		mu:        &sync.RWMutex{},
+	}
+	for _, opt := range opts {
+		opt(jr)
+	}
+	return jr
+}
+
+// Settings returns the runner's current settings.
+func (jr *JobRunner) Settings() RunnerSettings {
+	jr.mu.RLock()
+	defer jr.mu.RUnlock()
+	return jr.settings
+}
+
+// UpdateSettings replaces the runner's limits, retention policy and queue
+// settings. Raising the concurrency limits starts queued jobs straight away.
+func (jr *JobRunner) UpdateSettings(settings RunnerSettings) {
+	jr.mu.Lock()
+	jr.settings = settings
+	jr.mu.Unlock()
+
+	s := jr.scheduler
+	s.mu.Lock()
+	s.reorder(settings.Queue.Policy)
+	s.mu.Unlock()
+
+	jr.dispatch()
 }
 
 // CreateJob creates a new job and stores it in memory.
-func (jr *JobRunner) CreateJob(id string, owner *big.Int, cmd *exec.Cmd) JobInfo {
-	return jr.store.CreateRecord(id, cmd, owner, JobState(Created), nil)
+func (jr *JobRunner) CreateJob(id string, owner string, cmd *exec.Cmd, opts ...JobOption) JobInfo {
+	return jr.store.CreateRecord(id, cmd, owner, JobState(Created), nil, opts...)
 }
 
-// StartJob runs a job.
+// CreateNamedJob creates a new job like CreateJob, named name. It fails if
+// the owner already has a job with that name.
+func (jr *JobRunner) CreateNamedJob(id string, owner string, name string, cmd *exec.Cmd, opts ...JobOption) (JobInfo, error) {
+	return jr.store.CreateNamedRecord(id, name, cmd, owner, JobState(Created), nil, opts...)
+}
+
+// StartJob runs a job, restarting it as its restart policy asks. It returns
+// once the job has finished for good.
 func (jr *JobRunner) StartJob(job JobInfo) error {
-	err := jr.runJob(job.Id, job.Cmd)
+	return jr.superviseJob(job, 1, jr.runAttempt)
+}
 
-	if err != nil && !isKilled(err) {
-		jr.store.UpdateRecordError(job.Id, err)
-		return err
+// superviseJob runs the given attempt of a job with run, then runs the job
+// again as its restart policy asks. It returns once the job has finished for
+// good.
+func (jr *JobRunner) superviseJob(job JobInfo, attempt int, run func(JobInfo) (JobInfo, FailureReason, error)) error {
+	start := time.Now()
+	defer jr.removeJobState(job.Id)
+
+	for ; ; attempt++ {
+		var reason FailureReason
+		var err error
+		job, reason, err = run(job)
+		run = jr.runAttempt
+
+		stopped := job.State == Stopped
+		if !stopped && job.Restart.shouldRestart(err == nil, attempt) {
+			delay := job.Restart.backoff(attempt)
+			log.Printf("job %s: attempt %d exited, restarting in %s", job.Id, attempt, delay.Round(time.Millisecond))
+			select {
+			case <-job.stopped:
+				stopped = true
+			case <-time.After(delay):
+				job.Cmd = cloneCommand(job.Cmd)
+				continue
+			}
+		}
+
+		switch {
+		case stopped:
+			jr.metrics.JobFinished(job.Owner, Stopped.String(), time.Since(start))
+			return nil
+		case err == nil:
+			jr.store.UpdateRecordState(job.Id, JobState(Completed))
+			jr.metrics.JobFinished(job.Owner, Completed.String(), time.Since(start))
+			return nil
+		default:
+			jr.store.UpdateRecordFailure(job.Id, reason, err)
+			jr.metrics.JobFinished(job.Owner, Error.String(), time.Since(start))
+			return err
+		}
+	}
+}
+
+// runAttempt runs the job's command once and records how it exited. It
+// returns the updated job, and why the attempt failed if it did.
+func (jr *JobRunner) runAttempt(job JobInfo) (JobInfo, FailureReason, error) {
+	oomKillsBefore := systemOOMKills()
+	err := jr.runJob(job.Id, job.Owner, job.Cmd)
+	return jr.finishAttempt(job.Id, err, oomKillsBefore)
+}
+
+// finishAttempt records how the job's latest attempt exited, given the error
+// its command exited with. oomKillsBefore is the system's OOM kill count
+// before the attempt started, or -1 if it isn't known.
+func (jr *JobRunner) finishAttempt(id string, err error, oomKillsBefore int64) (JobInfo, FailureReason, error) {
+	job, _ := jr.store.GetRecord(id)
+	exitCode := -1
+	if job.Cmd.ProcessState != nil {
+		exitCode = job.Cmd.ProcessState.ExitCode()
+		if rusage, ok := job.Cmd.ProcessState.SysUsage().(*syscall.Rusage); ok && job.CgroupPath == "" {
+			// ru_maxrss is in kilobytes on Linux
+			jr.store.UpdateRecordMemory(job.Id, job.MemoryLimit, rusage.Maxrss*1024, job.OOMKills)
+		}
+	} else if jr.stateDir != "" {
+		exitCode = shimExitCode(err)
 	}
 
-	if job.Cmd.ProcessState.Success() {
-		jr.store.UpdateRecordState(job.Id, JobState(Completed))
+	var reason FailureReason
+	switch {
+	case err == nil:
+	// however a stopped job's process exits, it's down to the stop
+	case job.State == Stopped:
+	case isKilled(err):
+		var msg string
+		reason, msg = killReason(job, oomKillsBefore)
+		err = fmt.Errorf("%s: %w", msg, err)
+	case isExitError(err):
+		reason = FailureExitCode
+	default:
+		reason = FailureError
 	}
 
-	return nil
+	jr.store.FinishRecordAttempt(job.Id, exitCode, reason, err)
+	jr.saveJobState(job.Id)
+	job, _ = jr.store.GetRecord(job.Id)
+	return job, reason, err
 }
 
-// StopJob terminates a running job.
+// killReason works out why a job that wasn't stopped was killed with
+// SIGKILL. The job's cgroup counts OOM kills exactly, without one the best we
+// can do is check whether the OOM killer ran anywhere while the job did.
+func killReason(job JobInfo, systemOOMKillsBefore int64) (FailureReason, string) {
+	if job.CgroupPath != "" {
+		if job.OOMKills > 0 {
+			return FailureOOMKilled, "out of memory: killed by the OOM killer"
+		}
+		return FailureKilled, "killed by a signal from outside the job runner"
+	}
+
+	if systemOOMKillsBefore >= 0 && systemOOMKills() > systemOOMKillsBefore {
+		return FailureOOMKilled, "probably out of memory: killed while the OOM killer was active"
+	}
+	return FailureKilled, "killed by a signal from outside the job runner"
+}
+
+// StopJob terminates a running job or cancels a queued one.
 func (jr *JobRunner) StopJob(id string) error {
+	return jr.stopJob(id, 0)
+}
+
+// stopJob stops a job like StopJob. With a grace period the job's process is
+// sent SIGTERM first and only killed if it hasn't exited once grace is up.
+func (jr *JobRunner) stopJob(id string, grace time.Duration) error {
 	job, err := jr.store.GetRecord(id)
 
 	if err != nil {
 		return err
 	}
 
-	if job.Cmd.Process == nil {
-		return fmt.Errorf("cannot stop a nil process")
+	if job.State == Queued && jr.scheduler.remove(id) {
+		if err := jr.store.UpdateRecordState(job.Id, JobState(Stopped)); err != nil {
+			return err
+		}
+		close(job.stopped)
+		return nil
 	}
 
-	if job.State > Running {
-		return fmt.Errorf("cannot stop a job in a terminal state")
+	if job.State.IsTerminal() {
+		return &ErrAlreadyFinished{}
+	}
+
+	// the job is marked as stopped before it is killed so that StartJob can
+	// tell this kill apart from one it didn't ask for
+	err = jr.store.UpdateRecordState(job.Id, JobState(Stopped))
+
+	if err != nil {
+		return err
+	}
+
+	close(job.stopped)
+	jr.saveJobState(job.Id)
+
+	// a dispatched job may not have started its process yet, runJob won't
+	// start it now or kills it if it was starting. Between attempts the last
+	// process has exited, and a shim's job could have had its pid reused.
+	job, _ = jr.store.GetRecord(job.Id)
+	if job.Cmd.Process == nil || job.attemptFinished() {
+		jr.metrics.JobStopped(job.Owner)
+		return nil
+	}
+
+	if grace > 0 && job.Cmd.Process.Signal(syscall.SIGTERM) == nil {
+		ctx, cancel := context.WithTimeout(context.Background(), grace)
+		_, err = jr.WaitJob(ctx, job.Id)
+		cancel()
+		if err == nil {
+			jr.metrics.JobStopped(job.Owner)
+			return nil
+		}
 	}
 
 	err = job.Cmd.Process.Kill()
 
+	// the job stays stopped, it was stopped before it was killed
 	if err != nil && err != os.ErrProcessDone {
-		jr.store.UpdateRecordError(job.Id, err)
 		return err
 	}
 
-	err = jr.store.UpdateRecordState(job.Id, JobState(Stopped))
+	jr.metrics.JobStopped(job.Owner)
+	return nil
+}
 
+// DeleteJob removes a finished job and its log files.
+func (jr *JobRunner) DeleteJob(id string) error {
+	job, err := jr.store.RemoveRecord(id)
 	if err != nil {
 		return err
 	}
+	jr.removeLogs(job)
 	return nil
 }
 
@@ -101,9 +427,23 @@ func (jr *JobRunner) GetJob(id string) (JobInfo, error) {
 	return jr.store.GetRecord(id)
 }
 
+// GetJobByName retrieves the owner's job with the given name.
+func (jr *JobRunner) GetJobByName(owner string, name string) (JobInfo, error) {
+	return jr.store.GetRecordByName(owner, name)
+}
+
+// CountJobs returns how many stored jobs are in each state.
+func (jr *JobRunner) CountJobs() map[JobState]int {
+	return jr.store.CountRecordsByState()
+}
+
 // runJob handles the output of the job. It combines stdout and stderr
 // into a single output that gets fed into a file on the system.
-func (jr *JobRunner) runJob(id string, cmd *exec.Cmd) error {
+func (jr *JobRunner) runJob(id string, owner string, cmd *exec.Cmd) error {
+	if jr.stateDir != "" {
+		return jr.runJobInShim(id, owner, cmd)
+	}
+
 	stdout, err := cmd.StdoutPipe()
 	if err != nil {
 		return err
@@ -116,7 +456,13 @@ func (jr *JobRunner) runJob(id string, cmd *exec.Cmd) error {
 
 	output := io.MultiReader(stdout, stderr)
 
-	lb, err := NewLogBuffer(id)
+	record, err := jr.store.GetRecord(id)
+
+	if err != nil {
+		return err
+	}
+
+	lb, err := NewLogBufferInDir(jr.logDir, attemptLogId(id, len(record.Attempts)+1))
 
 	if err != nil {
 		return err
@@ -124,7 +470,9 @@ func (jr *JobRunner) runJob(id string, cmd *exec.Cmd) error {
 
 	defer lb.Close()
 
-	jr.store.UpdateRecordOutput(id, lb)
+	if err = jr.store.StartRecordAttempt(id, cmd, lb); err != nil {
+		return err
+	}
 
 	err = cmd.Start()
 
@@ -132,22 +480,93 @@ func (jr *JobRunner) runJob(id string, cmd *exec.Cmd) error {
 		return err
 	}
 
-	jr.store.UpdateRecordState(id, JobState(Running))
+	// the job was stopped while its process started
+	if err := jr.store.UpdateRecordState(id, JobState(Running)); err != nil {
+		cmd.Process.Kill()
+	}
+	jr.metrics.JobStarted(owner)
+
+	if path := jr.applyLimits(id, cmd.Process.Pid); path != "" {
+		defer jr.releaseCgroup(id, path)
+	}
 
-	if _, err := io.Copy(lb, output); err != nil {
+	if _, err := io.Copy(&countingWriter{w: lb, metrics: jr.metrics}, output); err != nil {
 		return err
 	}
 
 	return cmd.Wait()
 }
 
+// applyLimits places a started process in its own cgroup when resource limits
+// are configured and returns the cgroup's path. The process briefly runs
+// unrestricted between starting and being moved into the cgroup.
+func (jr *JobRunner) applyLimits(id string, pid int) string {
+	limits := jr.Settings().Limits
+	if limits.IsZero() {
+		return ""
+	}
+
+	if !cgroupsEnabled() {
+		log.Printf("job %s: resource limits not applied, cgroup v2 is not available", id)
+		return ""
+	}
+
+	path, err := createCgroup(id, limits)
+	if err != nil {
+		log.Printf("job %s: could not create cgroup: %s", id, err.Error())
+		return ""
+	}
+
+	if err := addToCgroup(path, pid); err != nil {
+		log.Printf("job %s: could not move process into cgroup: %s", id, err.Error())
+		removeCgroup(path)
+		return ""
+	}
+
+	jr.store.UpdateRecordCgroup(id, path)
+	return path
+}
+
+// releaseCgroup records a finished job's memory usage from its cgroup and
+// removes the cgroup, whose memory accounting goes away with it.
+func (jr *JobRunner) releaseCgroup(id string, path string) {
+	if usage, err := readMemoryUsage(path); err == nil {
+		jr.store.UpdateRecordMemory(id, usage.limit, usage.peak, usage.oomKills)
+	}
+	removeCgroup(path)
+}
+
+// countingWriter reports every write's size as log output.
+type countingWriter struct {
+	w       io.Writer
+	metrics metrics.Recorder
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.metrics.LogBytesWritten(n)
+	return n, err
+}
+
+// isExitError checks if a command ran and exited with a non-zero code.
+func isExitError(err error) bool {
+	switch err.(type) {
+	case *exec.ExitError, *shimExitError:
+		return true
+	}
+	return false
+}
+
 // isKilled checks if a command exited via a SIGKILL signal by
 // checking its Wait() status.
 func isKilled(err error) bool {
-	if exitErr, ok := err.(*exec.ExitError); ok {
+	switch exitErr := err.(type) {
+	case *exec.ExitError:
 		if waitStatus, ok := exitErr.Sys().(syscall.WaitStatus); ok {
 			return waitStatus.Signal() == syscall.SIGKILL
 		}
+	case *shimExitError:
+		return exitErr.signal == syscall.SIGKILL
 	}
 	return false
 }
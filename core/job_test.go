@@ -1,13 +1,14 @@
 package core
 
 import (
+	"context"
 	"fmt"
-	"math/big"
 	"os"
 	"os/exec"
 	"testing"
 	"time"
 
+	"github.com/ItsMeWithTheFace/linux-process-runner/metrics"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/suite"
 )
@@ -23,7 +24,7 @@ func (suite *JobTestSuite) SetupTest() {
 
 func (suite *JobTestSuite) TestStartJob() {
 	cmd := mockExecCommand("echo", "hello", "world")
-	job := suite.jr.CreateJob("1", big.NewInt(123), cmd)
+	job := suite.jr.CreateJob("1", "123", cmd)
 	err := suite.jr.StartJob(job)
 	assert.NoError(suite.T(), err, "starting job should not throw an error")
 
@@ -34,19 +35,20 @@ func (suite *JobTestSuite) TestStartJob() {
 
 func (suite *JobTestSuite) TestStopJob() {
 	cmd := mockExecCommand("echo", "hello", "world")
-	job := suite.jr.store.CreateRecord("1", cmd, big.NewInt(123), JobState(Created), nil)
+	job := suite.jr.store.CreateRecord("1", cmd, "123", JobState(Created), nil)
 	cmd.Start()
 	suite.jr.StopJob(job.Id)
 	updatedJob, _ := suite.jr.store.GetRecord(job.Id)
 
 	assert.Equal(suite.T(), JobState(Stopped), updatedJob.State, "it should have stopped")
+	assert.IsType(suite.T(), &ErrAlreadyFinished{}, suite.jr.StopJob(job.Id), "a finished job can't be stopped again")
 }
 
 func (suite *JobTestSuite) TestStopLongJob() {
 	cmd := mockExecCommand("sleep")
 
 	errChan := make(chan error, 1)
-	job := suite.jr.CreateJob("1", big.NewInt(123), cmd)
+	job := suite.jr.CreateJob("1", "123", cmd)
 	go func() {
 		errChan <- suite.jr.StartJob(job)
 	}()
@@ -59,17 +61,79 @@ func (suite *JobTestSuite) TestStopLongJob() {
 	assert.Equal(suite.T(), JobState(Stopped), updatedJob.State, "it should have stopped")
 }
 
+func (suite *JobTestSuite) TestStopJobKillFails() {
+	cmd := mockExecCommand("sleep")
+	suite.Require().NoError(cmd.Start())
+	defer cmd.Wait()
+	defer cmd.Process.Kill()
+
+	// a released handle to the job's process can't be signalled
+	process, err := os.FindProcess(cmd.Process.Pid)
+	suite.Require().NoError(err)
+	process.Release()
+	jobCmd := mockExecCommand("sleep")
+	jobCmd.Process = process
+	job := suite.jr.store.CreateRecord("1", jobCmd, "123", JobState(Running), nil)
+
+	assert.Error(suite.T(), suite.jr.StopJob(job.Id))
+	job, _ = suite.jr.store.GetRecord(job.Id)
+	assert.Equal(suite.T(), JobState(Stopped), job.State, "a failed kill shouldn't undo the stop")
+	assert.NoError(suite.T(), job.Err)
+}
+
 func (suite *JobTestSuite) TestStopUnstartedJob() {
 	cmd := mockExecCommand("echo", "hello", "world")
-	job := suite.jr.store.CreateRecord("1", cmd, big.NewInt(1), JobState(Created), nil)
+	job := suite.jr.store.CreateRecord("1", cmd, "1", JobState(Created), nil)
+
+	assert.NoError(suite.T(), suite.jr.StopJob(job.Id), "a dispatched job should stop before it starts")
+	assert.NoError(suite.T(), suite.jr.StartJob(job))
+	job, _ = suite.jr.store.GetRecord(job.Id)
+	assert.Equal(suite.T(), JobState(Stopped), job.State)
+	assert.Empty(suite.T(), job.Attempts, "the job's command shouldn't run")
+	assert.Nil(suite.T(), cmd.Process)
+}
+
+func (suite *JobTestSuite) TestFailedJob() {
+	job := suite.jr.CreateJob("1", "123", mockExecCommand("false"))
+	assert.Error(suite.T(), suite.jr.StartJob(job))
+
+	job, _ = suite.jr.store.GetRecord("1")
+	assert.Equal(suite.T(), JobState(Error), job.State)
+	assert.Equal(suite.T(), FailureExitCode, job.FailureReason)
+	assert.Greater(suite.T(), job.MemoryPeak, int64(0), "peak RSS should be recorded without a cgroup")
+}
+
+func (suite *JobTestSuite) TestKilledJob() {
+	job := suite.jr.CreateJob("1", "123", mockExecCommand("sleep"))
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- suite.jr.StartJob(job)
+	}()
+	for job, _ := suite.jr.store.GetRecord("1"); job.State == JobState(Created); job, _ = suite.jr.store.GetRecord("1") {
+	}
+	job.Cmd.Process.Kill()
+	assert.Error(suite.T(), <-errChan)
+
+	job, _ = suite.jr.store.GetRecord("1")
+	assert.Equal(suite.T(), JobState(Error), job.State, "a kill the runner didn't send is a failure")
+	assert.Contains(suite.T(), []FailureReason{FailureKilled, FailureOOMKilled}, job.FailureReason)
+}
+
+func (suite *JobTestSuite) TestKillReason() {
+	reason, _ := killReason(JobInfo{CgroupPath: "/sys/fs/cgroup/job", OOMKills: 1}, 0)
+	assert.Equal(suite.T(), FailureOOMKilled, reason)
 
-	assert.Error(suite.T(), suite.jr.StopJob(job.Id), "it should error for unstarted job")
+	reason, _ = killReason(JobInfo{CgroupPath: "/sys/fs/cgroup/job"}, 0)
+	assert.Equal(suite.T(), FailureKilled, reason, "the cgroup's count should win over the system's")
+
+	reason, _ = killReason(JobInfo{}, -1)
+	assert.Equal(suite.T(), FailureKilled, reason, "no counter means no evidence of an OOM kill")
 }
 
 func (suite *JobTestSuite) TestRunJob() {
 	cmd := mockExecCommand("echo", "hello", "world")
-	job := suite.jr.store.CreateRecord("1", cmd, big.NewInt(1), JobState(Created), nil)
-	err := suite.jr.runJob(job.Id, cmd)
+	job := suite.jr.store.CreateRecord("1", cmd, "1", JobState(Created), nil)
+	err := suite.jr.runJob(job.Id, job.Owner, cmd)
 	assert.NoError(suite.T(), err, "running job should not error")
 	assert.FileExists(suite.T(), fmt.Sprintf("/var/log/linux-process-runner/%s.log", job.Id), "it should create an output file")
 
@@ -86,6 +150,74 @@ func (suite *JobTestSuite) TestRunJob() {
 	assert.Equal(suite.T(), "hello world", s, "log buffer should contain the same output as command")
 }
 
+func (suite *JobTestSuite) TestWaitJob() {
+	job := suite.jr.CreateJob("1", "123", mockExecCommand("false"))
+	go suite.jr.StartJob(job)
+
+	job, err := suite.jr.WaitJob(context.Background(), "1")
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), JobState(Error), job.State)
+	suite.Require().Len(job.Attempts, 1)
+	assert.Equal(suite.T(), 1, job.Attempts[0].ExitCode, "the job should be returned once its process has exited")
+
+	job = suite.jr.CreateJob("2", "123", mockExecCommand("sleep"))
+	go suite.jr.StartJob(job)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = suite.jr.WaitJob(ctx, "2")
+	assert.Equal(suite.T(), context.DeadlineExceeded, err, "waiting should give up with the context")
+
+	for job, _ := suite.jr.store.GetRecord("2"); job.State == JobState(Created); job, _ = suite.jr.store.GetRecord("2") {
+	}
+	assert.NoError(suite.T(), suite.jr.StopJob("2"))
+	job, err = suite.jr.WaitJob(context.Background(), "2")
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), JobState(Stopped), job.State)
+	assert.False(suite.T(), job.Attempts[0].FinishedAt.IsZero(), "a stopped job should be returned once its process has exited")
+
+	_, err = suite.jr.WaitJob(context.Background(), "3")
+	assert.IsType(suite.T(), &ErrNotFound{}, err)
+}
+
+type fakeRecorder struct {
+	metrics.Nop
+	started  []string
+	stopped  []string
+	finished []string
+	bytes    int
+}
+
+func (f *fakeRecorder) JobStarted(owner string) { f.started = append(f.started, owner) }
+func (f *fakeRecorder) JobStopped(owner string) { f.stopped = append(f.stopped, owner) }
+func (f *fakeRecorder) LogBytesWritten(n int)   { f.bytes += n }
+func (f *fakeRecorder) JobFinished(owner string, state string, duration time.Duration) {
+	f.finished = append(f.finished, owner+":"+state)
+}
+
+func (suite *JobTestSuite) TestMetrics() {
+	rec := &fakeRecorder{}
+	suite.jr = InitializeJobRunner(InitializeInMemoryJobStore(), WithMetrics(rec))
+
+	job := suite.jr.CreateJob("1", "alice", mockExecCommand("echo", "hello", "world"))
+	assert.NoError(suite.T(), suite.jr.StartJob(job))
+
+	job = suite.jr.CreateJob("2", "bob", mockExecCommand("sleep"))
+	done := make(chan error, 1)
+	go func() {
+		done <- suite.jr.StartJob(job)
+	}()
+	for job, _ := suite.jr.store.GetRecord("2"); job.State == JobState(Created); job, _ = suite.jr.store.GetRecord("2") {
+	}
+	assert.NoError(suite.T(), suite.jr.StopJob("2"))
+	<-done
+
+	assert.Equal(suite.T(), []string{"alice", "bob"}, rec.started)
+	assert.Equal(suite.T(), []string{"bob"}, rec.stopped)
+	assert.Equal(suite.T(), []string{"alice:completed", "bob:stopped"}, rec.finished)
+	assert.Equal(suite.T(), len("hello world"), rec.bytes)
+	assert.Equal(suite.T(), map[JobState]int{Completed: 1, Stopped: 1}, suite.jr.CountJobs())
+}
+
 func TestJobTestSuite(t *testing.T) {
 	suite.Run(t, new(JobTestSuite))
 }
@@ -97,6 +229,8 @@ func TestCommand(t *testing.T) {
 	} else if os.Getenv("GO_TEST_PROCESS") == "2" {
 		time.Sleep(10 * time.Second)
 		os.Exit(0)
+	} else if os.Getenv("GO_TEST_PROCESS") == "3" {
+		os.Exit(1)
 	}
 	return
 }
@@ -114,6 +248,8 @@ func mockExecCommand(command string, args ...string) *exec.Cmd {
 		cmd.Env = []string{"GO_TEST_PROCESS=1"}
 	case "sleep":
 		cmd.Env = []string{"GO_TEST_PROCESS=2"}
+	case "false":
+		cmd.Env = []string{"GO_TEST_PROCESS=3"}
 	}
 
 	return cmd
@@ -0,0 +1,239 @@
+package core
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// Limits on job metadata, the same as Kubernetes'.
+const (
+	MaxLabelNameLength   = 63
+	MaxLabelPrefixLength = 253
+	MaxLabelValueLength  = 63
+	MaxJobNameLength     = 63
+	// MaxAnnotationsSize bounds the keys and values of all of a job's
+	// annotations together.
+	MaxAnnotationsSize = 256 * 1024
+)
+
+var (
+	labelNamePattern   = regexp.MustCompile(`^[A-Za-z0-9]([-A-Za-z0-9_.]*[A-Za-z0-9])?$`)
+	labelPrefixPattern = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?(\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*$`)
+)
+
+// WithLabels attaches labels, which jobs can be selected by, and annotations,
+// which are free-form, to a job.
+func WithLabels(labels map[string]string, annotations map[string]string) JobOption {
+	return func(job *JobInfo) {
+		job.Labels = labels
+		job.Annotations = annotations
+	}
+}
+
+// ValidateLabels checks label keys and values. Keys are an optional DNS
+// subdomain prefix and a slash followed by a name of up to 63 alphanumerics,
+// '-', '_' or '.', starting and ending with an alphanumeric. Values follow the
+// same rules as names but may be empty.
+func ValidateLabels(labels map[string]string) error {
+	for key, value := range labels {
+		if err := validateLabelKey(key); err != nil {
+			return err
+		}
+		if err := validateLabelValue(value); err != nil {
+			return fmt.Errorf("label %s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+// ValidateJobName checks a job name, which follows the rules for label names
+// but can't look like a job ID so that either can be used to look a job up.
+func ValidateJobName(name string) error {
+	if len(name) > MaxJobNameLength || !labelNamePattern.MatchString(name) {
+		return fmt.Errorf("name %q must be at most %d alphanumerics, '-', '_' or '.' starting and ending with an alphanumeric", name, MaxJobNameLength)
+	}
+	if _, err := uuid.Parse(name); err == nil {
+		return fmt.Errorf("name %q cannot be a UUID", name)
+	}
+	return nil
+}
+
+// ValidateAnnotations checks annotation keys, which follow the rules for
+// label keys, and the annotations' total size. Values can be anything.
+func ValidateAnnotations(annotations map[string]string) error {
+	size := 0
+	for key, value := range annotations {
+		if err := validateLabelKey(key); err != nil {
+			return err
+		}
+		size += len(key) + len(value)
+	}
+	if size > MaxAnnotationsSize {
+		return fmt.Errorf("annotations are %d bytes, the limit is %d", size, MaxAnnotationsSize)
+	}
+	return nil
+}
+
+func validateLabelKey(key string) error {
+	name := key
+	if i := strings.LastIndexByte(key, '/'); i >= 0 {
+		prefix := key[:i]
+		name = key[i+1:]
+		if len(prefix) == 0 || len(prefix) > MaxLabelPrefixLength || !labelPrefixPattern.MatchString(prefix) {
+			return fmt.Errorf("key %q must have a DNS subdomain of at most %d characters before the '/'", key, MaxLabelPrefixLength)
+		}
+	}
+	if len(name) == 0 || len(name) > MaxLabelNameLength || !labelNamePattern.MatchString(name) {
+		return fmt.Errorf("key %q must be at most %d alphanumerics, '-', '_' or '.' starting and ending with an alphanumeric", key, MaxLabelNameLength)
+	}
+	return nil
+}
+
+func validateLabelValue(value string) error {
+	if value == "" {
+		return nil
+	}
+	if len(value) > MaxLabelValueLength || !labelNamePattern.MatchString(value) {
+		return fmt.Errorf("value %q must be at most %d alphanumerics, '-', '_' or '.' starting and ending with an alphanumeric", value, MaxLabelValueLength)
+	}
+	return nil
+}
+
+// SelectorOperator is how a requirement compares a label.
+type SelectorOperator string
+
+const (
+	SelectorEquals       SelectorOperator = "="
+	SelectorNotEquals    SelectorOperator = "!="
+	SelectorIn           SelectorOperator = "in"
+	SelectorNotIn        SelectorOperator = "notin"
+	SelectorExists       SelectorOperator = "exists"
+	SelectorDoesNotExist SelectorOperator = "!"
+)
+
+// Requirement is one condition of a selector.
+type Requirement struct {
+	Key      string
+	Operator SelectorOperator
+	Values   []string
+}
+
+// Selector matches jobs whose labels meet every requirement. The empty
+// selector matches every job.
+type Selector []Requirement
+
+var setRequirementPattern = regexp.MustCompile(`^(\S+)\s+(in|notin)\s*\((.*)\)$`)
+
+// ParseSelector parses a Kubernetes style label selector: a comma separated
+// list of "key=value", "key==value", "key!=value", "key in (a,b)",
+// "key notin (a,b)", "key" and "!key".
+func ParseSelector(selector string) (Selector, error) {
+	var parts []string
+	depth, start := 0, 0
+	for i, r := range selector {
+		switch r {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				parts = append(parts, selector[start:i])
+				start = i + 1
+			}
+		}
+	}
+	parts = append(parts, selector[start:])
+
+	var out Selector
+	for _, part := range parts {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			if len(parts) == 1 {
+				break
+			}
+			return nil, &ErrInvalidSelector{reason: "empty requirement"}
+		}
+
+		req, err := parseRequirement(part)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, req)
+	}
+	return out, nil
+}
+
+func parseRequirement(part string) (Requirement, error) {
+	var req Requirement
+	switch {
+	case strings.HasPrefix(part, "!") && !strings.Contains(part, "="):
+		req = Requirement{Key: strings.TrimSpace(part[1:]), Operator: SelectorDoesNotExist}
+	case setRequirementPattern.MatchString(part):
+		m := setRequirementPattern.FindStringSubmatch(part)
+		req = Requirement{Key: m[1], Operator: SelectorOperator(m[2])}
+		for _, value := range strings.Split(m[3], ",") {
+			req.Values = append(req.Values, strings.TrimSpace(value))
+		}
+	case strings.Contains(part, "!="):
+		kv := strings.SplitN(part, "!=", 2)
+		req = Requirement{Key: strings.TrimSpace(kv[0]), Operator: SelectorNotEquals, Values: []string{strings.TrimSpace(kv[1])}}
+	case strings.Contains(part, "="):
+		kv := strings.SplitN(part, "=", 2)
+		value := strings.TrimPrefix(kv[1], "=")
+		req = Requirement{Key: strings.TrimSpace(kv[0]), Operator: SelectorEquals, Values: []string{strings.TrimSpace(value)}}
+	default:
+		req = Requirement{Key: part, Operator: SelectorExists}
+	}
+
+	if err := validateLabelKey(req.Key); err != nil {
+		return Requirement{}, &ErrInvalidSelector{reason: err.Error()}
+	}
+	for _, value := range req.Values {
+		if err := validateLabelValue(value); err != nil {
+			return Requirement{}, &ErrInvalidSelector{reason: err.Error()}
+		}
+	}
+	sort.Strings(req.Values)
+	return req, nil
+}
+
+// Matches reports whether labels meet every requirement of the selector.
+// Like Kubernetes, != and notin match jobs that don't have the label at all.
+func (s Selector) Matches(labels map[string]string) bool {
+	for _, req := range s {
+		if !req.matches(labels) {
+			return false
+		}
+	}
+	return true
+}
+
+func (r Requirement) matches(labels map[string]string) bool {
+	value, ok := labels[r.Key]
+	switch r.Operator {
+	case SelectorExists:
+		return ok
+	case SelectorDoesNotExist:
+		return !ok
+	case SelectorEquals, SelectorIn:
+		return ok && r.hasValue(value)
+	case SelectorNotEquals, SelectorNotIn:
+		return !ok || !r.hasValue(value)
+	default:
+		return false
+	}
+}
+
+func (r Requirement) hasValue(value string) bool {
+	for _, v := range r.Values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
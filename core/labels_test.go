@@ -0,0 +1,75 @@
+package core
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateLabels(t *testing.T) {
+	assert.NoError(t, ValidateLabels(map[string]string{
+		"team":                    "payments",
+		"example.com/pipeline-id": "run_42.b",
+		"ticket":                  "",
+	}))
+
+	for _, labels := range []map[string]string{
+		{"": "a"},
+		{"-team": "a"},
+		{"team/": "a"},
+		{"/team": "a"},
+		{"Example.com/team": "a"},
+		{strings.Repeat("a", MaxLabelNameLength+1): "a"},
+		{"team": "has space"},
+		{"team": strings.Repeat("a", MaxLabelValueLength+1)},
+	} {
+		assert.Error(t, ValidateLabels(labels), "%v", labels)
+	}
+}
+
+func TestValidateJobName(t *testing.T) {
+	assert.NoError(t, ValidateJobName("nightly-backup.v2"))
+	assert.Error(t, ValidateJobName(""))
+	assert.Error(t, ValidateJobName("has space"))
+	assert.Error(t, ValidateJobName(strings.Repeat("a", MaxJobNameLength+1)))
+	assert.Error(t, ValidateJobName("6ba7b810-9dad-11d1-80b4-00c04fd430c8"), "names can't be confused with IDs")
+}
+
+func TestValidateAnnotations(t *testing.T) {
+	assert.NoError(t, ValidateAnnotations(map[string]string{"description": "anything goes, even spaces"}))
+	assert.Error(t, ValidateAnnotations(map[string]string{"not a key": "a"}))
+	assert.Error(t, ValidateAnnotations(map[string]string{"big": strings.Repeat("a", MaxAnnotationsSize)}))
+}
+
+func TestSelector(t *testing.T) {
+	labels := map[string]string{"env": "prod", "team": "b"}
+	for selector, matches := range map[string]bool{
+		"":                            true,
+		"env=prod":                    true,
+		"env==prod":                   true,
+		"env=dev":                     false,
+		"env!=dev":                    true,
+		"tier!=web":                   true,
+		"team in (a, b)":              true,
+		"team notin (a,b)":            false,
+		"tier notin (web)":            true,
+		"env":                         true,
+		"!env":                        false,
+		"!tier":                       true,
+		"env=prod,team in (a,b)":      true,
+		"env=prod, team in (a,c)":     false,
+		"env in (prod),!tier,team=b":  true,
+		"example.com/owner notin (x)": true,
+	} {
+		sel, err := ParseSelector(selector)
+		if assert.NoError(t, err, selector) {
+			assert.Equal(t, matches, sel.Matches(labels), selector)
+		}
+	}
+
+	for _, selector := range []string{"env=prod,", "env=has space", "team in (a b)", "=prod", "!"} {
+		_, err := ParseSelector(selector)
+		assert.IsType(t, &ErrInvalidSelector{}, err, selector)
+	}
+}
@@ -3,8 +3,12 @@ package core
 import (
 	"io"
 	"os"
+	"path/filepath"
 )
 
+// DefaultLogDir is where job output is written to unless configured otherwise.
+const DefaultLogDir = "/var/log/linux-process-runner"
+
 type logBuffer struct {
 	*os.File
 }
@@ -26,10 +30,29 @@ func (lb logBuffer) NewReader() (io.ReadCloser, error) {
 
 // NewLogBuffer creates the log file to store output to.
 func NewLogBuffer(id string) (LogBuffer, error) {
-	// TODO: allow users to configure this folder
-	f, err := os.Create("/var/log/linux-process-runner/" + id + ".log")
+	return NewLogBufferInDir(DefaultLogDir, id)
+}
+
+// NewLogBufferInDir creates the log file to store output to under dir.
+func NewLogBufferInDir(dir string, id string) (LogBuffer, error) {
+	f, err := os.Create(logPath(dir, id))
 	if err != nil {
 		return nil, err
 	}
 	return logBuffer{File: f}, nil
 }
+
+// openLogBufferInDir opens an existing log file under dir without
+// truncating it, or creates it if it's missing.
+func openLogBufferInDir(dir string, id string) (LogBuffer, error) {
+	f, err := os.OpenFile(logPath(dir, id), os.O_RDWR|os.O_APPEND|os.O_CREATE, 0666)
+	if err != nil {
+		return nil, err
+	}
+	return logBuffer{File: f}, nil
+}
+
+// logPath returns the location of a job's log file.
+func logPath(dir string, id string) string {
+	return filepath.Join(dir, id+".log")
+}
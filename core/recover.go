@@ -0,0 +1,256 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+)
+
+// jobStateFile is where a job's record is saved in its state dir.
+const jobStateFile = "job.json"
+
+// jobState is the part of a job's record that is saved while its shim runs,
+// enough to track the job again after the server restarts.
+type jobState struct {
+	Id          string            `json:"id"`
+	Name        string            `json:"name,omitempty"`
+	Owner       string            `json:"owner"`
+	Path        string            `json:"path"`
+	Args        []string          `json:"args"`
+	Env         []string          `json:"env,omitempty"`
+	Dir         string            `json:"dir,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+	Restart     RestartPolicy     `json:"restart"`
+	Priority    int32             `json:"priority"`
+	CreatedAt   time.Time         `json:"created_at"`
+	// Stopped is set once the job has been stopped, its last attempt may
+	// still be exiting.
+	Stopped     bool           `json:"stopped,omitempty"`
+	CgroupPath  string         `json:"cgroup_path,omitempty"`
+	MemoryLimit int64          `json:"memory_limit,omitempty"`
+	MemoryPeak  int64          `json:"memory_peak,omitempty"`
+	Attempts    []attemptState `json:"attempts"`
+}
+
+// attemptState is a saved Attempt.
+type attemptState struct {
+	StartedAt     time.Time     `json:"started_at"`
+	FinishedAt    time.Time     `json:"finished_at,omitempty"`
+	ExitCode      int           `json:"exit_code"`
+	Error         string        `json:"error,omitempty"`
+	FailureReason FailureReason `json:"failure_reason,omitempty"`
+}
+
+// jobStateDir returns the folder a job's state and its shim's files are kept
+// in.
+func (jr *JobRunner) jobStateDir(id string) string {
+	return filepath.Join(jr.stateDir, id)
+}
+
+// saveJobState saves a job's record to its state dir, if the runner has one.
+func (jr *JobRunner) saveJobState(id string) error {
+	if jr.stateDir == "" {
+		return nil
+	}
+	err := jr.writeJobState(id)
+	if err != nil {
+		log.Printf("job %s: could not save state: %s", id, err.Error())
+	}
+	return err
+}
+
+func (jr *JobRunner) writeJobState(id string) error {
+	job, err := jr.store.GetRecord(id)
+	if err != nil {
+		return err
+	}
+
+	state := jobState{
+		Id:          job.Id,
+		Name:        job.Name,
+		Owner:       job.Owner,
+		Path:        job.Cmd.Path,
+		Args:        job.Cmd.Args,
+		Env:         job.Cmd.Env,
+		Dir:         job.Cmd.Dir,
+		Labels:      job.Labels,
+		Annotations: job.Annotations,
+		Restart:     job.Restart,
+		Priority:    job.Priority,
+		CreatedAt:   job.CreatedAt,
+		Stopped:     job.State == Stopped,
+		CgroupPath:  job.CgroupPath,
+		MemoryLimit: job.MemoryLimit,
+		MemoryPeak:  job.MemoryPeak,
+	}
+	for _, attempt := range job.Attempts {
+		saved := attemptState{
+			StartedAt:     attempt.StartedAt,
+			FinishedAt:    attempt.FinishedAt,
+			ExitCode:      attempt.ExitCode,
+			FailureReason: attempt.FailureReason,
+		}
+		if attempt.Err != nil {
+			saved.Error = attempt.Err.Error()
+		}
+		state.Attempts = append(state.Attempts, saved)
+	}
+
+	dir := jr.jobStateDir(id)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	return writeJSONAtomic(filepath.Join(dir, jobStateFile), state)
+}
+
+// removeJobState removes the state dir of a job that has finished for good.
+func (jr *JobRunner) removeJobState(id string) {
+	if jr.stateDir == "" {
+		return
+	}
+	if err := os.RemoveAll(jr.jobStateDir(id)); err != nil {
+		log.Printf("job %s: could not remove state: %s", id, err.Error())
+	}
+}
+
+// Recover reattaches to the jobs left in the state dir by a previous run of
+// the server. Jobs whose shim is still running are tracked, stopped and
+// streamed like any other, and jobs that exited while the server was down
+// are finished or restarted as their restart policy asks. It returns how many
+// jobs were recovered.
+func (jr *JobRunner) Recover() (int, error) {
+	if jr.stateDir == "" {
+		return 0, nil
+	}
+	if err := os.MkdirAll(jr.stateDir, 0700); err != nil {
+		return 0, err
+	}
+
+	entries, err := ioutil.ReadDir(jr.stateDir)
+	if err != nil {
+		return 0, err
+	}
+
+	recovered := 0
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		if err := jr.recoverJob(entry.Name()); err != nil {
+			log.Printf("job %s: could not recover: %s", entry.Name(), err.Error())
+			continue
+		}
+		recovered++
+	}
+	return recovered, nil
+}
+
+// recoverJob restores the record of the job saved under id and goes back to
+// supervising it.
+func (jr *JobRunner) recoverJob(id string) error {
+	dir := jr.jobStateDir(id)
+	var state jobState
+	if err := readJSON(filepath.Join(dir, jobStateFile), &state); err != nil {
+		return err
+	}
+	if state.Id != id || len(state.Args) == 0 || len(state.Attempts) == 0 {
+		return fmt.Errorf("%s is incomplete", jobStateFile)
+	}
+
+	cmd := exec.Command(state.Path)
+	cmd.Args = state.Args
+	cmd.Env = state.Env
+	cmd.Dir = state.Dir
+
+	job := JobInfo{
+		Id:          state.Id,
+		Name:        state.Name,
+		Cmd:         cmd,
+		Owner:       state.Owner,
+		State:       JobState(Running),
+		CreatedAt:   state.CreatedAt,
+		CgroupPath:  state.CgroupPath,
+		Priority:    state.Priority,
+		MemoryLimit: state.MemoryLimit,
+		MemoryPeak:  state.MemoryPeak,
+		Labels:      state.Labels,
+		Annotations: state.Annotations,
+		Restart:     state.Restart,
+	}
+	if state.Stopped {
+		job.State = JobState(Stopped)
+		job.FinishedAt = time.Now()
+	}
+	for i, saved := range state.Attempts {
+		output, err := openLogBufferInDir(jr.logDir, attemptLogId(id, i+1))
+		if err != nil {
+			return err
+		}
+		attempt := Attempt{
+			Number:        i + 1,
+			Output:        output,
+			StartedAt:     saved.StartedAt,
+			FinishedAt:    saved.FinishedAt,
+			ExitCode:      saved.ExitCode,
+			FailureReason: saved.FailureReason,
+		}
+		if saved.Error != "" {
+			attempt.Err = errors.New(saved.Error)
+		}
+		job.Attempts = append(job.Attempts, attempt)
+	}
+	job.Output = job.Attempts[len(job.Attempts)-1].Output
+
+	last := len(job.Attempts)
+	var started shimStarted
+	alive := false
+	if !job.attemptFinished() && readJSON(shimStartedPath(dir, last), &started) == nil {
+		alive = shimAlive(dir, started)
+		if alive {
+			cmd.Process, _ = os.FindProcess(started.Pid)
+		}
+	}
+	// the server went away in the middle of stopping the job
+	if alive && job.State == Stopped {
+		cmd.Process.Kill()
+	}
+
+	if err := jr.store.RestoreRecord(job); err != nil {
+		return err
+	}
+	jr.scheduler.reserve(job.Owner)
+	if alive {
+		jr.metrics.JobStarted(job.Owner)
+	}
+	log.Printf("job %s: recovered attempt %d, shim running: %t", id, last, alive)
+
+	go func() {
+		jr.superviseJob(job, last, func(job JobInfo) (JobInfo, FailureReason, error) {
+			return jr.reattachAttempt(job, started, alive)
+		})
+		jr.release(job.Owner)
+	}()
+	return nil
+}
+
+// reattachAttempt waits for the latest attempt of a recovered job to exit
+// and records how it did, unless it had already been recorded.
+func (jr *JobRunner) reattachAttempt(job JobInfo, started shimStarted, alive bool) (JobInfo, FailureReason, error) {
+	if job.attemptFinished() {
+		attempt := job.Attempts[len(job.Attempts)-1]
+		return job, attempt.FailureReason, attempt.Err
+	}
+
+	attempt := len(job.Attempts)
+	if alive {
+		waitShim(jr.jobStateDir(job.Id), attempt, started)
+	}
+	err := jr.shimResult(job.Id, attempt, job.CgroupPath)
+	return jr.finishAttempt(job.Id, err, -1)
+}
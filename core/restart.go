@@ -0,0 +1,123 @@
+package core
+
+import (
+	"fmt"
+	"math/rand"
+	"os/exec"
+	"time"
+)
+
+// RestartMode decides when a job's command is run again after it exits.
+type RestartMode int32
+
+const (
+	// RestartNever runs the command once.
+	RestartNever RestartMode = iota
+	// RestartOnFailure runs the command again if it failed.
+	RestartOnFailure
+	// RestartAlways runs the command again however it exited, unless the job
+	// was stopped.
+	RestartAlways
+)
+
+// Default restart backoffs, used when a RestartPolicy leaves them at zero.
+const (
+	DefaultRestartBackoff    = time.Second
+	DefaultMaxRestartBackoff = 5 * time.Minute
+)
+
+// RestartPolicy controls whether and when a job is restarted. MaxAttempts
+// counts the first run as well, zero means no limit. The delay before a
+// restart doubles with every attempt from InitialBackoff up to MaxBackoff.
+type RestartPolicy struct {
+	Mode           RestartMode   `json:"mode"`
+	MaxAttempts    int           `json:"max_attempts,omitempty"`
+	InitialBackoff time.Duration `json:"initial_backoff,omitempty"`
+	MaxBackoff     time.Duration `json:"max_backoff,omitempty"`
+}
+
+// Validate checks that the policy is usable.
+func (p RestartPolicy) Validate() error {
+	if p.Mode < RestartNever || p.Mode > RestartAlways {
+		return fmt.Errorf("unknown restart mode %d", p.Mode)
+	}
+	if p.MaxAttempts < 0 || p.InitialBackoff < 0 || p.MaxBackoff < 0 {
+		return fmt.Errorf("restart attempts and backoffs cannot be negative")
+	}
+	return nil
+}
+
+// shouldRestart reports whether another attempt should follow the given one.
+func (p RestartPolicy) shouldRestart(succeeded bool, attempt int) bool {
+	if p.MaxAttempts > 0 && attempt >= p.MaxAttempts {
+		return false
+	}
+	switch p.Mode {
+	case RestartAlways:
+		return true
+	case RestartOnFailure:
+		return !succeeded
+	default:
+		return false
+	}
+}
+
+// backoff returns how long to wait before the attempt after the given one.
+// The delay is picked at random from the upper half of the exponential
+// backoff so that jobs failing together don't all restart together.
+func (p RestartPolicy) backoff(attempt int) time.Duration {
+	initial, max := p.InitialBackoff, p.MaxBackoff
+	if initial == 0 {
+		initial = DefaultRestartBackoff
+	}
+	if max == 0 {
+		max = DefaultMaxRestartBackoff
+	}
+
+	d := initial
+	for i := 1; i < attempt && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// WithRestartPolicy restarts the job according to policy.
+func WithRestartPolicy(policy RestartPolicy) JobOption {
+	return func(job *JobInfo) {
+		job.Restart = policy
+	}
+}
+
+// cloneCommand returns an unstarted copy of cmd, an exec.Cmd can only be
+// started once.
+func cloneCommand(cmd *exec.Cmd) *exec.Cmd {
+	clone := exec.Command(cmd.Path, cmd.Args[1:]...)
+	clone.Args = cmd.Args
+	clone.Env = cmd.Env
+	clone.Dir = cmd.Dir
+	clone.SysProcAttr = cmd.SysProcAttr
+	return clone
+}
+
+// attemptFinished reports whether the job's latest attempt has exited.
+func (job JobInfo) attemptFinished() bool {
+	return len(job.Attempts) > 0 && !job.Attempts[len(job.Attempts)-1].FinishedAt.IsZero()
+}
+
+// finished reports whether the job is in a terminal state and its process
+// has exited. A stopped job is terminal before its process has gone.
+func (job JobInfo) finished() bool {
+	return job.State.IsTerminal() && (len(job.Attempts) == 0 || job.attemptFinished())
+}
+
+// attemptLogId names the log of one attempt. The first keeps the job's ID so
+// jobs that never restart have the same log file as before.
+func attemptLogId(id string, attempt int) string {
+	if attempt <= 1 {
+		return id
+	}
+	return fmt.Sprintf("%s.%d", id, attempt)
+}
@@ -0,0 +1,160 @@
+package core
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type RestartTestSuite struct {
+	suite.Suite
+	jr     *JobRunner
+	logDir string
+}
+
+func (suite *RestartTestSuite) SetupTest() {
+	dir, err := ioutil.TempDir("", "logs")
+	suite.Require().NoError(err)
+	suite.logDir = dir
+	suite.jr = InitializeJobRunner(InitializeInMemoryJobStore(), WithLogDir(dir))
+}
+
+func (suite *RestartTestSuite) TearDownTest() {
+	os.RemoveAll(suite.logDir)
+}
+
+func (suite *RestartTestSuite) TestRestartOnFailure() {
+	policy := RestartPolicy{Mode: RestartOnFailure, MaxAttempts: 3, InitialBackoff: time.Millisecond}
+	job := suite.jr.CreateJob("1", "123", mockExecCommand("false"), WithRestartPolicy(policy))
+	assert.Error(suite.T(), suite.jr.StartJob(job))
+
+	job, _ = suite.jr.GetJob("1")
+	assert.Equal(suite.T(), JobState(Error), job.State)
+	assert.Equal(suite.T(), FailureExitCode, job.FailureReason)
+	suite.Require().Len(job.Attempts, 3)
+	for i, attempt := range job.Attempts {
+		assert.Equal(suite.T(), i+1, attempt.Number)
+		assert.Equal(suite.T(), 1, attempt.ExitCode)
+		assert.Equal(suite.T(), FailureExitCode, attempt.FailureReason)
+		assert.False(suite.T(), attempt.FinishedAt.IsZero())
+		assert.FileExists(suite.T(), logPath(suite.logDir, attemptLogId("1", i+1)), "every attempt has its own log")
+	}
+}
+
+func (suite *RestartTestSuite) TestOnFailureDoesNotRestartSuccess() {
+	policy := RestartPolicy{Mode: RestartOnFailure, MaxAttempts: 3, InitialBackoff: time.Millisecond}
+	job := suite.jr.CreateJob("1", "123", mockExecCommand("echo"), WithRestartPolicy(policy))
+	assert.NoError(suite.T(), suite.jr.StartJob(job))
+
+	job, _ = suite.jr.GetJob("1")
+	assert.Equal(suite.T(), JobState(Completed), job.State)
+	assert.Len(suite.T(), job.Attempts, 1)
+}
+
+func (suite *RestartTestSuite) TestRestartAlways() {
+	policy := RestartPolicy{Mode: RestartAlways, MaxAttempts: 2, InitialBackoff: time.Millisecond}
+	job := suite.jr.CreateJob("1", "123", mockExecCommand("echo"), WithRestartPolicy(policy))
+	assert.NoError(suite.T(), suite.jr.StartJob(job))
+
+	job, _ = suite.jr.GetJob("1")
+	assert.Equal(suite.T(), JobState(Completed), job.State)
+	assert.Len(suite.T(), job.Attempts, 2)
+}
+
+func (suite *RestartTestSuite) TestStopDuringBackoff() {
+	policy := RestartPolicy{Mode: RestartAlways, InitialBackoff: time.Minute}
+	job := suite.jr.CreateJob("1", "123", mockExecCommand("echo"), WithRestartPolicy(policy))
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- suite.jr.StartJob(job)
+	}()
+
+	suite.Require().Eventually(func() bool {
+		job, _ := suite.jr.GetJob("1")
+		return job.attemptFinished()
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.NoError(suite.T(), suite.jr.StopJob("1"))
+
+	select {
+	case err := <-errChan:
+		assert.NoError(suite.T(), err)
+	case <-time.After(5 * time.Second):
+		suite.FailNow("stopping should cancel the pending restart")
+	}
+
+	job, _ = suite.jr.GetJob("1")
+	assert.Equal(suite.T(), JobState(Stopped), job.State)
+	assert.Len(suite.T(), job.Attempts, 1)
+}
+
+func (suite *RestartTestSuite) TestStopRunningAttempt() {
+	policy := RestartPolicy{Mode: RestartAlways, InitialBackoff: time.Millisecond}
+	job := suite.jr.CreateJob("1", "123", mockExecCommand("sleep"), WithRestartPolicy(policy))
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- suite.jr.StartJob(job)
+	}()
+
+	suite.Require().Eventually(func() bool {
+		job, _ := suite.jr.GetJob("1")
+		return job.State == Running
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.NoError(suite.T(), suite.jr.StopJob("1"))
+	assert.NoError(suite.T(), <-errChan)
+
+	job, _ = suite.jr.GetJob("1")
+	assert.Equal(suite.T(), JobState(Stopped), job.State, "a stopped job is never restarted")
+	assert.Len(suite.T(), job.Attempts, 1)
+}
+
+func TestRestartTestSuite(t *testing.T) {
+	suite.Run(t, new(RestartTestSuite))
+}
+
+func TestShouldRestart(t *testing.T) {
+	never := RestartPolicy{}
+	assert.False(t, never.shouldRestart(false, 1))
+
+	onFailure := RestartPolicy{Mode: RestartOnFailure, MaxAttempts: 2}
+	assert.True(t, onFailure.shouldRestart(false, 1))
+	assert.False(t, onFailure.shouldRestart(true, 1))
+	assert.False(t, onFailure.shouldRestart(false, 2), "the attempts are used up")
+
+	always := RestartPolicy{Mode: RestartAlways}
+	assert.True(t, always.shouldRestart(true, 1000), "zero attempts means no limit")
+}
+
+func TestRestartBackoff(t *testing.T) {
+	policy := RestartPolicy{InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second}
+	for _, tc := range []struct {
+		attempt int
+		max     time.Duration
+	}{
+		{1, 100 * time.Millisecond},
+		{2, 200 * time.Millisecond},
+		{4, 800 * time.Millisecond},
+		{5, time.Second},
+		{50, time.Second},
+	} {
+		for i := 0; i < 20; i++ {
+			d := policy.backoff(tc.attempt)
+			assert.GreaterOrEqual(t, d, tc.max/2, "attempt %d", tc.attempt)
+			assert.LessOrEqual(t, d, tc.max, "attempt %d", tc.attempt)
+		}
+	}
+
+	d := RestartPolicy{}.backoff(1)
+	assert.GreaterOrEqual(t, d, DefaultRestartBackoff/2)
+	assert.LessOrEqual(t, d, DefaultRestartBackoff)
+}
+
+func TestRestartPolicyValidate(t *testing.T) {
+	assert.NoError(t, RestartPolicy{Mode: RestartAlways, MaxAttempts: 5}.Validate())
+	assert.Error(t, RestartPolicy{Mode: RestartMode(7)}.Validate())
+	assert.Error(t, RestartPolicy{MaxAttempts: -1}.Validate())
+	assert.Error(t, RestartPolicy{InitialBackoff: -time.Second}.Validate())
+}
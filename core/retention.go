@@ -0,0 +1,51 @@
+package core
+
+import (
+	"context"
+	"log"
+	"os"
+	"time"
+)
+
+// RemoveExpiredJobs deletes jobs that finished longer ago than the retention
+// TTL, along with their log files if the policy asks for it. It returns the
+// IDs of the removed jobs.
+func (jr *JobRunner) RemoveExpiredJobs() []string {
+	policy := jr.Settings().Retention
+	if policy.TTL <= 0 {
+		return nil
+	}
+
+	var ids []string
+	for _, job := range jr.store.RemoveRecordsFinishedBefore(time.Now().Add(-policy.TTL)) {
+		ids = append(ids, job.Id)
+		if policy.RemoveLogs {
+			jr.removeLogs(job)
+		}
+	}
+	return ids
+}
+
+// removeLogs deletes the log files of every attempt of a job.
+func (jr *JobRunner) removeLogs(job JobInfo) {
+	for n := 1; n <= len(job.Attempts) || n == 1; n++ {
+		if err := os.Remove(logPath(jr.logDir, attemptLogId(job.Id, n))); err != nil && !os.IsNotExist(err) {
+			log.Printf("job %s: could not remove log file: %s", job.Id, err.Error())
+		}
+	}
+}
+
+// RunRetention removes expired jobs every interval until ctx is cancelled.
+func (jr *JobRunner) RunRetention(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			jr.RemoveExpiredJobs()
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package core
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type RetentionTestSuite struct {
+	suite.Suite
+	jr     *JobRunner
+	logDir string
+}
+
+func (suite *RetentionTestSuite) SetupTest() {
+	dir, err := ioutil.TempDir("", "logs")
+	suite.Require().NoError(err)
+	suite.logDir = dir
+	suite.jr = InitializeJobRunner(InitializeInMemoryJobStore(), WithLogDir(dir))
+}
+
+func (suite *RetentionTestSuite) TearDownTest() {
+	os.RemoveAll(suite.logDir)
+}
+
+func (suite *RetentionTestSuite) TestRemoveExpiredJobs() {
+	suite.jr.UpdateSettings(RunnerSettings{Retention: RetentionPolicy{TTL: time.Millisecond, RemoveLogs: true}})
+
+	finished := suite.jr.CreateJob("finished", "1", mockExecCommand("echo"))
+	assert.NoError(suite.T(), suite.jr.StartJob(finished))
+	assert.FileExists(suite.T(), logPath(suite.logDir, "finished"))
+	suite.jr.CreateJob("pending", "1", mockExecCommand("echo"))
+
+	time.Sleep(5 * time.Millisecond)
+	assert.Equal(suite.T(), []string{"finished"}, suite.jr.RemoveExpiredJobs())
+
+	_, err := suite.jr.GetJob("finished")
+	assert.Error(suite.T(), err, "expired job should be removed")
+	assert.NoFileExists(suite.T(), logPath(suite.logDir, "finished"), "expired job's log should be removed")
+	_, err = suite.jr.GetJob("pending")
+	assert.NoError(suite.T(), err, "unfinished job should be kept")
+}
+
+func (suite *RetentionTestSuite) TestRetentionDisabled() {
+	job := suite.jr.CreateJob("1", "1", mockExecCommand("echo"))
+	assert.NoError(suite.T(), suite.jr.StartJob(job))
+	assert.Empty(suite.T(), suite.jr.RemoveExpiredJobs(), "a zero ttl keeps jobs forever")
+}
+
+func (suite *RetentionTestSuite) TestDeleteJob() {
+	finished := suite.jr.CreateJob("finished", "1", mockExecCommand("echo"))
+	suite.Require().NoError(suite.jr.StartJob(finished))
+	assert.FileExists(suite.T(), logPath(suite.logDir, "finished"))
+	suite.jr.CreateJob("pending", "1", mockExecCommand("echo"))
+
+	assert.IsType(suite.T(), &ErrNotFinished{}, suite.jr.DeleteJob("pending"))
+	assert.NoError(suite.T(), suite.jr.DeleteJob("finished"))
+	assert.NoFileExists(suite.T(), logPath(suite.logDir, "finished"), "deleting a job removes its logs")
+	_, err := suite.jr.GetJob("finished")
+	assert.IsType(suite.T(), &ErrNotFound{}, err)
+	assert.IsType(suite.T(), &ErrNotFound{}, suite.jr.DeleteJob("finished"))
+}
+
+func TestRetentionTestSuite(t *testing.T) {
+	suite.Run(t, new(RetentionTestSuite))
+}
@@ -0,0 +1,206 @@
+package core
+
+import (
+	"sort"
+	"sync"
+)
+
+// QueuePolicy decides the order queued jobs are started in.
+type QueuePolicy string
+
+const (
+	// QueueFIFO starts jobs in the order they were submitted.
+	QueueFIFO QueuePolicy = "fifo"
+	// QueuePriority starts jobs with a higher priority first and jobs with the
+	// same priority in the order they were submitted.
+	QueuePriority QueuePolicy = "priority"
+)
+
+// QueueSettings limits how many submitted jobs run at once, globally and for
+// each owner. A zero limit means unlimited.
+type QueueSettings struct {
+	MaxConcurrent int
+	MaxPerOwner   int
+	Policy        QueuePolicy
+}
+
+// queuedJob is a submitted job waiting for a free slot.
+type queuedJob struct {
+	job JobInfo
+	seq uint64
+}
+
+// scheduler holds submitted jobs until the concurrency limits allow them to
+// start and counts the ones it started until they finish. The queue is kept
+// in dispatch order for policy.
+type scheduler struct {
+	mu      sync.Mutex
+	queue   []queuedJob
+	policy  QueuePolicy
+	seq     uint64
+	running int
+	owners  map[string]int
+}
+
+func newScheduler() *scheduler {
+	return &scheduler{owners: make(map[string]int)}
+}
+
+// SubmitJob queues a job to be started once the concurrency limits allow it.
+// The priority only matters with the priority queue policy. While the runner
+// is draining the job fails with ErrDraining instead.
+func (jr *JobRunner) SubmitJob(job JobInfo, priority int32) error {
+	if jr.Draining() {
+		jr.store.UpdateRecordFailure(job.Id, FailureError, &ErrDraining{})
+		return &ErrDraining{}
+	}
+
+	if err := jr.store.UpdateRecordQueued(job.Id, priority); err != nil {
+		return err
+	}
+
+	s := jr.scheduler
+	s.mu.Lock()
+	s.seq++
+	job.Priority = priority
+	s.insert(queuedJob{job: job, seq: s.seq}, jr.Settings().Queue.Policy)
+	s.mu.Unlock()
+
+	jr.dispatch()
+	return nil
+}
+
+// QueuePosition returns a queued job's place in line starting from 1, or 0
+// if the job isn't queued.
+func (jr *JobRunner) QueuePosition(id string) int {
+	s := jr.scheduler
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, q := range s.queue {
+		if q.job.Id == id {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// QueuePositions returns the place in line of every queued job, starting
+// from 1, so that listing many jobs doesn't look each one up.
+func (jr *JobRunner) QueuePositions() map[string]int {
+	s := jr.scheduler
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	positions := make(map[string]int, len(s.queue))
+	for i, q := range s.queue {
+		positions[q.job.Id] = i + 1
+	}
+	return positions
+}
+
+// dispatch starts every queued job that fits within the limits. Jobs whose
+// owner is at their limit are skipped so they don't hold up everyone else,
+// and nothing starts while the runner is draining.
+func (jr *JobRunner) dispatch() {
+	if jr.Draining() {
+		return
+	}
+
+	settings := jr.Settings().Queue
+	s := jr.scheduler
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	remaining := s.queue[:0]
+	for _, q := range s.queue {
+		globalFull := settings.MaxConcurrent > 0 && s.running >= settings.MaxConcurrent
+		ownerFull := settings.MaxPerOwner > 0 && s.owners[q.job.Owner] >= settings.MaxPerOwner
+		if globalFull || ownerFull {
+			remaining = append(remaining, q)
+			continue
+		}
+
+		s.reserveLocked(q.job.Owner)
+		// the job leaves the queue now, so it can't be cancelled as a
+		// queued job any more and is stopped like any other
+		jr.store.UpdateRecordState(q.job.Id, JobState(Created))
+		go jr.runSubmitted(q.job)
+	}
+	s.queue = remaining
+}
+
+// runSubmitted runs a dispatched job and frees its slot once it finishes.
+func (jr *JobRunner) runSubmitted(job JobInfo) {
+	jr.StartJob(job)
+	jr.release(job.Owner)
+}
+
+// release frees the slot of a job that has finished and starts whichever
+// queued jobs now fit.
+func (jr *JobRunner) release(owner string) {
+	s := jr.scheduler
+	s.mu.Lock()
+	s.running--
+	if s.owners[owner]--; s.owners[owner] == 0 {
+		delete(s.owners, owner)
+	}
+	s.mu.Unlock()
+
+	jr.dispatch()
+}
+
+// reserve takes up a slot for a job that didn't go through the queue, like
+// a recovered one.
+func (s *scheduler) reserve(owner string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.reserveLocked(owner)
+}
+
+// reserveLocked is reserve for callers that hold s.mu.
+func (s *scheduler) reserveLocked(owner string) {
+	s.running++
+	s.owners[owner]++
+}
+
+// remove takes a job out of the queue and reports whether it was queued.
+func (s *scheduler) remove(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, q := range s.queue {
+		if q.job.Id == id {
+			s.queue = append(s.queue[:i], s.queue[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// insert adds a job to the queue in dispatch order for policy. Callers must
+// hold s.mu.
+func (s *scheduler) insert(q queuedJob, policy QueuePolicy) {
+	s.reorder(policy)
+	i := sort.Search(len(s.queue), func(i int) bool { return queuedBefore(s.policy, q, s.queue[i]) })
+	s.queue = append(s.queue, queuedJob{})
+	copy(s.queue[i+1:], s.queue[i:])
+	s.queue[i] = q
+}
+
+// reorder sorts the queue if the policy changed since it was last ordered,
+// as when the queue settings are reloaded. Callers must hold s.mu.
+func (s *scheduler) reorder(policy QueuePolicy) {
+	if policy == s.policy {
+		return
+	}
+	s.policy = policy
+	sort.SliceStable(s.queue, func(i, j int) bool { return queuedBefore(policy, s.queue[i], s.queue[j]) })
+}
+
+// queuedBefore reports whether a is dispatched before b under policy.
+func queuedBefore(policy QueuePolicy, a, b queuedJob) bool {
+	if policy == QueuePriority && a.job.Priority != b.job.Priority {
+		return a.job.Priority > b.job.Priority
+	}
+	return a.seq < b.seq
+}
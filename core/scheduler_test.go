@@ -0,0 +1,149 @@
+package core
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type SchedulerTestSuite struct {
+	suite.Suite
+	jr  *JobRunner
+	ids []string
+}
+
+func (suite *SchedulerTestSuite) newRunner(queue QueueSettings) {
+	suite.jr = InitializeJobRunner(InitializeInMemoryJobStore(), WithSettings(RunnerSettings{Queue: queue}))
+	suite.ids = nil
+}
+
+func (suite *SchedulerTestSuite) TearDownTest() {
+	// cancel the queue first so stopping running jobs doesn't start more
+	for _, id := range suite.ids {
+		if suite.state(id) == Queued {
+			suite.jr.StopJob(id)
+		}
+	}
+	for _, id := range suite.ids {
+		if !suite.state(id).IsTerminal() {
+			suite.waitForState(id, Running)
+			suite.jr.StopJob(id)
+		}
+	}
+}
+
+// submit queues a sleeping job.
+func (suite *SchedulerTestSuite) submit(id string, owner string, priority int32) {
+	job := suite.jr.CreateJob(id, owner, mockExecCommand("sleep"))
+	suite.ids = append(suite.ids, id)
+	suite.Require().NoError(suite.jr.SubmitJob(job, priority))
+}
+
+// waitForState waits until a job is in one of the given states.
+func (suite *SchedulerTestSuite) waitForState(id string, states ...JobState) {
+	suite.Require().Eventually(func() bool {
+		job, _ := suite.jr.GetJob(id)
+		for _, state := range states {
+			if job.State == state {
+				return true
+			}
+		}
+		return false
+	}, 5*time.Second, 10*time.Millisecond, "job %s never reached %v", id, states)
+}
+
+func (suite *SchedulerTestSuite) state(id string) JobState {
+	job, _ := suite.jr.GetJob(id)
+	return job.State
+}
+
+func (suite *SchedulerTestSuite) TestGlobalLimit() {
+	suite.newRunner(QueueSettings{MaxConcurrent: 1, Policy: QueueFIFO})
+	suite.submit("1", "alice", 0)
+	suite.submit("2", "bob", 0)
+	suite.submit("3", "carol", 0)
+
+	suite.waitForState("1", Running)
+	assert.Equal(suite.T(), JobState(Queued), suite.state("2"))
+	assert.Equal(suite.T(), 1, suite.jr.QueuePosition("2"))
+	assert.Equal(suite.T(), 2, suite.jr.QueuePosition("3"))
+	assert.Equal(suite.T(), 0, suite.jr.QueuePosition("1"), "a running job isn't queued")
+
+	suite.Require().NoError(suite.jr.StopJob("1"))
+	suite.waitForState("2", Running)
+	assert.Equal(suite.T(), 1, suite.jr.QueuePosition("3"))
+}
+
+func (suite *SchedulerTestSuite) TestPerOwnerLimit() {
+	suite.newRunner(QueueSettings{MaxPerOwner: 1, Policy: QueueFIFO})
+	suite.submit("1", "alice", 0)
+	suite.submit("2", "alice", 0)
+	suite.submit("3", "bob", 0)
+
+	suite.waitForState("1", Running)
+	suite.waitForState("3", Running)
+	assert.Equal(suite.T(), JobState(Queued), suite.state("2"), "alice is at her limit")
+}
+
+func (suite *SchedulerTestSuite) TestPriority() {
+	suite.newRunner(QueueSettings{MaxConcurrent: 1, Policy: QueuePriority})
+	suite.submit("1", "alice", 0)
+	suite.waitForState("1", Running)
+	suite.submit("low", "alice", 1)
+	suite.submit("high", "alice", 5)
+	suite.submit("also-high", "alice", 5)
+
+	assert.Equal(suite.T(), 1, suite.jr.QueuePosition("high"))
+	assert.Equal(suite.T(), 2, suite.jr.QueuePosition("also-high"), "equal priorities keep their order")
+	assert.Equal(suite.T(), 3, suite.jr.QueuePosition("low"))
+	assert.Equal(suite.T(), map[string]int{"high": 1, "also-high": 2, "low": 3}, suite.jr.QueuePositions())
+
+	suite.jr.UpdateSettings(RunnerSettings{Queue: QueueSettings{MaxConcurrent: 1, Policy: QueueFIFO}})
+	assert.Equal(suite.T(), 1, suite.jr.QueuePosition("low"), "switching policy should reorder the queue")
+	assert.Equal(suite.T(), map[string]int{"low": 1, "high": 2, "also-high": 3}, suite.jr.QueuePositions())
+}
+
+func (suite *SchedulerTestSuite) TestCancelQueued() {
+	suite.newRunner(QueueSettings{MaxConcurrent: 1, Policy: QueueFIFO})
+	suite.submit("1", "alice", 0)
+	suite.submit("2", "alice", 0)
+	suite.waitForState("1", Running)
+
+	suite.Require().NoError(suite.jr.StopJob("2"))
+	assert.Equal(suite.T(), JobState(Stopped), suite.state("2"))
+	assert.Equal(suite.T(), 0, suite.jr.QueuePosition("2"))
+
+	suite.Require().NoError(suite.jr.StopJob("1"))
+	time.Sleep(100 * time.Millisecond)
+	job, _ := suite.jr.GetJob("2")
+	assert.Equal(suite.T(), JobState(Stopped), job.State, "a cancelled job should never start")
+	assert.Nil(suite.T(), job.Cmd.Process)
+}
+
+func (suite *SchedulerTestSuite) TestRaisingLimitStartsQueuedJobs() {
+	suite.newRunner(QueueSettings{MaxConcurrent: 1, Policy: QueueFIFO})
+	suite.submit("1", "alice", 0)
+	suite.submit("2", "alice", 0)
+	suite.waitForState("1", Running)
+	assert.Equal(suite.T(), JobState(Queued), suite.state("2"))
+
+	suite.jr.UpdateSettings(RunnerSettings{Queue: QueueSettings{MaxConcurrent: 2, Policy: QueueFIFO}})
+	suite.waitForState("2", Running)
+}
+
+func (suite *SchedulerTestSuite) TestFinishedJobsFreeTheirSlot() {
+	suite.newRunner(QueueSettings{MaxConcurrent: 1, Policy: QueueFIFO})
+	for _, id := range []string{"1", "2", "3"} {
+		job := suite.jr.CreateJob(id, "alice", mockExecCommand("echo", "hello", "world"))
+		suite.Require().NoError(suite.jr.SubmitJob(job, 0))
+	}
+	for _, id := range []string{"1", "2", "3"} {
+		suite.waitForState(id, Completed)
+	}
+}
+
+func TestSchedulerTestSuite(t *testing.T) {
+	suite.Run(t, new(SchedulerTestSuite))
+}
@@ -0,0 +1,340 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// ShimCommand is the argument the server's own binary is run with to act as
+// the shim of a job, see RunShim.
+const ShimCommand = "shim"
+
+// shimPollInterval is how often a reattached shim is checked for having
+// exited, since it isn't a child of the server that reattached to it.
+const shimPollInterval = 100 * time.Millisecond
+
+// shimStarted is what a shim records once the job's command has started.
+type shimStarted struct {
+	ShimPid int `json:"shim_pid"`
+	Pid     int `json:"pid"`
+	// BootId tells a shim that is still running from an unrelated process
+	// that was given the same pid after a reboot.
+	BootId string `json:"boot_id"`
+}
+
+// shimExited is what a shim records once the job's command has exited, or
+// failed to start.
+type shimExited struct {
+	ExitCode int    `json:"exit_code"`
+	Signal   int    `json:"signal,omitempty"`
+	MaxRSS   int64  `json:"max_rss,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// shimReport is what a shim tells the server that started it once the job's
+// command has started, or failed to.
+type shimReport struct {
+	Pid   int    `json:"pid,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// shimExitError is how a command run by a shim exited when it didn't exit
+// cleanly, like an exec.ExitError.
+type shimExitError struct {
+	code   int
+	signal syscall.Signal
+}
+
+func (e *shimExitError) Error() string {
+	if e.signal != 0 {
+		return "signal: " + e.signal.String()
+	}
+	return fmt.Sprintf("exit status %d", e.code)
+}
+
+// RunShim is the main function of a job's shim. The shim runs one attempt of
+// the job's command in its own session, writes the command's output to the
+// attempt's log and records the command's pid and exit status in the job's
+// state dir, so that the job carries on and its output is kept when the
+// server goes away. It returns the shim's exit code.
+func RunShim(args []string) int {
+	flags := flag.NewFlagSet(ShimCommand, flag.ContinueOnError)
+	dir := flags.String("state", "", "the job's state dir")
+	attempt := flags.Int("attempt", 1, "the attempt to run")
+	logFile := flags.String("log", "", "file the command's output is appended to")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *dir == "" || *logFile == "" || flags.NArg() < 2 {
+		fmt.Fprintln(os.Stderr, "usage: shim -state DIR -attempt N -log FILE -- PATH ARG0 [ARG...]")
+		return 2
+	}
+
+	// the server passes a pipe to hear whether the command started, it may
+	// be gone by the time anything is written so write errors are ignored
+	report := os.NewFile(3, "report")
+	exited := shimExited{ExitCode: -1}
+	fail := func(err error) int {
+		exited.Error = err.Error()
+		writeJSONAtomic(shimExitedPath(*dir, *attempt), exited)
+		json.NewEncoder(report).Encode(shimReport{Error: exited.Error})
+		report.Close()
+		return 1
+	}
+
+	out, err := os.OpenFile(*logFile, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0666)
+	if err != nil {
+		return fail(err)
+	}
+	defer out.Close()
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		return fail(err)
+	}
+
+	cmd := exec.Command(flags.Arg(0))
+	cmd.Args = flags.Args()[1:]
+	cmd.Stdout = w
+	cmd.Stderr = w
+	err = cmd.Start()
+	w.Close()
+	if err != nil {
+		return fail(err)
+	}
+
+	started := shimStarted{ShimPid: os.Getpid(), Pid: cmd.Process.Pid, BootId: bootId()}
+	if err := writeJSONAtomic(shimStartedPath(*dir, *attempt), started); err != nil {
+		cmd.Process.Kill()
+		cmd.Wait()
+		return fail(err)
+	}
+	json.NewEncoder(report).Encode(shimReport{Pid: cmd.Process.Pid})
+	report.Close()
+
+	_, copyErr := io.Copy(out, r)
+	err = cmd.Wait()
+	if cmd.ProcessState != nil {
+		exited.ExitCode = cmd.ProcessState.ExitCode()
+		if status, ok := cmd.ProcessState.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+			exited.Signal = int(status.Signal())
+		}
+		if rusage, ok := cmd.ProcessState.SysUsage().(*syscall.Rusage); ok {
+			// ru_maxrss is in kilobytes on Linux
+			exited.MaxRSS = rusage.Maxrss * 1024
+		}
+	}
+	if copyErr != nil {
+		exited.Error = copyErr.Error()
+	} else if err != nil && !isExitError(err) {
+		exited.Error = err.Error()
+	}
+
+	if err := writeJSONAtomic(shimExitedPath(*dir, *attempt), exited); err != nil {
+		return 1
+	}
+	return 0
+}
+
+// runJobInShim runs the job's command under a shim. It returns once the
+// command has exited, with an error describing how if it didn't exit cleanly.
+func (jr *JobRunner) runJobInShim(id string, owner string, cmd *exec.Cmd) error {
+	record, err := jr.store.GetRecord(id)
+	if err != nil {
+		return err
+	}
+
+	attempt := len(record.Attempts) + 1
+	lb, err := NewLogBufferInDir(jr.logDir, attemptLogId(id, attempt))
+	if err != nil {
+		return err
+	}
+
+	defer lb.Close()
+
+	if err = jr.store.StartRecordAttempt(id, cmd, lb); err != nil {
+		return err
+	}
+
+	// a restarted server has to find the job as soon as its shim may exist
+	if err = jr.saveJobState(id); err != nil {
+		return err
+	}
+
+	dir := jr.jobStateDir(id)
+	report, w, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer report.Close()
+
+	args := append(jr.shim[1:len(jr.shim):len(jr.shim)],
+		"-state", dir, "-attempt", strconv.Itoa(attempt), "-log", logPath(jr.logDir, attemptLogId(id, attempt)),
+		"--", cmd.Path)
+	shim := exec.Command(jr.shim[0], append(args, cmd.Args...)...)
+	// the command inherits the shim's environment and working dir
+	shim.Env = cmd.Env
+	shim.Dir = cmd.Dir
+	shim.ExtraFiles = []*os.File{w}
+	// a session of its own keeps the shim out of the way of signals sent to
+	// the server's process group
+	shim.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	err = shim.Start()
+	w.Close()
+	if err != nil {
+		return err
+	}
+
+	var started shimReport
+	if err := json.NewDecoder(report).Decode(&started); err != nil {
+		shim.Wait()
+		return fmt.Errorf("the job's shim exited before starting it: %w", err)
+	}
+	if started.Error != "" {
+		shim.Wait()
+		return fmt.Errorf("%s", started.Error)
+	}
+
+	if cmd.Process, err = os.FindProcess(started.Pid); err != nil {
+		return err
+	}
+	// the job was stopped while its shim started it
+	if err := jr.store.UpdateRecordState(id, JobState(Running)); err != nil {
+		cmd.Process.Kill()
+	}
+	jr.metrics.JobStarted(owner)
+
+	path := jr.applyLimits(id, started.Pid)
+	if path != "" {
+		jr.saveJobState(id)
+	}
+
+	shim.Wait()
+	return jr.shimResult(id, attempt, path)
+}
+
+// shimResult reads how an attempt run by a shim exited once the shim has
+// gone, and releases the attempt's cgroup.
+func (jr *JobRunner) shimResult(id string, attempt int, cgroupPath string) error {
+	if info, err := os.Stat(logPath(jr.logDir, attemptLogId(id, attempt))); err == nil {
+		jr.metrics.LogBytesWritten(int(info.Size()))
+	}
+
+	var exited shimExited
+	err := readJSON(shimExitedPath(jr.jobStateDir(id), attempt), &exited)
+	if cgroupPath != "" {
+		jr.releaseCgroup(id, cgroupPath)
+	} else if exited.MaxRSS > 0 {
+		job, _ := jr.store.GetRecord(id)
+		jr.store.UpdateRecordMemory(id, job.MemoryLimit, exited.MaxRSS, job.OOMKills)
+	}
+
+	switch {
+	case err != nil:
+		return fmt.Errorf("the job's shim exited without recording how the job exited: %w", err)
+	case exited.Error != "":
+		return fmt.Errorf("%s", exited.Error)
+	case exited.Signal != 0:
+		return &shimExitError{code: -1, signal: syscall.Signal(exited.Signal)}
+	case exited.ExitCode != 0:
+		return &shimExitError{code: exited.ExitCode}
+	default:
+		return nil
+	}
+}
+
+// waitShim blocks until a shim the server didn't start has exited.
+func waitShim(dir string, attempt int, started shimStarted) {
+	for shimAlive(dir, started) {
+		if _, err := os.Stat(shimExitedPath(dir, attempt)); err == nil {
+			return
+		}
+		time.Sleep(shimPollInterval)
+	}
+}
+
+// shimAlive reports whether the shim of the job whose state is in dir is
+// still running. The pid alone could have been reused, so the process has to
+// have been started since the last boot and be running with dir.
+func shimAlive(dir string, started shimStarted) bool {
+	if started.ShimPid <= 0 || started.BootId != bootId() {
+		return false
+	}
+	cmdline, err := ioutil.ReadFile(filepath.Join(procRoot, strconv.Itoa(started.ShimPid), "cmdline"))
+	if err != nil {
+		return false
+	}
+	return bytes.Contains(cmdline, []byte(dir+"\x00"))
+}
+
+// shimExitCode returns the exit code of a command that a shim ran.
+func shimExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	if exitErr, ok := err.(*shimExitError); ok {
+		return exitErr.code
+	}
+	return -1
+}
+
+// bootId returns an ID that changes every time the system boots, or an empty
+// string if it isn't available.
+func bootId() string {
+	b, err := ioutil.ReadFile(filepath.Join(procRoot, "sys/kernel/random/boot_id"))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(b))
+}
+
+func shimStartedPath(dir string, attempt int) string {
+	return filepath.Join(dir, fmt.Sprintf("%d.started.json", attempt))
+}
+
+func shimExitedPath(dir string, attempt int) string {
+	return filepath.Join(dir, fmt.Sprintf("%d.exited.json", attempt))
+}
+
+// writeJSONAtomic replaces path with v as JSON so that readers never see a
+// partially written file.
+func writeJSONAtomic(path string, v interface{}) error {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func readJSON(path string, v interface{}) error {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
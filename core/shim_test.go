@@ -0,0 +1,234 @@
+package core
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+// TestMain lets the test binary act as a job's shim, the way the server's
+// binary does.
+func TestMain(m *testing.M) {
+	if len(os.Args) > 1 && os.Args[1] == ShimCommand {
+		os.Exit(RunShim(os.Args[2:]))
+	}
+	os.Exit(m.Run())
+}
+
+type ShimTestSuite struct {
+	suite.Suite
+	jr       *JobRunner
+	logDir   string
+	stateDir string
+}
+
+func (suite *ShimTestSuite) SetupTest() {
+	dir, err := ioutil.TempDir("", "shim")
+	suite.Require().NoError(err)
+	suite.logDir = filepath.Join(dir, "logs")
+	suite.stateDir = filepath.Join(dir, "state")
+	suite.Require().NoError(os.Mkdir(suite.logDir, 0700))
+	suite.jr = InitializeJobRunner(InitializeInMemoryJobStore(), WithLogDir(suite.logDir), WithStateDir(suite.stateDir))
+}
+
+func (suite *ShimTestSuite) TearDownTest() {
+	suite.jr.Shutdown(context.Background())
+	os.RemoveAll(filepath.Dir(suite.logDir))
+}
+
+func (suite *ShimTestSuite) submit(id string, name string, args ...string) {
+	job := suite.jr.CreateJob(id, "123", exec.Command(name, args...))
+	suite.Require().NoError(suite.jr.SubmitJob(job, 0))
+}
+
+func (suite *ShimTestSuite) wait(id string) JobInfo {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	job, err := suite.jr.WaitJob(ctx, id)
+	suite.Require().NoError(err)
+	return job
+}
+
+func (suite *ShimTestSuite) output(id string) string {
+	b, err := ioutil.ReadFile(logPath(suite.logDir, id))
+	suite.Require().NoError(err)
+	return string(b)
+}
+
+func (suite *ShimTestSuite) assertStateRemoved(id string) {
+	assert.Eventually(suite.T(), func() bool {
+		_, err := os.Stat(filepath.Join(suite.stateDir, id))
+		return os.IsNotExist(err)
+	}, time.Second, 5*time.Millisecond, "a finished job's state should be removed")
+}
+
+// crashServer runs a server in another process that starts a job and exits
+// as soon as the job is running, leaving the job to its shim.
+func (suite *ShimTestSuite) crashServer(args ...string) {
+	cmd := exec.Command(os.Args[0], append([]string{"-test.run=TestShimServerProcess", "--"}, args...)...)
+	cmd.Env = append(os.Environ(), "SHIM_TEST_LOG_DIR="+suite.logDir, "SHIM_TEST_STATE_DIR="+suite.stateDir)
+	out, err := cmd.CombinedOutput()
+	suite.Require().NoError(err, string(out))
+}
+
+func (suite *ShimTestSuite) TestJobRunsInShim() {
+	suite.submit("1", "sh", "-c", "echo out; echo err >&2; exit 3")
+
+	job := suite.wait("1")
+	assert.Equal(suite.T(), JobState(Error), job.State)
+	assert.Equal(suite.T(), FailureExitCode, job.FailureReason)
+	assert.Equal(suite.T(), 3, job.Attempts[0].ExitCode)
+	assert.Equal(suite.T(), "out\nerr\n", suite.output("1"))
+	suite.assertStateRemoved("1")
+
+	suite.submit("2", "/does/not/exist")
+	job = suite.wait("2")
+	assert.Equal(suite.T(), JobState(Error), job.State)
+	assert.Equal(suite.T(), FailureError, job.FailureReason, "a command that can't start should fail like it does without a shim")
+}
+
+func (suite *ShimTestSuite) TestStopJobInShim() {
+	suite.submit("1", "sleep", "10")
+	suite.Require().Eventually(func() bool {
+		job, _ := suite.jr.GetJob("1")
+		return job.State == Running
+	}, 5*time.Second, 5*time.Millisecond)
+
+	_, err := suite.jr.GetJobStats("1")
+	assert.NoError(suite.T(), err, "stats should be read from the job's process, not its shim's")
+
+	suite.Require().NoError(suite.jr.StopJob("1"))
+	job := suite.wait("1")
+	assert.Equal(suite.T(), JobState(Stopped), job.State)
+	assert.Equal(suite.T(), -1, job.Attempts[0].ExitCode)
+	suite.assertStateRemoved("1")
+}
+
+func (suite *ShimTestSuite) TestStopJobInShimDuringBackoff() {
+	policy := RestartPolicy{Mode: RestartAlways, InitialBackoff: time.Minute}
+	job := suite.jr.CreateJob("1", "123", exec.Command("true"), WithRestartPolicy(policy))
+	suite.Require().NoError(suite.jr.SubmitJob(job, 0))
+	suite.Require().Eventually(func() bool {
+		job, _ := suite.jr.GetJob("1")
+		return job.attemptFinished()
+	}, 5*time.Second, 5*time.Millisecond)
+
+	suite.Require().NoError(suite.jr.StopJob("1"), "the exited attempt's pid shouldn't be signalled")
+	job = suite.wait("1")
+	assert.Equal(suite.T(), JobState(Stopped), job.State)
+	assert.Len(suite.T(), job.Attempts, 1)
+	assert.Equal(suite.T(), 0, job.Attempts[0].ExitCode, "the finished attempt should be kept as it was")
+}
+
+func (suite *ShimTestSuite) TestRecoverRunningJob() {
+	suite.crashServer("sh", "-c", "echo before; sleep 0.5; echo after; exit 4")
+
+	recovered, err := suite.jr.Recover()
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), 1, recovered)
+
+	job, err := suite.jr.GetJobByName("alice", "job")
+	suite.Require().NoError(err, "the job should keep its owner and name")
+	assert.Equal(suite.T(), JobState(Running), job.State)
+	assert.Equal(suite.T(), map[string]string{"app": "test"}, job.Labels)
+
+	job = suite.wait("1")
+	assert.Equal(suite.T(), JobState(Error), job.State)
+	assert.Equal(suite.T(), 4, job.Attempts[0].ExitCode)
+	assert.Equal(suite.T(), "before\nafter\n", suite.output("1"), "output written while no server ran should be kept")
+	suite.assertStateRemoved("1")
+}
+
+func (suite *ShimTestSuite) TestRecoverAndStop() {
+	suite.crashServer("sleep", "10")
+
+	_, err := suite.jr.Recover()
+	suite.Require().NoError(err)
+	job, _ := suite.jr.GetJob("1")
+	pid := job.Cmd.Process.Pid
+
+	suite.Require().NoError(suite.jr.StopJob("1"))
+	job = suite.wait("1")
+	assert.Equal(suite.T(), JobState(Stopped), job.State)
+	assert.Error(suite.T(), syscall.Kill(pid, 0), "the job's process should be gone")
+}
+
+func (suite *ShimTestSuite) TestRecoverJobFinishedWhileDown() {
+	suite.crashServer("sh", "-c", "sleep 0.2; exit 2")
+	time.Sleep(500 * time.Millisecond)
+
+	_, err := suite.jr.Recover()
+	suite.Require().NoError(err)
+
+	job := suite.wait("1")
+	assert.Equal(suite.T(), JobState(Error), job.State)
+	assert.Equal(suite.T(), FailureExitCode, job.FailureReason)
+	assert.Equal(suite.T(), 2, job.Attempts[0].ExitCode)
+	suite.assertStateRemoved("1")
+}
+
+func (suite *ShimTestSuite) TestStopRecoveredJobDuringBackoff() {
+	suite.T().Setenv("SHIM_TEST_RESTART", "1")
+	suite.crashServer("sh", "-c", "sleep 0.2; exit 1")
+	time.Sleep(500 * time.Millisecond)
+
+	_, err := suite.jr.Recover()
+	suite.Require().NoError(err)
+	suite.Require().Eventually(func() bool {
+		job, _ := suite.jr.GetJob("1")
+		return job.attemptFinished()
+	}, 5*time.Second, 5*time.Millisecond)
+
+	suite.Require().NoError(suite.jr.StopJob("1"), "a job whose shim had exited should still stop")
+	job := suite.wait("1")
+	assert.Equal(suite.T(), JobState(Stopped), job.State)
+	assert.Len(suite.T(), job.Attempts, 1)
+	suite.assertStateRemoved("1")
+}
+
+func TestShimTestSuite(t *testing.T) {
+	suite.Run(t, new(ShimTestSuite))
+}
+
+// TestShimServerProcess stands in for a server that crashes once its job is
+// running. It only runs when started by crashServer.
+func TestShimServerProcess(t *testing.T) {
+	stateDir := os.Getenv("SHIM_TEST_STATE_DIR")
+	if stateDir == "" {
+		return
+	}
+
+	args := os.Args
+	for i, arg := range args {
+		if arg == "--" {
+			args = args[i+1:]
+			break
+		}
+	}
+
+	jr := InitializeJobRunner(InitializeInMemoryJobStore(), WithLogDir(os.Getenv("SHIM_TEST_LOG_DIR")), WithStateDir(stateDir))
+	opts := []JobOption{WithLabels(map[string]string{"app": "test"}, nil)}
+	if os.Getenv("SHIM_TEST_RESTART") != "" {
+		opts = append(opts, WithRestartPolicy(RestartPolicy{Mode: RestartAlways, InitialBackoff: time.Minute}))
+	}
+	job, err := jr.CreateNamedJob("1", "alice", "job", exec.Command(args[0], args[1:]...), opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := jr.SubmitJob(job, 0); err != nil {
+		t.Fatal(err)
+	}
+	for job.State != Running {
+		time.Sleep(5 * time.Millisecond)
+		job, _ = jr.GetJob("1")
+	}
+	os.Exit(0)
+}
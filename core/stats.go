@@ -0,0 +1,304 @@
+package core
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const procRoot = "/proc"
+
+// clockTicks is the kernel's USER_HZ, the unit of CPU times in /proc. It is
+// 100 on every architecture Linux supports today.
+const clockTicks = 100
+
+// StatsSource says where a job's statistics were read from.
+type StatsSource string
+
+const (
+	// StatsFromCgroup means the totals come from the job's cgroup and include
+	// processes that have already exited.
+	StatsFromCgroup StatsSource = "cgroup"
+	// StatsFromProc means the totals were summed over the job's live process
+	// tree in /proc.
+	StatsFromProc StatsSource = "proc"
+)
+
+// JobStats is a snapshot of the resources used by a job's process tree.
+type JobStats struct {
+	Time   time.Time
+	Source StatsSource
+
+	// CPUUsage is the total CPU time used so far.
+	CPUUsage time.Duration
+	// CPUPercent is the CPU used over the sampling window as a percentage of
+	// one core.
+	CPUPercent float64
+	// MemoryBytes is the cgroup's memory.current, or the RSS total without a
+	// cgroup.
+	MemoryBytes  int64
+	RSSBytes     int64
+	IOReadBytes  int64
+	IOWriteBytes int64
+	PIDs         int64
+	OpenFDs      int64
+}
+
+// CPUPercentSince returns the CPU used between prev and s as a percentage of
+// one core.
+func (s JobStats) CPUPercentSince(prev JobStats) float64 {
+	elapsed := s.Time.Sub(prev.Time)
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(s.CPUUsage-prev.CPUUsage) / float64(elapsed) * 100
+}
+
+// GetJobStats samples a running job's resource usage. CPUPercent is averaged
+// over the current attempt, whose process the CPU usage was read from.
+func (jr *JobRunner) GetJobStats(id string) (JobStats, error) {
+	job, err := jr.store.GetRecord(id)
+	if err != nil {
+		return JobStats{}, err
+	}
+
+	// between restarts the job is running but its last process has exited
+	if job.State != Running || job.Cmd.Process == nil || job.attemptFinished() {
+		return JobStats{}, &ErrNotRunning{}
+	}
+
+	stats, err := collectStats(job.Cmd.Process.Pid, job.CgroupPath)
+	if err != nil {
+		return JobStats{}, err
+	}
+
+	startedAt := job.CreatedAt
+	if len(job.Attempts) > 0 {
+		startedAt = job.Attempts[len(job.Attempts)-1].StartedAt
+	}
+	stats.CPUPercent = stats.CPUPercentSince(JobStats{Time: startedAt})
+	return stats, nil
+}
+
+// collectStats reads usage from the cgroup at cgroupPath if there is one,
+// otherwise from pid and its descendants. Open file descriptors are only
+// tracked per process and always come from /proc.
+func collectStats(pid int, cgroupPath string) (JobStats, error) {
+	stats := JobStats{Time: time.Now(), Source: StatsFromProc}
+
+	var pids []int
+	var err error
+	if cgroupPath != "" {
+		pids, err = cgroupPids(cgroupPath)
+	} else {
+		pids, err = processTree(procRoot, pid)
+	}
+	if err != nil {
+		return JobStats{}, err
+	}
+
+	for _, p := range pids {
+		proc, err := readProcStats(procRoot, p)
+		if err != nil {
+			// the process exited while we were reading it
+			continue
+		}
+		stats.CPUUsage += proc.cpu
+		stats.RSSBytes += proc.rss
+		stats.IOReadBytes += proc.readBytes
+		stats.IOWriteBytes += proc.writeBytes
+		stats.OpenFDs += proc.fds
+		stats.PIDs++
+	}
+	stats.MemoryBytes = stats.RSSBytes
+
+	if cgroupPath != "" {
+		if err := readCgroupStats(cgroupPath, &stats); err != nil {
+			return JobStats{}, err
+		}
+		stats.Source = StatsFromCgroup
+	}
+
+	return stats, nil
+}
+
+// procStats is the usage of a single process.
+type procStats struct {
+	ppid       int
+	cpu        time.Duration
+	rss        int64
+	readBytes  int64
+	writeBytes int64
+	fds        int64
+}
+
+// readProcStats reads a process's usage from /proc. IO counters and file
+// descriptors are left at zero if the server isn't allowed to read them.
+func readProcStats(root string, pid int) (procStats, error) {
+	dir := filepath.Join(root, strconv.Itoa(pid))
+
+	s, err := readStat(dir, pid)
+	if err != nil {
+		return procStats{}, err
+	}
+
+	if io, err := readKeyValues(filepath.Join(dir, "io"), ":"); err == nil {
+		s.readBytes = io["read_bytes"]
+		s.writeBytes = io["write_bytes"]
+	}
+
+	if fds, err := ioutil.ReadDir(filepath.Join(dir, "fd")); err == nil {
+		s.fds = int64(len(fds))
+	}
+
+	return s, nil
+}
+
+// readStat reads the parent, CPU time and RSS of the process whose /proc
+// directory is dir.
+func readStat(dir string, pid int) (procStats, error) {
+	b, err := ioutil.ReadFile(filepath.Join(dir, "stat"))
+	if err != nil {
+		return procStats{}, err
+	}
+	// the command name is in parentheses and may contain spaces, the fields
+	// we want come after it
+	end := strings.LastIndexByte(string(b), ')')
+	if end < 0 {
+		return procStats{}, fmt.Errorf("malformed stat for pid %d", pid)
+	}
+	fields := strings.Fields(string(b[end+1:]))
+	if len(fields) < 22 {
+		return procStats{}, fmt.Errorf("malformed stat for pid %d", pid)
+	}
+
+	var s procStats
+	s.ppid, _ = strconv.Atoi(fields[1])
+
+	// utime, stime, cutime and cstime, the latter two cover children that
+	// have exited and been waited for
+	var ticks int64
+	for _, f := range fields[11:15] {
+		n, _ := strconv.ParseInt(f, 10, 64)
+		ticks += n
+	}
+	s.cpu = time.Duration(ticks) * time.Second / clockTicks
+
+	rssPages, _ := strconv.ParseInt(fields[21], 10, 64)
+	s.rss = rssPages * int64(os.Getpagesize())
+
+	return s, nil
+}
+
+// processTree returns pid and every process descended from it. Only each
+// process's stat is read to find its parent, the rest of its usage is left
+// for the processes in the tree.
+func processTree(root string, pid int) ([]int, error) {
+	entries, err := ioutil.ReadDir(root)
+	if err != nil {
+		return nil, err
+	}
+
+	children := make(map[int][]int)
+	for _, entry := range entries {
+		p, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+		s, err := readStat(filepath.Join(root, entry.Name()), p)
+		if err != nil {
+			continue
+		}
+		children[s.ppid] = append(children[s.ppid], p)
+	}
+
+	tree := []int{pid}
+	for i := 0; i < len(tree); i++ {
+		tree = append(tree, children[tree[i]]...)
+	}
+	return tree, nil
+}
+
+// cgroupPids lists every process in a cgroup.
+func cgroupPids(path string) ([]int, error) {
+	b, err := ioutil.ReadFile(filepath.Join(path, "cgroup.procs"))
+	if err != nil {
+		return nil, err
+	}
+	var pids []int
+	for _, line := range strings.Fields(string(b)) {
+		if pid, err := strconv.Atoi(line); err == nil {
+			pids = append(pids, pid)
+		}
+	}
+	return pids, nil
+}
+
+// readCgroupStats replaces the totals summed from /proc with the cgroup's own
+// accounting, which includes processes that have already exited.
+func readCgroupStats(path string, stats *JobStats) error {
+	cpu, err := readKeyValues(filepath.Join(path, "cpu.stat"), " ")
+	if err != nil {
+		return err
+	}
+	stats.CPUUsage = time.Duration(cpu["usage_usec"]) * time.Microsecond
+
+	if b, err := ioutil.ReadFile(filepath.Join(path, "memory.current")); err == nil {
+		stats.MemoryBytes, _ = strconv.ParseInt(strings.TrimSpace(string(b)), 10, 64)
+	}
+
+	if b, err := ioutil.ReadFile(filepath.Join(path, "pids.current")); err == nil {
+		stats.PIDs, _ = strconv.ParseInt(strings.TrimSpace(string(b)), 10, 64)
+	}
+
+	// io.stat has a line per device: "8:0 rbytes=1 wbytes=2 rios=3 ..."
+	if b, err := ioutil.ReadFile(filepath.Join(path, "io.stat")); err == nil {
+		stats.IOReadBytes, stats.IOWriteBytes = 0, 0
+		for _, line := range strings.Split(string(b), "\n") {
+			for _, field := range strings.Fields(line) {
+				kv := strings.SplitN(field, "=", 2)
+				if len(kv) != 2 {
+					continue
+				}
+				n, _ := strconv.ParseInt(kv[1], 10, 64)
+				switch kv[0] {
+				case "rbytes":
+					stats.IOReadBytes += n
+				case "wbytes":
+					stats.IOWriteBytes += n
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// readKeyValues parses files made of "key<sep>value" lines with integer values.
+func readKeyValues(path string, sep string) (map[string]int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	values := make(map[string]int64)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		kv := strings.SplitN(scanner.Text(), sep, 2)
+		if len(kv) != 2 {
+			continue
+		}
+		n, err := strconv.ParseInt(strings.TrimSpace(kv[1]), 10, 64)
+		if err != nil {
+			continue
+		}
+		values[strings.TrimSpace(kv[0])] = n
+	}
+	return values, scanner.Err()
+}
@@ -0,0 +1,168 @@
+package core
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type StatsTestSuite struct {
+	suite.Suite
+}
+
+func (suite *StatsTestSuite) TestProcessTree() {
+	cmd := exec.Command("sh", "-c", "sleep 10 & sleep 10 & wait")
+	suite.Require().NoError(cmd.Start())
+	defer cmd.Process.Kill()
+
+	var stats JobStats
+	for i := 0; i < 100; i++ {
+		var err error
+		stats, err = collectStats(cmd.Process.Pid, "")
+		suite.Require().NoError(err)
+		if stats.PIDs == 3 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	assert.Equal(suite.T(), StatsFromProc, stats.Source)
+	assert.Equal(suite.T(), int64(3), stats.PIDs, "the shell and both sleeps should be counted")
+	assert.Greater(suite.T(), stats.RSSBytes, int64(0))
+	assert.Equal(suite.T(), stats.RSSBytes, stats.MemoryBytes, "memory should fall back to RSS without a cgroup")
+	assert.Greater(suite.T(), stats.OpenFDs, int64(0))
+}
+
+func (suite *StatsTestSuite) TestProcessTreeFromStat() {
+	root, err := ioutil.TempDir("", "proc")
+	suite.Require().NoError(err)
+	defer os.RemoveAll(root)
+
+	// pid -> ppid, only stat is written so nothing else can be read
+	for pid, ppid := range map[string]string{"1": "0", "2": "1", "3": "2", "4": "1", "5": "3"} {
+		dir := filepath.Join(root, pid)
+		suite.Require().NoError(os.Mkdir(dir, 0700))
+		stat := pid + " (sh -c x) S " + ppid + " 0 0 0 -1 0 0 0 0 0 0 0 0 0 20 0 1 0 0 0 0\n"
+		suite.Require().NoError(ioutil.WriteFile(filepath.Join(dir, "stat"), []byte(stat), 0600))
+	}
+	suite.Require().NoError(os.Mkdir(filepath.Join(root, "self"), 0700))
+
+	tree, err := processTree(root, 2)
+	suite.Require().NoError(err)
+	assert.ElementsMatch(suite.T(), []int{2, 3, 5}, tree)
+}
+
+func (suite *StatsTestSuite) TestCgroupStats() {
+	dir, err := ioutil.TempDir("", "cgroup")
+	suite.Require().NoError(err)
+	defer os.RemoveAll(dir)
+
+	for name, contents := range map[string]string{
+		"cgroup.procs":   "",
+		"cpu.stat":       "usage_usec 2500000\nuser_usec 2000000\nsystem_usec 500000\n",
+		"memory.current": "10485760\n",
+		"pids.current":   "4\n",
+		"io.stat":        "8:0 rbytes=1024 wbytes=2048 rios=1 wios=2 dbytes=0 dios=0\n8:16 rbytes=1 wbytes=2 rios=1 wios=1 dbytes=0 dios=0\n",
+	} {
+		suite.Require().NoError(ioutil.WriteFile(filepath.Join(dir, name), []byte(contents), 0644))
+	}
+
+	stats, err := collectStats(0, dir)
+	suite.Require().NoError(err)
+
+	assert.Equal(suite.T(), StatsFromCgroup, stats.Source)
+	assert.Equal(suite.T(), 2500*time.Millisecond, stats.CPUUsage)
+	assert.Equal(suite.T(), int64(10485760), stats.MemoryBytes)
+	assert.Equal(suite.T(), int64(4), stats.PIDs, "pids.current should include processes /proc can't see")
+	assert.Equal(suite.T(), int64(1025), stats.IOReadBytes, "io should be summed across devices")
+	assert.Equal(suite.T(), int64(2050), stats.IOWriteBytes)
+}
+
+func (suite *StatsTestSuite) TestMemoryUsage() {
+	dir, err := ioutil.TempDir("", "cgroup")
+	suite.Require().NoError(err)
+	defer os.RemoveAll(dir)
+
+	for name, contents := range map[string]string{
+		"memory.events": "low 0\nhigh 0\nmax 12\noom 1\noom_kill 1\noom_group_kill 0\n",
+		"memory.max":    "67108864\n",
+		"memory.peak":   "67100000\n",
+	} {
+		suite.Require().NoError(ioutil.WriteFile(filepath.Join(dir, name), []byte(contents), 0644))
+	}
+
+	usage, err := readMemoryUsage(dir)
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), memoryUsage{limit: 67108864, peak: 67100000, oomKills: 1}, usage)
+
+	suite.Require().NoError(ioutil.WriteFile(filepath.Join(dir, "memory.max"), []byte("max\n"), 0644))
+	suite.Require().NoError(os.Remove(filepath.Join(dir, "memory.peak")))
+	usage, err = readMemoryUsage(dir)
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), memoryUsage{oomKills: 1}, usage, "unlimited and unknown should be zero")
+}
+
+func (suite *StatsTestSuite) TestCPUPercentSince() {
+	now := time.Now()
+	prev := JobStats{Time: now, CPUUsage: time.Second}
+	next := JobStats{Time: now.Add(2 * time.Second), CPUUsage: 2 * time.Second}
+	assert.InDelta(suite.T(), 50.0, next.CPUPercentSince(prev), 0.001)
+	assert.Equal(suite.T(), 0.0, prev.CPUPercentSince(prev))
+}
+
+func (suite *StatsTestSuite) TestStatsOfFinishedJob() {
+	jr := InitializeJobRunner(InitializeInMemoryJobStore())
+	job := jr.CreateJob("1", "alice", mockExecCommand("echo", "hello", "world"))
+	suite.Require().NoError(jr.StartJob(job))
+
+	_, err := jr.GetJobStats("1")
+	assert.IsType(suite.T(), &ErrNotRunning{}, err)
+
+	_, err = jr.GetJobStats("missing")
+	assert.IsType(suite.T(), &ErrNotFound{}, err)
+}
+
+func (suite *StatsTestSuite) TestStatsOfRunningJob() {
+	jr := InitializeJobRunner(InitializeInMemoryJobStore())
+	job := jr.CreateJob("1", "alice", mockExecCommand("sleep"))
+	go jr.StartJob(job)
+	defer jr.StopJob("1")
+
+	for job, _ := jr.GetJob("1"); job.State == Created; job, _ = jr.GetJob("1") {
+	}
+
+	stats, err := jr.GetJobStats("1")
+	suite.Require().NoError(err)
+	assert.GreaterOrEqual(suite.T(), stats.PIDs, int64(1))
+	assert.GreaterOrEqual(suite.T(), stats.CPUPercent, 0.0)
+}
+
+func (suite *StatsTestSuite) TestCPUPercentOfCurrentAttempt() {
+	jr := InitializeJobRunner(InitializeInMemoryJobStore())
+	// a job that waited an hour to start shouldn't have its CPU averaged
+	// over the wait
+	queuedLongAgo := func(job *JobInfo) { job.CreatedAt = time.Now().Add(-time.Hour) }
+	job := jr.CreateJob("1", "alice", exec.Command("sh", "-c", "while :; do :; done"), queuedLongAgo)
+	go jr.StartJob(job)
+	defer jr.StopJob("1")
+
+	suite.Require().Eventually(func() bool {
+		job, _ := jr.GetJob("1")
+		return job.State == Running
+	}, 5*time.Second, 10*time.Millisecond)
+	time.Sleep(200 * time.Millisecond)
+
+	stats, err := jr.GetJobStats("1")
+	suite.Require().NoError(err)
+	assert.Greater(suite.T(), stats.CPUPercent, 10.0, "a busy loop should use most of a core since it started")
+}
+
+func TestStatsTestSuite(t *testing.T) {
+	suite.Run(t, new(StatsTestSuite))
+}
@@ -0,0 +1,85 @@
+package core
+
+import "context"
+
+// WatchBufferSize is how many events a watcher can fall behind by before it
+// is closed.
+const WatchBufferSize = 256
+
+// JobEventType is what happened to a job.
+type JobEventType int32
+
+const (
+	JobAdded JobEventType = iota
+	JobModified
+	JobDeleted
+)
+
+// JobEvent is a change to a watched job, with the job as it was afterwards.
+type JobEvent struct {
+	Type JobEventType
+	Job  JobInfo
+}
+
+// watcher receives the events of the jobs its selector matches, or of a
+// single job if it has an id.
+type watcher struct {
+	id       string
+	selector Selector
+	events   chan JobEvent
+}
+
+func (w *watcher) matches(job *JobInfo) bool {
+	if w.id != "" {
+		return job.Id == w.id
+	}
+	return w.selector.Matches(job.Labels)
+}
+
+// ListJobs returns every job the selector matches.
+func (jr *JobRunner) ListJobs(selector Selector) []JobInfo {
+	return jr.store.ListRecords(selector)
+}
+
+// WatchJobs returns the jobs the selector matches and a channel of their
+// changes from then on. The channel is closed if the caller falls more than
+// WatchBufferSize events behind, and cancel must be called once the caller
+// is done watching.
+func (jr *JobRunner) WatchJobs(selector Selector) (jobs []JobInfo, events <-chan JobEvent, cancel func()) {
+	return jr.store.WatchRecords(selector)
+}
+
+// WaitJob blocks until a job has reached a terminal state and its process has
+// exited, or until ctx is done, and returns the job as it was last seen.
+func (jr *JobRunner) WaitJob(ctx context.Context, id string) (JobInfo, error) {
+	for {
+		job, events, cancel, err := jr.store.WatchRecord(id)
+		if err != nil {
+			return JobInfo{}, err
+		}
+		job, caughtUp, err := waitFinished(ctx, job, events)
+		cancel()
+		// a watch that fell behind is started again from the job's latest state
+		if caughtUp || err != nil {
+			return job, err
+		}
+	}
+}
+
+// waitFinished follows a job's events until it has finished. It returns
+// false if the events stopped before then.
+func waitFinished(ctx context.Context, job JobInfo, events <-chan JobEvent) (JobInfo, bool, error) {
+	// a deleted job had finished already, so its last event ends the wait too
+	for !job.finished() {
+		select {
+		case <-ctx.Done():
+			return job, true, ctx.Err()
+		case event, ok := <-events:
+			if !ok {
+				return job, false, nil
+			}
+			job = event.Job
+		}
+	}
+	return job, true, nil
+}
@@ -0,0 +1,309 @@
+package gateway
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	pb "github.com/ItsMeWithTheFace/linux-process-runner/api/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// MaxRequestBytes bounds the size of a request body.
+const MaxRequestBytes = 1024 * 1024
+
+var marshaler = protojson.MarshalOptions{UseProtoNames: true}
+
+// Gateway serves the job API as JSON over HTTP. Every request goes through
+// the same interceptors as the gRPC method it maps to, with the client
+// certificate from the HTTP connection, so authentication, authorization and
+// auditing work exactly as they do over gRPC.
+type Gateway struct {
+	jobs   pb.JobRunnerServiceServer
+	unary  []grpc.UnaryServerInterceptor
+	stream []grpc.StreamServerInterceptor
+	mux    *http.ServeMux
+}
+
+// GatewayOption configures a Gateway.
+type GatewayOption func(*Gateway)
+
+// WithUnaryInterceptors runs every unary call through the interceptors, in
+// the order they are given, like grpc.ChainUnaryInterceptor.
+func WithUnaryInterceptors(interceptors ...grpc.UnaryServerInterceptor) GatewayOption {
+	return func(g *Gateway) {
+		g.unary = interceptors
+	}
+}
+
+// WithStreamInterceptors runs every streaming call through the interceptors,
+// in the order they are given, like grpc.ChainStreamInterceptor.
+func WithStreamInterceptors(interceptors ...grpc.StreamServerInterceptor) GatewayOption {
+	return func(g *Gateway) {
+		g.stream = interceptors
+	}
+}
+
+// InitializeGateway creates a gateway to the job API served by jobs.
+func InitializeGateway(jobs pb.JobRunnerServiceServer, opts ...GatewayOption) *Gateway {
+	g := &Gateway{jobs: jobs, mux: http.NewServeMux()}
+	for _, opt := range opts {
+		opt(g)
+	}
+	g.mux.HandleFunc("/v1/jobs", g.handleJobs)
+	g.mux.HandleFunc("/v1/jobs/", g.handleJob)
+	return g
+}
+
+func (g *Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// browsers send client certificates along with requests from any site,
+	// so only read-only requests may come from other origins
+	if r.Method != http.MethodGet && r.Method != http.MethodHead || isWebsocket(r) {
+		if !sameOrigin(r) {
+			writeMessage(w, http.StatusForbidden, status.New(codes.PermissionDenied, "cross-origin requests are not allowed").Proto())
+			return
+		}
+	}
+	g.mux.ServeHTTP(w, r)
+}
+
+// handleJobs serves
+//
+//	POST /v1/jobs    starts a job from a JobStartRequest
+//	GET  /v1/jobs    lists jobs, optionally ?selector=env%3Dprod
+func (g *Gateway) handleJobs(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		req := &pb.JobStartRequest{}
+		if err := readRequest(r, req); err != nil {
+			writeError(w, err)
+			return
+		}
+		g.call(w, r, "/JobRunnerService/StartJob", req, func(ctx context.Context, req interface{}) (interface{}, error) {
+			return g.jobs.StartJob(ctx, req.(*pb.JobStartRequest))
+		})
+	case http.MethodGet:
+		req := &pb.ListJobsRequest{Selector: r.URL.Query().Get("selector")}
+		g.call(w, r, "/JobRunnerService/ListJobs", req, func(ctx context.Context, req interface{}) (interface{}, error) {
+			return g.jobs.ListJobs(ctx, req.(*pb.ListJobsRequest))
+		})
+	default:
+		writeMethodNotAllowed(w, http.MethodGet, http.MethodPost)
+	}
+}
+
+// handleJob serves, where ID is a job's ID or name
+//
+//	GET  /v1/jobs/ID         gets a job's info
+//	POST /v1/jobs/ID/stop    stops a job
+//	GET  /v1/jobs/ID/wait    gets a job's info once it has finished
+//	GET  /v1/jobs/ID/output  streams a job's output, optionally ?attempt=N and
+//	                         ?offset=BYTES, over a WebSocket if the client
+//	                         asks to upgrade
+func (g *Gateway) handleJob(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/v1/jobs/"), "/")
+	id := parts[0]
+	if id == "" || len(parts) > 2 {
+		http.NotFound(w, r)
+		return
+	}
+
+	action := ""
+	if len(parts) == 2 {
+		action = parts[1]
+	}
+
+	switch action {
+	case "":
+		if r.Method != http.MethodGet {
+			writeMethodNotAllowed(w, http.MethodGet)
+			return
+		}
+		g.call(w, r, "/JobRunnerService/GetJobInfo", &pb.JobQueryRequest{Id: id}, func(ctx context.Context, req interface{}) (interface{}, error) {
+			return g.jobs.GetJobInfo(ctx, req.(*pb.JobQueryRequest))
+		})
+	case "stop":
+		if r.Method != http.MethodPost {
+			writeMethodNotAllowed(w, http.MethodPost)
+			return
+		}
+		g.call(w, r, "/JobRunnerService/StopJob", &pb.JobStopRequest{Id: id}, func(ctx context.Context, req interface{}) (interface{}, error) {
+			return g.jobs.StopJob(ctx, req.(*pb.JobStopRequest))
+		})
+	case "wait":
+		if r.Method != http.MethodGet {
+			writeMethodNotAllowed(w, http.MethodGet)
+			return
+		}
+		g.call(w, r, "/JobRunnerService/WaitJob", &pb.JobQueryRequest{Id: id}, func(ctx context.Context, req interface{}) (interface{}, error) {
+			return g.jobs.WaitJob(ctx, req.(*pb.JobQueryRequest))
+		})
+	case "output":
+		if r.Method != http.MethodGet {
+			writeMethodNotAllowed(w, http.MethodGet)
+			return
+		}
+		req := &pb.JobQueryRequest{Id: id}
+		if attempt := r.URL.Query().Get("attempt"); attempt != "" {
+			n, err := strconv.ParseInt(attempt, 10, 32)
+			if err != nil {
+				writeError(w, status.Errorf(codes.InvalidArgument, "attempt %q is not a number", attempt))
+				return
+			}
+			req.Attempt = int32(n)
+		}
+		if offset := r.URL.Query().Get("offset"); offset != "" {
+			n, err := strconv.ParseInt(offset, 10, 64)
+			if err != nil {
+				writeError(w, status.Errorf(codes.InvalidArgument, "offset %q is not a number", offset))
+				return
+			}
+			req.Offset = n
+		}
+		if isWebsocket(r) {
+			g.websocketOutput(w, r, req)
+			return
+		}
+		g.streamOutput(w, r, req)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// call runs a unary handler through the interceptors and writes its response
+// or error as JSON.
+func (g *Gateway) call(w http.ResponseWriter, r *http.Request, method string, req interface{}, handler grpc.UnaryHandler) {
+	info := &grpc.UnaryServerInfo{Server: g.jobs, FullMethod: method}
+	for i := len(g.unary) - 1; i >= 0; i-- {
+		interceptor, next := g.unary[i], handler
+		handler = func(ctx context.Context, req interface{}) (interface{}, error) {
+			return interceptor(ctx, req, info, next)
+		}
+	}
+
+	resp, err := handler(peerContext(r), req)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeMessage(w, http.StatusOK, resp.(proto.Message))
+}
+
+// streamOutput runs StreamJobOutput through the interceptors.
+func (g *Gateway) streamOutput(w http.ResponseWriter, r *http.Request, req *pb.JobQueryRequest) {
+	stream := newHttpStream(peerContext(r), w, acceptsEventStream(r))
+	stream.finish(g.callStreamOutput(stream, req))
+}
+
+func (g *Gateway) callStreamOutput(stream grpc.ServerStream, req *pb.JobQueryRequest) error {
+	var handler grpc.StreamHandler = func(srv interface{}, ss grpc.ServerStream) error {
+		return g.jobs.StreamJobOutput(req, &outputStream{ss})
+	}
+	info := &grpc.StreamServerInfo{FullMethod: "/JobRunnerService/StreamJobOutput", IsServerStream: true}
+	for i := len(g.stream) - 1; i >= 0; i-- {
+		interceptor, next := g.stream[i], handler
+		handler = func(srv interface{}, ss grpc.ServerStream) error {
+			return interceptor(srv, ss, info, next)
+		}
+	}
+
+	return handler(g.jobs, stream)
+}
+
+// peerContext describes the HTTP client the way gRPC would, so that the
+// interceptors find its verified certificate chain and address.
+func peerContext(r *http.Request) context.Context {
+	p := &peer.Peer{}
+	if addr, err := net.ResolveTCPAddr("tcp", r.RemoteAddr); err == nil {
+		p.Addr = addr
+	}
+	if r.TLS != nil {
+		p.AuthInfo = credentials.TLSInfo{State: *r.TLS}
+	}
+	return peer.NewContext(r.Context(), p)
+}
+
+// sameOrigin reports whether a request came from a page served by the
+// gateway itself, or from something other than a browser.
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && u.Host == r.Host
+}
+
+func readRequest(r *http.Request, req proto.Message) error {
+	b, err := ioutil.ReadAll(http.MaxBytesReader(nil, r.Body, MaxRequestBytes))
+	if err != nil {
+		return status.Errorf(codes.InvalidArgument, "reading request: %s", err.Error())
+	}
+	if err := protojson.Unmarshal(b, req); err != nil {
+		return status.Errorf(codes.InvalidArgument, "parsing request: %s", err.Error())
+	}
+	return nil
+}
+
+func writeMessage(w http.ResponseWriter, code int, m proto.Message) {
+	b, err := marshaler.Marshal(m)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write(append(b, '\n'))
+}
+
+// writeError writes a gRPC status as JSON with the HTTP status closest to
+// its code.
+func writeError(w http.ResponseWriter, err error) {
+	s := status.Convert(err)
+	writeMessage(w, httpStatus(s.Code()), s.Proto())
+}
+
+func writeMethodNotAllowed(w http.ResponseWriter, methods ...string) {
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+	writeMessage(w, http.StatusMethodNotAllowed, status.New(codes.Unimplemented, "method not allowed").Proto())
+}
+
+// httpStatus maps gRPC codes to HTTP statuses the way grpc-gateway does.
+func httpStatus(code codes.Code) int {
+	switch code {
+	case codes.OK:
+		return http.StatusOK
+	case codes.Canceled:
+		return 499
+	case codes.InvalidArgument, codes.FailedPrecondition, codes.OutOfRange:
+		return http.StatusBadRequest
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.AlreadyExists, codes.Aborted:
+		return http.StatusConflict
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.Unimplemented:
+		return http.StatusNotImplemented
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,241 @@
+package gateway
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ItsMeWithTheFace/linux-process-runner/api"
+	"github.com/ItsMeWithTheFace/linux-process-runner/auth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"golang.org/x/net/websocket"
+)
+
+const certDir = "../api/test_certs/ca1/"
+
+type GatewayTestSuite struct {
+	suite.Suite
+	rbac   *auth.RBAC
+	server *httptest.Server
+	client *http.Client
+}
+
+func (suite *GatewayTestSuite) SetupTest() {
+	suite.rbac = auth.NewRBAC(auth.DefaultRolePolicy())
+	authenticator := auth.NewAuthenticator(auth.WithRBAC(suite.rbac, api.MethodActions))
+	gw := InitializeGateway(api.InitializeJobRunnerServer(),
+		WithUnaryInterceptors(authenticator.UnaryInterceptor),
+		WithStreamInterceptors(authenticator.StreamInterceptor),
+	)
+
+	reloader, err := auth.NewServerTlsReloader(auth.TlsFiles{
+		Cert: certDir + "server.pem",
+		Key:  certDir + "server.key",
+		CA:   certDir + "ca1.pem",
+	})
+	suite.Require().NoError(err)
+	suite.server = httptest.NewUnstartedServer(gw)
+	suite.server.TLS = reloader.TlsConfig()
+	suite.server.StartTLS()
+
+	cert, err := tls.LoadX509KeyPair(certDir+"client.pem", certDir+"client.key")
+	suite.Require().NoError(err)
+	caPEM, err := ioutil.ReadFile(certDir + "ca1.pem")
+	suite.Require().NoError(err)
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(caPEM)
+	suite.client = &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		RootCAs:      roots,
+		ServerName:   "bufnet",
+	}}}
+}
+
+func (suite *GatewayTestSuite) TearDownTest() {
+	suite.server.Close()
+}
+
+func (suite *GatewayTestSuite) do(method string, path string, body string, header http.Header) (*http.Response, string) {
+	req, err := http.NewRequest(method, suite.server.URL+path, strings.NewReader(body))
+	suite.Require().NoError(err)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	resp, err := suite.client.Do(req)
+	suite.Require().NoError(err)
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	suite.Require().NoError(err)
+	return resp, string(b)
+}
+
+func (suite *GatewayTestSuite) TestJobLifecycle() {
+	resp, body := suite.do(http.MethodPost, "/v1/jobs", `{"command": "echo", "arguments": ["hello"], "name": "greet", "labels": {"env": "dev"}}`, nil)
+	suite.Require().Equal(http.StatusOK, resp.StatusCode, body)
+	var started struct{ Id string }
+	suite.Require().NoError(json.Unmarshal([]byte(body), &started))
+
+	resp, body = suite.do(http.MethodGet, "/v1/jobs/greet/output", "", nil)
+	assert.Equal(suite.T(), http.StatusOK, resp.StatusCode)
+	assert.Equal(suite.T(), "hello\n", body, "output should be streamed as is")
+
+	resp, body = suite.do(http.MethodGet, "/v1/jobs/"+started.Id+"/output", "", http.Header{"Accept": {"text/event-stream"}})
+	assert.Equal(suite.T(), "text/event-stream", resp.Header.Get("Content-Type"))
+	assert.Equal(suite.T(), `data: {"output":"aGVsbG8K"}`, strings.TrimSpace(body), "events should hold the JSON of each message")
+
+	resp, body = suite.do(http.MethodGet, "/v1/jobs/"+started.Id, "", nil)
+	assert.Equal(suite.T(), http.StatusOK, resp.StatusCode)
+	var info struct {
+		Name  string
+		State string
+		Owner string
+	}
+	suite.Require().NoError(json.Unmarshal([]byte(body), &info))
+	assert.Equal(suite.T(), "greet", info.Name)
+	assert.Equal(suite.T(), "COMPLETED", info.State)
+	assert.True(suite.T(), strings.HasPrefix(info.Owner, "client@"), "the job should belong to the certificate's identity")
+
+	resp, body = suite.do(http.MethodGet, "/v1/jobs?selector=env%3Ddev", "", nil)
+	assert.Equal(suite.T(), http.StatusOK, resp.StatusCode)
+	assert.Contains(suite.T(), body, started.Id)
+
+	resp, _ = suite.do(http.MethodGet, "/v1/jobs?selector=env%3Dprod", "", nil)
+	assert.Equal(suite.T(), http.StatusOK, resp.StatusCode)
+}
+
+func (suite *GatewayTestSuite) TestStopJob() {
+	resp, body := suite.do(http.MethodPost, "/v1/jobs", `{"command": "sleep", "arguments": ["10"], "name": "nap"}`, nil)
+	suite.Require().Equal(http.StatusOK, resp.StatusCode, body)
+
+	// give the job time to start so that it has a process to stop
+	suite.Require().Eventually(func() bool {
+		_, body := suite.do(http.MethodGet, "/v1/jobs/nap", "", nil)
+		return strings.Contains(body, `"started_at"`)
+	}, time.Second, 10*time.Millisecond)
+
+	resp, body = suite.do(http.MethodPost, "/v1/jobs/nap/stop", "", nil)
+	assert.Equal(suite.T(), http.StatusOK, resp.StatusCode, body)
+
+	_, body = suite.do(http.MethodGet, "/v1/jobs/nap", "", nil)
+	assert.Contains(suite.T(), body, `"state":"STOPPED"`)
+
+	resp, body = suite.do(http.MethodGet, "/v1/jobs/nap/wait", "", nil)
+	assert.Equal(suite.T(), http.StatusOK, resp.StatusCode, body)
+	assert.Contains(suite.T(), body, `"finished_at"`, "waiting should return once the process has exited")
+
+	resp, _ = suite.do(http.MethodGet, "/v1/jobs/nap/stop", "", nil)
+	assert.Equal(suite.T(), http.StatusMethodNotAllowed, resp.StatusCode)
+	assert.Equal(suite.T(), "POST", resp.Header.Get("Allow"))
+}
+
+func (suite *GatewayTestSuite) TestErrors() {
+	resp, body := suite.do(http.MethodGet, "/v1/jobs/missing", "", nil)
+	assert.Equal(suite.T(), http.StatusNotFound, resp.StatusCode)
+	assert.Contains(suite.T(), body, `"code":5`, "errors should be gRPC statuses as JSON")
+
+	resp, _ = suite.do(http.MethodGet, "/v1/jobs/missing/output", "", nil)
+	assert.Equal(suite.T(), http.StatusNotFound, resp.StatusCode, "errors before streaming should keep their status")
+
+	resp, _ = suite.do(http.MethodPost, "/v1/jobs", `{"command": "true", "nope": 1}`, nil)
+	assert.Equal(suite.T(), http.StatusBadRequest, resp.StatusCode, "unknown fields should be rejected")
+
+	resp, _ = suite.do(http.MethodPost, "/v1/jobs", `{"command": "true", "name": "dup"}`, nil)
+	suite.Require().Equal(http.StatusOK, resp.StatusCode)
+	resp, _ = suite.do(http.MethodPost, "/v1/jobs", `{"command": "true", "name": "dup"}`, nil)
+	assert.Equal(suite.T(), http.StatusConflict, resp.StatusCode)
+}
+
+func (suite *GatewayTestSuite) TestAuthorization() {
+	suite.rbac.SetPolicy(auth.RolePolicy{DefaultRole: auth.RoleViewer})
+
+	resp, body := suite.do(http.MethodPost, "/v1/jobs", `{"command": "true"}`, nil)
+	assert.Equal(suite.T(), http.StatusForbidden, resp.StatusCode, "roles should apply as they do over gRPC")
+	assert.Contains(suite.T(), body, `"code":7`)
+
+	resp, _ = suite.do(http.MethodGet, "/v1/jobs", "", nil)
+	assert.Equal(suite.T(), http.StatusOK, resp.StatusCode, "viewers can still list jobs")
+}
+
+func (suite *GatewayTestSuite) TestRequiresClientCertificate() {
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+	_, err := client.Get(suite.server.URL + "/v1/jobs")
+	assert.Error(suite.T(), err, "the handshake should fail without a client certificate")
+
+	// a request that somehow arrives without a verified chain is still rejected
+	rec := httptest.NewRecorder()
+	suite.server.Config.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/jobs", nil))
+	assert.Equal(suite.T(), http.StatusForbidden, rec.Code)
+}
+
+func (suite *GatewayTestSuite) dialOutput(id string, origin string) *websocket.Conn {
+	config, err := websocket.NewConfig("wss"+strings.TrimPrefix(suite.server.URL, "https")+"/v1/jobs/"+id+"/output", origin)
+	suite.Require().NoError(err)
+	config.TlsConfig = suite.client.Transport.(*http.Transport).TLSClientConfig
+	conn, err := websocket.DialConfig(config)
+	suite.Require().NoError(err)
+	return conn
+}
+
+func (suite *GatewayTestSuite) TestWebsocketOutput() {
+	resp, body := suite.do(http.MethodPost, "/v1/jobs", `{"command": "printf", "arguments": ["\\033[31mred\\033[0m"], "name": "colors"}`, nil)
+	suite.Require().Equal(http.StatusOK, resp.StatusCode, body)
+
+	conn := suite.dialOutput("colors", suite.server.URL)
+	defer conn.Close()
+	var output []byte
+	for {
+		var frame []byte
+		if err := websocket.Message.Receive(conn, &frame); err != nil {
+			break
+		}
+		output = append(output, frame...)
+	}
+	assert.Equal(suite.T(), "\x1b[31mred\x1b[0m", string(output), "output should be sent as is, escape sequences included")
+
+	conn = suite.dialOutput("missing", suite.server.URL)
+	defer conn.Close()
+	var msg string
+	suite.Require().NoError(websocket.Message.Receive(conn, &msg))
+	assert.Contains(suite.T(), msg, `"code":5`, "errors should end the stream with their status")
+}
+
+func (suite *GatewayTestSuite) TestCrossOriginRequests() {
+	resp, _ := suite.do(http.MethodPost, "/v1/jobs", `{"command": "true"}`, http.Header{"Origin": {"https://evil.example"}})
+	assert.Equal(suite.T(), http.StatusForbidden, resp.StatusCode, "other sites can't start jobs with the user's certificate")
+
+	resp, _ = suite.do(http.MethodGet, "/v1/jobs/x/output", "", http.Header{
+		"Origin":                {"https://evil.example"},
+		"Connection":            {"Upgrade"},
+		"Upgrade":               {"websocket"},
+		"Sec-Websocket-Version": {"13"},
+		"Sec-Websocket-Key":     {"dGhlIHNhbXBsZSBub25jZQ=="},
+	})
+	assert.Equal(suite.T(), http.StatusForbidden, resp.StatusCode, "other sites can't read output with the user's certificate")
+
+	resp, _ = suite.do(http.MethodPost, "/v1/jobs", `{"command": "true"}`, http.Header{"Origin": {suite.server.URL}})
+	assert.Equal(suite.T(), http.StatusOK, resp.StatusCode, "the web UI can")
+}
+
+func TestGatewayTestSuite(t *testing.T) {
+	suite.Run(t, new(GatewayTestSuite))
+}
+
+func TestAcceptsEventStream(t *testing.T) {
+	for accept, want := range map[string]bool{
+		"":                  false,
+		"*/*":               false,
+		"text/event-stream": true,
+		"application/json, text/event-stream; q=0.9": true,
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("Accept", accept)
+		assert.Equal(t, want, acceptsEventStream(r), accept)
+	}
+}
@@ -0,0 +1,140 @@
+package gateway
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	pb "github.com/ItsMeWithTheFace/linux-process-runner/api/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// httpStream is the server side of a streaming call answered over HTTP. With
+// events every message is sent as a Server-Sent Event holding its JSON,
+// otherwise job output is written as is and other messages as one JSON
+// object per line, flushing after each of them.
+//
+// Errors before the first message are written as a JSON error like a unary
+// call's. Later errors end the stream with an "error" event, or without
+// events with Grpc-Status and Grpc-Message trailers.
+type httpStream struct {
+	ctx     context.Context
+	w       http.ResponseWriter
+	events  bool
+	started bool
+}
+
+func newHttpStream(ctx context.Context, w http.ResponseWriter, events bool) *httpStream {
+	return &httpStream{ctx: ctx, w: w, events: events}
+}
+
+func (s *httpStream) SetHeader(metadata.MD) error  { return nil }
+func (s *httpStream) SendHeader(metadata.MD) error { return nil }
+func (s *httpStream) SetTrailer(metadata.MD)       {}
+func (s *httpStream) Context() context.Context     { return s.ctx }
+
+// RecvMsg is never called, the request is read before the call starts.
+func (s *httpStream) RecvMsg(interface{}) error { return io.EOF }
+
+func (s *httpStream) SendMsg(m interface{}) error {
+	s.start()
+
+	var err error
+	if out, ok := m.(*pb.JobStreamOutput); ok && !s.events {
+		_, err = s.w.Write(out.GetOutput())
+	} else if msg, ok := m.(proto.Message); ok {
+		err = s.writeJson("", msg)
+	} else {
+		err = fmt.Errorf("cannot send %T", m)
+	}
+	if err != nil {
+		return err
+	}
+
+	if f, ok := s.w.(http.Flusher); ok {
+		f.Flush()
+	}
+	return nil
+}
+
+// finish ends the stream with the call's result.
+func (s *httpStream) finish(err error) {
+	if err != nil && !s.started {
+		writeError(s.w, err)
+		return
+	}
+	s.start()
+	if err == nil {
+		return
+	}
+
+	st := status.Convert(err)
+	if s.events {
+		s.writeJson("error", st.Proto())
+		return
+	}
+	s.w.Header().Set(http.TrailerPrefix+"Grpc-Status", strconv.Itoa(int(st.Code())))
+	s.w.Header().Set(http.TrailerPrefix+"Grpc-Message", st.Message())
+}
+
+func (s *httpStream) start() {
+	if s.started {
+		return
+	}
+	s.started = true
+
+	if s.events {
+		s.w.Header().Set("Content-Type", "text/event-stream")
+	} else {
+		s.w.Header().Set("Content-Type", "application/octet-stream")
+	}
+	s.w.Header().Set("Cache-Control", "no-cache")
+	s.w.Header().Set("X-Content-Type-Options", "nosniff")
+	s.w.WriteHeader(http.StatusOK)
+}
+
+// writeJson writes a message as a Server-Sent Event of the given type, or as
+// a line of JSON without events.
+func (s *httpStream) writeJson(event string, m proto.Message) error {
+	b, err := marshaler.Marshal(m)
+	if err != nil {
+		return err
+	}
+	if !s.events {
+		_, err = s.w.Write(append(b, '\n'))
+		return err
+	}
+	if event != "" {
+		if _, err = fmt.Fprintf(s.w, "event: %s\n", event); err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintf(s.w, "data: %s\n\n", b)
+	return err
+}
+
+// acceptsEventStream reports whether the client asked for Server-Sent Events.
+func acceptsEventStream(r *http.Request) bool {
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		if mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(accept)); err == nil && mediaType == "text/event-stream" {
+			return true
+		}
+	}
+	return false
+}
+
+// outputStream adapts a stream to the StreamJobOutput server interface.
+type outputStream struct {
+	grpc.ServerStream
+}
+
+func (s *outputStream) Send(out *pb.JobStreamOutput) error {
+	return s.SendMsg(out)
+}
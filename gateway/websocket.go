@@ -0,0 +1,79 @@
+package gateway
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	pb "github.com/ItsMeWithTheFace/linux-process-runner/api/proto"
+	"golang.org/x/net/websocket"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// websocketOutput streams a job's output over a WebSocket. Output is sent in
+// binary frames as is, and an error ends the stream with a text frame holding
+// its status as JSON.
+func (g *Gateway) websocketOutput(w http.ResponseWriter, r *http.Request, req *pb.JobQueryRequest) {
+	ctx := peerContext(r)
+	server := websocket.Server{
+		// ServeHTTP already checked the origin
+		Handshake: func(*websocket.Config, *http.Request) error { return nil },
+		Handler: func(conn *websocket.Conn) {
+			defer conn.Close()
+
+			// the client never sends anything, reading only notices it leaving
+			ctx, cancel := context.WithCancel(ctx)
+			defer cancel()
+			go func() {
+				io.Copy(ioutil.Discard, conn)
+				cancel()
+			}()
+
+			if err := g.callStreamOutput(&websocketStream{ctx: ctx, conn: conn}, req); err != nil && ctx.Err() == nil {
+				b, _ := marshaler.Marshal(status.Convert(err).Proto())
+				websocket.Message.Send(conn, string(b))
+			}
+		},
+	}
+	server.ServeHTTP(w, r)
+}
+
+// websocketStream is the server side of a streaming call answered over a
+// WebSocket.
+type websocketStream struct {
+	ctx  context.Context
+	conn *websocket.Conn
+}
+
+func (s *websocketStream) SetHeader(metadata.MD) error  { return nil }
+func (s *websocketStream) SendHeader(metadata.MD) error { return nil }
+func (s *websocketStream) SetTrailer(metadata.MD)       {}
+func (s *websocketStream) Context() context.Context     { return s.ctx }
+
+// RecvMsg is never called, the request is read before the call starts.
+func (s *websocketStream) RecvMsg(interface{}) error { return io.EOF }
+
+func (s *websocketStream) SendMsg(m interface{}) error {
+	switch out := m.(type) {
+	case *pb.JobStreamOutput:
+		return websocket.Message.Send(s.conn, out.GetOutput())
+	case proto.Message:
+		b, err := marshaler.Marshal(out)
+		if err != nil {
+			return err
+		}
+		return websocket.Message.Send(s.conn, string(b))
+	default:
+		return fmt.Errorf("cannot send %T", m)
+	}
+}
+
+// isWebsocket reports whether the client asked to upgrade to a WebSocket.
+func isWebsocket(r *http.Request) bool {
+	return strings.EqualFold(r.Header.Get("Upgrade"), "websocket")
+}
@@ -0,0 +1,31 @@
+package handlers
+
+import (
+	"context"
+	"flag"
+	"log"
+
+	pb "github.com/ItsMeWithTheFace/linux-process-runner/api/proto"
+)
+
+// HandleDrainCommand stops the server from accepting new jobs, or lets it
+// accept them again, and prints how many jobs are left.
+func (c *Client) HandleDrainCommand(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("drain", flag.ContinueOnError)
+	resume := flags.Bool("resume", false, "accept new jobs again")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	out, err := c.AdminServiceClient.Drain(ctx, &pb.DrainRequest{Resume: *resume})
+	if err != nil {
+		return err
+	}
+
+	state := "accepting jobs"
+	if out.GetDraining() {
+		state = "draining"
+	}
+	log.Printf("server is %s, %d jobs running and %d queued", state, out.GetRunningJobs(), out.GetQueuedJobs())
+	return nil
+}
@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	pb "github.com/ItsMeWithTheFace/linux-process-runner/api/proto"
+)
+
+// HandleAuditCommand queries the server's audit log and prints the matching
+// entries, oldest first.
+func (c *Client) HandleAuditCommand(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("audit", flag.ContinueOnError)
+	principal := flags.String("principal", "", "only show entries for this principal, e.g. alice@CN=ca")
+	job := flags.String("job", "", "only show entries for this job ID")
+	method := flags.String("method", "", "only show entries for this RPC, e.g. StartJob")
+	since := flags.Duration("since", 0, "only show entries newer than this, e.g. 1h")
+	limit := flags.Int("limit", 0, "number of most recent entries to show, the server's default applies if zero")
+	verify := flags.Bool("verify", false, "check the log's hash chain for tampering")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	query := &pb.AuditQuery{
+		Principal: *principal,
+		JobId:     *job,
+		Method:    *method,
+		Limit:     int32(*limit),
+		Verify:    *verify,
+	}
+	if *since > 0 {
+		query.Since = time.Now().Add(-*since).Unix()
+	}
+
+	out, err := c.AuditServiceClient.QueryAuditLog(ctx, query)
+	if err != nil {
+		return err
+	}
+
+	for _, e := range out.GetEntries() {
+		target := e.GetJobId()
+		if e.GetCommand() != "" {
+			target = strings.TrimSpace(fmt.Sprintf("%s %s", target, strings.Join(append([]string{e.GetCommand()}, e.GetArguments()...), " ")))
+		}
+		log.Printf("%s\t%s\t%s\t%s\t%s\t%s\t%s",
+			time.Unix(0, e.GetTime()).Format(time.RFC3339), e.GetPrincipal(), e.GetMethod(),
+			target, e.GetDecision(), e.GetOutcome(), e.GetError())
+	}
+
+	if *verify {
+		if !out.GetVerified() {
+			return fmt.Errorf("audit log failed verification: %s", out.GetVerificationError())
+		}
+		log.Println("audit log hash chain verified")
+	}
+
+	return nil
+}
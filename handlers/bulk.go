@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	pb "github.com/ItsMeWithTheFace/linux-process-runner/api/proto"
+	"google.golang.org/grpc"
+)
+
+// selectorFlags are the flags that pick the jobs of a bulk operation.
+type selectorFlags struct {
+	labels    *string
+	owner     *string
+	states    *string
+	olderThan *time.Duration
+	dryRun    *bool
+}
+
+func addSelectorFlags(flags *flag.FlagSet) selectorFlags {
+	return selectorFlags{
+		labels:    flags.String("selector", "", "label selector, e.g. \"pipeline-run=42\""),
+		owner:     flags.String("owner", "", "only jobs owned by this principal, e.g. alice@CN=ca"),
+		states:    flags.String("state", "", "only jobs in one of these comma separated states, e.g. running,queued"),
+		olderThan: flags.Duration("older-than", 0, "only jobs created at least this long ago"),
+		dryRun:    flags.Bool("dry-run", false, "only show which jobs would be affected"),
+	}
+}
+
+func (f selectorFlags) isSet() bool {
+	return *f.labels != "" || *f.owner != "" || *f.states != "" || *f.olderThan != 0
+}
+
+func (f selectorFlags) request() (*pb.BulkJobRequest, error) {
+	sel := &pb.JobSelector{
+		Owner:         *f.owner,
+		Labels:        *f.labels,
+		MinAgeSeconds: int64(f.olderThan.Seconds()),
+	}
+	if *f.states != "" {
+		for _, name := range strings.Split(*f.states, ",") {
+			state, ok := pb.JobState_value[strings.ToUpper(strings.TrimSpace(name))]
+			if !ok {
+				return nil, fmt.Errorf("unknown job state %q", name)
+			}
+			sel.States = append(sel.States, pb.JobState(state))
+		}
+	}
+	return &pb.BulkJobRequest{Selector: sel, DryRun: *f.dryRun}, nil
+}
+
+// HandleStopJobCommand stops a job by ID, or every job matching the selector
+// flags.
+func (c *Client) HandleStopJobCommand(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("stop", flag.ContinueOnError)
+	selector := addSelectorFlags(flags)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if !selector.isSet() {
+		if flags.NArg() != 1 {
+			return fmt.Errorf("usage: stop ID | stop [-selector S] [-owner O] [-state S,...] [-older-than D] [-dry-run]")
+		}
+		if _, err := c.JobRunnerServiceClient.StopJob(ctx, &pb.JobStopRequest{Id: flags.Arg(0)}); err != nil {
+			return err
+		}
+		log.Printf("stopped job with ID: %s", flags.Arg(0))
+		return nil
+	}
+
+	return runBulk(ctx, selector, flags, "stop", "stopped", c.JobRunnerServiceClient.StopJobs)
+}
+
+// HandleDeleteJobsCommand deletes every finished job matching the selector
+// flags.
+func (c *Client) HandleDeleteJobsCommand(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("rm", flag.ContinueOnError)
+	selector := addSelectorFlags(flags)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if !selector.isSet() {
+		return fmt.Errorf("usage: rm [-selector S] [-owner O] [-state S,...] [-older-than D] [-dry-run]")
+	}
+
+	return runBulk(ctx, selector, flags, "delete", "deleted", c.JobRunnerServiceClient.DeleteJobs)
+}
+
+func runBulk(
+	ctx context.Context,
+	selector selectorFlags,
+	flags *flag.FlagSet,
+	verb string,
+	past string,
+	call func(context.Context, *pb.BulkJobRequest, ...grpc.CallOption) (*pb.BulkJobOutput, error),
+) error {
+	if flags.NArg() > 0 {
+		return fmt.Errorf("unexpected arguments: %v", flags.Args())
+	}
+	req, err := selector.request()
+	if err != nil {
+		return err
+	}
+
+	out, err := call(ctx, req)
+	if err != nil {
+		return err
+	}
+
+	done := 0
+	for _, result := range out.GetResults() {
+		state := strings.ToLower(result.GetState().String())
+		switch {
+		case result.GetError() != "":
+			log.Printf("%s\t%s\tcannot %s: %s", result.GetId(), state, verb, result.GetError())
+		case req.GetDryRun():
+			done++
+			log.Printf("%s\t%s\twould %s", result.GetId(), state, verb)
+		default:
+			done++
+			log.Printf("%s\t%s\t%s", result.GetId(), state, past)
+		}
+	}
+
+	if req.GetDryRun() {
+		log.Printf("would %s %d of %d matching jobs", verb, done, len(out.GetResults()))
+	} else {
+		log.Printf("%s %d of %d matching jobs", past, done, len(out.GetResults()))
+	}
+	return nil
+}
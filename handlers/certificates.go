@@ -0,0 +1,207 @@
+package handlers
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"time"
+
+	pb "github.com/ItsMeWithTheFace/linux-process-runner/api/proto"
+)
+
+// EnrollmentPollInterval is how often a pending enrollment is checked for an
+// admin's decision.
+const EnrollmentPollInterval = 5 * time.Second
+
+// HandleEnrollCommand generates a new private key and requests a certificate
+// for name. Requests without a token wait until an admin approves or denies
+// them. The key and certificate are written to keyPath and certPath.
+func HandleEnrollCommand(
+	ctx context.Context,
+	client pb.EnrollmentServiceClient,
+	name string,
+	token string,
+	certPath string,
+	keyPath string,
+) error {
+	key, csr, err := newCertificateRequest(&x509.CertificateRequest{Subject: pkix.Name{CommonName: name}})
+	if err != nil {
+		return err
+	}
+
+	req, err := client.Enroll(ctx, &pb.EnrollRequest{Csr: csr, Token: token})
+	if err != nil {
+		return err
+	}
+
+	if req.GetState() == pb.CertificateRequestState_PENDING {
+		log.Printf("enrollment request %s is waiting for approval", req.GetId())
+	}
+
+	for req.GetState() == pb.CertificateRequestState_PENDING {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(EnrollmentPollInterval):
+		}
+
+		req, err = client.GetEnrollment(ctx, &pb.EnrollmentQuery{Id: req.GetId()})
+		if err != nil {
+			return err
+		}
+	}
+
+	if req.GetState() == pb.CertificateRequestState_DENIED {
+		return fmt.Errorf("enrollment request %s was denied", req.GetId())
+	}
+
+	if err := writeCertificate(req, key, certPath, keyPath); err != nil {
+		return err
+	}
+
+	log.Printf("enrolled as %s with certificate %s", req.GetName(), req.GetSerial())
+	return nil
+}
+
+// HandleRenewCommand requests a fresh certificate for the identity in the
+// certificate at certPath and replaces the files at certPath and keyPath.
+func (c *Client) HandleRenewCommand(ctx context.Context, certPath string, keyPath string) error {
+	b, err := ioutil.ReadFile(certPath)
+	if err != nil {
+		return err
+	}
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return fmt.Errorf("%s does not contain a PEM encoded certificate", certPath)
+	}
+	current, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return err
+	}
+
+	template := &x509.CertificateRequest{Subject: pkix.Name{CommonName: current.Subject.CommonName}}
+	for _, uri := range current.URIs {
+		if uri.Scheme == "spiffe" {
+			template.URIs = append(template.URIs, uri)
+		}
+	}
+
+	key, csr, err := newCertificateRequest(template)
+	if err != nil {
+		return err
+	}
+
+	req, err := c.CertificateServiceClient.RenewCertificate(ctx, &pb.RenewCertificateRequest{Csr: csr})
+	if err != nil {
+		return err
+	}
+
+	if err := writeCertificate(req, key, certPath, keyPath); err != nil {
+		return err
+	}
+
+	log.Printf("renewed certificate, new serial: %s", req.GetSerial())
+	return nil
+}
+
+// HandleCertsCommand routes the admin's certificate management subcommands.
+func (c *Client) HandleCertsCommand(ctx context.Context, args []string) error {
+	usage := fmt.Errorf("usage: certs [token NAME [ROLE] | list | approve ID [ROLE] | deny ID | issued | revoke SERIAL]")
+	if len(args) < 1 {
+		return usage
+	}
+
+	switch {
+	case args[0] == "token" && len(args) >= 2:
+		req := &pb.EnrollmentTokenRequest{Name: args[1]}
+		if len(args) > 2 {
+			req.Role = args[2]
+		}
+		out, err := c.CertificateServiceClient.CreateEnrollmentToken(ctx, req)
+		if err != nil {
+			return err
+		}
+		log.Printf("token: %s (expires %s)", out.GetToken(), time.Unix(out.GetExpiresAt(), 0).Format(time.RFC3339))
+	case args[0] == "list":
+		out, err := c.CertificateServiceClient.ListCertificateRequests(ctx, &pb.ListCertificateRequestsRequest{})
+		if err != nil {
+			return err
+		}
+		for _, r := range out.GetRequests() {
+			log.Printf("%s\t%s\t%s\t%s", r.GetId(), r.GetName(), r.GetState(), r.GetRole())
+		}
+	case args[0] == "approve" && len(args) >= 2:
+		req := &pb.CertificateRequestApproval{Id: args[1]}
+		if len(args) > 2 {
+			req.Role = args[2]
+		}
+		out, err := c.CertificateServiceClient.ApproveCertificateRequest(ctx, req)
+		if err != nil {
+			return err
+		}
+		log.Printf("issued certificate %s for %s", out.GetSerial(), out.GetName())
+	case args[0] == "deny" && len(args) >= 2:
+		_, err := c.CertificateServiceClient.ApproveCertificateRequest(ctx, &pb.CertificateRequestApproval{Id: args[1], Deny: true})
+		if err != nil {
+			return err
+		}
+		log.Printf("denied request %s", args[1])
+	case args[0] == "issued":
+		out, err := c.CertificateServiceClient.ListIssuedCertificates(ctx, &pb.ListIssuedCertificatesRequest{})
+		if err != nil {
+			return err
+		}
+		for _, crt := range out.GetCertificates() {
+			log.Printf("%s\t%s\t%s\trevoked=%t", crt.GetSerial(), crt.GetName(),
+				time.Unix(crt.GetNotAfter(), 0).Format(time.RFC3339), crt.GetRevoked())
+		}
+	case args[0] == "revoke" && len(args) >= 2:
+		_, err := c.CertificateServiceClient.RevokeCertificate(ctx, &pb.RevokeCertificateRequest{Serial: args[1]})
+		if err != nil {
+			return err
+		}
+		log.Printf("revoked certificate %s", args[1])
+	default:
+		return usage
+	}
+
+	return nil
+}
+
+// newCertificateRequest generates an ECDSA key and a PEM encoded CSR from template.
+func newCertificateRequest(template *x509.CertificateRequest) (*ecdsa.PrivateKey, []byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	der, err := x509.CreateCertificateRequest(rand.Reader, template, key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return key, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der}), nil
+}
+
+// writeCertificate stores the issued certificate and its key. The key is
+// written first so that a watcher never pairs the new certificate with the
+// old key for longer than it takes to write one file.
+func writeCertificate(req *pb.CertificateRequest, key *ecdsa.PrivateKey, certPath string, keyPath string) error {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return err
+	}
+
+	if err := ioutil.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(certPath, req.GetCertificate(), 0644)
+}
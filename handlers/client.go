@@ -2,22 +2,52 @@ package handlers
 
 import (
 	"context"
+	"flag"
 	"fmt"
 	"io"
 	"log"
+	"strings"
 
 	pb "github.com/ItsMeWithTheFace/linux-process-runner/api/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 // Client implements the client-side gRPC functions.
 type Client struct {
 	pb.JobRunnerServiceClient
+	pb.CertificateServiceClient
+	pb.AuditServiceClient
+	pb.ScheduleServiceClient
+	pb.WorkflowServiceClient
+	pb.AdminServiceClient
+
+	// CertPath and KeyPath are where renewed certificates are written.
+	CertPath string
+	KeyPath  string
 }
 
 // HandleArgs accepts command-line arguments and routes them to the appropriate handler.
 func (c *Client) HandleArgs(args []string) error {
 	if len(args) < 1 {
-		return fmt.Errorf("please provide one of the following commands: [start, stop, get, stream]")
+		return fmt.Errorf("please provide one of the following commands: [start, stop, rm, get, wait, list, watch, stream, stats, schedule, workflow, renew, certs, audit, drain]")
+	}
+
+	switch args[0] {
+	case "renew":
+		return c.HandleRenewCommand(context.Background(), c.CertPath, c.KeyPath)
+	case "audit":
+		return c.HandleAuditCommand(context.Background(), args[1:])
+	case "drain":
+		return c.HandleDrainCommand(context.Background(), args[1:])
+	case "schedule":
+		return c.HandleScheduleCommand(context.Background(), args[1:])
+	case "workflow":
+		return c.HandleWorkflowCommand(context.Background(), args[1:])
+	case "list":
+		return c.HandleListJobsCommand(context.Background(), args[1:])
+	case "watch":
+		return c.HandleWatchJobsCommand(context.Background(), args[1:])
 	}
 
 	// TODO: add some better argument handling
@@ -28,21 +58,67 @@ func (c *Client) HandleArgs(args []string) error {
 
 	switch command {
 	case "start":
-		return c.HandleStartJobCommand(context.Background(), args[1], args[2:])
+		return c.HandleStartJobCommand(context.Background(), args[1:])
 	case "stop":
-		return c.HandleStopJobCommand(context.Background(), args[1])
+		return c.HandleStopJobCommand(context.Background(), args[1:])
+	case "rm":
+		return c.HandleDeleteJobsCommand(context.Background(), args[1:])
 	case "get":
 		return c.HandleGetJobCommand(context.Background(), args[1])
+	case "wait":
+		return c.HandleWaitJobCommand(context.Background(), args[1:])
 	case "stream":
-		return c.HandleStreamJobOutputCommand(context.Background(), args[1])
+		return c.HandleStreamJobOutputCommand(context.Background(), args[1:])
+	case "stats":
+		return c.HandleStatsCommand(context.Background(), args[1:])
+	case "certs":
+		return c.HandleCertsCommand(context.Background(), args[1:])
 	default:
-		return fmt.Errorf("please provide one of the following commands: [start, stop, get, stream]")
+		return fmt.Errorf("please provide one of the following commands: [start, stop, get, wait, list, watch, stream, stats, schedule, workflow, renew, certs, audit, drain]")
 	}
 }
 
-// HandleStartJobCommand starts the job and returns the job ID.
-func (c *Client) HandleStartJobCommand(ctx context.Context, command string, args []string) error {
-	out, err := c.JobRunnerServiceClient.StartJob(ctx, &pb.JobStartRequest{Command: command, Arguments: args})
+// HandleStartJobCommand starts the job and returns the job ID. Flags are only
+// read before the command, everything after it is passed to the job.
+func (c *Client) HandleStartJobCommand(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("start", flag.ContinueOnError)
+	priority := flags.Int("priority", 0, "jobs with a higher priority leave the queue first")
+	restart := flags.String("restart", "never", "when to run the command again: never, on-failure or always")
+	maxAttempts := flags.Int("max-attempts", 0, "give up after this many runs including the first, no limit if zero")
+	backoff := flags.Duration("backoff", 0, "delay before the first restart, doubled after every attempt")
+	maxBackoff := flags.Duration("max-backoff", 0, "longest delay between restarts")
+	labels, annotations := keyValueFlag{}, keyValueFlag{}
+	flags.Var(labels, "label", "key=value label to select the job by, can be repeated")
+	flags.Var(annotations, "annotation", "key=value annotation, can be repeated")
+	name := flags.String("name", "", "name to use instead of the job's ID, unique among your jobs")
+	idempotencyKey := flags.String("idempotency-key", "", "retrying with the same key returns the job the first try started")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() < 1 {
+		return fmt.Errorf("start requires a command")
+	}
+
+	mode, ok := pb.RestartMode_value[strings.ReplaceAll(strings.ToUpper(*restart), "-", "_")]
+	if !ok {
+		return fmt.Errorf("unknown restart policy %q", *restart)
+	}
+
+	out, err := c.JobRunnerServiceClient.StartJob(ctx, &pb.JobStartRequest{
+		Command:   flags.Arg(0),
+		Arguments: flags.Args()[1:],
+		Priority:  int32(*priority),
+		RestartPolicy: &pb.RestartPolicy{
+			Mode:             pb.RestartMode(mode),
+			MaxAttempts:      int32(*maxAttempts),
+			InitialBackoffMs: backoff.Milliseconds(),
+			MaxBackoffMs:     maxBackoff.Milliseconds(),
+		},
+		Labels:         labels,
+		Annotations:    annotations,
+		IdempotencyKey: *idempotencyKey,
+		Name:           *name,
+	})
 
 	if err != nil {
 		return err
@@ -52,35 +128,83 @@ func (c *Client) HandleStartJobCommand(ctx context.Context, command string, args
 	return nil
 }
 
-// HandleStopJobCommand stops the job.
-func (c *Client) HandleStopJobCommand(ctx context.Context, id string) error {
-	_, err := c.JobRunnerServiceClient.StopJob(ctx, &pb.JobStopRequest{Id: id})
+// HandleGetJobCommand retrieves a job's metadata.
+func (c *Client) HandleGetJobCommand(ctx context.Context, id string) error {
+	job, err := c.JobRunnerServiceClient.GetJobInfo(ctx, &pb.JobQueryRequest{Id: id})
 
 	if err != nil {
 		return err
 	}
 
-	log.Printf("stopped job with ID: %s", id)
+	log.Println(job)
 
 	return nil
 }
 
-// HandleGetJobCommand retrieves a job's metadata.
-func (c *Client) HandleGetJobCommand(ctx context.Context, id string) error {
-	job, err := c.JobRunnerServiceClient.GetJobInfo(ctx, &pb.JobQueryRequest{Id: id})
+// WaitTimeoutExitCode is what wait exits with when --timeout passes before
+// the job finishes, the same as timeout(1).
+const WaitTimeoutExitCode = 124
+
+// ExitError asks the client to exit with a code instead of logging an error.
+type ExitError struct {
+	Code int
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("exit code %d", e.Code)
+}
+
+// HandleWaitJobCommand blocks until a job has finished, prints its metadata and
+// exits with its exit code. Jobs that failed without one, e.g. because they
+// were stopped or killed by a signal, exit with 1.
+func (c *Client) HandleWaitJobCommand(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("wait", flag.ContinueOnError)
+	timeout := flags.Duration("timeout", 0, "give up waiting after this long, wait forever if zero")
+
+	id, err := parseIdAndFlags(flags, args)
+	if err != nil {
+		return err
+	}
+
+	if *timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *timeout)
+		defer cancel()
+	}
+
+	job, err := c.JobRunnerServiceClient.WaitJob(ctx, &pb.JobQueryRequest{Id: id})
 
+	if status.Code(err) == codes.DeadlineExceeded {
+		log.Printf("job %s did not finish within %s", id, *timeout)
+		return &ExitError{Code: WaitTimeoutExitCode}
+	}
 	if err != nil {
 		return err
 	}
 
 	log.Println(job)
 
-	return nil
+	if job.GetState() == pb.JobState_COMPLETED {
+		return nil
+	}
+	if n := len(job.GetAttempts()); n > 0 && job.GetAttempts()[n-1].GetExitCode() > 0 {
+		return &ExitError{Code: int(job.GetAttempts()[n-1].GetExitCode())}
+	}
+	return &ExitError{Code: 1}
 }
 
 // HandleStreamJobOutputCommand receives the streamed output of a job and prints it.
-func (c *Client) HandleStreamJobOutputCommand(ctx context.Context, id string) error {
-	srv, err := c.JobRunnerServiceClient.StreamJobOutput(ctx, &pb.JobQueryRequest{Id: id})
+// With --attempt only that run of a restarted job is printed.
+func (c *Client) HandleStreamJobOutputCommand(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("stream", flag.ContinueOnError)
+	attempt := flags.Int("attempt", 0, "only print this attempt's output, every attempt is printed if zero")
+
+	id, err := parseIdAndFlags(flags, args)
+	if err != nil {
+		return err
+	}
+
+	srv, err := c.JobRunnerServiceClient.StreamJobOutput(ctx, &pb.JobQueryRequest{Id: id, Attempt: int32(*attempt)})
 
 	if err != nil {
 		fmt.Print(err.Error())
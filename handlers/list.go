@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"strings"
+
+	pb "github.com/ItsMeWithTheFace/linux-process-runner/api/proto"
+)
+
+// keyValueFlag collects repeated key=value flags into a map.
+type keyValueFlag map[string]string
+
+func (f keyValueFlag) String() string {
+	return formatLabels(f)
+}
+
+func (f keyValueFlag) Set(s string) error {
+	kv := strings.SplitN(s, "=", 2)
+	if len(kv) != 2 {
+		return fmt.Errorf("%q is not key=value", s)
+	}
+	f[kv[0]] = kv[1]
+	return nil
+}
+
+// HandleListJobsCommand prints the jobs a label selector matches.
+func (c *Client) HandleListJobsCommand(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("list", flag.ContinueOnError)
+	selector := flags.String("l", "", "label selector, e.g. \"env=prod,team in (a,b)\"")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	out, err := c.JobRunnerServiceClient.ListJobs(ctx, &pb.ListJobsRequest{Selector: *selector})
+	if err != nil {
+		return err
+	}
+
+	for _, job := range out.GetJobs() {
+		log.Print(formatJob(job))
+	}
+	return nil
+}
+
+// HandleWatchJobsCommand prints the jobs a label selector matches, then every
+// change to them until interrupted.
+func (c *Client) HandleWatchJobsCommand(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("watch", flag.ContinueOnError)
+	selector := flags.String("l", "", "label selector, e.g. \"env=prod,team in (a,b)\"")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	srv, err := c.JobRunnerServiceClient.WatchJobs(ctx, &pb.ListJobsRequest{Selector: *selector})
+	if err != nil {
+		return err
+	}
+
+	for {
+		event, err := srv.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("watch: %s", err.Error())
+		}
+		log.Printf("%s\t%s", strings.ToLower(event.GetType().String()), formatJob(event.GetJob()))
+	}
+}
+
+func formatJob(job *pb.JobInfo) string {
+	name := job.GetName()
+	if name == "" {
+		name = "-"
+	}
+	return fmt.Sprintf("%s\t%s\t%s\t%s\tcreated: %s\t%s\t%s",
+		job.GetId(), name, job.GetOwner(), strings.ToLower(job.GetState().String()), formatUnix(job.GetCreatedAt()),
+		formatLabels(job.GetLabels()), strings.Join(append([]string{job.GetCommand()}, job.GetArguments()...), " "))
+}
+
+// formatLabels renders labels as a sorted k=v list, or "-" if there are none.
+func formatLabels(labels map[string]string) string {
+	if len(labels) == 0 {
+		return "-"
+	}
+	pairs := make([]string, 0, len(labels))
+	for k, v := range labels {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	pb "github.com/ItsMeWithTheFace/linux-process-runner/api/proto"
+)
+
+// HandleScheduleCommand creates, lists, pauses, resumes and deletes schedules.
+func (c *Client) HandleScheduleCommand(ctx context.Context, args []string) error {
+	usage := fmt.Errorf("usage: schedule [create [-overlap allow|skip|replace] CRON COMMAND [ARGS...] | list | pause ID | resume ID | rm ID]")
+	if len(args) < 1 {
+		return usage
+	}
+
+	switch {
+	case args[0] == "create":
+		flags := flag.NewFlagSet("schedule create", flag.ContinueOnError)
+		overlap := flags.String("overlap", "allow", "what to do when the previous job is still running: allow, skip or replace")
+		if err := flags.Parse(args[1:]); err != nil {
+			return err
+		}
+		if flags.NArg() < 2 {
+			return usage
+		}
+		policy, ok := pb.OverlapPolicy_value[strings.ToUpper(*overlap)]
+		if !ok {
+			return fmt.Errorf("unknown overlap policy %q", *overlap)
+		}
+
+		out, err := c.ScheduleServiceClient.CreateSchedule(ctx, &pb.CreateScheduleRequest{
+			Cron:          flags.Arg(0),
+			Command:       flags.Arg(1),
+			Arguments:     flags.Args()[2:],
+			OverlapPolicy: pb.OverlapPolicy(policy),
+		})
+		if err != nil {
+			return err
+		}
+		log.Printf("ID: %s (next run %s)", out.GetId(), formatUnix(out.GetNextRunAt()))
+	case args[0] == "list":
+		out, err := c.ScheduleServiceClient.ListSchedules(ctx, &pb.ListSchedulesRequest{})
+		if err != nil {
+			return err
+		}
+		for _, s := range out.GetSchedules() {
+			status := "active"
+			if s.GetPaused() {
+				status = "paused"
+			}
+			log.Printf("%s\t%s\t%q\t%s\t%s\tnext: %s\tlast job: %s\t%s",
+				s.GetId(), s.GetOwner(), s.GetCron(), strings.ToLower(s.GetOverlapPolicy().String()), status,
+				formatUnix(s.GetNextRunAt()), s.GetLastJobId(),
+				strings.Join(append([]string{s.GetCommand()}, s.GetArguments()...), " "))
+		}
+	case (args[0] == "pause" || args[0] == "resume") && len(args) == 2:
+		_, err := c.ScheduleServiceClient.PauseSchedule(ctx, &pb.PauseScheduleRequest{Id: args[1], Paused: args[0] == "pause"})
+		if err != nil {
+			return err
+		}
+		log.Printf("%sd schedule %s", args[0], args[1])
+	case args[0] == "rm" && len(args) == 2:
+		_, err := c.ScheduleServiceClient.DeleteSchedule(ctx, &pb.DeleteScheduleRequest{Id: args[1]})
+		if err != nil {
+			return err
+		}
+		log.Printf("deleted schedule %s", args[1])
+	default:
+		return usage
+	}
+
+	return nil
+}
+
+// formatUnix renders a unix timestamp in seconds, or "-" for zero.
+func formatUnix(sec int64) string {
+	if sec == 0 {
+		return "-"
+	}
+	return time.Unix(sec, 0).Format(time.RFC3339)
+}
@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"time"
+
+	pb "github.com/ItsMeWithTheFace/linux-process-runner/api/proto"
+)
+
+// HandleStatsCommand prints a running job's resource usage, or keeps printing
+// it until the job finishes with --watch.
+func (c *Client) HandleStatsCommand(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("stats", flag.ContinueOnError)
+	watch := flags.Bool("watch", false, "keep printing stats until the job finishes")
+	interval := flags.Duration("interval", time.Second, "time between samples with --watch")
+
+	id, err := parseIdAndFlags(flags, args)
+	if err != nil {
+		return err
+	}
+
+	req := &pb.JobStatsRequest{Id: id, IntervalMs: interval.Milliseconds()}
+
+	if !*watch {
+		stats, err := c.JobRunnerServiceClient.GetJobStats(ctx, req)
+		if err != nil {
+			return err
+		}
+		printStats(stats, true)
+		return nil
+	}
+
+	srv, err := c.JobRunnerServiceClient.StreamJobStats(ctx, req)
+	if err != nil {
+		return err
+	}
+
+	for header := true; ; header = false {
+		stats, err := srv.Recv()
+		if err == io.EOF {
+			log.Printf("job %s is no longer running", id)
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("stats: %s", err.Error())
+		}
+		printStats(stats, header)
+	}
+}
+
+// parseIdAndFlags accepts the job ID before or after the command's flags.
+func parseIdAndFlags(flags *flag.FlagSet, args []string) (string, error) {
+	if err := flags.Parse(args); err != nil {
+		return "", err
+	}
+	if flags.NArg() < 1 {
+		return "", fmt.Errorf("%s requires a job ID", flags.Name())
+	}
+
+	id := flags.Arg(0)
+	if err := flags.Parse(flags.Args()[1:]); err != nil {
+		return "", err
+	}
+	if flags.NArg() > 0 {
+		return "", fmt.Errorf("unexpected arguments: %v", flags.Args())
+	}
+	return id, nil
+}
+
+func printStats(stats *pb.JobStats, header bool) {
+	if header {
+		fmt.Printf("%-20s %8s %10s %10s %10s %10s %6s %6s\n", "TIME", "CPU", "MEMORY", "RSS", "READ", "WRITE", "PIDS", "FDS")
+	}
+	fmt.Printf("%-20s %7.1f%% %10s %10s %10s %10s %6d %6d\n",
+		time.Unix(0, stats.GetTime()).Format("2006-01-02 15:04:05"),
+		stats.GetCpuPercent(),
+		formatBytes(stats.GetMemoryBytes()),
+		formatBytes(stats.GetRssBytes()),
+		formatBytes(stats.GetIoReadBytes()),
+		formatBytes(stats.GetIoWriteBytes()),
+		stats.GetPids(),
+		stats.GetOpenFds(),
+	)
+}
+
+// formatBytes renders n using binary units, e.g. 1.5MiB.
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
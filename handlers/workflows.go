@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"strings"
+
+	pb "github.com/ItsMeWithTheFace/linux-process-runner/api/proto"
+	"gopkg.in/yaml.v3"
+)
+
+// workflowFile is the YAML a workflow is submitted from, e.g.
+//
+//	name: release
+//	steps:
+//	  - name: build
+//	    command: make
+//	  - name: test
+//	    command: make
+//	    args: [test]
+//	    depends_on: [build]
+//	  - name: cleanup
+//	    command: make
+//	    args: [clean]
+//	    depends_on: [test]
+//	    condition: always
+type workflowFile struct {
+	Name  string `yaml:"name"`
+	Steps []struct {
+		Name      string   `yaml:"name"`
+		Command   string   `yaml:"command"`
+		Args      []string `yaml:"args"`
+		DependsOn []string `yaml:"depends_on"`
+		// Condition is success, the default, or always.
+		Condition string `yaml:"condition"`
+	} `yaml:"steps"`
+}
+
+// HandleWorkflowCommand submits, shows, lists and cancels workflows.
+func (c *Client) HandleWorkflowCommand(ctx context.Context, args []string) error {
+	usage := fmt.Errorf("usage: workflow [submit FILE | get ID | list | cancel ID]")
+	if len(args) < 1 {
+		return usage
+	}
+
+	switch {
+	case args[0] == "submit" && len(args) == 2:
+		req, err := readWorkflowFile(args[1])
+		if err != nil {
+			return err
+		}
+		wf, err := c.WorkflowServiceClient.SubmitWorkflow(ctx, req)
+		if err != nil {
+			return err
+		}
+		log.Printf("ID: %s", wf.GetId())
+	case args[0] == "get" && len(args) == 2:
+		wf, err := c.WorkflowServiceClient.GetWorkflow(ctx, &pb.WorkflowQueryRequest{Id: args[1]})
+		if err != nil {
+			return err
+		}
+		printWorkflow(wf, true)
+	case args[0] == "list":
+		out, err := c.WorkflowServiceClient.ListWorkflows(ctx, &pb.ListWorkflowsRequest{})
+		if err != nil {
+			return err
+		}
+		for _, wf := range out.GetWorkflows() {
+			printWorkflow(wf, false)
+		}
+	case args[0] == "cancel" && len(args) == 2:
+		wf, err := c.WorkflowServiceClient.CancelWorkflow(ctx, &pb.WorkflowQueryRequest{Id: args[1]})
+		if err != nil {
+			return err
+		}
+		printWorkflow(wf, true)
+	default:
+		return usage
+	}
+
+	return nil
+}
+
+func readWorkflowFile(path string) (*pb.SubmitWorkflowRequest, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var file workflowFile
+	if err := yaml.Unmarshal(b, &file); err != nil {
+		return nil, fmt.Errorf("reading workflow %s: %w", path, err)
+	}
+
+	req := &pb.SubmitWorkflowRequest{Name: file.Name}
+	for _, step := range file.Steps {
+		condition := pb.StepCondition_CONDITION_SUCCESS
+		if step.Condition != "" {
+			value, ok := pb.StepCondition_value["CONDITION_"+strings.ToUpper(step.Condition)]
+			if !ok {
+				return nil, fmt.Errorf("step %s: unknown condition %q", step.Name, step.Condition)
+			}
+			condition = pb.StepCondition(value)
+		}
+		req.Steps = append(req.Steps, &pb.WorkflowStep{
+			Name:      step.Name,
+			Command:   step.Command,
+			Arguments: step.Args,
+			DependsOn: step.DependsOn,
+			Condition: condition,
+		})
+	}
+	return req, nil
+}
+
+// printWorkflow prints a workflow's aggregate status, and with steps a line
+// for each of its steps.
+func printWorkflow(wf *pb.Workflow, steps bool) {
+	counts := make(map[pb.StepState]int)
+	for _, step := range wf.GetSteps() {
+		counts[step.GetState()]++
+	}
+	var summary []string
+	for _, state := range []pb.StepState{
+		pb.StepState_STEP_SUCCEEDED, pb.StepState_STEP_FAILED, pb.StepState_STEP_CANCELLED,
+		pb.StepState_STEP_RUNNING, pb.StepState_STEP_PENDING,
+	} {
+		if counts[state] > 0 {
+			summary = append(summary, fmt.Sprintf("%d %s", counts[state], stepStateName(state)))
+		}
+	}
+
+	log.Printf("%s\t%s\t%q\t%s\t%s\tcreated: %s\tfinished: %s",
+		wf.GetId(), wf.GetOwner(), wf.GetName(),
+		strings.ToLower(strings.TrimPrefix(wf.GetState().String(), "WORKFLOW_")),
+		strings.Join(summary, ", "), formatUnix(wf.GetCreatedAt()), formatUnix(wf.GetFinishedAt()))
+	if !steps {
+		return
+	}
+
+	for _, step := range wf.GetSteps() {
+		jobId := step.GetJobId()
+		if jobId == "" {
+			jobId = "-"
+		}
+		after := "-"
+		if len(step.GetDependsOn()) > 0 {
+			after = strings.Join(step.GetDependsOn(), ",")
+			if step.GetCondition() == pb.StepCondition_CONDITION_ALWAYS {
+				after += " (always)"
+			}
+		}
+		log.Printf("  %s\t%s\tjob: %s\tafter: %s\t%s",
+			step.GetName(), stepStateName(step.GetState()), jobId, after,
+			strings.Join(append([]string{step.GetCommand()}, step.GetArguments()...), " "))
+	}
+}
+
+func stepStateName(state pb.StepState) string {
+	return strings.ToLower(strings.TrimPrefix(state.String(), "STEP_"))
+}
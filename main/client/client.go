@@ -1,8 +1,12 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
+	"fmt"
 	"log"
+	"os"
 
 	pb "github.com/ItsMeWithTheFace/linux-process-runner/api/proto"
 	"github.com/ItsMeWithTheFace/linux-process-runner/auth"
@@ -14,27 +18,77 @@ func main() {
 	cert := flag.String("cert", "certs/client.pem", "path to the client cert's public key")
 	certKey := flag.String("cert-key", "certs/client.key", "path to the client cert's private key")
 	caCert := flag.String("ca-cert", "certs/ca.pem", "path to the CA's public key")
+	addr := flag.String("addr", "0.0.0.0:8080", "address of the server")
+	enrollAddr := flag.String("enroll-addr", "0.0.0.0:8443", "address of the server's enrollment listener")
 
 	flag.Parse()
 
-	tlsCreds, err := auth.GetClientTlsCredentials(*cert, *certKey, *caCert)
+	// enrolling happens before the client has a certificate to connect with
+	if flag.Arg(0) == "enroll" {
+		if err := enroll(*enrollAddr, *caCert, *cert, *certKey, flag.Args()[1:]); err != nil {
+			log.Fatalf("could not enroll: %s", err.Error())
+		}
+		return
+	}
+
+	tlsReloader, err := auth.NewClientTlsReloader(auth.TlsFiles{Cert: *cert, Key: *certKey, CA: *caCert})
 	if err != nil {
 		log.Fatalf("could not load tls creds: %s", err.Error())
 	}
 
-	// TODO: use configurable server address and port
-	conn, err := grpc.Dial("0.0.0.0:8080", grpc.WithTransportCredentials(tlsCreds))
+	// long-running streams reconnect with whatever certs are on disk at the time
+	go tlsReloader.Watch(context.Background(), auth.DefaultWatchInterval)
+
+	conn, err := grpc.Dial(*addr, grpc.WithTransportCredentials(tlsReloader.Credentials()))
 
 	if err != nil {
 		log.Fatalf("could not connect to host: %s", err.Error())
 	}
 
 	client := &handlers.Client{
-		JobRunnerServiceClient: pb.NewJobRunnerServiceClient(conn),
+		JobRunnerServiceClient:   pb.NewJobRunnerServiceClient(conn),
+		CertificateServiceClient: pb.NewCertificateServiceClient(conn),
+		AuditServiceClient:       pb.NewAuditServiceClient(conn),
+		ScheduleServiceClient:    pb.NewScheduleServiceClient(conn),
+		WorkflowServiceClient:    pb.NewWorkflowServiceClient(conn),
+		AdminServiceClient:       pb.NewAdminServiceClient(conn),
+		CertPath:                 *cert,
+		KeyPath:                  *certKey,
 	}
 
 	err = client.HandleArgs(flag.Args())
+	var exitErr *handlers.ExitError
+	if errors.As(err, &exitErr) {
+		os.Exit(exitErr.Code)
+	}
 	if err != nil {
 		log.Fatalf("error handling command args: %s, err: %s", flag.Args(), err.Error())
 	}
 }
+
+// enroll requests a first certificate from the server's built-in CA and
+// stores it where the other commands expect to find it.
+func enroll(addr string, caCert string, cert string, certKey string, args []string) error {
+	flags := flag.NewFlagSet("enroll", flag.ExitOnError)
+	name := flags.String("name", "", "name to request a certificate for")
+	token := flags.String("token", "", "one-time enrollment token, requests without one wait for an admin's approval")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *name == "" {
+		return fmt.Errorf("enroll requires --name")
+	}
+
+	creds, err := auth.GetEnrollmentTlsCredentials(caCert)
+	if err != nil {
+		return err
+	}
+
+	conn, err := grpc.Dial(addr, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	return handlers.HandleEnrollCommand(context.Background(), pb.NewEnrollmentServiceClient(conn), *name, *token, cert, certKey)
+}
@@ -1,37 +1,264 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
 	"flag"
-	"fmt"
 	"log"
 	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/ItsMeWithTheFace/linux-process-runner/api"
 	pb "github.com/ItsMeWithTheFace/linux-process-runner/api/proto"
+	"github.com/ItsMeWithTheFace/linux-process-runner/audit"
 	"github.com/ItsMeWithTheFace/linux-process-runner/auth"
+	"github.com/ItsMeWithTheFace/linux-process-runner/ca"
+	"github.com/ItsMeWithTheFace/linux-process-runner/config"
+	"github.com/ItsMeWithTheFace/linux-process-runner/core"
+	"github.com/ItsMeWithTheFace/linux-process-runner/gateway"
+	"github.com/ItsMeWithTheFace/linux-process-runner/metrics"
+	"github.com/ItsMeWithTheFace/linux-process-runner/schedule"
+	"github.com/ItsMeWithTheFace/linux-process-runner/webui"
+	"github.com/ItsMeWithTheFace/linux-process-runner/workflow"
 	"google.golang.org/grpc"
 )
 
+// retentionInterval is how often finished jobs are checked for expiry.
+const retentionInterval = time.Minute
+
+// crlResignInterval is how often the built-in CA's CRL is checked for being
+// due a re-sign, well within the days the CRL is valid for.
+const crlResignInterval = time.Hour
+
+// streamDrainTimeout is how long open RPCs, like output streams, are given to
+// finish at shutdown once every job has.
+const streamDrainTimeout = 5 * time.Second
+
 func main() {
+	// every job's shim is a copy of this binary, see core.RunShim
+	if len(os.Args) > 1 && os.Args[1] == core.ShimCommand {
+		os.Exit(core.RunShim(os.Args[2:]))
+	}
+
+	configPath := flag.String("config", "", "path to the server's YAML config file, built-in defaults are used if empty")
+
 	flag.Parse()
-	// TODO: make address and port configurable
-	lis, err := net.Listen("tcp", fmt.Sprintf("0.0.0.0:%d", 8080))
+
+	cfg := config.Default()
+	if *configPath != "" {
+		var err error
+		cfg, err = config.Load(*configPath)
+		if err != nil {
+			log.Fatalf("failed to load config: %v", err)
+		}
+	} else if err := cfg.Validate(); err != nil {
+		log.Fatalf("invalid default config: %v", err)
+	}
+
+	lis, err := net.Listen("tcp", cfg.Listeners.GRPC)
 	if err != nil {
 		log.Fatalf("failed to listen: %v", err)
 	}
 
-	// TODO: pull server certs from configurable, secure storage
-	tlsCreds, err := auth.GetServerTlsCredentials("certs/server.pem", "certs/server.key", "certs/ca.pem")
+	tlsReloader, err := auth.NewServerTlsReloader(tlsFiles(cfg))
 	if err != nil {
 		log.Fatalf("failed to load tls creds: %v", err)
 	}
 
+	var authority *ca.Authority
+	if cfg.CertificateAuthority.Enabled {
+		authority, err = ca.LoadAuthority(
+			cfg.CertificateAuthority.Cert,
+			cfg.CertificateAuthority.Key,
+			cfg.CertificateAuthority.StateDir,
+			cfg.CertificateAuthority.CertTTL,
+			ca.WithPendingLimits(cfg.CertificateAuthority.MaxPending, cfg.CertificateAuthority.MaxPendingPerName),
+			ca.WithRequestTTL(cfg.CertificateAuthority.RequestTTL),
+		)
+		if err != nil {
+			log.Fatalf("failed to load certificate authority: %v", err)
+		}
+	}
+
+	revocations, err := auth.NewRevocationChecker(cfg.TLS.CA, crlPaths(cfg, authority))
+	if err != nil {
+		log.Fatalf("failed to load crls: %v", err)
+	}
+	revocations.SetRejectStale(cfg.TLS.RejectStaleCRLs)
+	rolePolicy, err := loadRolePolicy(cfg)
+	if err != nil {
+		log.Fatalf("failed to load role policy: %v", err)
+	}
+	rbac := auth.NewRBAC(rolePolicy)
+
+	commandPolicy, err := loadCommandPolicy(cfg)
+	if err != nil {
+		log.Fatalf("failed to load command policy: %v", err)
+	}
+	commands, err := auth.NewPolicyEngine(commandPolicy)
+	if err != nil {
+		log.Fatalf("failed to load command policy: %v", err)
+	}
+
+	var auditLog *audit.FileLogger
+	if cfg.Audit.Path != "" {
+		auditLog, err = audit.NewFileLogger(cfg.Audit.Path, audit.FileLoggerOptions{
+			MaxBytes:   cfg.Audit.MaxBytes,
+			MaxBackups: cfg.Audit.MaxBackups,
+			HashChain:  cfg.Audit.HashChain,
+		})
+		if err != nil {
+			log.Fatalf("failed to open audit log: %v", err)
+		}
+	}
+
+	methods := make(map[string]auth.Action)
+	for method, action := range api.MethodActions {
+		methods[method] = action
+	}
+	if authority != nil {
+		for method, action := range api.CertificateMethodActions {
+			methods[method] = action
+		}
+	}
+	if auditLog != nil {
+		for method, action := range api.AuditMethodActions {
+			methods[method] = action
+		}
+	}
+	if cfg.Schedules.StateDir != "" {
+		for method, action := range api.ScheduleMethodActions {
+			methods[method] = action
+		}
+	}
+	for method, action := range api.WorkflowMethodActions {
+		methods[method] = action
+	}
+	for method, action := range api.AdminMethodActions {
+		methods[method] = action
+	}
+
+	authenticator := auth.NewAuthenticator(
+		auth.WithRevocationChecker(revocations),
+		auth.WithRBAC(rbac, methods),
+	)
+
+	var recorder metrics.Recorder = metrics.Nop{}
+	var registry *metrics.Registry
+	if cfg.Listeners.Metrics != "" {
+		registry = metrics.NewRegistry()
+		recorder = registry
+	}
+
+	jr := core.InitializeJobRunner(
+		core.InitializeInMemoryJobStore(),
+		core.WithLogDir(cfg.Log.Dir),
+		core.WithSettings(runnerSettings(cfg)),
+		core.WithMetrics(recorder),
+		core.WithStateDir(cfg.Jobs.StateDir),
+	)
+	recovered, err := jr.Recover()
+	if err != nil {
+		log.Fatalf("failed to recover jobs: %v", err)
+	}
+	if recovered > 0 {
+		log.Printf("recovered %d jobs", recovered)
+	}
+	jobRunnerServer := api.InitializeJobRunnerServer(
+		api.WithJobRunner(jr),
+		api.WithPolicy(policy(cfg)),
+		api.WithCommandPolicy(commands),
+		api.WithMetrics(recorder),
+	)
+
+	unary := []grpc.UnaryServerInterceptor{authenticator.UnaryInterceptor}
+	stream := []grpc.StreamServerInterceptor{authenticator.StreamInterceptor}
+	if auditLog != nil {
+		// auditing goes first so that calls rejected by the authenticator are logged
+		auditor := audit.NewAuditor(auditLog)
+		unary = append([]grpc.UnaryServerInterceptor{auditor.UnaryInterceptor}, unary...)
+		stream = append([]grpc.StreamServerInterceptor{auditor.StreamInterceptor}, stream...)
+	}
+	if registry != nil {
+		unary = append([]grpc.UnaryServerInterceptor{registry.UnaryInterceptor}, unary...)
+		stream = append([]grpc.StreamServerInterceptor{registry.StreamInterceptor}, stream...)
+	}
+
 	grpcServer := grpc.NewServer(
-		grpc.Creds(tlsCreds),
-		grpc.UnaryInterceptor(auth.UnaryAuthInterceptor),
-		grpc.StreamInterceptor(auth.StreamAuthInterceptor),
+		grpc.Creds(tlsReloader.Credentials()),
+		grpc.ChainUnaryInterceptor(unary...),
+		grpc.ChainStreamInterceptor(stream...),
 	)
-	pb.RegisterJobRunnerServiceServer(grpcServer, api.InitializeJobRunnerServer())
+	pb.RegisterJobRunnerServiceServer(grpcServer, jobRunnerServer)
+	pb.RegisterAdminServiceServer(grpcServer, api.InitializeAdminServer(jr))
+
+	if cfg.Schedules.StateDir != "" {
+		scheduler, err := schedule.Load(jr, cfg.Schedules.StateDir, schedule.WithRunCheck(api.ScheduleRunCheck(rbac, commands)))
+		if err != nil {
+			log.Fatalf("failed to load schedules: %v", err)
+		}
+		pb.RegisterScheduleServiceServer(grpcServer, api.InitializeScheduleServer(scheduler, commands))
+		go scheduler.Run(context.Background())
+	}
+
+	orchestrator := workflow.InitializeOrchestrator(jr)
+	pb.RegisterWorkflowServiceServer(grpcServer, api.InitializeWorkflowServer(orchestrator, commands))
+	go orchestrator.Run(context.Background())
+
+	if auditLog != nil {
+		pb.RegisterAuditServiceServer(grpcServer, api.InitializeAuditServer(auditLog))
+	}
+
+	if authority != nil {
+		pb.RegisterCertificateServiceServer(grpcServer, api.InitializeCertificateServer(authority, func() {
+			if err := revocations.Refresh(); err != nil {
+				log.Printf("failed to reload crls after revocation: %v", err)
+			}
+		}))
+		go authority.KeepCRLFresh(context.Background(), crlResignInterval, func() {
+			if err := revocations.Refresh(); err != nil {
+				log.Printf("failed to reload crls after re-signing the ca's: %v", err)
+			}
+		})
+	}
+
+	stopListeners, cancelListeners := context.WithCancel(context.Background())
+	if cfg.Listeners.Gateway != "" {
+		gw := gateway.InitializeGateway(jobRunnerServer,
+			gateway.WithUnaryInterceptors(unary...),
+			gateway.WithStreamInterceptors(stream...),
+		)
+		go serveGateway(stopListeners, cfg.Listeners.Gateway, tlsReloader, gw)
+	}
+
+	if cfg.Listeners.Enrollment != "" {
+		go serveEnrollment(cfg.Listeners.Enrollment, cfg.CertificateAuthority, tlsReloader, authority, auditLog)
+	}
+
+	go jr.RunRetention(context.Background(), retentionInterval)
+
+	if registry != nil {
+		go serveMetrics(cfg.Listeners.Metrics, registry, jr)
+	}
+
+	if cfg.TLS.WatchInterval > 0 {
+		go tlsReloader.Watch(context.Background(), cfg.TLS.WatchInterval)
+	}
+
+	if cfg.TLS.CRLRefreshInterval > 0 {
+		go revocations.Watch(context.Background(), cfg.TLS.CRLRefreshInterval)
+	}
+
+	if *configPath != "" {
+		go reloadOnHangup(*configPath, cfg, tlsReloader, revocations, rbac, authority, commands, jr, jobRunnerServer)
+	}
+
+	shutdownDone := make(chan struct{})
+	go shutdownOnSignal(jr, grpcServer, cancelListeners, shutdownDone)
 
 	log.Println("starting server...")
 
@@ -39,4 +266,245 @@ func main() {
 	if err != nil {
 		log.Fatalf("failed to serve: %v", err)
 	}
+	<-shutdownDone
+}
+
+// shutdownOnSignal shuts the server down gracefully once the process receives
+// a SIGTERM or SIGINT. New jobs are rejected straight away, but the API keeps
+// serving while the running jobs finish or are stopped, so clients can still
+// follow them. done is closed once everything has stopped.
+func shutdownOnSignal(jr *core.JobRunner, grpcServer *grpc.Server, stopListeners func(), done chan<- struct{}) {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGTERM, syscall.SIGINT)
+
+	log.Printf("received %s, shutting down", <-sig)
+	if err := jr.Shutdown(context.Background()); err != nil {
+		log.Printf("shutdown: %v", err)
+	}
+
+	stopListeners()
+	stopped := make(chan struct{})
+	go func() {
+		grpcServer.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(streamDrainTimeout):
+		log.Printf("shutdown: closing streams still open after %s", streamDrainTimeout)
+		grpcServer.Stop()
+	}
+
+	log.Println("server stopped")
+	close(done)
+}
+
+// reloadOnHangup re-reads the config file whenever the process receives a
+// SIGHUP and applies every setting that can change without dropping running
+// jobs or active streams. An invalid file leaves the current config in place.
+func reloadOnHangup(
+	path string,
+	current *config.Config,
+	tlsReloader *auth.ServerTlsReloader,
+	revocations *auth.RevocationChecker,
+	rbac *auth.RBAC,
+	authority *ca.Authority,
+	commands *auth.PolicyEngine,
+	jr *core.JobRunner,
+	s *api.JobRunnerServer,
+) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	for range hup {
+		next, err := config.Load(path)
+		if err != nil {
+			log.Printf("config reload failed, keeping current config: %v", err)
+			continue
+		}
+
+		rolePolicy, err := loadRolePolicy(next)
+		if err != nil {
+			log.Printf("config reload failed, keeping current config: %v", err)
+			continue
+		}
+
+		commandPolicy, err := loadCommandPolicy(next)
+		if err != nil {
+			log.Printf("config reload failed, keeping current config: %v", err)
+			continue
+		}
+
+		if err := tlsReloader.Reload(tlsFiles(next)); err != nil {
+			log.Printf("config reload failed, keeping current config: %v", err)
+			continue
+		}
+		if err := reloadRevocations(revocations, next, authority); err != nil {
+			log.Printf("config reload failed, keeping current crls: %v", err)
+		}
+		jr.UpdateSettings(runnerSettings(next))
+		s.SetPolicy(policy(next))
+		rbac.SetPolicy(rolePolicy)
+		if err := commands.SetPolicy(commandPolicy); err != nil {
+			log.Printf("config reload failed, keeping current command policy: %v", err)
+		}
+
+		for _, field := range current.RestartRequired(next) {
+			log.Printf("config reload: changes to %s require a restart", field)
+		}
+
+		current = current.Reloaded(next)
+		log.Println("config reloaded")
+	}
+}
+
+// serveEnrollment serves the enrollment API on its own listener. Clients have
+// no certificate yet, so only the server is authenticated and enrollment
+// tokens or an admin's approval take the place of client auth.
+func serveEnrollment(addr string, caConfig config.CertificateAuthorityConfig, tlsReloader *auth.ServerTlsReloader, authority *ca.Authority, auditLog *audit.FileLogger) {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		log.Fatalf("failed to listen for enrollment: %v", err)
+	}
+
+	opts := []grpc.ServerOption{grpc.Creds(tlsReloader.ServerAuthOnlyCredentials())}
+	if auditLog != nil {
+		opts = append(opts, grpc.UnaryInterceptor(audit.NewAuditor(auditLog).UnaryInterceptor))
+	}
+
+	s := grpc.NewServer(opts...)
+	var enrollOpts []api.EnrollmentOption
+	if caConfig.EnrollRate > 0 {
+		enrollOpts = append(enrollOpts, api.WithEnrollRate(caConfig.EnrollRate, caConfig.EnrollBurst))
+	}
+	pb.RegisterEnrollmentServiceServer(s, api.InitializeEnrollmentServer(authority, enrollOpts...))
+
+	log.Printf("serving enrollment on %s", addr)
+	if err := s.Serve(lis); err != nil {
+		log.Fatalf("failed to serve enrollment: %v", err)
+	}
+}
+
+// serveMetrics serves the registry's metrics, plus a gauge of stored jobs by
+// state, on /metrics.
+func serveMetrics(addr string, registry *metrics.Registry, jr *core.JobRunner) {
+	registry.GaugeFunc("jobs", "Jobs currently stored, by state.", "state", func() map[string]float64 {
+		gauge := make(map[string]float64)
+		for _, state := range []core.JobState{core.Created, core.Running, core.Stopped, core.Completed, core.Error} {
+			gauge[state.String()] = 0
+		}
+		for state, n := range jr.CountJobs() {
+			gauge[state.String()] = float64(n)
+		}
+		return gauge
+	})
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", registry)
+
+	log.Printf("serving metrics on %s", addr)
+	if err := http.ListenAndServe(addr, mux); err != nil {
+		log.Fatalf("failed to serve metrics: %v", err)
+	}
+}
+
+// serveGateway serves the JSON gateway and the web UI over HTTPS, asking for
+// client certificates just like the gRPC listener, until ctx is done.
+func serveGateway(ctx context.Context, addr string, tlsReloader *auth.ServerTlsReloader, gw *gateway.Gateway) {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		log.Fatalf("failed to listen for gateway: %v", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/v1/", gw)
+	mux.Handle("/ui/", http.StripPrefix("/ui/", webui.Handler()))
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		http.Redirect(w, r, "/ui/", http.StatusFound)
+	})
+
+	srv := &http.Server{Handler: mux, TLSConfig: tlsReloader.TlsConfig()}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), streamDrainTimeout)
+		defer cancel()
+		srv.Shutdown(shutdownCtx)
+	}()
+
+	log.Printf("serving gateway on %s", addr)
+	if err := srv.Serve(tls.NewListener(lis, srv.TLSConfig)); err != nil && err != http.ErrServerClosed {
+		log.Fatalf("failed to serve gateway: %v", err)
+	}
+}
+
+// reloadRevocations reloads the CRLs of cfg, and the built-in CA's own, into
+// revocations.
+func reloadRevocations(revocations *auth.RevocationChecker, cfg *config.Config, authority *ca.Authority) error {
+	revocations.SetRejectStale(cfg.TLS.RejectStaleCRLs)
+	return revocations.Reload(cfg.TLS.CA, crlPaths(cfg, authority))
+}
+
+// crlPaths returns the configured CRLs plus the built-in CA's own CRL.
+func crlPaths(cfg *config.Config, authority *ca.Authority) []string {
+	if authority == nil {
+		return cfg.TLS.CRLs
+	}
+	return append(append([]string{}, cfg.TLS.CRLs...), authority.CRLPath())
+}
+
+func tlsFiles(cfg *config.Config) auth.TlsFiles {
+	return auth.TlsFiles{
+		Cert: cfg.TLS.Cert,
+		Key:  cfg.TLS.Key,
+		CA:   cfg.TLS.CA,
+	}
+}
+
+func runnerSettings(cfg *config.Config) core.RunnerSettings {
+	return core.RunnerSettings{
+		Limits: core.ResourceLimits{
+			CPUPercent:   cfg.Limits.CPUPercent,
+			MemoryBytes:  cfg.Limits.MemoryBytes,
+			MaxProcesses: cfg.Limits.MaxProcesses,
+		},
+		Retention: core.RetentionPolicy{
+			TTL:        cfg.Retention.JobTTL,
+			RemoveLogs: cfg.Retention.RemoveLogs,
+		},
+		Queue: core.QueueSettings{
+			MaxConcurrent: cfg.Queue.MaxConcurrent,
+			MaxPerOwner:   cfg.Queue.MaxPerOwner,
+			Policy:        core.QueuePolicy(cfg.Queue.Policy),
+		},
+		Shutdown: core.ShutdownSettings{
+			Mode:        core.ShutdownMode(cfg.Shutdown.Mode),
+			Timeout:     cfg.Shutdown.Timeout,
+			GracePeriod: cfg.Shutdown.GracePeriod,
+		},
+	}
+}
+
+func loadRolePolicy(cfg *config.Config) (auth.RolePolicy, error) {
+	if cfg.Authorization.RolePolicyFile == "" {
+		return auth.DefaultRolePolicy(), nil
+	}
+	return auth.LoadRolePolicy(cfg.Authorization.RolePolicyFile)
+}
+
+func loadCommandPolicy(cfg *config.Config) (auth.CommandPolicy, error) {
+	if cfg.Authorization.CommandPolicyFile == "" {
+		return auth.DefaultCommandPolicy(), nil
+	}
+	return auth.LoadCommandPolicy(cfg.Authorization.CommandPolicyFile)
+}
+
+func policy(cfg *config.Config) api.Policy {
+	return api.Policy{
+		PublicJobInfo:     cfg.Authorization.PublicJobInfo,
+		IdempotencyWindow: cfg.Idempotency.Window,
+	}
 }
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ItsMeWithTheFace/linux-process-runner/auth"
+	"github.com/ItsMeWithTheFace/linux-process-runner/ca"
+	"github.com/ItsMeWithTheFace/linux-process-runner/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type ServerTestSuite struct {
+	suite.Suite
+	dir       string
+	authority *ca.Authority
+	cfg       *config.Config
+}
+
+func (suite *ServerTestSuite) SetupTest() {
+	dir, err := ioutil.TempDir("", "server")
+	suite.Require().NoError(err)
+	suite.dir = dir
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	suite.Require().NoError(err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	suite.Require().NoError(err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	suite.Require().NoError(err)
+
+	certPath := filepath.Join(dir, "ca.pem")
+	keyPath := filepath.Join(dir, "ca.key")
+	suite.Require().NoError(ioutil.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	suite.Require().NoError(ioutil.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600))
+
+	suite.authority, err = ca.LoadAuthority(certPath, keyPath, filepath.Join(dir, "state"), time.Hour)
+	suite.Require().NoError(err)
+	suite.cfg = config.Default()
+	suite.cfg.TLS.CA = certPath
+}
+
+func (suite *ServerTestSuite) TearDownTest() {
+	os.RemoveAll(suite.dir)
+}
+
+// enroll issues a certificate for name from the built-in CA and returns its
+// serial and the parsed certificate.
+func (suite *ServerTestSuite) enroll(name string) (string, *x509.Certificate) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	suite.Require().NoError(err)
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject: pkix.Name{CommonName: name},
+	}, key)
+	suite.Require().NoError(err)
+
+	token, _, err := suite.authority.CreateToken(name, "", time.Hour)
+	suite.Require().NoError(err)
+	req, err := suite.authority.Submit(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der}), token)
+	suite.Require().NoError(err)
+
+	block, _ := pem.Decode(req.Certificate)
+	suite.Require().NotNil(block)
+	crt, err := x509.ParseCertificate(block.Bytes)
+	suite.Require().NoError(err)
+	return req.Serial, crt
+}
+
+func (suite *ServerTestSuite) TestReloadKeepsBuiltInCRL() {
+	serial, crt := suite.enroll("alice")
+	suite.Require().NoError(suite.authority.Revoke(serial))
+
+	revocations, err := auth.NewRevocationChecker(suite.cfg.TLS.CA, crlPaths(suite.cfg, suite.authority))
+	suite.Require().NoError(err)
+	suite.Require().True(revocations.IsRevoked(crt))
+
+	suite.Require().NoError(reloadRevocations(revocations, suite.cfg, suite.authority))
+	assert.True(suite.T(), revocations.IsRevoked(crt), "a certificate revoked by the built-in CA should stay revoked after a reload")
+}
+
+func TestServerTestSuite(t *testing.T) {
+	suite.Run(t, new(ServerTestSuite))
+}
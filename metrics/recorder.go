@@ -0,0 +1,29 @@
+package metrics
+
+import "time"
+
+// Recorder receives measurements from the job runner and the API.
+type Recorder interface {
+	// JobStarted is called once a job's process has started.
+	JobStarted(owner string)
+	// JobStopped is called when a job is stopped on request.
+	JobStopped(owner string)
+	// JobFinished is called once a job's process has exited, with the state
+	// it ended in.
+	JobFinished(owner string, state string, duration time.Duration)
+	// LogBytesWritten is called as job output is written to its log.
+	LogBytesWritten(n int)
+	// StreamStarted and StreamFinished bracket every output stream.
+	StreamStarted()
+	StreamFinished()
+}
+
+// Nop discards every measurement. It is used when metrics are disabled.
+type Nop struct{}
+
+func (Nop) JobStarted(string)                         {}
+func (Nop) JobStopped(string)                         {}
+func (Nop) JobFinished(string, string, time.Duration) {}
+func (Nop) LogBytesWritten(int)                       {}
+func (Nop) StreamStarted()                            {}
+func (Nop) StreamFinished()                           {}
@@ -0,0 +1,178 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+const namespace = "linux_process_runner"
+
+// Registry records measurements in memory and serves them in the Prometheus
+// text exposition format.
+type Registry struct {
+	mu         *sync.Mutex
+	collectors []collector
+
+	jobStarts     *valueVec
+	jobStops      *valueVec
+	jobFailures   *valueVec
+	jobDurations  *histogramVec
+	logBytes      *valueVec
+	activeStreams *valueVec
+
+	rpcsStarted  *valueVec
+	rpcsHandled  *valueVec
+	rpcDurations *histogramVec
+}
+
+// NewRegistry creates a Registry with every job, stream and gRPC metric.
+func NewRegistry() *Registry {
+	r := &Registry{
+		mu: &sync.Mutex{},
+
+		jobStarts:     newValueVec(namespace+"_job_starts_total", "Jobs whose process was started.", "counter", "owner"),
+		jobStops:      newValueVec(namespace+"_job_stops_total", "Jobs stopped on request.", "counter", "owner"),
+		jobFailures:   newValueVec(namespace+"_job_failures_total", "Jobs that failed to start or exited with an error.", "counter", "owner"),
+		jobDurations:  newHistogramVec(namespace+"_job_duration_seconds", "Time from a job starting until its process exited.", DefaultBuckets, "state"),
+		logBytes:      newValueVec(namespace+"_log_bytes_written_total", "Bytes of job output written to logs.", "counter"),
+		activeStreams: newValueVec(namespace+"_active_streams", "Output streams currently open.", "gauge"),
+
+		rpcsStarted:  newValueVec("grpc_server_started_total", "RPCs started on the server.", "counter", "grpc_type", "grpc_service", "grpc_method"),
+		rpcsHandled:  newValueVec("grpc_server_handled_total", "RPCs completed on the server, regardless of success or failure.", "counter", "grpc_type", "grpc_service", "grpc_method", "grpc_code"),
+		rpcDurations: newHistogramVec("grpc_server_handling_seconds", "Time taken to handle RPCs.", DefaultBuckets, "grpc_type", "grpc_service", "grpc_method"),
+	}
+
+	r.collectors = []collector{
+		r.jobStarts, r.jobStops, r.jobFailures, r.jobDurations, r.logBytes, r.activeStreams,
+		r.rpcsStarted, r.rpcsHandled, r.rpcDurations,
+	}
+	return r
+}
+
+// GaugeFunc adds a gauge whose values are read from f on every scrape. f
+// returns the gauge's value for each value of label.
+func (r *Registry) GaugeFunc(name string, help string, label string, f func() map[string]float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.collectors = append(r.collectors, &gaugeFunc{name: namespace + "_" + name, help: help, label: label, f: f})
+}
+
+// JobStarted counts a job start for owner.
+func (r *Registry) JobStarted(owner string) {
+	r.jobStarts.add(1, owner)
+}
+
+// JobStopped counts a stop request for owner's job.
+func (r *Registry) JobStopped(owner string) {
+	r.jobStops.add(1, owner)
+}
+
+// JobFinished records how long a job ran and counts it as a failure if it
+// ended in an error.
+func (r *Registry) JobFinished(owner string, state string, duration time.Duration) {
+	if state == "error" {
+		r.jobFailures.add(1, owner)
+	}
+	r.jobDurations.observe(duration.Seconds(), state)
+}
+
+// LogBytesWritten counts bytes of job output.
+func (r *Registry) LogBytesWritten(n int) {
+	r.logBytes.add(float64(n))
+}
+
+// StreamStarted counts an opened output stream.
+func (r *Registry) StreamStarted() {
+	r.activeStreams.add(1)
+}
+
+// StreamFinished counts a closed output stream.
+func (r *Registry) StreamFinished() {
+	r.activeStreams.add(-1)
+}
+
+// ServeHTTP writes every metric in the Prometheus text format.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	collectors := append([]collector{}, r.collectors...)
+	r.mu.Unlock()
+
+	var buf bytes.Buffer
+	for _, c := range collectors {
+		if err := c.write(&buf); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		log.Printf("failed to write metrics: %v", err)
+	}
+}
+
+// UnaryInterceptor counts and times unary RPCs.
+func (r *Registry) UnaryInterceptor(
+	ctx context.Context,
+	req interface{},
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (interface{}, error) {
+	done := r.startRPC("unary", info.FullMethod)
+	resp, err := handler(ctx, req)
+	done(err)
+	return resp, err
+}
+
+// StreamInterceptor counts and times streaming RPCs.
+func (r *Registry) StreamInterceptor(
+	srv interface{},
+	stream grpc.ServerStream,
+	info *grpc.StreamServerInfo,
+	handler grpc.StreamHandler,
+) error {
+	kind := "server_stream"
+	if info.IsClientStream {
+		kind = "bidi_stream"
+		if !info.IsServerStream {
+			kind = "client_stream"
+		}
+	}
+
+	done := r.startRPC(kind, info.FullMethod)
+	err := handler(srv, stream)
+	done(err)
+	return err
+}
+
+func (r *Registry) startRPC(kind string, fullMethod string) func(error) {
+	service, method := splitMethod(fullMethod)
+	r.rpcsStarted.add(1, kind, service, method)
+	start := time.Now()
+
+	return func(err error) {
+		s, ok := status.FromError(err)
+		if !ok {
+			s = status.FromContextError(err)
+		}
+		r.rpcsHandled.add(1, kind, service, method, s.Code().String())
+		r.rpcDurations.observe(time.Since(start).Seconds(), kind, service, method)
+	}
+}
+
+// splitMethod splits "/Service/Method" into its service and method names.
+func splitMethod(fullMethod string) (string, string) {
+	parts := strings.SplitN(strings.TrimPrefix(fullMethod, "/"), "/", 2)
+	if len(parts) != 2 {
+		return "unknown", "unknown"
+	}
+	return parts[0], parts[1]
+}
@@ -0,0 +1,113 @@
+package metrics
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type RegistryTestSuite struct {
+	suite.Suite
+	registry *Registry
+}
+
+func (suite *RegistryTestSuite) SetupTest() {
+	suite.registry = NewRegistry()
+}
+
+func (suite *RegistryTestSuite) scrape() string {
+	rec := httptest.NewRecorder()
+	suite.registry.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Equal(suite.T(), 200, rec.Code)
+	assert.Contains(suite.T(), rec.Header().Get("Content-Type"), "text/plain; version=0.0.4")
+	return rec.Body.String()
+}
+
+func (suite *RegistryTestSuite) TestJobMetrics() {
+	suite.registry.JobStarted("alice@CN=ca")
+	suite.registry.JobStarted("alice@CN=ca")
+	suite.registry.JobStarted(`bob "the builder"@CN=ca`)
+	suite.registry.JobStopped("alice@CN=ca")
+	suite.registry.JobFinished("alice@CN=ca", "error", 2*time.Second)
+	suite.registry.JobFinished("alice@CN=ca", "completed", 20*time.Millisecond)
+	suite.registry.LogBytesWritten(512)
+	suite.registry.StreamStarted()
+	suite.registry.StreamStarted()
+	suite.registry.StreamFinished()
+
+	out := suite.scrape()
+	for _, line := range []string{
+		"# TYPE linux_process_runner_job_starts_total counter",
+		`linux_process_runner_job_starts_total{owner="alice@CN=ca"} 2`,
+		`linux_process_runner_job_starts_total{owner="bob \"the builder\"@CN=ca"} 1`,
+		`linux_process_runner_job_stops_total{owner="alice@CN=ca"} 1`,
+		`linux_process_runner_job_failures_total{owner="alice@CN=ca"} 1`,
+		"# TYPE linux_process_runner_job_duration_seconds histogram",
+		`linux_process_runner_job_duration_seconds_bucket{state="error",le="1"} 0`,
+		`linux_process_runner_job_duration_seconds_bucket{state="error",le="2.5"} 1`,
+		`linux_process_runner_job_duration_seconds_bucket{state="error",le="+Inf"} 1`,
+		`linux_process_runner_job_duration_seconds_sum{state="error"} 2`,
+		`linux_process_runner_job_duration_seconds_count{state="completed"} 1`,
+		"linux_process_runner_log_bytes_written_total 512",
+		"linux_process_runner_active_streams 1",
+	} {
+		assert.Contains(suite.T(), out, line+"\n")
+	}
+}
+
+func (suite *RegistryTestSuite) TestGaugeFunc() {
+	suite.registry.GaugeFunc("jobs", "Jobs by state.", "state", func() map[string]float64 {
+		return map[string]float64{"running": 3, "completed": 1}
+	})
+
+	out := suite.scrape()
+	assert.Contains(suite.T(), out, "# TYPE linux_process_runner_jobs gauge\n")
+	assert.Contains(suite.T(), out, "linux_process_runner_jobs{state=\"completed\"} 1\nlinux_process_runner_jobs{state=\"running\"} 3\n",
+		"values should be sorted by label")
+}
+
+func (suite *RegistryTestSuite) TestInterceptors() {
+	info := &grpc.UnaryServerInfo{FullMethod: "/JobRunnerService/StartJob"}
+	suite.registry.UnaryInterceptor(context.Background(), nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, nil
+	})
+	suite.registry.UnaryInterceptor(context.Background(), nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, status.Error(codes.PermissionDenied, "denied")
+	})
+
+	streamInfo := &grpc.StreamServerInfo{FullMethod: "/JobRunnerService/StreamJobOutput", IsServerStream: true}
+	suite.registry.StreamInterceptor(nil, nil, streamInfo, func(srv interface{}, stream grpc.ServerStream) error {
+		return context.Canceled
+	})
+
+	out := suite.scrape()
+	for _, line := range []string{
+		`grpc_server_started_total{grpc_type="unary",grpc_service="JobRunnerService",grpc_method="StartJob"} 2`,
+		`grpc_server_handled_total{grpc_type="unary",grpc_service="JobRunnerService",grpc_method="StartJob",grpc_code="OK"} 1`,
+		`grpc_server_handled_total{grpc_type="unary",grpc_service="JobRunnerService",grpc_method="StartJob",grpc_code="PermissionDenied"} 1`,
+		`grpc_server_handled_total{grpc_type="server_stream",grpc_service="JobRunnerService",grpc_method="StreamJobOutput",grpc_code="Canceled"} 1`,
+		`grpc_server_handling_seconds_count{grpc_type="unary",grpc_service="JobRunnerService",grpc_method="StartJob"} 2`,
+	} {
+		assert.Contains(suite.T(), out, line+"\n")
+	}
+}
+
+func (suite *RegistryTestSuite) TestEmptyRegistry() {
+	out := suite.scrape()
+	assert.Contains(suite.T(), out, "linux_process_runner_active_streams 0\n", "unlabelled metrics should always be exposed")
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		assert.True(suite.T(), strings.HasPrefix(line, "#") || !strings.Contains(line, "owner="), "labelled metrics should only appear once observed")
+	}
+}
+
+func TestRegistryTestSuite(t *testing.T) {
+	suite.Run(t, new(RegistryTestSuite))
+}
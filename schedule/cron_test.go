@@ -0,0 +1,71 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type CronTestSuite struct {
+	suite.Suite
+}
+
+func (suite *CronTestSuite) TestNext() {
+	// a Wednesday
+	from := time.Date(2021, time.November, 3, 10, 17, 30, 0, time.UTC)
+
+	cases := []struct {
+		expr string
+		want time.Time
+	}{
+		{"* * * * *", time.Date(2021, time.November, 3, 10, 18, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2021, time.November, 3, 10, 30, 0, 0, time.UTC)},
+		{"0 2 * * *", time.Date(2021, time.November, 4, 2, 0, 0, 0, time.UTC)},
+		{"@daily", time.Date(2021, time.November, 4, 0, 0, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2021, time.November, 3, 11, 0, 0, 0, time.UTC)},
+		{"30 9 * * mon-fri", time.Date(2021, time.November, 4, 9, 30, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2021, time.November, 7, 0, 0, 0, 0, time.UTC)},
+		{"0 0 1 jan,jul *", time.Date(2022, time.January, 1, 0, 0, 0, 0, time.UTC)},
+		{"5/20 10 * * *", time.Date(2021, time.November, 3, 10, 25, 0, 0, time.UTC)},
+		// both day fields restricted: the 15th or any Friday
+		{"0 0 15 * fri", time.Date(2021, time.November, 5, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2024, time.February, 29, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tc := range cases {
+		c, err := ParseCron(tc.expr)
+		suite.Require().NoError(err, tc.expr)
+		assert.Equal(suite.T(), tc.want, c.Next(from), tc.expr)
+	}
+}
+
+func (suite *CronTestSuite) TestNeverMatches() {
+	c, err := ParseCron("0 0 30 2 *")
+	suite.Require().NoError(err)
+	assert.True(suite.T(), c.Next(time.Now()).IsZero(), "February 30th never comes")
+}
+
+func (suite *CronTestSuite) TestInvalid() {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"* * * foo *",
+		"@fortnightly",
+	} {
+		_, err := ParseCron(expr)
+		assert.Error(suite.T(), err, expr)
+	}
+}
+
+func TestCronTestSuite(t *testing.T) {
+	suite.Run(t, new(CronTestSuite))
+}
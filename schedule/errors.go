@@ -0,0 +1,17 @@
+package schedule
+
+import "fmt"
+
+type ErrNotFound struct{}
+
+type ErrInvalidSchedule struct {
+	reason string
+}
+
+func (e *ErrNotFound) Error() string {
+	return fmt.Sprintf("schedule not found")
+}
+
+func (e *ErrInvalidSchedule) Error() string {
+	return fmt.Sprintf("invalid schedule: %s", e.reason)
+}
@@ -0,0 +1,352 @@
+package schedule
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ItsMeWithTheFace/linux-process-runner/core"
+	"github.com/google/uuid"
+)
+
+const stateFile = "schedules.json"
+
+// TickInterval is how often the scheduler checks for schedules that are due.
+const TickInterval = time.Second
+
+// OverlapPolicy decides what happens when a schedule is due while jobs it
+// started earlier are still running.
+type OverlapPolicy int32
+
+const (
+	// OverlapAllow starts another job alongside the running ones.
+	OverlapAllow OverlapPolicy = iota
+	// OverlapSkip skips the run.
+	OverlapSkip
+	// OverlapReplace stops the running jobs and starts a new one.
+	OverlapReplace
+)
+
+// Schedule starts a job from a template every time its cron expression
+// matches. The jobs belong to the schedule's owner.
+type Schedule struct {
+	Id        string        `json:"id"`
+	Owner     string        `json:"owner"`
+	Cron      string        `json:"cron"`
+	Command   string        `json:"command"`
+	Args      []string      `json:"args,omitempty"`
+	Overlap   OverlapPolicy `json:"overlap"`
+	Paused    bool          `json:"paused"`
+	CreatedAt time.Time     `json:"created_at"`
+	LastRunAt time.Time     `json:"last_run_at,omitempty"`
+	LastJobId string        `json:"last_job_id,omitempty"`
+	// OwnerRole is the role the owner's certificate named when the schedule
+	// was created, so that the owner's role can be worked out again on every
+	// run.
+	OwnerRole string `json:"owner_role,omitempty"`
+	// JobIds are the jobs the schedule started that were still running the
+	// last time it was due.
+	JobIds []string `json:"job_ids,omitempty"`
+
+	// NextRunAt is worked out from the cron expression when the schedule is
+	// loaded, runs missed while the server was down are not caught up on.
+	NextRunAt time.Time `json:"-"`
+	cron      *Cron
+}
+
+// RunCheck decides whether a schedule may still start its job. It is called
+// on every run, so that a schedule whose owner has since lost the right to
+// run its command is skipped.
+type RunCheck func(sch Schedule) error
+
+// Scheduler starts jobs for every schedule that is due and persists the
+// schedules in a directory.
+type Scheduler struct {
+	jr    *core.JobRunner
+	dir   string
+	now   func() time.Time
+	check RunCheck
+
+	mu        *sync.Mutex
+	schedules map[string]*Schedule
+}
+
+// SchedulerOption configures a Scheduler.
+type SchedulerOption func(*Scheduler)
+
+// WithRunCheck checks every run with check before its job is started.
+func WithRunCheck(check RunCheck) SchedulerOption {
+	return func(s *Scheduler) {
+		s.check = check
+	}
+}
+
+// Load creates a scheduler that starts jobs through jr, with any schedules
+// saved in dir by a previous run.
+func Load(jr *core.JobRunner, dir string, opts ...SchedulerOption) (*Scheduler, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	s := &Scheduler{
+		jr:        jr,
+		dir:       dir,
+		now:       time.Now,
+		mu:        &sync.Mutex{},
+		schedules: make(map[string]*Schedule),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	b, err := ioutil.ReadFile(filepath.Join(dir, stateFile))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err == nil {
+		if err := json.Unmarshal(b, &s.schedules); err != nil {
+			return nil, fmt.Errorf("reading schedules: %w", err)
+		}
+	}
+
+	now := s.now()
+	for id, sch := range s.schedules {
+		if sch.cron, err = ParseCron(sch.Cron); err != nil {
+			return nil, fmt.Errorf("schedule %s: %w", id, err)
+		}
+		sch.NextRunAt = sch.cron.Next(now)
+	}
+
+	return s, nil
+}
+
+// Create adds a schedule for owner that runs command with args. ownerRole
+// is the role the owner's certificate named, if any.
+func (s *Scheduler) Create(owner string, ownerRole string, cron string, command string, args []string, overlap OverlapPolicy) (Schedule, error) {
+	parsed, err := ParseCron(cron)
+	if err != nil {
+		return Schedule{}, &ErrInvalidSchedule{reason: err.Error()}
+	}
+	if command == "" {
+		return Schedule{}, &ErrInvalidSchedule{reason: "a command is required"}
+	}
+	if overlap < OverlapAllow || overlap > OverlapReplace {
+		return Schedule{}, &ErrInvalidSchedule{reason: fmt.Sprintf("unknown overlap policy %d", overlap)}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	sch := &Schedule{
+		Id:        uuid.NewString(),
+		Owner:     owner,
+		OwnerRole: ownerRole,
+		Cron:      cron,
+		Command:   command,
+		Args:      args,
+		Overlap:   overlap,
+		CreatedAt: now,
+		NextRunAt: parsed.Next(now),
+		cron:      parsed,
+	}
+	s.schedules[sch.Id] = sch
+
+	if err := s.save(); err != nil {
+		delete(s.schedules, sch.Id)
+		return Schedule{}, err
+	}
+	return sch.copy(), nil
+}
+
+// Get returns a schedule.
+func (s *Scheduler) Get(id string) (Schedule, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sch, ok := s.schedules[id]
+	if !ok {
+		return Schedule{}, &ErrNotFound{}
+	}
+	return sch.copy(), nil
+}
+
+// List returns every schedule, oldest first.
+func (s *Scheduler) List() []Schedule {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	out := make([]Schedule, 0, len(s.schedules))
+	for _, sch := range s.schedules {
+		out = append(out, sch.copy())
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.Before(out[j].CreatedAt) })
+	return out
+}
+
+// Delete removes a schedule. Jobs it already started keep running.
+func (s *Scheduler) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sch, ok := s.schedules[id]
+	if !ok {
+		return &ErrNotFound{}
+	}
+	delete(s.schedules, id)
+
+	if err := s.save(); err != nil {
+		s.schedules[id] = sch
+		return err
+	}
+	return nil
+}
+
+// SetPaused pauses or resumes a schedule. A resumed schedule next runs the
+// next time its expression matches, runs missed while paused are skipped.
+func (s *Scheduler) SetPaused(id string, paused bool) (Schedule, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sch, ok := s.schedules[id]
+	if !ok {
+		return Schedule{}, &ErrNotFound{}
+	}
+	if sch.Paused == paused {
+		return sch.copy(), nil
+	}
+
+	sch.Paused = paused
+	if !paused {
+		sch.NextRunAt = sch.cron.Next(s.now())
+	}
+
+	if err := s.save(); err != nil {
+		sch.Paused = !paused
+		return Schedule{}, err
+	}
+	return sch.copy(), nil
+}
+
+// Run starts the jobs of due schedules until ctx is done.
+func (s *Scheduler) Run(ctx context.Context) {
+	ticker := time.NewTicker(TickInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.runDue(s.now())
+		}
+	}
+}
+
+// runDue starts a job for every schedule that was due at or before now.
+func (s *Scheduler) runDue(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ran := false
+	for _, sch := range s.schedules {
+		if sch.Paused || sch.NextRunAt.IsZero() || sch.NextRunAt.After(now) {
+			continue
+		}
+		s.run(sch, now)
+		sch.NextRunAt = sch.cron.Next(now)
+		ran = true
+	}
+
+	if ran {
+		if err := s.save(); err != nil {
+			log.Printf("schedules: could not save: %s", err.Error())
+		}
+	}
+}
+
+// run starts a schedule's job, applying its overlap policy to the jobs it
+// started before. Callers must hold s.mu.
+func (s *Scheduler) run(sch *Schedule, now time.Time) {
+	if s.check != nil {
+		if err := s.check(sch.copy()); err != nil {
+			log.Printf("schedule %s: skipped, %s", sch.Id, err.Error())
+			return
+		}
+	}
+
+	var running []string
+	for _, id := range sch.JobIds {
+		if job, err := s.jr.GetJob(id); err == nil && !job.State.IsTerminal() {
+			running = append(running, id)
+		}
+	}
+	sch.JobIds = running
+
+	if len(running) > 0 {
+		switch sch.Overlap {
+		case OverlapSkip:
+			log.Printf("schedule %s: skipped, %d job(s) still running", sch.Id, len(running))
+			return
+		case OverlapReplace:
+			for _, id := range running {
+				if err := s.jr.StopJob(id); err != nil {
+					log.Printf("schedule %s: could not stop job %s: %s", sch.Id, id, err.Error())
+				}
+			}
+			sch.JobIds = nil
+		}
+	}
+
+	job := s.jr.CreateJob(uuid.NewString(), sch.Owner, exec.Command(sch.Command, sch.Args...))
+	if err := s.jr.SubmitJob(job, 0); err != nil {
+		log.Printf("schedule %s: could not start job: %s", sch.Id, err.Error())
+		return
+	}
+
+	sch.LastRunAt = now
+	sch.LastJobId = job.Id
+	sch.JobIds = append(sch.JobIds, job.Id)
+}
+
+// save persists every schedule. Callers must hold s.mu.
+func (s *Scheduler) save() error {
+	b, err := json.MarshalIndent(s.schedules, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(s.dir, stateFile), b)
+}
+
+func (sch *Schedule) copy() Schedule {
+	out := *sch
+	out.Args = append([]string(nil), sch.Args...)
+	out.JobIds = append([]string(nil), sch.JobIds...)
+	return out
+}
+
+// writeFileAtomic replaces path with b so that readers never see a partial file.
+func writeFileAtomic(path string, b []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,183 @@
+package schedule
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ItsMeWithTheFace/linux-process-runner/core"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type SchedulerTestSuite struct {
+	suite.Suite
+	dir       string
+	jr        *core.JobRunner
+	scheduler *Scheduler
+}
+
+func (suite *SchedulerTestSuite) SetupTest() {
+	var err error
+	suite.dir, err = ioutil.TempDir("", "schedules")
+	suite.Require().NoError(err)
+
+	logDir, err := ioutil.TempDir(suite.dir, "logs")
+	suite.Require().NoError(err)
+	suite.jr = core.InitializeJobRunner(core.InitializeInMemoryJobStore(), core.WithLogDir(logDir))
+
+	suite.scheduler, err = Load(suite.jr, suite.dir)
+	suite.Require().NoError(err)
+}
+
+func (suite *SchedulerTestSuite) TearDownTest() {
+	for _, sch := range suite.scheduler.List() {
+		for _, id := range sch.JobIds {
+			suite.waitForRunning(id)
+			suite.jr.StopJob(id)
+		}
+	}
+	os.RemoveAll(suite.dir)
+}
+
+func (suite *SchedulerTestSuite) waitForRunning(id string) {
+	suite.Require().Eventually(func() bool {
+		job, _ := suite.jr.GetJob(id)
+		return job.State != core.Created && job.State != core.Queued
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func (suite *SchedulerTestSuite) TestPersistence() {
+	sch, err := suite.scheduler.Create("alice@CN=ca", "", "@daily", "echo", []string{"hi"}, OverlapSkip)
+	suite.Require().NoError(err)
+	_, err = suite.scheduler.SetPaused(sch.Id, true)
+	suite.Require().NoError(err)
+
+	reloaded, err := Load(suite.jr, suite.dir)
+	suite.Require().NoError(err)
+	got, err := reloaded.Get(sch.Id)
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), "alice@CN=ca", got.Owner)
+	assert.Equal(suite.T(), []string{"hi"}, got.Args)
+	assert.Equal(suite.T(), OverlapSkip, got.Overlap)
+	assert.True(suite.T(), got.Paused)
+	assert.False(suite.T(), got.NextRunAt.IsZero())
+
+	suite.Require().NoError(reloaded.Delete(sch.Id))
+	reloaded, err = Load(suite.jr, suite.dir)
+	suite.Require().NoError(err)
+	assert.Empty(suite.T(), reloaded.List())
+}
+
+func (suite *SchedulerTestSuite) TestInvalid() {
+	_, err := suite.scheduler.Create("alice@CN=ca", "", "every day", "echo", nil, OverlapAllow)
+	assert.IsType(suite.T(), &ErrInvalidSchedule{}, err)
+	_, err = suite.scheduler.Create("alice@CN=ca", "", "@daily", "", nil, OverlapAllow)
+	assert.IsType(suite.T(), &ErrInvalidSchedule{}, err)
+	_, err = suite.scheduler.Create("alice@CN=ca", "", "@daily", "echo", nil, OverlapPolicy(7))
+	assert.IsType(suite.T(), &ErrInvalidSchedule{}, err)
+	assert.IsType(suite.T(), &ErrNotFound{}, suite.scheduler.Delete("missing"))
+}
+
+// due creates a schedule and makes it due at the returned time.
+func (suite *SchedulerTestSuite) due(overlap OverlapPolicy) (Schedule, time.Time) {
+	sch, err := suite.scheduler.Create("alice@CN=ca", "", "* * * * *", "sleep", []string{"10"}, overlap)
+	suite.Require().NoError(err)
+	return sch, sch.NextRunAt
+}
+
+func (suite *SchedulerTestSuite) TestRunsJobsAsOwner() {
+	sch, at := suite.due(OverlapAllow)
+
+	suite.scheduler.runDue(at.Add(-time.Second))
+	sch, _ = suite.scheduler.Get(sch.Id)
+	assert.Empty(suite.T(), sch.LastJobId, "nothing should run before the schedule is due")
+
+	suite.scheduler.runDue(at)
+	sch, _ = suite.scheduler.Get(sch.Id)
+	suite.Require().NotEmpty(sch.LastJobId)
+	assert.Equal(suite.T(), at, sch.LastRunAt)
+	assert.Equal(suite.T(), at.Add(time.Minute), sch.NextRunAt)
+
+	job, err := suite.jr.GetJob(sch.LastJobId)
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), "alice@CN=ca", job.Owner)
+	assert.Equal(suite.T(), []string{"sleep", "10"}, job.Cmd.Args)
+}
+
+func (suite *SchedulerTestSuite) TestOverlapAllow() {
+	sch, at := suite.due(OverlapAllow)
+	suite.scheduler.runDue(at)
+	suite.scheduler.runDue(at.Add(time.Minute))
+
+	sch, _ = suite.scheduler.Get(sch.Id)
+	assert.Len(suite.T(), sch.JobIds, 2, "both jobs should run")
+}
+
+func (suite *SchedulerTestSuite) TestOverlapSkip() {
+	sch, at := suite.due(OverlapSkip)
+	suite.scheduler.runDue(at)
+	first, _ := suite.scheduler.Get(sch.Id)
+	suite.waitForRunning(first.LastJobId)
+
+	suite.scheduler.runDue(at.Add(time.Minute))
+	sch, _ = suite.scheduler.Get(sch.Id)
+	assert.Equal(suite.T(), first.LastJobId, sch.LastJobId, "the run should be skipped")
+	assert.Equal(suite.T(), at.Add(2*time.Minute), sch.NextRunAt, "a skipped run still counts as due")
+}
+
+func (suite *SchedulerTestSuite) TestOverlapReplace() {
+	sch, at := suite.due(OverlapReplace)
+	suite.scheduler.runDue(at)
+	first, _ := suite.scheduler.Get(sch.Id)
+	suite.waitForRunning(first.LastJobId)
+
+	suite.scheduler.runDue(at.Add(time.Minute))
+	sch, _ = suite.scheduler.Get(sch.Id)
+	assert.NotEqual(suite.T(), first.LastJobId, sch.LastJobId)
+	assert.Equal(suite.T(), []string{sch.LastJobId}, sch.JobIds)
+
+	job, _ := suite.jr.GetJob(first.LastJobId)
+	assert.Equal(suite.T(), core.JobState(core.Stopped), job.State, "the old job should be replaced")
+}
+
+func (suite *SchedulerTestSuite) TestPaused() {
+	sch, at := suite.due(OverlapAllow)
+	_, err := suite.scheduler.SetPaused(sch.Id, true)
+	suite.Require().NoError(err)
+
+	suite.scheduler.runDue(at)
+	sch, _ = suite.scheduler.Get(sch.Id)
+	assert.Empty(suite.T(), sch.LastJobId, "paused schedules should not run")
+}
+
+func (suite *SchedulerTestSuite) TestRunCheck() {
+	var denied error
+	var checked []Schedule
+	scheduler, err := Load(suite.jr, suite.dir, WithRunCheck(func(sch Schedule) error {
+		checked = append(checked, sch)
+		return denied
+	}))
+	suite.Require().NoError(err)
+	suite.scheduler = scheduler
+
+	sch, at := suite.due(OverlapAllow)
+	denied = errors.New("command is no longer allowed")
+	suite.scheduler.runDue(at)
+	suite.Require().Len(checked, 1)
+	assert.Equal(suite.T(), sch.Id, checked[0].Id)
+	sch, _ = suite.scheduler.Get(sch.Id)
+	assert.Empty(suite.T(), sch.LastJobId, "a denied run should be skipped")
+	assert.Equal(suite.T(), at.Add(time.Minute), sch.NextRunAt, "a denied run still counts as due")
+
+	denied = nil
+	suite.scheduler.runDue(at.Add(time.Minute))
+	sch, _ = suite.scheduler.Get(sch.Id)
+	assert.NotEmpty(suite.T(), sch.LastJobId, "the schedule should run once it's allowed again")
+}
+
+func TestSchedulerTestSuite(t *testing.T) {
+	suite.Run(t, new(SchedulerTestSuite))
+}
@@ -0,0 +1,150 @@
+"use strict";
+
+// AnsiRenderer appends terminal output to an element, turning ANSI SGR
+// escape sequences into styled spans and dropping every other escape
+// sequence. Text is only ever added as text nodes, never as HTML.
+class AnsiRenderer {
+  constructor(target) {
+    this.target = target;
+    this.decoder = new TextDecoder();
+    // an escape sequence or UTF-8 character can be split across chunks
+    this.pending = "";
+    this.reset();
+  }
+
+  reset() {
+    this.fg = null;
+    this.bg = null;
+    this.bold = false;
+    this.dim = false;
+    this.italic = false;
+    this.underline = false;
+    this.strike = false;
+    this.inverse = false;
+  }
+
+  // write renders a chunk of output given as an ArrayBuffer.
+  write(chunk) {
+    const text = this.pending + this.decoder.decode(chunk, { stream: true });
+    this.pending = "";
+
+    let start = 0;
+    let i = 0;
+    while ((i = text.indexOf("\x1b", i)) !== -1) {
+      this.append(text.slice(start, i));
+
+      const rest = text.slice(i);
+      const m = AnsiRenderer.sequence.exec(rest);
+      if (m === null) {
+        if (AnsiRenderer.incomplete.test(rest) && rest.length < 256) {
+          this.pending = rest;
+          return;
+        }
+        // a lone escape, skip it
+        i++;
+        start = i;
+        continue;
+      }
+
+      if (m[2] === "m") {
+        this.sgr(m[1]);
+      }
+      i += m[0].length;
+      start = i;
+    }
+    this.append(text.slice(start));
+  }
+
+  sgr(params) {
+    const codes = params === "" ? [0] : params.split(/[;:]/).map((n) => parseInt(n || "0", 10));
+    for (let i = 0; i < codes.length; i++) {
+      const code = codes[i];
+      if (code === 0) this.reset();
+      else if (code === 1) this.bold = true;
+      else if (code === 2) this.dim = true;
+      else if (code === 3) this.italic = true;
+      else if (code === 4) this.underline = true;
+      else if (code === 7) this.inverse = true;
+      else if (code === 9) this.strike = true;
+      else if (code === 22) this.bold = this.dim = false;
+      else if (code === 23) this.italic = false;
+      else if (code === 24) this.underline = false;
+      else if (code === 27) this.inverse = false;
+      else if (code === 29) this.strike = false;
+      else if (code >= 30 && code <= 37) this.fg = AnsiRenderer.palette[code - 30];
+      else if (code === 39) this.fg = null;
+      else if (code >= 40 && code <= 47) this.bg = AnsiRenderer.palette[code - 40];
+      else if (code === 49) this.bg = null;
+      else if (code >= 90 && code <= 97) this.fg = AnsiRenderer.palette[code - 90 + 8];
+      else if (code >= 100 && code <= 107) this.bg = AnsiRenderer.palette[code - 100 + 8];
+      else if (code === 38 || code === 48) {
+        let color = null;
+        if (codes[i + 1] === 5 && i + 2 < codes.length) {
+          color = AnsiRenderer.color256(codes[i + 2]);
+          i += 2;
+        } else if (codes[i + 1] === 2 && i + 4 < codes.length) {
+          color = `rgb(${codes[i + 2] & 255}, ${codes[i + 3] & 255}, ${codes[i + 4] & 255})`;
+          i += 4;
+        }
+        if (code === 38) this.fg = color;
+        else this.bg = color;
+      }
+    }
+  }
+
+  append(text) {
+    if (text === "") {
+      return;
+    }
+
+    let fg = this.fg;
+    let bg = this.bg;
+    if (this.inverse) {
+      fg = this.bg || AnsiRenderer.background;
+      bg = this.fg || AnsiRenderer.foreground;
+    }
+
+    const classes = [];
+    if (this.bold) classes.push("ansi-bold");
+    if (this.dim) classes.push("ansi-dim");
+    if (this.italic) classes.push("ansi-italic");
+    if (this.underline) classes.push("ansi-underline");
+    if (this.strike) classes.push("ansi-strike");
+
+    if (fg === null && bg === null && classes.length === 0) {
+      this.target.appendChild(document.createTextNode(text));
+      return;
+    }
+
+    const span = document.createElement("span");
+    span.className = classes.join(" ");
+    if (fg !== null) span.style.color = fg;
+    if (bg !== null) span.style.backgroundColor = bg;
+    span.textContent = text;
+    this.target.appendChild(span);
+  }
+
+  static color256(n) {
+    if (n < 16) {
+      return AnsiRenderer.palette[n];
+    }
+    if (n < 232) {
+      const levels = [0, 95, 135, 175, 215, 255];
+      const i = n - 16;
+      return `rgb(${levels[Math.floor(i / 36)]}, ${levels[Math.floor(i / 6) % 6]}, ${levels[i % 6]})`;
+    }
+    const gray = 8 + 10 * (Math.min(n, 255) - 232);
+    return `rgb(${gray}, ${gray}, ${gray})`;
+  }
+}
+
+AnsiRenderer.foreground = "#e6edf3";
+AnsiRenderer.background = "#0d1117";
+AnsiRenderer.palette = [
+  "#484f58", "#ff7b72", "#3fb950", "#d29922", "#58a6ff", "#bc8cff", "#39c5cf", "#b1bac4",
+  "#6e7681", "#ffa198", "#56d364", "#e3b341", "#79c0ff", "#d2a8ff", "#56d4dd", "#ffffff",
+];
+// CSI sequences with their parameters and final byte, OSC sequences ended by
+// BEL or ST, and two byte escapes
+AnsiRenderer.sequence = /^\x1b(?:\[([0-9;:?<=>]*)[\x20-\x2f]*([\x40-\x7e])|\][^\x07\x1b]*(?:\x07|\x1b\\)|[\x40-\x5a\x5c-\x5f])/;
+AnsiRenderer.incomplete = /^\x1b(?:\[[0-9;:?<=>]*[\x20-\x2f]*|\][^\x07\x1b]*\x1b?)?$/;
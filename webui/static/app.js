@@ -0,0 +1,199 @@
+"use strict";
+
+// How often the job list and a job's details are refreshed.
+const refreshInterval = 2000;
+
+const terminalStates = ["STOPPED", "COMPLETED", "ERROR"];
+
+const listView = document.getElementById("list-view");
+const jobView = document.getElementById("job-view");
+const errorBox = document.getElementById("error");
+
+let timer = null;
+let socket = null;
+
+// request calls the gateway's JSON API, turning error statuses into
+// exceptions with the server's message.
+async function request(path) {
+  const resp = await fetch(path, { headers: { Accept: "application/json" } });
+  const body = await resp.json();
+  if (!resp.ok) {
+    throw new Error(body.message || resp.statusText);
+  }
+  return body;
+}
+
+function showError(err) {
+  errorBox.textContent = err ? err.message : "";
+  errorBox.hidden = !err;
+}
+
+function formatTime(seconds) {
+  return seconds ? new Date(Number(seconds) * 1000).toLocaleString() : "-";
+}
+
+function formatLabels(labels) {
+  const pairs = Object.entries(labels || {}).map(([k, v]) => `${k}=${v}`);
+  return pairs.length ? pairs.sort().join(", ") : "-";
+}
+
+function formatCommand(job) {
+  return [job.command].concat(job.arguments || []).join(" ");
+}
+
+function cell(row, text, className) {
+  const td = document.createElement("td");
+  td.textContent = text;
+  if (className) td.className = className;
+  row.appendChild(td);
+  return td;
+}
+
+function jobLink(job) {
+  return "#/jobs/" + encodeURIComponent(job.id);
+}
+
+// The job list.
+
+async function refreshList() {
+  const selector = document.getElementById("selector").value;
+  try {
+    const list = await request("/v1/jobs?selector=" + encodeURIComponent(selector));
+    const jobs = (list.jobs || []).reverse();
+    const tbody = document.getElementById("jobs");
+    tbody.replaceChildren();
+    for (const job of jobs) {
+      const row = document.createElement("tr");
+      row.addEventListener("click", () => { location.hash = jobLink(job); });
+      cell(row, job.name || "-");
+      cell(row, job.id);
+      const state = job.state || "CREATED";
+      cell(row, state.toLowerCase(), "state state-" + state.toLowerCase());
+      cell(row, job.owner);
+      cell(row, formatTime(job.created_at));
+      cell(row, formatLabels(job.labels));
+      cell(row, formatCommand(job), "command");
+      tbody.appendChild(row);
+    }
+    document.getElementById("empty").hidden = jobs.length > 0;
+    showError(null);
+  } catch (err) {
+    showError(err);
+  }
+}
+
+function showList() {
+  jobView.hidden = true;
+  listView.hidden = false;
+  document.title = "jobs - linux-process-runner";
+  refreshList();
+  timer = setInterval(refreshList, refreshInterval);
+}
+
+document.getElementById("filter").addEventListener("submit", (event) => {
+  event.preventDefault();
+  refreshList();
+});
+
+// A single job.
+
+function renderDetails(job) {
+  const state = job.state || "CREATED";
+  const details = [
+    ["ID", job.id],
+    ["Name", job.name || "-"],
+    ["Owner", job.owner],
+    ["State", state.toLowerCase()],
+    ["Command", formatCommand(job)],
+    ["Created", formatTime(job.created_at)],
+    ["Attempts", String((job.attempts || []).length)],
+    ["Labels", formatLabels(job.labels)],
+    ["Annotations", formatLabels(job.annotations)],
+  ];
+  if (job.failure_reason) details.push(["Failure", job.failure_reason]);
+  if (job.error) details.push(["Error", job.error]);
+
+  const dl = document.getElementById("job-details");
+  dl.replaceChildren();
+  for (const [name, value] of details) {
+    const dt = document.createElement("dt");
+    dt.textContent = name;
+    const dd = document.createElement("dd");
+    dd.textContent = value;
+    dl.append(dt, dd);
+  }
+
+  document.getElementById("job-title").textContent = job.name || job.id;
+  document.title = (job.name || job.id) + " - linux-process-runner";
+  return terminalStates.includes(state);
+}
+
+async function refreshJob(id) {
+  try {
+    const job = await request("/v1/jobs/" + encodeURIComponent(id));
+    if (renderDetails(job)) {
+      clearInterval(timer);
+    }
+    showError(null);
+  } catch (err) {
+    showError(err);
+  }
+}
+
+// tail streams a job's output over a WebSocket. Output arrives in binary
+// frames, and a text frame holds the error that ended the stream.
+function tail(id) {
+  const output = document.getElementById("output");
+  const status = document.getElementById("output-status");
+  output.replaceChildren();
+  const renderer = new AnsiRenderer(output);
+
+  const scheme = location.protocol === "https:" ? "wss://" : "ws://";
+  socket = new WebSocket(scheme + location.host + "/v1/jobs/" + encodeURIComponent(id) + "/output");
+  socket.binaryType = "arraybuffer";
+  status.textContent = "connecting";
+
+  socket.onopen = () => { status.textContent = "live"; };
+  socket.onmessage = (event) => {
+    if (typeof event.data === "string") {
+      showError(new Error(JSON.parse(event.data).message));
+      return;
+    }
+    const follow = output.scrollTop + output.clientHeight >= output.scrollHeight - 4;
+    renderer.write(event.data);
+    if (follow) {
+      output.scrollTop = output.scrollHeight;
+    }
+  };
+  socket.onclose = () => { status.textContent = "ended"; };
+}
+
+function showJob(id) {
+  listView.hidden = true;
+  jobView.hidden = false;
+  document.getElementById("job-details").replaceChildren();
+  refreshJob(id);
+  timer = setInterval(() => refreshJob(id), refreshInterval);
+  tail(id);
+}
+
+// Routing, a job's page is #/jobs/ID so that it can be shared.
+
+function route() {
+  clearInterval(timer);
+  if (socket !== null) {
+    socket.close();
+    socket = null;
+  }
+  showError(null);
+
+  const m = location.hash.match(/^#\/jobs\/(.+)$/);
+  if (m) {
+    showJob(decodeURIComponent(m[1]));
+  } else {
+    showList();
+  }
+}
+
+window.addEventListener("hashchange", route);
+route();
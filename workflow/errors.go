@@ -0,0 +1,17 @@
+package workflow
+
+import "fmt"
+
+type ErrNotFound struct{}
+
+type ErrInvalidWorkflow struct {
+	reason string
+}
+
+func (e *ErrNotFound) Error() string {
+	return fmt.Sprintf("workflow not found")
+}
+
+func (e *ErrInvalidWorkflow) Error() string {
+	return fmt.Sprintf("invalid workflow: %s", e.reason)
+}
@@ -0,0 +1,233 @@
+package workflow
+
+import (
+	"context"
+	"log"
+	"os/exec"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ItsMeWithTheFace/linux-process-runner/core"
+	"github.com/google/uuid"
+)
+
+// PollInterval is how often the orchestrator checks on the jobs of running
+// workflows.
+const PollInterval = 250 * time.Millisecond
+
+// Orchestrator runs the steps of workflows as jobs, each once the steps it
+// depends on have finished.
+type Orchestrator struct {
+	jr  *core.JobRunner
+	now func() time.Time
+
+	mu        *sync.Mutex
+	workflows map[string]*Workflow
+}
+
+// InitializeOrchestrator creates an orchestrator that starts jobs through jr.
+func InitializeOrchestrator(jr *core.JobRunner) *Orchestrator {
+	return &Orchestrator{
+		jr:        jr,
+		now:       time.Now,
+		mu:        &sync.Mutex{},
+		workflows: make(map[string]*Workflow),
+	}
+}
+
+// Submit validates a workflow for owner and starts the steps that don't
+// depend on any others.
+func (o *Orchestrator) Submit(owner string, name string, steps []StepSpec) (Workflow, error) {
+	if err := validate(steps); err != nil {
+		return Workflow{}, err
+	}
+
+	wf := &Workflow{
+		Id:        uuid.NewString(),
+		Owner:     owner,
+		Name:      name,
+		Steps:     make([]Step, len(steps)),
+		State:     Running,
+		CreatedAt: o.now(),
+	}
+	for i, spec := range steps {
+		wf.Steps[i] = Step{StepSpec: spec}
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.workflows[wf.Id] = wf
+	o.advance(wf)
+	return wf.copy(), nil
+}
+
+// Get returns a workflow.
+func (o *Orchestrator) Get(id string) (Workflow, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	wf, ok := o.workflows[id]
+	if !ok {
+		return Workflow{}, &ErrNotFound{}
+	}
+	return wf.copy(), nil
+}
+
+// List returns every workflow, oldest first.
+func (o *Orchestrator) List() []Workflow {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	out := make([]Workflow, 0, len(o.workflows))
+	for _, wf := range o.workflows {
+		out = append(out, wf.copy())
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.Before(out[j].CreatedAt) })
+	return out
+}
+
+// Cancel stops a workflow's running jobs and cancels the steps that haven't
+// started. Cancelling a finished workflow does nothing.
+func (o *Orchestrator) Cancel(id string) (Workflow, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	wf, ok := o.workflows[id]
+	if !ok {
+		return Workflow{}, &ErrNotFound{}
+	}
+	if wf.State != Running {
+		return wf.copy(), nil
+	}
+
+	wf.cancelled = true
+	o.advance(wf)
+	return wf.copy(), nil
+}
+
+// Run advances running workflows as their jobs finish until ctx is done.
+func (o *Orchestrator) Run(ctx context.Context) {
+	ticker := time.NewTicker(PollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			o.advanceAll()
+		}
+	}
+}
+
+func (o *Orchestrator) advanceAll() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	for _, wf := range o.workflows {
+		if wf.State == Running {
+			o.advance(wf)
+		}
+	}
+}
+
+// advance updates the steps whose jobs have finished, then starts or cancels
+// the steps that were waiting on them. Callers must hold o.mu.
+func (o *Orchestrator) advance(wf *Workflow) {
+	byName := make(map[string]*Step, len(wf.Steps))
+	for i := range wf.Steps {
+		step := &wf.Steps[i]
+		byName[step.Name] = step
+		if step.State != StepRunning {
+			continue
+		}
+		if wf.cancelled {
+			// a job that is just starting can't be stopped yet and one that
+			// just finished needn't be, either way its state says what to do
+			o.jr.StopJob(step.JobId)
+		}
+		step.State = o.jobState(step.JobId)
+	}
+
+	// cancelling a step settles the steps that depend on it as well, so keep
+	// going until nothing changes
+	for changed := true; changed; {
+		changed = false
+		for i := range wf.Steps {
+			step := &wf.Steps[i]
+			if step.State != StepPending {
+				continue
+			}
+
+			ready, succeeded := true, true
+			for _, dep := range step.DependsOn {
+				state := byName[dep].State
+				ready = ready && state.finished()
+				succeeded = succeeded && state == StepSucceeded
+			}
+			if !ready {
+				continue
+			}
+
+			changed = true
+			if wf.cancelled || (!succeeded && step.Condition == ConditionSuccess) {
+				step.State = StepCancelled
+				continue
+			}
+			o.start(wf, step)
+		}
+	}
+
+	for _, step := range wf.Steps {
+		if !step.State.finished() {
+			return
+		}
+	}
+
+	wf.FinishedAt = o.now()
+	wf.State = Succeeded
+	for _, step := range wf.Steps {
+		if step.State != StepSucceeded {
+			wf.State = Failed
+		}
+	}
+	if wf.cancelled {
+		wf.State = Cancelled
+	}
+}
+
+// start submits a step's job. A step whose job can't be started fails.
+func (o *Orchestrator) start(wf *Workflow, step *Step) {
+	job := o.jr.CreateJob(uuid.NewString(), wf.Owner, exec.Command(step.Command, step.Args...))
+	if err := o.jr.SubmitJob(job, 0); err != nil {
+		log.Printf("workflow %s: could not start step %s: %s", wf.Id, step.Name, err.Error())
+		step.State = StepFailed
+		return
+	}
+
+	step.JobId = job.Id
+	step.State = StepRunning
+}
+
+// jobState maps the state of a step's job to the step's state.
+func (o *Orchestrator) jobState(id string) StepState {
+	job, err := o.jr.GetJob(id)
+	if err != nil {
+		// removed by the retention policy before the workflow noticed it
+		// finished, so there's no telling how it went
+		return StepFailed
+	}
+
+	switch job.State {
+	case core.Completed:
+		return StepSucceeded
+	case core.Error:
+		return StepFailed
+	case core.Stopped:
+		return StepCancelled
+	default:
+		return StepRunning
+	}
+}
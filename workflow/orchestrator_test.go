@@ -0,0 +1,147 @@
+package workflow
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ItsMeWithTheFace/linux-process-runner/core"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type OrchestratorTestSuite struct {
+	suite.Suite
+	logDir       string
+	jr           *core.JobRunner
+	orchestrator *Orchestrator
+}
+
+func (suite *OrchestratorTestSuite) SetupTest() {
+	var err error
+	suite.logDir, err = ioutil.TempDir("", "logs")
+	suite.Require().NoError(err)
+	suite.jr = core.InitializeJobRunner(core.InitializeInMemoryJobStore(), core.WithLogDir(suite.logDir))
+	suite.orchestrator = InitializeOrchestrator(suite.jr)
+}
+
+func (suite *OrchestratorTestSuite) TearDownTest() {
+	for _, wf := range suite.orchestrator.List() {
+		suite.orchestrator.Cancel(wf.Id)
+	}
+	os.RemoveAll(suite.logDir)
+}
+
+// waitForState advances the workflow until it reaches state.
+func (suite *OrchestratorTestSuite) waitForState(id string, state State) Workflow {
+	var wf Workflow
+	suite.Require().Eventually(func() bool {
+		suite.orchestrator.advanceAll()
+		wf, _ = suite.orchestrator.Get(id)
+		return wf.State == state
+	}, 10*time.Second, 10*time.Millisecond, "workflow never reached state %d", state)
+	return wf
+}
+
+func (suite *OrchestratorTestSuite) steps(wf Workflow) map[string]Step {
+	out := make(map[string]Step)
+	for _, step := range wf.Steps {
+		out[step.Name] = step
+	}
+	return out
+}
+
+func (suite *OrchestratorTestSuite) TestDependencies() {
+	wf, err := suite.orchestrator.Submit("alice@CN=ca", "pipeline", []StepSpec{
+		{Name: "build", Command: "true"},
+		{Name: "test", Command: "sleep", Args: []string{"0.1"}, DependsOn: []string{"build"}},
+		{Name: "lint", Command: "true", DependsOn: []string{"build"}},
+		{Name: "package", Command: "true", DependsOn: []string{"test", "lint"}},
+	})
+	suite.Require().NoError(err)
+
+	steps := suite.steps(wf)
+	assert.Equal(suite.T(), StepRunning, steps["build"].State, "steps without dependencies start right away")
+	assert.NotEmpty(suite.T(), steps["build"].JobId)
+	assert.Equal(suite.T(), StepPending, steps["package"].State)
+	assert.Empty(suite.T(), steps["package"].JobId)
+
+	wf = suite.waitForState(wf.Id, Succeeded)
+	assert.False(suite.T(), wf.FinishedAt.IsZero())
+
+	steps = suite.steps(wf)
+	started := func(name string) time.Time {
+		job, err := suite.jr.GetJob(steps[name].JobId)
+		suite.Require().NoError(err)
+		return job.Attempts[0].StartedAt
+	}
+	finished := func(name string) time.Time {
+		job, err := suite.jr.GetJob(steps[name].JobId)
+		suite.Require().NoError(err)
+		return job.Attempts[0].FinishedAt
+	}
+	for _, step := range steps {
+		assert.Equal(suite.T(), StepSucceeded, step.State, step.Name)
+	}
+	assert.False(suite.T(), started("test").Before(finished("build")))
+	assert.False(suite.T(), started("package").Before(finished("test")))
+	assert.False(suite.T(), started("package").Before(finished("lint")))
+}
+
+func (suite *OrchestratorTestSuite) TestFailureCancelsDownstream() {
+	wf, err := suite.orchestrator.Submit("alice@CN=ca", "pipeline", []StepSpec{
+		{Name: "build", Command: "false"},
+		{Name: "test", Command: "true", DependsOn: []string{"build"}},
+		{Name: "package", Command: "true", DependsOn: []string{"test"}},
+		{Name: "cleanup", Command: "true", DependsOn: []string{"test"}, Condition: ConditionAlways},
+	})
+	suite.Require().NoError(err)
+
+	steps := suite.steps(suite.waitForState(wf.Id, Failed))
+	assert.Equal(suite.T(), StepFailed, steps["build"].State)
+	assert.Equal(suite.T(), StepCancelled, steps["test"].State)
+	assert.Empty(suite.T(), steps["test"].JobId, "cancelled steps never start a job")
+	assert.Equal(suite.T(), StepCancelled, steps["package"].State)
+	assert.Equal(suite.T(), StepSucceeded, steps["cleanup"].State, "always steps run after a failure")
+}
+
+func (suite *OrchestratorTestSuite) TestCancel() {
+	wf, err := suite.orchestrator.Submit("alice@CN=ca", "pipeline", []StepSpec{
+		{Name: "build", Command: "sleep", Args: []string{"10"}},
+		{Name: "test", Command: "true", DependsOn: []string{"build"}},
+	})
+	suite.Require().NoError(err)
+
+	buildId := suite.steps(wf)["build"].JobId
+	suite.Require().Eventually(func() bool {
+		job, _ := suite.jr.GetJob(buildId)
+		return job.State == core.Running
+	}, 5*time.Second, 10*time.Millisecond)
+
+	wf, err = suite.orchestrator.Cancel(wf.Id)
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), Cancelled, wf.State)
+	steps := suite.steps(wf)
+	assert.Equal(suite.T(), StepCancelled, steps["build"].State)
+	assert.Equal(suite.T(), StepCancelled, steps["test"].State)
+
+	job, _ := suite.jr.GetJob(buildId)
+	assert.Equal(suite.T(), core.JobState(core.Stopped), job.State, "running jobs should be stopped")
+
+	_, err = suite.orchestrator.Cancel("missing")
+	assert.IsType(suite.T(), &ErrNotFound{}, err)
+}
+
+func (suite *OrchestratorTestSuite) TestInvalid() {
+	_, err := suite.orchestrator.Submit("alice@CN=ca", "pipeline", []StepSpec{
+		{Name: "build", Command: "true", DependsOn: []string{"test"}},
+		{Name: "test", Command: "true", DependsOn: []string{"build"}},
+	})
+	assert.IsType(suite.T(), &ErrInvalidWorkflow{}, err)
+	assert.Empty(suite.T(), suite.orchestrator.List(), "invalid workflows are not kept")
+}
+
+func TestOrchestratorTestSuite(t *testing.T) {
+	suite.Run(t, new(OrchestratorTestSuite))
+}
@@ -0,0 +1,160 @@
+package workflow
+
+import (
+	"fmt"
+	"time"
+)
+
+// Condition decides whether a step runs once the steps it depends on have
+// finished.
+type Condition int32
+
+const (
+	// ConditionSuccess runs the step only if every step it depends on
+	// succeeded, otherwise it is cancelled.
+	ConditionSuccess Condition = iota
+	// ConditionAlways runs the step however the steps it depends on finished,
+	// e.g. to clean up after them.
+	ConditionAlways
+)
+
+// StepState is how far a step has got.
+type StepState int32
+
+const (
+	// StepPending steps are waiting for the steps they depend on.
+	StepPending StepState = iota
+	// StepRunning steps have a job, which may still be queued.
+	StepRunning
+	StepSucceeded
+	StepFailed
+	// StepCancelled steps were stopped, or never ran because a step they
+	// depend on failed or the workflow was cancelled.
+	StepCancelled
+)
+
+func (s StepState) finished() bool {
+	return s >= StepSucceeded
+}
+
+// State is the aggregate state of a workflow.
+type State int32
+
+const (
+	// Running workflows have steps that haven't finished.
+	Running State = iota
+	// Succeeded workflows ran every step successfully.
+	Succeeded
+	// Failed workflows have a step that failed or was cancelled.
+	Failed
+	// Cancelled workflows were cancelled before they finished.
+	Cancelled
+)
+
+// StepSpec describes a job to run once the steps named in DependsOn have
+// finished.
+type StepSpec struct {
+	Name      string
+	Command   string
+	Args      []string
+	DependsOn []string
+	Condition Condition
+}
+
+// Step is a step of a submitted workflow.
+type Step struct {
+	StepSpec
+	State StepState
+	// JobId is empty until the step's job is started.
+	JobId string
+}
+
+// Workflow is a graph of steps run as jobs of its owner.
+type Workflow struct {
+	Id         string
+	Owner      string
+	Name       string
+	Steps      []Step
+	State      State
+	CreatedAt  time.Time
+	FinishedAt time.Time
+
+	cancelled bool
+}
+
+// validate checks that the steps have unique names and commands, and that
+// their dependencies exist and don't form a cycle.
+func validate(steps []StepSpec) error {
+	if len(steps) == 0 {
+		return &ErrInvalidWorkflow{reason: "a workflow needs at least one step"}
+	}
+
+	byName := make(map[string]StepSpec, len(steps))
+	for _, step := range steps {
+		if step.Name == "" {
+			return &ErrInvalidWorkflow{reason: "every step needs a name"}
+		}
+		if _, ok := byName[step.Name]; ok {
+			return &ErrInvalidWorkflow{reason: fmt.Sprintf("step %q is defined twice", step.Name)}
+		}
+		if step.Command == "" {
+			return &ErrInvalidWorkflow{reason: fmt.Sprintf("step %q needs a command", step.Name)}
+		}
+		if step.Condition < ConditionSuccess || step.Condition > ConditionAlways {
+			return &ErrInvalidWorkflow{reason: fmt.Sprintf("step %q has unknown condition %d", step.Name, step.Condition)}
+		}
+		byName[step.Name] = step
+	}
+
+	for _, step := range steps {
+		for _, dep := range step.DependsOn {
+			if _, ok := byName[dep]; !ok {
+				return &ErrInvalidWorkflow{reason: fmt.Sprintf("step %q depends on unknown step %q", step.Name, dep)}
+			}
+		}
+	}
+
+	// depth first search, a step reached again while it is still being
+	// visited closes a cycle
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	marks := make(map[string]int, len(steps))
+	var visit func(name string) error
+	visit = func(name string) error {
+		switch marks[name] {
+		case visiting:
+			return &ErrInvalidWorkflow{reason: fmt.Sprintf("step %q depends on itself", name)}
+		case visited:
+			return nil
+		}
+		marks[name] = visiting
+		for _, dep := range byName[name].DependsOn {
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		marks[name] = visited
+		return nil
+	}
+	for _, step := range steps {
+		if err := visit(step.Name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (wf *Workflow) copy() Workflow {
+	out := *wf
+	out.Steps = make([]Step, len(wf.Steps))
+	for i, step := range wf.Steps {
+		out.Steps[i] = step
+		out.Steps[i].Args = append([]string(nil), step.Args...)
+		out.Steps[i].DependsOn = append([]string(nil), step.DependsOn...)
+	}
+	return out
+}
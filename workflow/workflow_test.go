@@ -0,0 +1,30 @@
+package workflow
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidate(t *testing.T) {
+	step := func(name string, deps ...string) StepSpec {
+		return StepSpec{Name: name, Command: "true", DependsOn: deps}
+	}
+
+	assert.NoError(t, validate([]StepSpec{
+		step("build"), step("test", "build"), step("lint", "build"), step("package", "test", "lint"),
+	}))
+
+	for name, steps := range map[string][]StepSpec{
+		"no steps":       nil,
+		"unnamed step":   {step("")},
+		"duplicate step": {step("build"), step("build")},
+		"no command":     {{Name: "build"}},
+		"bad condition":  {{Name: "build", Command: "true", Condition: Condition(7)}},
+		"unknown dep":    {step("test", "build")},
+		"self dep":       {step("build", "build")},
+		"cycle":          {step("a", "c"), step("b", "a"), step("c", "b")},
+	} {
+		assert.IsType(t, &ErrInvalidWorkflow{}, validate(steps), name)
+	}
+}